@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// minAdvisedArgonMemory is the argon2 memory, in KiB, below which the key of
+// a vault is too cheap to derive for guessing its passphrase to be slow.
+const minAdvisedArgonMemory = 64 * 1024
+
+// noAdvice is set by the -no-advice flag to leave out the advice on weak
+// settings given when a vault is opened.
+var noAdvice bool
+
+// vaultAdvice returns a warning for each weak setting of `v`, opened from
+// `vaultPath`, with how to fix it. Vaults in an older format are left to
+// offerUpgrade.
+func vaultAdvice(v *vault.Vault, vaultPath string) []string {
+	var advice []string
+	if params := v.KDFParams(); params.Memory < minAdvisedArgonMemory {
+		advice = append(advice, fmt.Sprintf("the key of %v is derived using %v MiB of memory, making the passphrase quicker to guess than with the recommended %v MiB. Strengthen it with the shell command: rekey %v %v", vaultPath, params.Memory/1024, minAdvisedArgonMemory/1024, params.Time, minAdvisedArgonMemory/1024))
+	}
+	// Windows files do not have Unix permissions
+	if info, err := os.Stat(vaultPath); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		fix := "chmod 600 " + vaultPath
+		if info.IsDir() {
+			fix = "chmod -R go-rwx " + vaultPath
+		}
+		advice = append(advice, fmt.Sprintf("%v can be read by other users of this machine. Restrict it with: %v", vaultPath, fix))
+	}
+	for _, name := range v.ConflictCopies() {
+		advice = append(advice, fmt.Sprintf("%v was left in %v by a file sync tool and is not part of the vault. Any change it holds was made on another device at the same time as this one's; make it again there if it is missing, then delete the file.", name, filepath.Join(vaultPath, "entries")))
+	}
+	return advice
+}
+
+// printAdvice prints the advice on the weak settings of `v`, unless
+// -no-advice is set.
+func printAdvice(v *vault.Vault, vaultPath string) {
+	if noAdvice {
+		return
+	}
+	for _, advice := range vaultAdvice(v, vaultPath) {
+		fmt.Printf("warning: %v\n", advice)
+	}
+}
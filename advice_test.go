@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestVaultAdvice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-advice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vaultPath := filepath.Join(dir, "vault.db")
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Rekey("testpass", vault.KDFParams{Time: 3, Memory: 8 * 1024, Lanes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is derived using less memory than advised
+	advice := vaultAdvice(v, vaultPath)
+	if len(advice) != 1 || !strings.Contains(advice[0], "rekey 3 64") {
+		t.Fatal("expected advice to rekey, got", advice)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err = os.Chmod(vaultPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	advice = vaultAdvice(v, vaultPath)
+	if len(advice) != 2 || !strings.Contains(advice[1], "chmod 600 "+vaultPath) {
+		t.Fatal("expected advice to restrict the vault's permissions, got", advice)
+	}
+}
@@ -0,0 +1,110 @@
+// Package autosave debounces saves of a vault, so that a burst of changes is
+// written to disk once, shortly after the last change.
+package autosave
+
+import (
+	"sync"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+)
+
+// DefaultDelay is how long a Saver waits after the last change before
+// saving.
+const DefaultDelay = 500 * time.Millisecond
+
+// Saver calls a save func `delay` after the most recent call to Changed.
+// Saves never run concurrently, and a change made while a save is in progress
+// schedules another save, so the last change is always written.
+type Saver struct {
+	save  func() error
+	delay time.Duration
+	clock clock.Clock
+
+	// saveMu is held while save runs, serializing saves.
+	saveMu sync.Mutex
+
+	// mu guards the fields below.
+	mu sync.Mutex
+	// generation counts calls to Changed. A scheduled save only runs if no
+	// change has been made since it was scheduled.
+	generation uint64
+	pending    bool
+	closed     bool
+	err        error
+}
+
+// New returns a Saver that calls `save` `delay` after the last change,
+// measuring time using `c`.
+func New(save func() error, delay time.Duration, c clock.Clock) *Saver {
+	return &Saver{
+		save:  save,
+		delay: delay,
+		clock: c,
+	}
+}
+
+// Changed records a change, scheduling a save once `delay` has passed
+// without further changes. Changes after Close are ignored.
+func (s *Saver) Changed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.generation++
+	s.pending = true
+
+	generation := s.generation
+	expired := s.clock.After(s.delay)
+	go func() {
+		<-expired
+		s.mu.Lock()
+		current := s.generation == generation
+		s.mu.Unlock()
+		if current {
+			s.Flush()
+		}
+	}()
+}
+
+// Flush saves immediately if there are unsaved changes, waiting for any save
+// already in progress. It returns the error from the save, if any.
+func (s *Saver) Flush() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.pending {
+		s.mu.Unlock()
+		return nil
+	}
+	s.pending = false
+	s.mu.Unlock()
+
+	err := s.save()
+
+	s.mu.Lock()
+	s.err = err
+	if err != nil {
+		s.pending = true
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// Err returns the error from the most recent save, or nil if it succeeded.
+func (s *Saver) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close flushes any unsaved changes and stops the Saver from scheduling
+// further saves.
+func (s *Saver) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return s.Flush()
+}
@@ -0,0 +1,86 @@
+package autosave
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+)
+
+// waitSaves waits a short while for `saves` to reach `n`.
+func waitSaves(saves *int32, n int32) bool {
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(saves) != n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+func TestSaverDebounce(t *testing.T) {
+	var saves int32
+	c := clock.NewFake(time.Unix(0, 0))
+	s := New(func() error {
+		atomic.AddInt32(&saves, 1)
+		return nil
+	}, DefaultDelay, c)
+
+	for i := 0; i < 10; i++ {
+		s.Changed()
+		c.Advance(DefaultDelay / 2)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if atomic.LoadInt32(&saves) != 0 {
+		t.Fatal("saved before changes stopped")
+	}
+
+	c.Advance(DefaultDelay)
+	if !waitSaves(&saves, 1) {
+		t.Fatal("expected exactly one save after a burst of changes, got", atomic.LoadInt32(&saves))
+	}
+
+	// nothing has changed, so Close does not save again
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s.Changed()
+	c.Advance(DefaultDelay)
+	time.Sleep(time.Millisecond * 10)
+	if atomic.LoadInt32(&saves) != 1 {
+		t.Fatal("saved after Close")
+	}
+}
+
+func TestSaverFlush(t *testing.T) {
+	var saves int32
+	failing := true
+	c := clock.NewFake(time.Unix(0, 0))
+	s := New(func() error {
+		atomic.AddInt32(&saves, 1)
+		if failing {
+			return errors.New("disk full")
+		}
+		return nil
+	}, DefaultDelay, c)
+
+	s.Changed()
+	if err := s.Flush(); err == nil {
+		t.Fatal("expected Flush to return the save error")
+	}
+	if s.Err() == nil {
+		t.Fatal("expected Err to return the save error")
+	}
+
+	// a failed save leaves the changes pending, so Close retries it
+	failing = false
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&saves) != 2 || s.Err() != nil {
+		t.Fatal("Close did not retry the failed save")
+	}
+}
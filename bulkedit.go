@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/avahowell/masterkey/repl"
+	"github.com/avahowell/masterkey/vault"
+)
+
+// bulkFilter selects the credentials exportyaml and bulkedit work on.
+type bulkFilter struct {
+	tag, folder string
+	withSecrets bool
+}
+
+// addFlags defines the filter's flags in `fs`.
+func (f *bulkFilter) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.tag, "tag", "", "")
+	fs.StringVar(&f.folder, "folder", "", "")
+	fs.BoolVar(&f.withSecrets, "with-secrets", false, "")
+}
+
+// entries returns the entries of the credentials in `v` whose locations
+// contain `searchtext`, and that have the filter's tag and are filed in its
+// folder, if set. Passwords, and usernames the vault masks, are left out
+// unless withSecrets is set.
+func (f *bulkFilter) entries(v *vault.Vault, searchtext string) ([]vault.Entry, error) {
+	var tagged, filed map[string]bool
+	var err error
+	if f.tag != "" {
+		if tagged, err = taggedSet(v, f.tag); err != nil {
+			return nil, err
+		}
+	}
+	if f.folder != "" {
+		if filed, err = folderSet(v, f.folder); err != nil {
+			return nil, err
+		}
+	}
+	var entries []vault.Entry
+	err = v.Each(func(location string, cred *vault.Credential) error {
+		if !strings.Contains(location, searchtext) || (tagged != nil && !tagged[location]) || (filed != nil && !filed[location]) {
+			return nil
+		}
+		entry := vault.NewEntry(location, cred)
+		if !f.withSecrets {
+			entry.Password = ""
+			if v.MasksUsername(cred) {
+				entry.Username = ""
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// describeChanges lists the locations in `changes` with the fields that
+// change at each.
+func describeChanges(changes []vault.EntryChange) string {
+	var printstring string
+	for _, change := range changes {
+		printstring += fmt.Sprintf("%v: %v\n", change.Location, strings.Join(change.Fields, ", "))
+	}
+	return printstring
+}
+
+// hasSecrets returns true if any of `entries` holds a password.
+func hasSecrets(entries []vault.Entry) bool {
+	for _, entry := range entries {
+		if entry.Password != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func exportyaml(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("exportyaml", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		var filter bulkFilter
+		filter.addFlags(fs)
+		if err := fs.Parse(args); err != nil || fs.NArg() < 1 || fs.NArg() > 2 {
+			return "", msg.Errorf("%v requires 1 or 2 arguments. See help for usage.", "exportyaml")
+		}
+		path := fs.Arg(0)
+		entries, err := filter.entries(v, fs.Arg(1))
+		if err != nil {
+			return "", err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(vault.MarshalEntriesYAML(entries))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+		printstring := fmt.Sprintf("exported %v credentials to %v\n", len(entries), path)
+		if hasSecrets(entries) {
+			plaintextFiles.add(path)
+			printstring += fmt.Sprintf("%v contains plaintext passwords. Delete it once it has been imported.\n", path)
+		}
+		return printstring, nil
+	}
+}
+
+func importyaml(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("importyaml", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		dryRun := fs.Bool("dry-run", false, "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return "", msg.Errorf("%v requires 1 argument. See help for usage.", "importyaml")
+		}
+		path := fs.Arg(0)
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		entries, err := vault.UnmarshalEntriesYAML(bs)
+		if err != nil {
+			return "", msg.Errorf("could not read %v: %v", path, err)
+		}
+		changes, err := v.ApplyEntries(entries, *dryRun)
+		if err != nil {
+			return "", err
+		}
+		if len(changes) == 0 {
+			return "no changes\n", nil
+		}
+		if *dryRun {
+			return describeChanges(changes) + fmt.Sprintf("%v credentials would change. Run importyaml without --dry-run to change them.\n", len(changes)), nil
+		}
+		printstring := describeChanges(changes) + fmt.Sprintf("%v credentials changed\n", len(changes))
+		if hasSecrets(entries) {
+			shredded, err := offerShred(path)
+			if err != nil {
+				return "", err
+			}
+			printstring += shredded
+		}
+		return printstring, nil
+	}
+}
+
+func bulkedit(v *vault.Vault, edit func(string) (string, error)) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("bulkedit", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		var filter bulkFilter
+		filter.addFlags(fs)
+		if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+			return "", msg.Errorf("bulkedit only accepts --with-secrets, --tag, --folder and searchtext. See help for usage.")
+		}
+		entries, err := filter.entries(v, fs.Arg(0))
+		if err != nil {
+			return "", err
+		}
+		if len(entries) == 0 {
+			return "", vault.ErrNoSuchCredential
+		}
+		edited, err := edit(string(vault.MarshalEntriesYAML(entries)))
+		if err != nil {
+			return "", err
+		}
+		entries, err = vault.UnmarshalEntriesYAML([]byte(edited))
+		if err != nil {
+			return "", msg.Errorf("changes discarded: %v", err)
+		}
+		changes, err := v.ApplyEntries(entries, true)
+		if err != nil {
+			return "", msg.Errorf("changes discarded: %v", err)
+		}
+		if len(changes) == 0 {
+			return "no changes\n", nil
+		}
+		fmt.Print(describeChanges(changes))
+		ok, err := askYesNo(fmt.Sprintf("Change these %v credentials?", len(changes)))
+		if err != nil || !ok {
+			return "changes discarded\n", err
+		}
+		if changes, err = v.ApplyEntries(entries, false); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v credentials changed\n", len(changes)), nil
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/syncserver"
+	"github.com/avahowell/masterkey/vault"
+)
+
+const (
+	// pendingSuffix is appended to a cached vault's path to name the file
+	// marking that it has changes the sync server has not seen.
+	pendingSuffix = ".pending"
+
+	// cacheRetryInterval is how often pending changes are retried while the
+	// sync server is unreachable.
+	cacheRetryInterval = 30 * time.Second
+
+	// cacheTimeout bounds each request to the sync server, so that an
+	// unreachable server does not hold up opening the vault for long.
+	cacheTimeout = 15 * time.Second
+)
+
+// isRemoteURL returns true if `path` is the URL of a vault on a sync server,
+// rather than the path of a local vault.
+func isRemoteURL(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// isOffline returns true if `err` means the sync server could not be reached.
+func isOffline(err error) bool {
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// cachePath returns the path of the local cache of the vault at remoteURL,
+// in the user's cache directory.
+func cachePath(remoteURL string) (string, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndex(u.Path, "/vaults/")
+	if u.Host == "" || i < 0 {
+		return "", fmt.Errorf("%v is not the URL of a vault on a sync server, such as https://example.com/vaults/personal", remoteURL)
+	}
+	name := u.Path[i+len("/vaults/"):]
+	if name == "" || strings.ContainsAny(name, `/\.:`) {
+		return "", fmt.Errorf("%v is not a valid vault name", name)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "masterkey", strings.Replace(u.Host, ":", "_", -1), name), nil
+}
+
+// pendingChanges returns true if the vault at vaultPath has changes that
+// have not been uploaded to its sync server.
+func pendingChanges(vaultPath string) bool {
+	_, err := os.Stat(vaultPath + pendingSuffix)
+	return err == nil
+}
+
+// setPending records whether the vault at vaultPath has changes that have
+// not been uploaded to its sync server.
+func setPending(vaultPath string, pending bool) error {
+	if pending {
+		return ioutil.WriteFile(vaultPath+pendingSuffix, nil, 0600)
+	}
+	if err := os.Remove(vaultPath + pendingSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// remoteCache keeps an encrypted local copy of a vault that lives on a sync
+// server, so that the vault opens and can be changed while the server is
+// unreachable. The copy is an ordinary vault file: changes are saved to it
+// as usual, and uploaded after each save by merging them with the server's
+// copy using vault.Sync. Saves the server has not seen are queued by marking
+// the copy as pending, and retried until the server can be reached, even
+// after masterkey is restarted.
+type remoteCache struct {
+	url    string
+	path   string
+	client *syncserver.Client
+	clock  clock.Clock
+	// report is called with a message describing each failed attempt to
+	// reconcile in the background.
+	report func(string)
+
+	// mu serializes reconciles, and guards v.
+	mu sync.Mutex
+	v  *vault.Vault
+
+	// stateMu guards the fields below. It is separate from mu since the
+	// vault's OnSave func runs while reconcile holds mu.
+	stateMu sync.Mutex
+	// passphrase opens the server's copy of the vault. It is dropped while
+	// the vault is locked.
+	passphrase string
+	// saves counts the saves of the cache, so that reconcile can tell
+	// whether the vault was saved while it ran.
+	saves uint64
+
+	// wake is signalled after each save, to reconcile without waiting for
+	// the retry interval.
+	wake    chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// openCache returns the cache of the vault at remoteURL. If this device is
+// not enrolled with the server yet, it is enrolled, and if there is no
+// cached copy yet, the server's copy is downloaded.
+func openCache(remoteURL string) (*remoteCache, error) {
+	if err := checkTLS(remoteURL); err != nil {
+		return nil, err
+	}
+	path, err := cachePath(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	d, err := loadDevice(path)
+	if err == errNotEnrolled {
+		name, err := askLine("This device is not enrolled with the sync server. Enter a name for it: ")
+		if err != nil {
+			return nil, err
+		}
+		if err = enrollDevice(remoteURL, path, name); err != nil {
+			return nil, err
+		}
+		d, err = loadDevice(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &syncserver.Client{
+		URL:        remoteURL,
+		Name:       d.Name,
+		Key:        d.Key,
+		HTTPClient: timedClient(cacheTimeout),
+	}
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		bs, _, err := c.Get()
+		if err == syncserver.ErrNotFound {
+			return nil, fmt.Errorf("%v holds no vault yet. Create one locally with -new, then upload it with remote set and remote sync", remoteURL)
+		}
+		if isOffline(err) {
+			return nil, fmt.Errorf("%v can not be reached, and there is no cached copy of the vault to open offline: %v", remoteURL, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(path, bs, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return newRemoteCache(remoteURL, path, c, clock.Real), nil
+}
+
+// newRemoteCache returns the cache at `path` of the vault at remoteURL,
+// reached using `client`. Failures to reconcile in the background are
+// reported on stderr.
+func newRemoteCache(remoteURL string, path string, client *syncserver.Client, clk clock.Clock) *remoteCache {
+	return &remoteCache{
+		url:    remoteURL,
+		path:   path,
+		client: client,
+		clock:  clk,
+		report: func(msg string) {
+			fmt.Fprint(os.Stderr, msg)
+		},
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// start reconciles `v`, the cached vault opened using `passphrase`, with the
+// server's copy, and returns a message describing the result. From then on,
+// the vault is reconciled after each save, and every cacheRetryInterval
+// while changes are pending, until Close is called.
+func (c *remoteCache) start(v *vault.Vault, passphrase string) string {
+	c.mu.Lock()
+	c.v = v
+	c.mu.Unlock()
+	c.stateMu.Lock()
+	c.passphrase = passphrase
+	c.stateMu.Unlock()
+
+	// the vault lives on the server, so remote commands act on it too
+	if settings := v.Settings(); settings.RemoteURL == "" {
+		settings.RemoteURL = c.url
+		v.SetSettings(settings)
+	}
+	v.OnSave(c.saved)
+	msg, _ := c.reconcile()
+	go c.run()
+	return msg
+}
+
+// lock drops the passphrase of the server's copy of the vault, which is
+// locked. Pending changes are kept until unlock is called.
+func (c *remoteCache) lock() {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.passphrase = ""
+}
+
+// unlock restores the passphrase of the server's copy once the vault has
+// been unlocked using it, and uploads any changes left pending meanwhile.
+func (c *remoteCache) unlock(passphrase string) {
+	c.stateMu.Lock()
+	c.passphrase = passphrase
+	c.stateMu.Unlock()
+	c.signal()
+}
+
+// signal wakes run to reconcile. A signal already waiting covers this one,
+// since run checks for pending changes when it wakes.
+func (c *remoteCache) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile merges the server's copy of the vault into the cache and uploads
+// the result, and returns a message describing what happened, and the error
+// if it failed. If the server can not be reached, the cache is marked as
+// pending. Nothing is done while the vault is locked.
+func (c *remoteCache) reconcile() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.v.Locked() {
+		c.lock()
+	}
+	c.stateMu.Lock()
+	passphrase, saves := c.passphrase, c.saves
+	c.stateMu.Unlock()
+	if passphrase == "" {
+		return "", nil
+	}
+
+	res, err := syncRemote(c.v, c.client, passphrase)
+	if err != nil {
+		setPending(c.path, true)
+		if isOffline(err) {
+			return fmt.Sprintf("%v can not be reached, working offline. Changes are saved to %v and will be uploaded once it is back.\n", c.url, c.path), err
+		}
+		return fmt.Sprintf("could not sync with %v: %v. Changes are saved to %v and will be uploaded later.\n", c.url, err, c.path), err
+	}
+	if len(res.Added)+len(res.Updated)+len(res.Deleted)+len(res.Conflicts) > 0 {
+		if err = c.v.Save(c.path); err != nil {
+			return fmt.Sprintf("could not save the changes brought in to %v: %v\n", c.path, err), err
+		}
+		// the server already has what was just saved
+		saves++
+	}
+
+	// a save made while reconciling has not been uploaded, and stays pending
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.saves == saves {
+		if err = setPending(c.path, false); err != nil {
+			return err.Error() + "\n", err
+		}
+	}
+	return describeSync(res), nil
+}
+
+// saved is the vault's OnSave func. A save to the cache marks it as pending
+// before Save returns, so that it is uploaded even if masterkey exits before
+// it has been.
+func (c *remoteCache) saved(filename string) {
+	if filename != c.path {
+		return
+	}
+	c.stateMu.Lock()
+	c.saves++
+	setPending(c.path, true)
+	c.stateMu.Unlock()
+	c.signal()
+}
+
+// run reconciles the vault after each save, and retries while changes are
+// pending, until the cache is closed. Failures are reported, except that
+// the same failure is not reported again on each retry.
+func (c *remoteCache) run() {
+	defer close(c.done)
+	var reported string
+	for {
+		select {
+		case <-c.wake:
+		case <-c.clock.After(cacheRetryInterval):
+		case <-c.closing:
+			return
+		}
+		if !pendingChanges(c.path) {
+			continue
+		}
+		msg, err := c.reconcile()
+		if err == nil {
+			reported = ""
+		} else if msg != reported {
+			c.report(msg)
+			reported = msg
+		}
+	}
+}
+
+// Close stops reconciling in the background, and makes a last attempt to
+// upload pending changes, returning a message describing it if one was made.
+// It must be called after the vault's last save, and before it is closed.
+func (c *remoteCache) Close() string {
+	c.mu.Lock()
+	v := c.v
+	c.mu.Unlock()
+	if v == nil {
+		return ""
+	}
+	close(c.closing)
+	<-c.done
+	v.OnSave(nil)
+	if !pendingChanges(c.path) {
+		return ""
+	}
+	msg, _ := c.reconcile()
+	return msg
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/syncserver"
+	"github.com/avahowell/masterkey/vault"
+	"golang.org/x/crypto/ed25519"
+)
+
+// serverHas returns true if the server's copy of the vault, reached using
+// `c`, holds a credential at `location`.
+func serverHas(t *testing.T, c *syncserver.Client, location string) bool {
+	bs, _, err := c.Get()
+	if err == syncserver.ErrNotFound {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := vault.Decode(bs, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	_, err = v.Get(location)
+	return err == nil
+}
+
+func TestRemoteCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(syncserver.New(filepath.Join(dir), "testtoken"))
+	defer ts.Close()
+	offline := httptest.NewServer(nil)
+	offline.Close()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	online := &syncserver.Client{URL: ts.URL + "/vaults/personal", Name: "laptop", Key: key}
+	if err = online.Enroll("testtoken"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "cache.db")
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("offline", vault.Credential{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+	v, err = vault.Open(path, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	// the vault opens while the server is unreachable, and its changes are
+	// queued
+	c := &syncserver.Client{URL: offline.URL + "/vaults/personal", Name: "laptop", Key: key}
+	clk := clock.NewFake(time.Now())
+	cache := newRemoteCache(online.URL, path, c, clk)
+	reports := make(chan string, 16)
+	cache.report = func(msg string) {
+		reports <- msg
+	}
+	cache.start(v, "testpass")
+	if !pendingChanges(path) {
+		t.Fatal("expected changes to be pending while offline")
+	}
+
+	// failed retries are reported
+	for deadline := time.Now().Add(5 * time.Second); len(reports) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("failed retry was not reported")
+		}
+		clk.Advance(cacheRetryInterval)
+	}
+
+	// once the server is back they are uploaded
+	cache.mu.Lock()
+	c.URL = online.URL
+	cache.mu.Unlock()
+	for deadline := time.Now().Add(5 * time.Second); pendingChanges(path); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("pending changes were not uploaded")
+		}
+		clk.Advance(cacheRetryInterval)
+	}
+	if !serverHas(t, online, "offline") {
+		t.Fatal("server does not have the change made offline")
+	}
+
+	// saves are uploaded straight away
+	if err = v.Add("online", vault.Credential{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !serverHas(t, online, "online"); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("save was not uploaded")
+		}
+	}
+
+	// the passphrase is dropped while the vault is locked, and saves made
+	// meanwhile are kept pending until it is unlocked again
+	v.Lock()
+	cache.lock()
+	cache.stateMu.Lock()
+	if cache.passphrase != "" {
+		t.Fatal("passphrase was kept while locked")
+	}
+	cache.stateMu.Unlock()
+	if err = v.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(cacheRetryInterval)
+	if !pendingChanges(path) {
+		t.Fatal("expected a save made while locked to be pending")
+	}
+	if err = v.Unlock("testpass"); err != nil {
+		t.Fatal(err)
+	}
+	cache.unlock("testpass")
+	for deadline := time.Now().Add(5 * time.Second); pendingChanges(path); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("save made while locked was not uploaded")
+		}
+	}
+	cache.Close()
+	if pendingChanges(path) {
+		t.Fatal("expected no pending changes after closing")
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	for _, remoteURL := range []string{
+		"https://example.com/vaults/personal",
+		"http://127.0.0.1:8443/vaults/personal",
+		"http://localhost/vaults/personal",
+		"http://[::1]:8443/vaults/personal",
+	} {
+		if err := checkTLS(remoteURL); err != nil {
+			t.Fatalf("checkTLS(%v): %v", remoteURL, err)
+		}
+	}
+	for _, remoteURL := range []string{
+		"http://example.com/vaults/personal",
+		"http://192.168.1.2:8443/vaults/personal",
+	} {
+		if err := checkTLS(remoteURL); err == nil {
+			t.Fatalf("expected checkTLS(%v) to reject plain http", remoteURL)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package clock abstracts the passage of time so that timeouts, such as the
+// REPL's idle timeout and secureclip's clipboard clearing, can be tested
+// without waiting on the wall clock.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Clock tells the time and waits for durations to elapse.
+	Clock interface {
+		Now() time.Time
+		After(d time.Duration) <-chan time.Time
+	}
+
+	// realClock is a Clock backed by the time package.
+	realClock struct{}
+
+	// Fake is a Clock that only moves when Advance is called.
+	Fake struct {
+		mu      sync.Mutex
+		now     time.Time
+		waiters []waiter
+	}
+
+	// waiter is a pending call to Fake.After.
+	waiter struct {
+		deadline time.Time
+		c        chan time.Time
+	}
+)
+
+// Real is the wall clock.
+var Real Clock = realClock{}
+
+// Now implements Clock.
+func (realClock) Now() time.Time { return time.Now() }
+
+// After implements Clock.
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// NewFake returns a Fake clock set to `now`.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now implements Clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After implements Clock. The returned channel receives once the fake clock
+// has been advanced by at least `d`.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+	f.waiters = append(f.waiters, waiter{deadline: f.now.Add(d), c: c})
+	return c
+}
+
+// Advance moves the fake clock forward by `d`, firing any After channels
+// whose deadline has passed.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- f.now
+	}
+	f.waiters = pending
+}
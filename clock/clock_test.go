@@ -0,0 +1,39 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Unix(0, 0)
+	f := NewFake(start)
+
+	c := f.After(time.Second * 5)
+	f.Advance(time.Second * 4)
+	select {
+	case <-c:
+		t.Fatal("After fired before its deadline")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case now := <-c:
+		if !now.Equal(start.Add(time.Second * 5)) {
+			t.Fatal("After sent the wrong time:", now)
+		}
+	default:
+		t.Fatal("After did not fire at its deadline")
+	}
+
+	if !f.Now().Equal(start.Add(time.Second * 5)) {
+		t.Fatal("Now did not reflect Advance")
+	}
+
+	select {
+	case <-f.After(0):
+	default:
+		t.Fatal("After(0) did not fire immediately")
+	}
+}
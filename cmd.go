@@ -1,391 +1,2494 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/avahowell/masterkey/exporter"
+	"github.com/avahowell/masterkey/importer"
+	"github.com/avahowell/masterkey/pwgen"
+	"github.com/avahowell/masterkey/qr"
 	"github.com/avahowell/masterkey/repl"
 	"github.com/avahowell/masterkey/secureclip"
 	"github.com/avahowell/masterkey/vault"
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// locationArg is an argument naming a credential in `v`, completed from its
+// locations.
+func locationArg(v *vault.Vault) repl.Arg {
+	return repl.Arg{Name: "location", Complete: func() []string {
+		locations, _ := v.Locations()
+		return locations
+	}}
+}
+
+// snapshotArg is an argument that names a snapshot of `v`.
+func snapshotArg(v *vault.Vault) repl.Arg {
+	return repl.Arg{Name: "name", Complete: func() []string {
+		var names []string
+		for _, s := range v.Snapshots() {
+			names = append(names, s.Name)
+		}
+		return names
+	}}
+}
+
+// tagArg is an argument that takes one or more tags, completed from those
+// used in `v`.
+func tagArg(v *vault.Vault) repl.Arg {
+	return repl.Arg{Name: "tag", Variadic: true, Complete: func() []string {
+		tags, _, _ := v.Tags()
+		return tags
+	}}
+}
+
+// folderArg is an optional argument that names a folder, completed from the
+// folders in `v`.
+func folderArg(v *vault.Vault) repl.Arg {
+	return repl.Arg{Name: "folder", Optional: true, Complete: func() []string {
+		folders, _, _ := v.Folders()
+		return folders
+	}}
+}
+
+// onOffArg is an argument that turns something on or off.
+var onOffArg = repl.Arg{Choices: []string{"on", "off"}}
+
+// Categories group commands in the list shown by help.
+const (
+	categoryCredentials = "Credentials"
+	categoryClipboard   = "Clipboard and display"
+	categoryImport      = "Import and export"
+	categorySync        = "Sync"
+	categorySecurity    = "Security"
+	categoryVault       = "Vault settings"
 )
 
 var (
 	listCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "list",
-			Action: list(v),
-			Usage:  "list: list the credentials stored inside this vault",
+			Name:     "list",
+			Action:   list(v),
+			Usage:    "list [--all] [--sort=name|modified|last-used|uses] [--tag=tag] [--folder=folder]: list the credentials stored inside this vault. Archived credentials are only listed with --all. --sort=modified lists the most recently changed first. Sorting by use requires trackusage to be on. --tag lists only the credentials with that tag, and --folder only those in that folder or the folders inside it.",
+			Category: categoryCredentials,
+			Examples: []string{"list", "list --sort=modified", "list --all --sort=last-used", "list --tag=work", "list --folder=work/aws"},
 		}
 	}
 
 	saveCmd = func(v *vault.Vault, vaultPath string) repl.Command {
 		return repl.Command{
-			Name:   "save",
-			Action: save(v, vaultPath),
-			Usage:  "save: save the changes in this vault to disk",
+			Name:     "save",
+			Action:   save(v, vaultPath),
+			Usage:    "save the changes in this vault to disk",
+			Args:     repl.NoArgs,
+			Category: categoryVault,
 		}
 	}
 
 	getCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "get",
-			Action: get(v),
-			Usage:  "get [location]: get the credential at [location]. [location] can be a partial string: masterkey will search the vault and return the first result.",
+			Name:     "get",
+			Action:   get(v),
+			Usage:    "get [location] [--json]: get the credential at [location]. [location] can be a partial string: masterkey will search the vault and return the first result. --json prints the credential as JSON, in the form add --from-json reads.",
+			Category: categoryCredentials,
+			Examples: []string{"get github.com", "get github.com --json"},
 		}
 	}
 
 	addCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "add",
-			Action: add(v),
-			Usage:  "add [location] [username] [password]: add a credential to the vault",
+			Name:     "add",
+			Action:   add(v),
+			Usage:    "add [location] [username] [password] | add --from-json [file]: add a credential to the vault, or add the credential described by a JSON file, as printed by get --json: {\"location\", \"username\", \"password\", \"notes\", \"meta\": {name: value}, \"icon\": base64}, of which only location is required",
+			Category: categoryCredentials,
+			Examples: []string{"add github.com alice hunter2", "add --from-json github.json"},
 		}
 	}
 
 	genCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "gen",
-			Action: gen(v),
-			Usage:  "gen [location] [username]: generate a password and add it to the vault",
+			Name:     "gen",
+			Action:   gen(v),
+			Usage:    "gen [--symbols] [--exclude chars] [--no-symbols-from chars] [location] [username]: generate a password and add it to the vault. --symbols adds symbols to the letters and numbers it is made of, --exclude leaves out characters that are ambiguous in print or rejected by the site, such as O0l1I, and --no-symbols-from adds every symbol except the ones given.",
+			Category: categoryCredentials,
+			Examples: []string{"gen github.com alice", "gen --symbols --exclude O0l1I bank.example.com alice"},
+		}
+	}
+
+	refsCmd = func(s *refServer) repl.Command {
+		return repl.Command{
+			Name:     "refs",
+			Action:   refs(s),
+			Usage:    "serve masterkey://location/field references, where field is username, password, notes or a meta name, to editors and masterkey resolve over a socket only you can use, until the shell exits. With no arguments, shows whether references are being served.",
+			Args:     []repl.Arg{{Choices: []string{"on", "off"}, Optional: true}},
+			Category: categorySync,
+			Examples: []string{"refs on"},
+		}
+	}
+
+	regenCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "regen",
+			Action:   regen(v),
+			Usage:    "replace the password at location with a new one of the same length, using the same classes of characters and only the symbols the old one used, for sites whose password rules you no longer remember. The old password is shown by get until the next regen.",
+			Args:     []repl.Arg{locationArg(v)},
+			Category: categoryCredentials,
+			Examples: []string{"regen github.com"},
 		}
 	}
 
 	editCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "edit",
-			Action: edit(v),
-			Usage:  "edit [location] [username] [password]: change the credentials at location to username, password",
+			Name:     "edit",
+			Action:   edit(v),
+			Usage:    "change the credentials at location to username, password",
+			Args:     []repl.Arg{locationArg(v), {Name: "username"}, {Name: "password"}},
+			Category: categoryCredentials,
+			Examples: []string{"edit github.com alice hunter3"},
 		}
 	}
 
 	clipCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "clip",
-			Action: clip(v),
-			Usage:  "clip [location] [meta name]: copy the password at location to the clipboard. meta name optional. Location and meta names can be partial strings, masterkey will search the vault and return the first result.",
+			Name:     "clip",
+			Action:   clip(v),
+			Usage:    "clip [--for duration] [location] [meta name]: copy the password at location to the clipboard, clearing it after duration, 30 seconds by default. meta name optional. Location and meta names can be partial strings, masterkey will search the vault and return the first result.",
+			Category: categoryClipboard,
+			Examples: []string{"clip github.com", "clip --for 10s github.com", `clip aws "secret key"`},
+		}
+	}
+
+	policyCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "policy",
+			Action:   policy(v),
+			Usage:    "policy [timeout|clipboard duration|default] [enforce on|off]: set how long this vault stays open with no activity, and how long copied secrets stay on the clipboard. Enforced timeouts can be shortened by flags and commands, but not lengthened.",
+			Category: categorySecurity,
+			Examples: []string{"policy timeout 2m", "policy clipboard 10s", "policy enforce on"},
+		}
+	}
+
+	peekCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "peek",
+			Action:   peek(v, os.Stdout),
+			Usage:    "print the password at location, then erase it from the terminal after [seconds] (default 10) or when a key is pressed. For environments where the clipboard can't be used.",
+			Args:     []repl.Arg{locationArg(v), {Name: "seconds", Optional: true, Type: repl.Int}},
+			Category: categoryClipboard,
+			Examples: []string{"peek github.com 5"},
+		}
+	}
+
+	totpCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "totp",
+			Action:   totp(v),
+			Usage:    "totp [location] [clip]: print the current two-factor code for the credential at [location], or copy it to the clipboard with clip. The TOTP secret is read from the totp meta tag, as a base32 secret or an otpauth://totp/ URI.\ntotp import-qr [image] [location]: read the otpauth:// QR code in the PNG, JPEG or GIF screenshot at [image] and store its secret on the credential at [location], which is created if it does not exist. The location defaults to the issuer named in the code.",
+			Category: categoryClipboard,
+			Examples: []string{"addmeta github.com totp JBSWY3DPEHPK3PXP", "totp github.com", "totp github.com clip", "totp import-qr ~/Desktop/github-2fa.png github.com"},
+		}
+	}
+
+	notesCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "notes",
+			Action:   notes(v, editText),
+			Usage:    "edit the notes for the credential at [location] using $EDITOR",
+			Args:     []repl.Arg{locationArg(v)},
+			Category: categoryCredentials,
+		}
+	}
+
+	urlCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "url",
+			Action:   setURL(v),
+			Usage:    "set the URL of the credential at [location] to [url], or clear it if [url] is left out",
+			Args:     []repl.Arg{locationArg(v), {Name: "url", Optional: true}},
+			Category: categoryCredentials,
+			Examples: []string{"url github.com https://github.com/login"},
+		}
+	}
+
+	emailCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "email",
+			Action:   setEmail(v),
+			Usage:    "set the email address of the credential at [location] to [address], or clear it if [address] is left out",
+			Args:     []repl.Arg{locationArg(v), {Name: "address", Optional: true}},
+			Category: categoryCredentials,
+			Examples: []string{"email github.com alice@example.com"},
+		}
+	}
+
+	tagCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "tag",
+			Action:   tag(v),
+			Usage:    "tag the credential at [location] with each of [tag], to group it with others. list --tag lists the credentials with a tag.",
+			Args:     []repl.Arg{locationArg(v), tagArg(v)},
+			Category: categoryCredentials,
+			Examples: []string{"tag github.com work", "tag chase.com finance banking"},
+		}
+	}
+
+	untagCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "untag",
+			Action:   untag(v),
+			Usage:    "remove each of [tag] from the credential at [location]",
+			Args:     []repl.Arg{locationArg(v), tagArg(v)},
+			Category: categoryCredentials,
+			Examples: []string{"untag github.com work"},
+		}
+	}
+
+	folderCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "folder",
+			Action:   folder(v),
+			Usage:    "move the credential at [location] into [folder], with nested folders separated by /, or to the top level if [folder] is left out",
+			Args:     []repl.Arg{locationArg(v), folderArg(v)},
+			Category: categoryCredentials,
+			Examples: []string{"folder aws-prod work/aws/prod", "folder aws-prod"},
+		}
+	}
+
+	foldersCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "folders",
+			Action:   folders(v),
+			Usage:    "list the folders in this vault, nested under their parents, with how many credentials are in each",
+			Args:     repl.NoArgs,
+			Category: categoryCredentials,
+		}
+	}
+
+	tagsCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "tags",
+			Action:   tags(v),
+			Usage:    "list the tags used in this vault, with how many credentials have each",
+			Args:     repl.NoArgs,
+			Category: categoryCredentials,
+		}
+	}
+
+	historyCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "history",
+			Action:   history(v),
+			Usage:    "list the passwords the credential at [location] had before its current one, newest first, with when each was replaced",
+			Args:     []repl.Arg{locationArg(v)},
+			Category: categoryCredentials,
+		}
+	}
+
+	iconCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "icon",
+			Action:   icon(v),
+			Usage:    "set the icon for the credential at [location]. fetch downloads the favicon of [site] (default: the location), file reads the image at [path], and clear removes the icon.",
+			Args:     []repl.Arg{{Choices: []string{"fetch", "file", "clear"}}, locationArg(v), {Name: "site or path", Optional: true}},
+			Category: categoryCredentials,
+			Examples: []string{"icon fetch github.com", "icon file github.com ~/icons/github.png"},
 		}
 	}
 
 	searchCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "search",
-			Action: search(v),
-			Usage:  "search [searchtext]: search the vault for locations containing searchtext",
+			Name:     "search",
+			Action:   search(v),
+			Usage:    "search [--all] [searchtext]: search the vault for locations containing searchtext. Archived credentials are only searched with --all.",
+			Category: categoryCredentials,
+			Examples: []string{"search github", "search --all mail"},
+		}
+	}
+
+	undoCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "undo",
+			Action:   undo(v),
+			Usage:    "revert the last change made to the vault's credentials since it was last saved",
+			Args:     repl.NoArgs,
+			Category: categoryCredentials,
+		}
+	}
+
+	redoCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "redo",
+			Action:   redo(v),
+			Usage:    "make the last change reverted by undo again",
+			Args:     repl.NoArgs,
+			Category: categoryCredentials,
+		}
+	}
+
+	snapshotCmd = func(v *vault.Vault) repl.Command {
+		name := snapshotArg(v)
+		name.Optional = true
+		return repl.Command{
+			Name:     "snapshot",
+			Action:   snapshot(v),
+			Usage:    "create a restore point called [name] holding the vault's credentials as they are now, list the restore points, or delete [name]. Restore points last until the vault is locked or masterkey exits, and are never saved.",
+			Args:     []repl.Arg{{Choices: []string{"create", "list", "delete"}}, name},
+			Category: categoryCredentials,
+			Examples: []string{"snapshot create before-import", "snapshot list"},
+		}
+	}
+
+	rollbackCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "rollback",
+			Action:   rollback(v),
+			Usage:    "restore the vault's credentials to the restore point [name] created by snapshot. undo reverts the rollback.",
+			Args:     []repl.Arg{snapshotArg(v)},
+			Category: categoryCredentials,
+			Examples: []string{"rollback before-import"},
 		}
 	}
 
 	deleteCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "delete",
-			Action: deletelocation(v),
-			Usage:  "delete [location]: remove [location] from the vault.",
+			Name:     "delete",
+			Action:   deletelocation(v),
+			Usage:    "delete [location]: remove [location] from the vault.\ndelete --match [searchtext]: remove every location containing searchtext from the vault, after confirming if more than one matches.",
+			Category: categoryCredentials,
+			Examples: []string{"delete github.com", "delete --match old-job"},
+		}
+	}
+
+	renameCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "rename",
+			Action:   rename(v),
+			Usage:    "move the credential at [location] to [new location], keeping its meta tags, aliases and password history",
+			Args:     []repl.Arg{locationArg(v), {Name: "new location"}},
+			Category: categoryCredentials,
+			Examples: []string{"rename github.com github.com/work"},
+		}
+	}
+
+	copyCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "copy",
+			Action:   copyCredential(v),
+			Usage:    "add a copy of the credential at [location], with its password, notes and meta tags, at [new location]",
+			Args:     []repl.Arg{locationArg(v), {Name: "new location"}},
+			Category: categoryCredentials,
+			Examples: []string{"copy db.staging.example.com db.prod.example.com"},
+		}
+	}
+
+	auditCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "audit",
+			Action:   audit(v),
+			Usage:    "audit --stale [age] | audit fix: --stale lists credentials that have not been used in age, such as 1y or 90d, as candidates for deleting or archiving, and requires trackusage to be on. fix walks through weak and reused passwords one at a time, offering to generate a stronger replacement of the same shape, copy it, and open the site's change-password page, and remembers replacements not yet confirmed on the site.",
+			Category: categorySecurity,
+			Examples: []string{"audit --stale 1y", "audit fix"},
+		}
+	}
+
+	archiveCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "archive",
+			Action:   archive(v),
+			Usage:    "hide the credential at location from list, search and the terminal UI without deleting it",
+			Args:     []repl.Arg{locationArg(v)},
+			Category: categoryCredentials,
+		}
+	}
+
+	unarchiveCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "unarchive",
+			Action:   unarchive(v),
+			Usage:    "restore an archived credential to list, search and the terminal UI",
+			Args:     []repl.Arg{locationArg(v)},
+			Category: categoryCredentials,
+		}
+	}
+
+	statusCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "status",
+			Action:   status(v),
+			Usage:    "status [--sizes] [--top n]: show how many credentials the vault holds and how large it is. With --sizes, also list the n largest credentials (10 by default).",
+			Category: categoryVault,
+			Examples: []string{"status --sizes --top 5"},
+		}
+	}
+
+	sizeWarningCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "sizewarning",
+			Action:   sizewarning(v),
+			Usage:    "warn when the encrypted vault grows larger than size (0 for the default). With no arguments, shows the current threshold.",
+			Args:     []repl.Arg{{Name: "size in MiB", Optional: true, Type: repl.Int}},
+			Category: categoryVault,
+			Examples: []string{"sizewarning 5"},
+		}
+	}
+
+	trackUsageCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "trackusage",
+			Action:   trackusage(v),
+			Usage:    "record, encrypted in the vault, how often and when each credential is used, so that list and the terminal UI can show the most relevant first. Turning it off deletes the recorded usage.",
+			Args:     []repl.Arg{onOffArg},
+			Category: categoryVault,
+		}
+	}
+
+	confirmDestructiveCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "confirmdestructive",
+			Action:   confirmdestructive(v),
+			Usage:    "require the master password to be entered again before destructive operations (delete --match, changepassword) on this vault.",
+			Args:     []repl.Arg{onOffArg},
+			Category: categorySecurity,
+		}
+	}
+	paddingCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "padding",
+			Action:   padding(v),
+			Usage:    "pad the vault before it is encrypted, so that its size does not reveal how many credentials it holds or change as they are added, at the cost of a larger file.",
+			Args:     []repl.Arg{onOffArg},
+			Category: categorySecurity,
+		}
+	}
+	locationRulesCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "locationrules",
+			Action:   locationrules(v),
+			Usage:    "locationrules [max length] [lowercase hosts on|off]: set the longest location that can be added (0 for the default) and whether hostnames and URLs are lowercased when added or looked up. With no arguments, shows the current rules.",
+			Category: categoryVault,
+			Examples: []string{"locationrules 200 on"},
 		}
 	}
 	addmetaCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "addmeta",
-			Action: addmeta(v),
-			Usage:  "addmeta [location] [meta name] [meta value]: add a metadata tag to the credential at [location]",
+			Name:     "addmeta",
+			Action:   addmeta(v),
+			Usage:    "add a metadata tag to the credential at [location]",
+			Args:     []repl.Arg{locationArg(v), {Name: "meta name"}, {Name: "meta value"}},
+			Category: categoryCredentials,
+			Examples: []string{`addmeta github.com "recovery email" alice@example.com`},
 		}
 	}
 
 	editmetaCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "editmeta",
-			Action: editmeta(v),
-			Usage:  "editmeta [location] [meta name] [new meta value]: edit an existing metadata tag at [location].",
+			Name:     "editmeta",
+			Action:   editmeta(v),
+			Usage:    "edit an existing metadata tag at [location].",
+			Args:     []repl.Arg{locationArg(v), {Name: "meta name"}, {Name: "new meta value"}},
+			Category: categoryCredentials,
 		}
 	}
 
 	deletemetaCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "deletemeta",
-			Action: deletemeta(v),
-			Usage:  "deletemeta [location] [meta name]: delete an existing metadata tag at [location].",
+			Name:     "deletemeta",
+			Action:   deletemeta(v),
+			Usage:    "delete an existing metadata tag at [location].",
+			Args:     []repl.Arg{locationArg(v), {Name: "meta name"}},
+			Category: categoryCredentials,
 		}
 	}
 
 	importCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "importcsv",
-			Action: importcsv(v),
-			Usage:  "importcsv [path to csv] [location key] [username key] [password key]: import a csv file.\nThe location key, username key, and password key are the CSV key names used to locate each value. Extra keys will be added to the vault as meta tags.",
+			Name:          "importcsv",
+			ContextAction: importcsv(v),
+			Usage:         "import a csv file.\nThe location key, username key, and password key are the CSV key names used to locate each value. Extra keys will be added to the vault as meta tags. Press Ctrl-C to stop, keeping the credentials imported so far.",
+			Args:          []repl.Arg{{Name: "path to csv"}, {Name: "location key"}, {Name: "username key"}, {Name: "password key"}},
+			Category:      categoryImport,
+			Examples:      []string{"importcsv passwords.csv url username password"},
+		}
+	}
+
+	exportPassCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "exportpass",
+			Action:   exportpass(v),
+			Usage:    "exportpass [--store-dir dir] [--gpg-id id]: export every credential to a pass (password-store) directory, encrypted to the gpg id. The store defaults to $PASSWORD_STORE_DIR or ~/.password-store, and the gpg id to the store's .gpg-id.",
+			Category: categoryImport,
+		}
+	}
+
+	exportBrowserCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "exportbrowser",
+			Action:   exportbrowser(v),
+			Usage:    "exportbrowser [--include-usernames] [path to csv]: export every credential to a CSV file that Chrome and Firefox can import. The file contains plaintext passwords, delete it once it has been imported. Masked usernames are left out unless --include-usernames is given.",
+			Category: categoryImport,
+			Examples: []string{"exportbrowser passwords.csv"},
+		}
+	}
+
+	exportYAMLCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "exportyaml",
+			Action:   exportyaml(v),
+			Usage:    "exportyaml [--with-secrets] [--tag tag] [--folder folder] [path] [searchtext]: write the credentials whose locations contain searchtext, or every credential, to a YAML file for editing by hand and applying back with importyaml. --tag and --folder narrow them down. Passwords, and usernames the vault masks, are only written with --with-secrets.",
+			Category: categoryImport,
+			Examples: []string{"exportyaml --tag work work.yaml", "importyaml --dry-run work.yaml", "importyaml work.yaml"},
+		}
+	}
+
+	importYAMLCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "importyaml",
+			Action:   importyaml(v),
+			Usage:    "importyaml [--dry-run] [path]: apply the changes made to a YAML file written by exportyaml to the credentials in it, after checking every entry, and list what changed. --dry-run lists the changes without making them. Credentials left out of the file are not changed, and nor are empty passwords and usernames.",
+			Category: categoryImport,
+			Examples: []string{"importyaml --dry-run work.yaml"},
+		}
+	}
+
+	bulkEditCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "bulkedit",
+			Action:   bulkedit(v, editText),
+			Usage:    "bulkedit [--with-secrets] [--tag tag] [--folder folder] [searchtext]: edit the tags, meta tags, notes and other fields of the credentials whose locations contain searchtext, or every credential, together as YAML in $EDITOR, then review the changes before they are made.",
+			Category: categoryCredentials,
+			Examples: []string{"bulkedit --tag work", "bulkedit example.com"},
+		}
+	}
+
+	importFormatCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:          "import",
+			ContextAction: importformat(v),
+			Usage:         msg.Sprintf("import the export of another password manager. Supported formats: %v. Locations that are already taken have the username or a number appended. Press Ctrl-C to stop, keeping the credentials imported so far.", strings.Join(importer.FormatNames(), ", ")),
+			Args:          []repl.Arg{{Name: "format", Choices: importer.FormatNames()}, {Name: "path to export"}},
+			Category:      categoryImport,
+			Examples:      []string{"import lastpass ~/Downloads/lastpass_export.csv"},
 		}
 	}
 
 	changePasswordCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "changepassword",
-			Action: changepassword(v),
-			Usage:  "changepassword: change the master password for the vault",
+			Name:     "changepassword",
+			Action:   changepassword(v),
+			Usage:    "change the master password for the vault",
+			Args:     repl.NoArgs,
+			Category: categorySecurity,
+		}
+	}
+
+	duressCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "duress",
+			Action:   duress(v),
+			Usage:    "set a second password that opens a decoy vault, kept hidden in the same file, instead of this one (decoy), or destroys this one and opens an empty vault (wipe), or remove it (off)",
+			Args:     []repl.Arg{{Choices: []string{"decoy", "wipe", "off"}, Optional: true}},
+			Category: categorySecurity,
+			Examples: []string{"duress decoy", "duress off"},
+		}
+	}
+
+	unlockWritesCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "unlock-writes",
+			Action:   unlockWrites(v),
+			Usage:    "allow changes to a vault opened with -protect-writes",
+			Args:     repl.NoArgs,
+			Category: categorySecurity,
+		}
+	}
+
+	questionCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "question",
+			Action:   question(v),
+			Usage:    "question [add|clip|list|delete] [location] [question]: manage security questions. add stores a random answer to a question, clip copies the answer of the question matching the given text, list shows the questions at location, and delete removes one.",
+			Category: categoryCredentials,
+			Examples: []string{`question add bank.example.com "first pet"`, "question clip bank.example.com pet"},
+		}
+	}
+
+	aliasCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "alias",
+			Action:   alias(v),
+			Usage:    "alias [add|delete|list] [alias] [location]: manage aliases. add makes alias refer to the credential at location, so that get, clip and the other commands accept it, delete removes an alias, and list shows every alias. Aliases are deleted along with their credential.",
+			Category: categoryCredentials,
+			Examples: []string{"alias add gh github.com", "alias list"},
+		}
+	}
+
+	tokensCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "tokens",
+			Action:   tokens(v),
+			Usage:    "tokens [tag|untag|expiring]: track when API tokens and SSH keys expire. tag [--provider name] [--expires date|90d|never] [--scopes a,b] [location] marks location as a token; the provider (github, aws, gcp, ssh or any other name) is guessed from the password if not given, and known providers default to their usual lifetime. untag [location] removes the mark. expiring [--within 30d] lists tokens that expire within the given time, with hints on where to rotate them.",
+			Category: categoryCredentials,
+			Examples: []string{"tokens tag --expires 90d ci-deploy-key", "tokens expiring --within 30d"},
+		}
+	}
+
+	maskUsernameCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "maskusername",
+			Action:   maskusername(v),
+			Usage:    "maskusername [location] [on|off]: treat the username at location as sensitive, masking it in output and leaving it out of plaintext exports. Without a location, every username in the vault is masked.",
+			Category: categoryCredentials,
+		}
+	}
+
+	setCmd = func() repl.Command {
+		return repl.Command{
+			Name:     "set",
+			Action:   set,
+			Usage:    "change a session option. Options: presentation, which hides passwords, notes and meta values and partially masks usernames, for screen sharing, and debug, which reports how long each command took, as -verbose does.",
+			Args:     []repl.Arg{{Name: "option", Choices: sessionOptionNames()}, onOffArg},
+			Category: categoryClipboard,
+			Examples: []string{"set presentation on", "set debug on"},
+		}
+	}
+
+	rekeyCmd = func(v *vault.Vault, vaultPath string) repl.Command {
+		return repl.Command{
+			Name:     "rekey",
+			Action:   rekey(v, vaultPath),
+			Usage:    "rekey [argon2 time] [argon2 memory in MiB]: re-encrypt and save the vault under a fresh salt and key, keeping the master password. The key derivation parameters are unchanged unless given.",
+			Category: categorySecurity,
+			Examples: []string{"rekey", "rekey 4 256"},
 		}
 	}
 
 	mergeCmd = func(v *vault.Vault) repl.Command {
 		return repl.Command{
-			Name:   "merge",
-			Action: merge(v),
-			Usage:  "merge [location]: merge the vault at location with the currently open vault.",
+			Name:     "merge",
+			Action:   merge(v),
+			Usage:    "merge the vaults at each location with the currently open vault. The vaults are opened in parallel.",
+			Args:     []repl.Arg{{Name: "location", Variadic: true}},
+			Category: categorySync,
+			Examples: []string{"merge ~/backup/vault.db"},
+		}
+	}
+
+	remoteCmd = func(v *vault.Vault, vaultPath string) repl.Command {
+		return repl.Command{
+			Name:     "remote",
+			Action:   remote(v, vaultPath),
+			Usage:    "remote [set url|enroll name|pair|devices|revoke name|sync|off]: sync the vault through a sync server started with masterkey syncserver. set stores the vault's URL on the server, such as https://example.com/vaults/personal. enroll enrolls this device under name, given a pairing code or, for the first device, the server's token. pair shows a code that enrolls another device, devices lists the enrolled devices, and revoke stops a lost device from reading or writing the vault on the server. sync merges the server's copy into the open vault and uploads the result, and off forgets the server. The server only ever sees the encrypted vault.",
+			Category: categorySync,
+			Examples: []string{"remote set https://example.com/vaults/personal", "remote sync"},
+		}
+	}
+
+	syncCmd = func(v *vault.Vault) repl.Command {
+		return repl.Command{
+			Name:     "sync",
+			Action:   syncVault(v),
+			Usage:    "bring in the changes made to another copy of the currently open vault, such as a conflicted copy left by a file sync tool. The most recent change to each credential wins.",
+			Args:     []repl.Arg{{Name: "location"}},
+			Category: categorySync,
+			Examples: []string{`sync "vault (conflicted copy).db"`},
 		}
 	}
 )
 
 func merge(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 1 {
-			return "", fmt.Errorf("merge requires one argument, the path of the vault to merge")
+		var reqs []vault.DecryptRequest
+		defer func() {
+			for _, req := range reqs {
+				req.File.Close()
+			}
+		}()
+		for _, vaultPath := range args {
+			f, err := vault.ReadFile(vaultPath)
+			if err != nil {
+				return "", err
+			}
+			reqs = append(reqs, vault.DecryptRequest{File: f})
+			pass, err := askPassword("Enter the password for " + vaultPath + ": ")
+			if err != nil {
+				return "", err
+			}
+			reqs[len(reqs)-1].Passphrase = pass
+		}
+
+		// the vaults' keys are derived in parallel, then merged in order
+		vaults, errs := vault.DecryptAll(reqs, 0)
+		for _, vmerge := range vaults {
+			if vmerge != nil {
+				defer vmerge.Close()
+			}
+		}
+		for i, err := range errs {
+			if err != nil {
+				return "", msg.Errorf("could not open %v: %v", args[i], err)
+			}
 		}
-		vaultPath := args[0]
-		pass, err := askPassword("Enter the password for the vault to be merged: ")
+		for i, vmerge := range vaults {
+			if err := v.Merge(vmerge); err != nil {
+				return "", msg.Errorf("merging %v: %v", args[i], err)
+			}
+		}
+		if len(vaults) == 1 {
+			return "vault merged successfully.", nil
+		}
+		return fmt.Sprintf("%v vaults merged successfully.", len(vaults)), nil
+	}
+}
+
+func syncVault(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		pass, err := askPassword("Enter the password for " + args[0] + ": ")
+		if err != nil {
+			return "", err
+		}
+		vsync, err := vault.Open(args[0], pass)
+		if err != nil {
+			return "", err
+		}
+		defer vsync.Close()
+
+		res, err := v.Sync(vsync)
 		if err != nil {
 			return "", err
 		}
+		if len(res.Added)+len(res.Updated)+len(res.Deleted)+len(res.Conflicts) == 0 {
+			return "vault is already up to date.", nil
+		}
+		printstring := ""
+		for _, change := range []struct {
+			verb      string
+			locations []string
+		}{
+			{"added", res.Added},
+			{"updated", res.Updated},
+			{"deleted", res.Deleted},
+			{"added under a new location, as its own was taken", res.Conflicts},
+		} {
+			for _, location := range change.locations {
+				printstring += fmt.Sprintf("%v: %v\n", location, change.verb)
+			}
+		}
+		return printstring, nil
+	}
+}
+
+// errNotConfirmed is returned from destructive commands if the user fails to
+// confirm the operation.
+var errNotConfirmed = errors.New("master password did not match, operation cancelled")
+
+// confirmDestructive asks the user to enter the master password again before
+// a destructive operation, if the vault has been configured to require it.
+func confirmDestructive(v *vault.Vault) error {
+	if !v.Settings().ConfirmDestructive {
+		return nil
+	}
+	pass, err := askPassword("This operation is destructive. Enter the master password to confirm: ")
+	if err != nil {
+		return err
+	}
+	if !v.VerifyPassphrase(pass) {
+		return errNotConfirmed
+	}
+	return nil
+}
+
+func confirmdestructive(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if err := confirmDestructive(v); err != nil {
+			return "", err
+		}
+
+		settings := v.Settings()
+		settings.ConfirmDestructive = args[0] == "on"
+		if err := v.SetSettings(settings); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("destructive operation confirmation turned %v\n", args[0]), nil
+	}
+}
+
+func padding(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		settings := v.Settings()
+		settings.PadData = args[0] == "on"
+		if err := v.SetSettings(settings); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("padding turned %v\n", args[0]), nil
+	}
+}
+
+func locationrules(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		settings := v.Settings()
+		if len(args) == 0 {
+			maxLength := settings.MaxLocationLength
+			if maxLength == 0 {
+				maxLength = vault.DefaultMaxLocationLength
+			}
+			lowercase := "off"
+			if settings.NormalizeHostnames {
+				lowercase = "on"
+			}
+			return fmt.Sprintf("max location length: %v\nlowercase hosts: %v\n", maxLength, lowercase), nil
+		}
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			return "", msg.Errorf("%v requires 0 or 2 arguments. See help for usage.", "locationrules")
+		}
+		maxLength, err := strconv.Atoi(args[0])
+		if err != nil || maxLength < 0 {
+			return "", msg.Errorf("max length must be a non-negative number")
+		}
+
+		settings.MaxLocationLength = maxLength
+		settings.NormalizeHostnames = args[1] == "on"
+		if err := v.SetSettings(settings); err != nil {
+			return "", err
+		}
+		return "location rules updated\n", nil
+	}
+}
+
+// defaultPassStoreDir returns the password store pass itself would use.
+func defaultPassStoreDir() string {
+	if dir := os.Getenv("PASSWORD_STORE_DIR"); dir != "" {
+		return dir
+	}
+	u, err := user.Current()
+	if err != nil {
+		return ".password-store"
+	}
+	return filepath.Join(u.HomeDir, ".password-store")
+}
+
+func exportpass(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("exportpass", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		storeDir := fs.String("store-dir", defaultPassStoreDir(), "")
+		gpgID := fs.String("gpg-id", "", "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+			return "", msg.Errorf("exportpass only accepts --store-dir and --gpg-id. See help for usage.")
+		}
+
+		n, err := exporter.Pass(v, *storeDir, *gpgID)
+		if err != nil {
+			return "", msg.Errorf("exported %v credentials before failing: %v", n, err)
+		}
+		return fmt.Sprintf("exported %v credentials to %v\n", n, *storeDir), nil
+	}
+}
+
+func exportbrowser(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("exportbrowser", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		includeUsernames := fs.Bool("include-usernames", false, "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return "", msg.Errorf("%v requires 1 argument. See help for usage.", "exportbrowser")
+		}
+		path := fs.Arg(0)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return "", err
+		}
+		plaintextFiles.add(path)
+		n, err := exporter.BrowserCSV(v, f, *includeUsernames)
+		if err != nil {
+			f.Close()
+			return "", err
+		}
+		if err := f.Close(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("exported %v credentials to %v\n%v contains plaintext passwords. Delete it once it has been imported.\n", n, path, path), nil
+	}
+}
+
+func importformat(v *vault.Vault) repl.ContextActionFunc {
+	return func(ctx context.Context, args []string) (string, error) {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		entries, err := importer.Read(args[0], f)
+		if err != nil {
+			return "", err
+		}
+		n, err := importer.ImportContext(ctx, v, entries)
+		if err == context.Canceled {
+			plaintextFiles.add(args[1])
+			return "", msg.Errorf("import canceled after importing %v of %v credentials", n, len(entries))
+		}
+		if err != nil {
+			plaintextFiles.add(args[1])
+			return "", msg.Errorf("imported %v credentials before failing: %v", n, err)
+		}
+		f.Close()
+
+		shredded, err := offerShred(args[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("imported %v credentials from %v\n", n, args[1]) + shredded, nil
+	}
+}
+
+func changepassword(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if err := confirmDestructive(v); err != nil {
+			return "", err
+		}
+		pass1, err := askPassword("Enter a new password for this vault: ")
+		if err != nil {
+			return "", err
+		}
+		pass2, err := askPassword("Again, please: ")
+		if err != nil {
+			return "", err
+		}
+
+		if pass1 != pass2 {
+			return "", msg.Errorf("passwords did not match: %v", describeMismatch(pass1, pass2))
+		}
+
+		err = v.ChangePassphrase(pass1)
+		if err != nil {
+			return "", err
+		}
+
+		return "master password changed successfully\n", nil
+	}
+}
+
+func duress(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) == 0 {
+			switch v.Settings().DuressAction {
+			case vault.DuressDecoy:
+				return "the duress password opens the decoy vault\n", nil
+			case vault.DuressWipe:
+				return "the duress password destroys the vault\n", nil
+			}
+			return "no duress password set\n", nil
+		}
+		if args[0] == "off" {
+			if err := v.ClearDuressPassphrase(); err != nil {
+				return "", err
+			}
+			return "duress password removed\n", nil
+		}
+		actions := map[string]vault.DuressAction{"decoy": vault.DuressDecoy, "wipe": vault.DuressWipe}
+		action := actions[args[0]]
+		if err := confirmDestructive(v); err != nil {
+			return "", err
+		}
+		pass1, err := askPassword("Enter the duress password: ")
+		if err != nil {
+			return "", err
+		}
+		pass2, err := askPassword("Again, please: ")
+		if err != nil {
+			return "", err
+		}
+		if pass1 != pass2 {
+			return "", msg.Errorf("passwords did not match: %v", describeMismatch(pass1, pass2))
+		}
+		if err = v.SetDuressPassphrase(pass1, action); err != nil {
+			return "", err
+		}
+		if action == vault.DuressWipe {
+			return "duress password set. Entering it in place of the master password overwrites and deletes the vault, then opens an empty one. Copies of the vault elsewhere, such as backups, are not affected.\n", nil
+		}
+		return "duress password set. Entering it in place of the master password opens a decoy vault, empty to begin with, whose credentials are saved hidden in this vault's file. Add a few plausible ones to it so that it passes for a real vault. Setting the duress password again empties the decoy.\n", nil
+	}
+}
+
+func question(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) == 2 && args[0] == "list" {
+			location, cred, err := v.Find(args[1])
+			if err != nil {
+				return "", err
+			}
+			questions := cred.Questions()
+			if len(questions) == 0 {
+				return fmt.Sprintf("%v has no security questions\n", location), nil
+			}
+			return strings.Join(questions, "\n") + "\n", nil
+		}
+		if len(args) < 3 {
+			return "", msg.Errorf("%v requires 3 arguments, or 2 for list. See help for usage.", "question")
+		}
+		location, _, err := v.Find(args[1])
+		if err != nil {
+			return "", err
+		}
+		// let the question be given without quotes
+		text := strings.Join(args[2:], " ")
+
+		switch args[0] {
+		case "add":
+			if err := v.AddQuestion(location, text); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("random answer to %q stored at %v. Use question clip to copy it.\n", text, location), nil
+		case "clip":
+			q, answer, err := v.FindQuestion(location, text)
+			if err != nil {
+				return "", err
+			}
+			if err := secureclip.Clip(answer); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("answer to %q at %v copied to clipboard, will clear in %v\n", q, location, describeClipTimeout(secureclip.Timeout())), nil
+		case "delete":
+			if err := confirmDestructive(v); err != nil {
+				return "", err
+			}
+			q, err := v.DeleteQuestion(location, text)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%q deleted from %v\n", q, location), nil
+		}
+		return "", msg.Errorf("unknown question action %v. See help for usage.", args[0])
+	}
+}
+
+func alias(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) == 1 && args[0] == "list" {
+			aliases, err := v.Aliases()
+			if err != nil {
+				return "", err
+			}
+			if len(aliases) == 0 {
+				return "this vault has no aliases\n", nil
+			}
+			var names []string
+			for name := range aliases {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			printstring := ""
+			for _, name := range names {
+				printstring += fmt.Sprintf("%v -> %v\n", name, aliases[name])
+			}
+			return printstring, nil
+		}
+		if len(args) == 2 && args[0] == "delete" {
+			if err := v.DeleteAlias(args[1]); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("alias %v deleted\n", args[1]), nil
+		}
+		if len(args) == 3 && args[0] == "add" {
+			location, _, err := v.Find(args[2])
+			if err != nil {
+				return "", err
+			}
+			if err = v.AddAlias(args[1], location); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%v is now an alias of %v\n", args[1], location), nil
+		}
+		return "", msg.Errorf("%v requires add with 2 arguments, delete with 1, or list. See help for usage.", "alias")
+	}
+}
+
+// parseDays parses a duration that may also be given in days, weeks or
+// years, such as 30d, 2w or 1y.
+func parseDays(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	case strings.HasSuffix(s, "y"):
+		unit = 365 * 24 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return 0, msg.Errorf("invalid duration %v", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// describeToken returns a line describing the token at location and when it
+// expires, relative to now.
+func describeToken(location string, token vault.Token, now time.Time) string {
+	name, hint := token.Provider, ""
+	if provider, ok := vault.TokenProviders[token.Provider]; ok {
+		name, hint = provider.Name, provider.Hint
+	}
+	days := int(token.Expires.Sub(now).Hours() / 24)
+	when := fmt.Sprintf("expires %v (in %v days)", token.Expires.Format(vault.TokenDateFormat), days)
+	if token.Expires.Before(now) {
+		when = fmt.Sprintf("expired %v (%v days ago)", token.Expires.Format(vault.TokenDateFormat), -days)
+	}
+	line := fmt.Sprintf("%v: %v token %v", location, name, when)
+	if len(token.Scopes) > 0 {
+		line += ", scopes " + strings.Join(token.Scopes, ",")
+	}
+	if hint != "" {
+		line += ". Rotate: " + hint
+	}
+	return line
+}
+
+func tokens(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) < 1 {
+			return "", msg.Errorf("%v requires at least 1 argument. See help for usage.", "tokens")
+		}
+		now := time.Now()
+		switch args[0] {
+		case "tag":
+			fs := flag.NewFlagSet("tokens tag", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			providerName := fs.String("provider", "", "")
+			expires := fs.String("expires", "", "")
+			scopes := fs.String("scopes", "", "")
+			if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+				return "", msg.Errorf("%v requires 1 argument, the location. See help for usage.", "tokens tag")
+			}
+			location, cred, err := v.Find(fs.Arg(0))
+			if err != nil {
+				return "", err
+			}
+			token := vault.Token{Provider: strings.ToLower(*providerName), Created: now}
+			if token.Provider == "" {
+				token.Provider = vault.GuessTokenProvider(cred.Password)
+			}
+			if token.Provider == "" {
+				return "", msg.Errorf("could not tell which provider issued the token at %v, give one with --provider", location)
+			}
+			switch *expires {
+			case "never":
+			case "":
+				if lifetime := vault.TokenProviders[token.Provider].Lifetime; lifetime > 0 {
+					token.Expires = now.Add(lifetime)
+				}
+			default:
+				if token.Expires, err = time.Parse(vault.TokenDateFormat, *expires); err != nil {
+					lifetime, err := parseDays(*expires)
+					if err != nil {
+						return "", msg.Errorf("--expires must be a date like 2006-01-02, a lifetime like 90d, or never")
+					}
+					token.Expires = now.Add(lifetime)
+				}
+			}
+			if *scopes != "" {
+				token.Scopes = strings.Split(*scopes, ",")
+			}
+			if err = v.SetToken(location, token); err != nil {
+				return "", err
+			}
+			if token.Expires.IsZero() {
+				return fmt.Sprintf("%v tagged as a %v token that does not expire\n", location, token.Provider), nil
+			}
+			return fmt.Sprintf("%v tagged as a %v token expiring %v\n", location, token.Provider, token.Expires.Format(vault.TokenDateFormat)), nil
+		case "untag":
+			if len(args) != 2 {
+				return "", msg.Errorf("%v requires 1 argument, the location. See help for usage.", "tokens untag")
+			}
+			location, _, err := v.Find(args[1])
+			if err != nil {
+				return "", err
+			}
+			if err = v.ClearToken(location); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%v is no longer tagged as a token\n", location), nil
+		case "expiring":
+			fs := flag.NewFlagSet("tokens expiring", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			within := fs.String("within", "30d", "")
+			if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 {
+				return "", msg.Errorf("tokens expiring only accepts --within. See help for usage.")
+			}
+			d, err := parseDays(*within)
+			if err != nil {
+				return "", err
+			}
+			expiring, err := v.ExpiringTokens(now, d)
+			if err != nil {
+				return "", err
+			}
+			if len(expiring) == 0 {
+				return fmt.Sprintf("no tokens expire within %v\n", *within), nil
+			}
+			var lines []string
+			for _, e := range expiring {
+				lines = append(lines, describeToken(e.Location, e.Token, now))
+			}
+			return strings.Join(lines, "\n") + "\n", nil
+		}
+		return "", msg.Errorf("unknown tokens action %v. See help for usage.", args[0])
+	}
+}
+
+func maskusername(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) < 1 || len(args) > 2 || (args[len(args)-1] != "on" && args[len(args)-1] != "off") {
+			return "", msg.Errorf("%v requires 1 or 2 arguments. See help for usage.", "maskusername")
+		}
+		on := args[len(args)-1] == "on"
+		if len(args) == 1 {
+			settings := v.Settings()
+			settings.SensitiveUsernames = on
+			if err := v.SetSettings(settings); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("masking of every username turned %v\n", args[0]), nil
+		}
+
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+		if err = v.SetUsernameSensitive(location, on); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("masking of the username at %v turned %v\n", location, args[1]), nil
+	}
+}
+
+// sessionOptions are the options that can be changed with `set`. They last
+// until masterkey exits.
+var sessionOptions = map[string]func(on bool){
+	"presentation": setPresentation,
+	"debug":        setDebug,
+}
+
+// sessionOptionNames returns the names of the session options, sorted.
+func sessionOptionNames() []string {
+	var names []string
+	for name := range sessionOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func set(args []string) (string, error) {
+	sessionOptions[args[0]](args[1] == "on")
+	return fmt.Sprintf("%v mode turned %v\n", args[0], args[1]), nil
+}
+
+func unlockWrites(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if protected, _ := v.WriteProtected(); !protected {
+			return "vault is not write-protected\n", nil
+		}
+		v.AllowWrites()
+		return "changes to the vault are now allowed\n", nil
+	}
+}
+
+func rekey(v *vault.Vault, vaultPath string) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) != 0 && len(args) != 2 {
+			return "", msg.Errorf("%v requires 0 or 2 arguments. See help for usage.", "rekey")
+		}
+		var params vault.KDFParams
+		if len(args) == 2 {
+			argonTime, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil || argonTime == 0 {
+				return "", msg.Errorf("argon2 time must be a positive number")
+			}
+			memory, err := strconv.ParseUint(args[1], 10, 22)
+			if err != nil || memory == 0 {
+				return "", msg.Errorf("argon2 memory must be a positive number of MiB")
+			}
+			params.Time = uint32(argonTime)
+			params.Memory = uint32(memory) * 1024
+		}
+
+		pass, err := askPassword("Enter the master password for this vault: ")
+		if err != nil {
+			return "", err
+		}
+		if err = v.Rekey(pass, params); err != nil {
+			return "", err
+		}
+		if err = v.Save(vaultPath); err != nil {
+			return "", err
+		}
+		return "vault rekeyed and saved\n", nil
+	}
+}
+
+func importcsv(v *vault.Vault) repl.ContextActionFunc {
+	return func(ctx context.Context, args []string) (string, error) {
+		filepath := args[0]
+		locationkey := args[1]
+		usernamekey := args[2]
+		passwordkey := args[3]
+
+		f, err := os.Open(filepath)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		n, err := v.LoadCSVContext(ctx, f, locationkey, usernamekey, passwordkey)
+		if err == context.Canceled {
+			plaintextFiles.add(filepath)
+			return "", msg.Errorf("importcsv canceled after importing %v credentials", n)
+		}
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+
+		shredded, err := offerShred(filepath)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v migrated successfully. %v locations imported.\n", filepath, n) + shredded, nil
+	}
+}
+
+func deletemeta(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location := args[0]
+		metaname := args[1]
+
+		err := v.DeleteMeta(location, metaname)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%v deleted from %v successfully.\n", metaname, location), nil
+	}
+}
+
+func undo(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		locations, err := v.Undo()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("undid the last change to %v\n", strings.Join(locations, ", ")), nil
+	}
+}
+
+func redo(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		locations, err := v.Redo()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("redid the last change to %v\n", strings.Join(locations, ", ")), nil
+	}
+}
+
+func snapshot(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if args[0] == "list" {
+			snapshots := v.Snapshots()
+			if len(snapshots) == 0 {
+				return "no snapshots\n", nil
+			}
+			printstring := "Snapshots:\n"
+			for _, s := range snapshots {
+				printstring += fmt.Sprintf("%v (created %v)\n", s.Name, s.Created.Local().Format("15:04:05"))
+			}
+			return printstring, nil
+		}
+		if len(args) != 2 {
+			return "", msg.Errorf("%v requires %v arguments. See help for usage.", "snapshot "+args[0], 2)
+		}
+		if args[0] == "delete" {
+			if err := v.DeleteSnapshot(args[1]); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("snapshot %v deleted\n", args[1]), nil
+		}
+		if err := v.CreateSnapshot(args[1]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("snapshot %v created\n", args[1]), nil
+	}
+}
+
+func rollback(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if err := confirmDestructive(v); err != nil {
+			return "", err
+		}
+		locations, err := v.Rollback(args[0])
+		if err != nil {
+			return "", err
+		}
+		if len(locations) == 0 {
+			return fmt.Sprintf("nothing has changed since snapshot %v\n", args[0]), nil
+		}
+		return fmt.Sprintf("rolled back to snapshot %v, changing %v\n", args[0], strings.Join(locations, ", ")), nil
+	}
+}
+
+func rename(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if err := v.Rename(args[0], args[1]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v renamed to %v\n", args[0], args[1]), nil
+	}
+}
+
+func copyCredential(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if err := v.Copy(args[0], args[1]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v copied to %v\n", args[0], args[1]), nil
+	}
+}
+
+func deletelocation(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) == 2 && args[0] == "--match" {
+			return deletematching(v, args[1])
+		}
+		if len(args) != 1 {
+			return "", msg.Errorf("%v requires 1 argument. See help for usage.", "delete")
+		}
+
+		location := args[0]
+
+		err := v.Delete(location)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%v deleted successfully.\n", location), nil
+	}
+}
+
+// deletematching removes every location containing searchtext from the
+// vault. If more than one location matches, the user is shown them and asked
+// to confirm first.
+func deletematching(v *vault.Vault, searchtext string) (string, error) {
+	if searchtext == "" {
+		return "", msg.Errorf("delete --match requires non-empty search text")
+	}
+	locations, err := v.Locations()
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	for _, location := range locations {
+		if strings.Contains(location, searchtext) {
+			matches = append(matches, location)
+		}
+	}
+	if len(matches) == 0 {
+		return "", vault.ErrNoSuchCredential
+	}
+	if len(matches) > 1 {
+		for _, location := range matches {
+			fmt.Println(location)
+		}
+		ok, err := askYesNo(fmt.Sprintf("Delete these %v credentials?", len(matches)))
+		if err != nil || !ok {
+			return "nothing deleted\n", err
+		}
+	}
+	if err = confirmDestructive(v); err != nil {
+		return "", err
+	}
+
+	printstring := ""
+	err = v.Batch(func(tx *vault.Tx) error {
+		for _, location := range matches {
+			if err := tx.Delete(location); err != nil {
+				return err
+			}
+			printstring += fmt.Sprintf("%v deleted successfully.\n", location)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return printstring, nil
+}
+
+func editmeta(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location := args[0]
+		metaname := args[1]
+		metaval := args[2]
+
+		if err := v.EditMeta(location, metaname, metaval); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%v updated successfully.\n", metaname), nil
+	}
+}
+
+func addmeta(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location := args[0]
+		metaname := args[1]
+		metaval := args[2]
+
+		if err := v.AddMeta(location, metaname, metaval); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%v added to %v successfully.\n", metaname, location), nil
+	}
+}
+
+func search(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("search", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		all := fs.Bool("all", false, "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return "", msg.Errorf("%v requires 1 argument. See help for usage.", "search")
+		}
+		searchtext := fs.Arg(0)
+
+		locations, err := v.Locations()
+		if err != nil {
+			return "", err
+		}
+		archived, err := archivedSet(v)
+		if err != nil {
+			return "", err
+		}
+		if *all {
+			archived = nil
+		}
+
+		printstring := ""
+		for _, location := range locations {
+			if !archived[location] && strings.Contains(location, searchtext) {
+				printstring += location + "\n"
+			}
+		}
+		return printstring, nil
+	}
+}
+
+func clip(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("clip", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		clipFor := fs.Duration("for", 0, "")
+		if err := fs.Parse(args); err != nil || fs.NArg() < 1 {
+			return "", msg.Errorf("%v requires at least 1 argument. See help for usage.", "clip")
+		}
+		args = fs.Args()
+		d, err := clipDuration(v, *clipFor)
+		if err != nil {
+			return "", err
+		}
+
+		location, cred, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+
+		toClip := cred.Password
+		clipLabel := credentialUsername(v, cred)
+		if len(args) > 1 {
+			meta := args[1]
+			metaname, metaval, err := v.FindMeta(location, meta)
+			if err != nil {
+				return "", err
+			}
+			toClip = metaval
+			clipLabel = metaname
+		}
+
+		err = secureclip.ClipFor(toClip, d)
+		if err != nil {
+			return "", err
+		}
+		v.RecordUse(location)
+
+		return fmt.Sprintf("%v@%v copied to clipboard, will clear in %v\n", clipLabel, location, describeClipTimeout(d)), nil
+	}
+}
+
+func totp(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) > 0 && args[0] == "import-qr" {
+			if len(args) != 2 && len(args) != 3 {
+				return "", msg.Errorf("%v requires 1 or 2 arguments. See help for usage.", "totp import-qr")
+			}
+			location := ""
+			if len(args) == 3 {
+				location = args[2]
+			}
+			return importTOTPQR(v, args[1], location)
+		}
+		if len(args) != 1 && len(args) != 2 {
+			return "", msg.Errorf("%v requires 1 or 2 arguments. See help for usage.", "totp")
+		}
+		if len(args) == 2 && args[1] != "clip" {
+			return "", msg.Errorf("%v must be one of %v. See help for usage.", "[clip]", "clip")
+		}
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+		code, remaining, err := v.GenerateTOTP(location)
+		if err != nil {
+			return "", err
+		}
+		v.RecordUse(location)
+		if len(args) == 2 {
+			// the code is useless once it expires, so clear it then
+			d := secureclip.Timeout()
+			if remaining < d {
+				d = remaining
+			}
+			if err := secureclip.ClipFor(code, d); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("code for %v copied to clipboard, will clear in %v\n", location, describeClipTimeout(d)), nil
+		}
+		if presenting() {
+			return "", errPresentation
+		}
+		return fmt.Sprintf("%v (valid for %v)\n", code, remaining), nil
+	}
+}
+
+// importTOTPQR reads the otpauth:// URI from the QR code in the image at
+// `path` and stores it as the TOTP secret of the credential at `location`,
+// adding the credential if it does not exist. If `location` is "", the
+// issuer named in the URI is used.
+func importTOTPQR(v *vault.Vault, path, location string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", msg.Errorf("could not read %v: %v", path, err)
+	}
+	uri, err := qr.Decode(img)
+	if err != nil {
+		return "", msg.Errorf("could not read a QR code from %v: %v", path, err)
+	}
+	issuer, account, err := vault.ParseOTPAuth(uri)
+	if err != nil {
+		return "", msg.Errorf("the QR code in %v is not a two-factor code: %v", path, err)
+	}
+	if location == "" {
+		if issuer == "" {
+			return "", msg.Errorf("the QR code in %v does not name its issuer, so give the location to store it at", path)
+		}
+		location = strings.ToLower(issuer)
+	}
+
+	cred, err := v.Get(location)
+	switch {
+	case err == vault.ErrNoSuchCredential:
+		err = v.Add(location, vault.Credential{Username: account, Meta: map[string]string{vault.TOTPMeta: uri}})
+	case err != nil:
+	case cred.TOTPSecret() != "":
+		return "", msg.Errorf("%v already has a TOTP secret", location)
+	default:
+		err = v.AddMeta(location, vault.TOTPMeta, uri)
+	}
+	if err != nil {
+		return "", err
+	}
+	shredded, err := offerShred(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("TOTP secret for %v stored at %v\n", account, location) + shredded, nil
+}
+
+// defaultPeekDuration is how long peek displays a password for if no
+// duration is provided.
+const defaultPeekDuration = 10 * time.Second
+
+func peek(v *vault.Vault, out io.Writer) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if presenting() {
+			return "", errPresentation
+		}
+		duration := defaultPeekDuration
+		if len(args) == 2 {
+			seconds, err := strconv.Atoi(args[1])
+			if err != nil || seconds <= 0 {
+				return "", msg.Errorf("peek duration must be a positive number of seconds")
+			}
+			duration = time.Duration(seconds) * time.Second
+		}
+
+		location, cred, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+
+		v.RecordUse(location)
+		lines := []string{
+			fmt.Sprintf("%v@%v: %v", credentialUsername(v, cred), location, cred.Password),
+			fmt.Sprintf("(hiding in %v, press any key to hide now)", duration),
+		}
+		for _, line := range lines {
+			fmt.Fprintln(out, line)
+		}
+
+		fd := int(os.Stdin.Fd())
+		if terminal.IsTerminal(fd) {
+			state, err := terminal.MakeRaw(fd)
+			if err != nil {
+				return "", err
+			}
+			_, err = waitForKey(duration)
+			terminal.Restore(fd, state)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			time.Sleep(duration)
+		}
+
+		// move up over the rows printed above, erasing each. A long
+		// password wraps onto more than one row.
+		width := 0
+		if fd := int(os.Stdout.Fd()); terminal.IsTerminal(fd) {
+			width, _, _ = terminal.GetSize(fd)
+		}
+		rows := 0
+		for _, line := range lines {
+			rows += terminalRows(line, width)
+		}
+		fmt.Fprint(out, "\r"+strings.Repeat("\033[1A\033[2K", rows))
+		return "", nil
+	}
+}
+
+// terminalRows returns how many rows `line` takes up on a terminal `width`
+// columns wide, once wrapped. A width of zero means it is not wrapped.
+func terminalRows(line string, width int) int {
+	w := runewidth.StringWidth(line)
+	if width <= 0 || w <= width {
+		return 1
+	}
+	return (w + width - 1) / width
+}
+
+func notes(v *vault.Vault, edit func(string) (string, error)) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if presenting() {
+			return "", errPresentation
+		}
+		location, cred, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+
+		edited, err := edit(cred.Notes)
+		if err != nil {
+			return "", err
+		}
+		if edited == cred.Notes {
+			return fmt.Sprintf("notes for %v unchanged\n", location), nil
+		}
+		if err := v.SetNotes(location, edited); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("notes for %v updated\n", location), nil
+	}
+}
+
+func setURL(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+		var u string
+		if len(args) == 2 {
+			u = args[1]
+		}
+		if err := v.SetURL(location, u); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("URL for %v updated\n", location), nil
+	}
+}
+
+func setEmail(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+		var email string
+		if len(args) == 2 {
+			email = args[1]
+		}
+		if err := v.SetEmail(location, email); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("email for %v updated\n", location), nil
+	}
+}
+
+func tag(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+		if err := v.Tag(location, args[1:]...); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tags for %v updated\n", location), nil
+	}
+}
+
+func untag(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+		if err := v.Untag(location, args[1:]...); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tags for %v updated\n", location), nil
+	}
+}
+
+func folder(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
+		}
+		var folder string
+		if len(args) == 2 {
+			folder = vault.CleanFolder(args[1])
+		}
+		if err := v.SetFolder(location, folder); err != nil {
+			return "", err
+		}
+		if folder == "" {
+			return fmt.Sprintf("%v moved to the top level\n", location), nil
+		}
+		return fmt.Sprintf("%v moved to %v\n", location, folder), nil
+	}
+}
 
-		vmerge, err := vault.Open(vaultPath, pass)
+func folders(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		folders, counts, err := v.Folders()
 		if err != nil {
 			return "", err
 		}
-		defer vmerge.Close()
+		if len(folders) == 0 {
+			return "no credentials are in folders\n", nil
+		}
+		var printstring string
+		for _, folder := range folders {
+			depth := strings.Count(folder, vault.FolderSeparator)
+			name := folder[strings.LastIndex(folder, vault.FolderSeparator)+1:]
+			printstring += fmt.Sprintf("%v%v/ (%v)\n", strings.Repeat("  ", depth), name, counts[folder])
+		}
+		return printstring, nil
+	}
+}
 
-		err = v.Merge(vmerge)
+func tags(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		tags, counts, err := v.Tags()
 		if err != nil {
 			return "", err
 		}
-		return "vault merged successfully.", nil
+		if len(tags) == 0 {
+			return "no credentials are tagged\n", nil
+		}
+		var printstring string
+		for _, tag := range tags {
+			printstring += fmt.Sprintf("%v (%v)\n", tag, counts[tag])
+		}
+		return printstring, nil
 	}
 }
 
-func changepassword(v *vault.Vault) repl.ActionFunc {
+func history(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		pass1, err := askPassword("Enter a new password for this vault: ")
+		location, _, err := v.Find(args[0])
 		if err != nil {
 			return "", err
 		}
-		pass2, err := askPassword("Again, please: ")
+		changes, err := v.History(location)
 		if err != nil {
 			return "", err
 		}
-
-		if pass1 != pass2 {
-			return "", fmt.Errorf("passwords did not match")
+		if len(changes) == 0 {
+			return fmt.Sprintf("%v has no previous passwords\n", location), nil
 		}
-
-		err = v.ChangePassphrase(pass1)
-		if err != nil {
-			return "", err
+		var printstring string
+		for i := len(changes) - 1; i >= 0; i-- {
+			printstring += fmt.Sprintf("%v  %v\n", changes[i].Replaced.Local().Format("2006-01-02 15:04"), displaySecret(changes[i].Password))
 		}
-
-		return "master password changed successfully\n", nil
+		return printstring, nil
 	}
 }
 
-func importcsv(v *vault.Vault) repl.ActionFunc {
+func icon(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 4 {
-			return "", fmt.Errorf("importcsv requires 4 arguments. See help for usage.")
-		}
-
-		filepath := args[0]
-		locationkey := args[1]
-		usernamekey := args[2]
-		passwordkey := args[3]
-
-		f, err := os.Open(filepath)
+		location, _, err := v.Find(args[1])
 		if err != nil {
 			return "", err
 		}
-		defer f.Close()
 
-		n, err := v.LoadCSV(f, locationkey, usernamekey, passwordkey)
+		var img []byte
+		switch args[0] {
+		case "fetch":
+			site := location
+			if len(args) == 3 {
+				site = args[2]
+			} else if cred, err := v.Get(location); err == nil && cred.SiteURL() != "" {
+				site = cred.SiteURL()
+			}
+			img, err = fetchFavicon(site)
+		case "file":
+			if len(args) != 3 {
+				return "", msg.Errorf("%v requires a path. See help for usage.", "icon file")
+			}
+			img, err = ioutil.ReadFile(args[2])
+		case "clear":
+		default:
+			return "", msg.Errorf("unknown icon action %v. See help for usage.", args[0])
+		}
 		if err != nil {
 			return "", err
 		}
 
-		return fmt.Sprintf("%v migrated successfully. %v locations imported.\n", filepath, n), nil
+		if err := v.SetIcon(location, img); err != nil {
+			return "", err
+		}
+		if img == nil {
+			return fmt.Sprintf("icon for %v removed\n", location), nil
+		}
+		return fmt.Sprintf("icon for %v updated (%v bytes)\n", location, len(img)), nil
 	}
 }
 
-func deletemeta(v *vault.Vault) repl.ActionFunc {
+func regen(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 2 {
-			return "", fmt.Errorf("deletemeta requires 2 arguments. See help for usage.")
-		}
-
-		location := args[0]
-		metaname := args[1]
-
-		err := v.DeleteMeta(location, metaname)
+		shape, err := v.Regenerate(args[0], 0)
 		if err != nil {
 			return "", err
 		}
-
-		return fmt.Sprintf("%v deleted from %v successfully.\n", metaname, location), nil
+		return fmt.Sprintf("%v regenerated: %v characters of %v. Copy it with clip, and the old password with get, to change it on the site.\n", args[0], shape.Length, shape.Describe()), nil
 	}
 }
 
-func deletelocation(v *vault.Vault) repl.ActionFunc {
+func edit(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 1 {
-			return "", fmt.Errorf("delete requires 1 argument. See help for usage.")
-		}
-
 		location := args[0]
+		credential := vault.Credential{
+			Username: args[1],
+			Password: args[2],
+		}
 
-		err := v.Delete(location)
+		err := v.Edit(location, credential)
 		if err != nil {
 			return "", err
 		}
-
-		return fmt.Sprintf("%v deleted successfully.\n", location), nil
+		return fmt.Sprintf("%v updated successfully\n", location), nil
 	}
 }
 
-func editmeta(v *vault.Vault) repl.ActionFunc {
+// errUsageNotTracked is returned when usage statistics are requested from a
+// vault that does not track them.
+var errUsageNotTracked = errors.New("this vault does not track usage. Turn it on with `trackusage on`")
+
+func list(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 3 {
-			return "", fmt.Errorf("editmeta requires 3 arguments. See help for usage.")
+		fs := flag.NewFlagSet("list", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		sortBy := fs.String("sort", "name", "")
+		all := fs.Bool("all", false, "")
+		tag := fs.String("tag", "", "")
+		folder := fs.String("folder", "", "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+			return "", msg.Errorf("list only accepts --all, --sort, --tag and --folder. See help for usage.")
 		}
-		location := args[0]
-		metaname := args[1]
-		metaval := args[2]
-
-		if err := v.EditMeta(location, metaname, metaval); err != nil {
+		archived, err := archivedSet(v)
+		if err != nil {
 			return "", err
 		}
-
-		return fmt.Sprintf("%v updated successfully.\n", metaname), nil
-	}
-}
-
-func addmeta(v *vault.Vault) repl.ActionFunc {
-	return func(args []string) (string, error) {
-		if len(args) != 3 {
-			return "", fmt.Errorf("addmeta requires 3 arguments. See help for usage.")
+		if *all {
+			archived = nil
+		}
+		var tagged map[string]bool
+		if *tag != "" {
+			if tagged, err = taggedSet(v, *tag); err != nil {
+				return "", err
+			}
+		}
+		var filed map[string]bool
+		if *folder != "" {
+			if filed, err = folderSet(v, *folder); err != nil {
+				return "", err
+			}
+		}
+		hidden := func(loc string) bool {
+			return archived[loc] || (tagged != nil && !tagged[loc]) || (filed != nil && !filed[loc])
+		}
+		if *sortBy == "name" {
+			locations, err := v.Locations()
+			if err != nil {
+				return "", err
+			}
+			printstring := "Locations stored in this vault: \n"
+			for _, loc := range locations {
+				if !hidden(loc) {
+					printstring += loc + "\n"
+				}
+			}
+			return printstring, nil
+		}
+		if *sortBy == "modified" {
+			locations, err := v.LocationsByModified()
+			if err != nil {
+				return "", err
+			}
+			printstring := "Locations stored in this vault: \n"
+			for _, loc := range locations {
+				if hidden(loc) {
+					continue
+				}
+				cred, err := v.Get(loc)
+				if err != nil {
+					return "", err
+				}
+				if cred.ModifiedAt.IsZero() {
+					printstring += fmt.Sprintf("%v (not changed recently)\n", loc)
+					continue
+				}
+				printstring += fmt.Sprintf("%v (changed %v)\n", loc, cred.ModifiedAt.Local().Format("2006-01-02 15:04"))
+			}
+			return printstring, nil
 		}
-		location := args[0]
-		metaname := args[1]
-		metaval := args[2]
 
-		if err := v.AddMeta(location, metaname, metaval); err != nil {
+		if *sortBy != "last-used" && *sortBy != "uses" {
+			return "", msg.Errorf("unknown sort order %v, expected name, modified, last-used or uses", *sortBy)
+		}
+		if !v.Settings().TrackUsage {
+			return "", errUsageNotTracked
+		}
+		locations, err := v.LocationsByLastUsed()
+		if err != nil {
 			return "", err
 		}
-
-		return fmt.Sprintf("%v added to %v successfully.\n", metaname, location), nil
+		uses := make(map[string]int)
+		lastUsed := make(map[string]time.Time)
+		err = v.Each(func(loc string, cred *vault.Credential) error {
+			uses[loc], lastUsed[loc] = cred.Usage()
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if *sortBy == "uses" {
+			sort.SliceStable(locations, func(i, j int) bool {
+				return uses[locations[i]] > uses[locations[j]]
+			})
+		}
+		printstring := "Locations stored in this vault: \n"
+		for _, loc := range locations {
+			if hidden(loc) {
+				continue
+			}
+			if lastUsed[loc].IsZero() {
+				printstring += fmt.Sprintf("%v (never used)\n", loc)
+				continue
+			}
+			printstring += fmt.Sprintf("%v (used %v times, last %v)\n", loc, uses[loc], lastUsed[loc].Local().Format("2006-01-02 15:04"))
+		}
+		return printstring, nil
 	}
 }
 
-func search(v *vault.Vault) repl.ActionFunc {
+func audit(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 1 {
-			return "", fmt.Errorf("search requires 1 argument. See help for usage.")
+		if len(args) == 1 && args[0] == "fix" {
+			return auditFix(v)
 		}
-		searchtext := args[0]
-
-		locations, err := v.Locations()
+		fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		staleAge := fs.String("stale", "", "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *staleAge == "" {
+			return "", msg.Errorf("%v requires --stale. See help for usage.", "audit")
+		}
+		age, err := parseDays(*staleAge)
 		if err != nil {
 			return "", err
 		}
-
-		printstring := ""
-		for _, location := range locations {
-			if strings.Contains(location, searchtext) {
-				printstring += location + "\n"
+		if !v.Settings().TrackUsage {
+			return "", errUsageNotTracked
+		}
+		stale, err := v.StaleCredentials(time.Now().Add(-age))
+		if err != nil {
+			return "", err
+		}
+		if len(stale) == 0 {
+			return fmt.Sprintf("every credential has been used in the last %v\n", *staleAge), nil
+		}
+		printstring := fmt.Sprintf("%v credentials not used in the last %v. Consider deleting them, or hiding them with archive:\n", len(stale), *staleAge)
+		for _, s := range stale {
+			if s.LastUsed.IsZero() {
+				printstring += fmt.Sprintf("%v (never used)\n", s.Location)
+				continue
 			}
+			printstring += fmt.Sprintf("%v (last used %v)\n", s.Location, s.LastUsed.Local().Format("2006-01-02"))
 		}
 		return printstring, nil
 	}
 }
 
-func clip(v *vault.Vault) repl.ActionFunc {
-	return func(args []string) (string, error) {
-		if len(args) < 1 {
-			return "", fmt.Errorf("clip requires at least 1 argument. See help for usage.")
+// describeIssue describes what is wrong with a credential's password.
+func describeIssue(issue vault.PasswordIssue) string {
+	var problems []string
+	if issue.RotationPending {
+		problems = append(problems, "replaced, but not yet confirmed changed on the site")
+	}
+	if issue.Weak() {
+		problems = append(problems, fmt.Sprintf("weak, about %.0f bits", issue.Strength))
+	}
+	if len(issue.ReusedAt) > 0 {
+		problems = append(problems, "also used at "+strings.Join(issue.ReusedAt, ", "))
+	}
+	return fmt.Sprintf("%v: %v", issue.Location, strings.Join(problems, "; "))
+}
+
+// currentIssue returns the issue with the password at `location`, or nil if
+// there is none.
+func currentIssue(v *vault.Vault, location string) (*vault.PasswordIssue, error) {
+	issues, err := v.PasswordIssues()
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		if issue.Location == location {
+			return &issue, nil
 		}
+	}
+	return nil, nil
+}
 
-		location, cred, err := v.Find(args[0])
+// auditFix walks through the credentials with weak or reused passwords,
+// offering to replace each one and helping change it on the site.
+func auditFix(v *vault.Vault) (string, error) {
+	issues, err := v.PasswordIssues()
+	if err != nil {
+		return "", err
+	}
+	if len(issues) == 0 {
+		return "no weak or reused passwords found\n", nil
+	}
+	fixed, pending := 0, 0
+	for i, found := range issues {
+		// fixing one credential can fix another that reused its password
+		issue, err := currentIssue(v, found.Location)
 		if err != nil {
 			return "", err
 		}
-
-		toClip := cred.Password
-		clipLabel := cred.Username
-		if len(args) > 1 {
-			meta := args[1]
-			metaname, metaval, err := v.FindMeta(location, meta)
+		if issue == nil {
+			fixed++
+			continue
+		}
+		fmt.Printf("[%v/%v] %v\n", i+1, len(issues), describeIssue(*issue))
+		if !issue.RotationPending {
+			ok, err := askYesNo("Generate a replacement?")
 			if err != nil {
 				return "", err
 			}
-			toClip = metaval
-			clipLabel = metaname
+			if !ok {
+				continue
+			}
+			shape, err := v.Regenerate(issue.Location, vault.WeakPasswordBits)
+			if err != nil {
+				return "", err
+			}
+			if err = v.SetRotationPending(issue.Location, true); err != nil {
+				return "", err
+			}
+			fmt.Printf("replaced with %v characters of %v. The old password is shown by get.\n", shape.Length, shape.Describe())
 		}
 
-		err = secureclip.Clip(toClip)
+		cred, err := v.Get(issue.Location)
 		if err != nil {
 			return "", err
 		}
-
-		return fmt.Sprintf("%v@%v copied to clipboard, will clear in 30 seconds\n", clipLabel, location), nil
+		if secureclip.Available() {
+			if err = secureclip.Clip(cred.Password); err != nil {
+				return "", err
+			}
+			fmt.Printf("new password copied to clipboard, will clear in %v\n", describeClipTimeout(secureclip.Timeout()))
+		}
+		if url := vault.ChangePasswordURL(issue.Location, cred); url != "" {
+			fmt.Printf("change it at %v\n", url)
+			if ok, err := askYesNo("Open it in your browser?"); err != nil {
+				return "", err
+			} else if ok {
+				if err = openBrowser(url); err != nil {
+					fmt.Println("could not open a browser:", err)
+				}
+			}
+		}
+		done, err := askYesNo("Changed it on the site?")
+		if err != nil {
+			return "", err
+		}
+		if !done {
+			pending++
+			continue
+		}
+		if err = v.SetRotationPending(issue.Location, false); err != nil {
+			return "", err
+		}
+		fixed++
 	}
+	printstring := fmt.Sprintf("%v of %v credentials fixed\n", fixed, len(issues))
+	if pending > 0 {
+		printstring += fmt.Sprintf("%v replacements are not yet changed on their sites. Run audit fix again to finish them.\n", pending)
+	}
+	return printstring, nil
 }
 
-func edit(v *vault.Vault) repl.ActionFunc {
+func archive(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 3 {
-			return "", fmt.Errorf("edit requires 3 arguments. See help for usage.")
+		location, _, err := v.Find(args[0])
+		if err != nil {
+			return "", err
 		}
-		location := args[0]
-		credential := vault.Credential{
-			Username: args[1],
-			Password: args[2],
+		if err = v.SetArchived(location, true); err != nil {
+			return "", err
 		}
+		return fmt.Sprintf("%v archived\n", location), nil
+	}
+}
 
-		err := v.Edit(location, credential)
+func unarchive(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		location, _, err := v.Find(args[0])
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("%v updated successfully\n", location), nil
+		if err = v.SetArchived(location, false); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v unarchived\n", location), nil
 	}
 }
 
-func list(v *vault.Vault) repl.ActionFunc {
+// archivedSet returns the set of archived locations in `v`.
+func archivedSet(v *vault.Vault) (map[string]bool, error) {
+	archived, err := v.ArchivedLocations()
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	for _, loc := range archived {
+		set[loc] = true
+	}
+	return set, nil
+}
+
+// folderSet returns the locations of the credentials in `v` filed in
+// `folder` or the folders nested inside it.
+func folderSet(v *vault.Vault, folder string) (map[string]bool, error) {
+	filed, err := v.LocationsInFolder(folder, true)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	for _, loc := range filed {
+		set[loc] = true
+	}
+	return set, nil
+}
+
+// taggedSet returns the locations of the credentials in `v` tagged with
+// `tag`.
+func taggedSet(v *vault.Vault, tag string) (map[string]bool, error) {
+	tagged, err := v.Locations(tag)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	for _, loc := range tagged {
+		set[loc] = true
+	}
+	return set, nil
+}
+
+func trackusage(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if err := v.SetTrackUsage(args[0] == "on"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("usage tracking turned %v\n", args[0]), nil
+	}
+}
+
+func save(v *vault.Vault, savePath string) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if err := v.Save(savePath); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v saved successfully.\n", savePath) + sizeWarning(v), nil
+	}
+}
+
+// sizeWarning returns a warning if `v` is larger than its size warning
+// threshold, or "" if it is not.
+func sizeWarning(v *vault.Vault) string {
+	if !v.TooLarge() {
+		return ""
+	}
+	return fmt.Sprintf("warning: the vault is %v bytes, larger than the %v byte threshold. The whole vault is decrypted into memory on every access; see status --sizes for the largest credentials.\n", v.Size(), v.SizeWarning())
+}
+
+func status(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
+		fs := flag.NewFlagSet("status", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		sizes := fs.Bool("sizes", false, "")
+		top := fs.Int("top", 10, "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *top <= 0 {
+			return "", msg.Errorf("status only accepts --sizes and a positive --top. See help for usage.")
+		}
 		locations, err := v.Locations()
 		if err != nil {
 			return "", err
 		}
-		printstring := "Locations stored in this vault: \n"
-		for _, loc := range locations {
-			printstring += loc + "\n"
+		printstring := fmt.Sprintf("%v credentials, %v bytes encrypted (warning threshold %v bytes)\n", len(locations), v.Size(), v.SizeWarning())
+		printstring += sizeWarning(v)
+		if !*sizes {
+			return printstring, nil
+		}
+		largest, err := v.LargestEntries(*top)
+		if err != nil {
+			return "", err
+		}
+		printstring += "Largest credentials:\n"
+		for _, entry := range largest {
+			printstring += fmt.Sprintf("%v: %v bytes\n", entry.Location, entry.Bytes)
 		}
 		return printstring, nil
 	}
 }
 
-func save(v *vault.Vault, savePath string) repl.ActionFunc {
+func sizewarning(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if err := v.Save(savePath); err != nil {
+		if len(args) == 0 {
+			return fmt.Sprintf("size warning threshold: %v bytes\n", v.SizeWarning()), nil
+		}
+		mib, err := strconv.ParseUint(args[0], 10, 20)
+		if err != nil {
+			return "", msg.Errorf("size must be a number of MiB")
+		}
+		settings := v.Settings()
+		settings.SizeWarning = int(mib) << 20
+		if err = v.SetSettings(settings); err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("%v saved successfully.\n", savePath), nil
+		return fmt.Sprintf("size warning threshold set to %v bytes\n", v.SizeWarning()) + sizeWarning(v), nil
 	}
 }
 
 func get(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
+		asJSON := false
+		if len(args) == 2 && args[1] == "--json" {
+			asJSON = true
+			args = args[:1]
+		}
 		if len(args) == 0 {
-			return "", fmt.Errorf("get requires at least one argument. See help for usage.")
+			return "", msg.Errorf("%v requires at least one argument. See help for usage.", "get")
+		}
+		if asJSON && presenting() {
+			return "", errPresentation
 		}
-		_, cred, err := v.Find(args[0])
+		location, cred, err := v.Find(args[0])
 		if err != nil {
 			return "", err
 		}
+		v.RecordUse(location)
+
+		if asJSON {
+			bs, err := vault.MarshalEntry(location, cred)
+			if err != nil {
+				return "", err
+			}
+			return string(bs) + "\n", nil
+		}
 
-		printstring := fmt.Sprintf("Username: %v\nPassword: %v\n", cred.Username, cred.Password)
+		printstring := fmt.Sprintf("Username: %v\nPassword: %v\n", credentialUsername(v, cred), displaySecret(cred.Password))
+		if previous := cred.PreviousPassword(); previous != "" {
+			printstring += fmt.Sprintf("Previous password: %v\n", displaySecret(previous))
+		}
+		if cred.Folder != "" {
+			printstring += fmt.Sprintf("Folder: %v\n", cred.Folder)
+		}
+		if len(cred.Tags) > 0 {
+			printstring += fmt.Sprintf("Tags: %v\n", strings.Join(cred.Tags, ", "))
+		}
+		if cred.URL != "" {
+			printstring += fmt.Sprintf("URL: %v\n", cred.URL)
+		}
+		if cred.Email != "" {
+			printstring += fmt.Sprintf("Email: %v\n", displayUsername(cred.Email))
+		}
+		if cred.Notes != "" {
+			printstring += fmt.Sprintf("Notes:\n%v\n", displaySecret(strings.TrimRight(cred.Notes, "\n")))
+		}
 
-		if len(cred.Meta) > 0 {
-			for metaname, metaval := range cred.Meta {
-				printstring += fmt.Sprintf("%v: %v\n", metaname, metaval)
+		if meta := cred.UserMeta(); len(meta) > 0 {
+			for metaname, metaval := range meta {
+				printstring += fmt.Sprintf("%v: %v\n", metaname, displaySecret(metaval))
 			}
 		}
 
@@ -395,8 +2498,11 @@ func get(v *vault.Vault) repl.ActionFunc {
 
 func add(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
+		if len(args) == 2 && args[0] == "--from-json" {
+			return addFromJSON(v, args[1])
+		}
 		if len(args) != 3 {
-			return "", fmt.Errorf("add requires at least three arguments. See help for usage.")
+			return "", msg.Errorf("%v requires at least three arguments. See help for usage.", "add")
 		}
 		location := args[0]
 		username := args[1]
@@ -413,16 +2519,47 @@ func add(v *vault.Vault) repl.ActionFunc {
 	}
 }
 
+// addFromJSON adds the credential described by the JSON file at `path`.
+func addFromJSON(v *vault.Vault, path string) (string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	location, cred, err := vault.UnmarshalEntry(bs)
+	if err != nil {
+		return "", msg.Errorf("could not read %v: %v", path, err)
+	}
+	if err = v.Add(location, cred); err != nil {
+		return "", err
+	}
+	shredded, err := offerShred(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v added successfully\n", location) + shredded, nil
+}
+
 func gen(v *vault.Vault) repl.ActionFunc {
 	return func(args []string) (string, error) {
-		if len(args) != 2 {
-			return "", fmt.Errorf("gen requires two arguments. See help for usage.")
+		fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		symbols := fs.Bool("symbols", false, "")
+		exclude := fs.String("exclude", "", "")
+		noSymbolsFrom := fs.String("no-symbols-from", "", "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+			return "", msg.Errorf("%v requires two arguments. See help for usage.", "gen")
 		}
 
-		location := args[0]
-		username := args[1]
+		location := fs.Arg(0)
+		username := fs.Arg(1)
+
+		charset := pwgen.CharsetAlphaNum
+		if *symbols || *noSymbolsFrom != "" {
+			charset = pwgen.Union(charset, pwgen.Exclude(pwgen.CharsetSymbols, *noSymbolsFrom))
+		}
+		charset = pwgen.Exclude(charset, *exclude)
 
-		if err := v.Generate(location, username); err != nil {
+		if err := v.GenerateFrom(location, username, charset); err != nil {
 			return "", err
 		}
 
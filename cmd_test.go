@@ -1,14 +1,34 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/atotto/clipboard"
+	"github.com/avahowell/masterkey/repltest"
+	"github.com/avahowell/masterkey/secureclip"
 	"github.com/avahowell/masterkey/vault"
 )
 
+// tempVaultPath returns a vault path inside a fresh temporary directory and
+// a function that removes it.
+func tempVaultPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "masterkey-vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "testvault"), func() { os.RemoveAll(dir) }
+}
+
 func TestListCommand(t *testing.T) {
 	v, err := vault.New("testpass")
 	if err != nil {
@@ -118,6 +138,20 @@ func TestGenCommand(t *testing.T) {
 	if cred.Password == "" {
 		t.Fatal("gencmd did not generate a password")
 	}
+
+	if _, err = gencmd([]string{"--no-symbols-from", `"'\`, "--exclude", "O0l1I", "symbols", "testusername"}); err != nil {
+		t.Fatal(err)
+	}
+	cred, err = v.Get("symbols")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(cred.Password, `"'\0l1`) {
+		t.Fatal("gen used an excluded character:", cred.Password)
+	}
+	if _, err = gencmd([]string{"--exclude", "abcdefghijklmnopqrstuvwxyz0123456789", "empty", "testusername"}); err == nil {
+		t.Fatal("expected gen to fail when every character is excluded")
+	}
 }
 
 func TestSaveCommand(t *testing.T) {
@@ -126,7 +160,9 @@ func TestSaveCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	savecmd := save(v, "testvault")
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	savecmd := save(v, path)
 
 	testcredential := vault.Credential{Username: "testuser", Password: "testpass"}
 
@@ -139,11 +175,11 @@ func TestSaveCommand(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if res != "testvault saved successfully.\n" {
+	if res != path+" saved successfully.\n" {
 		t.Fatal("expected save command to save successfully")
 	}
 
-	vopen, err := vault.Open("testvault", "testpass")
+	vopen, err := vault.Open(path, "testpass")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -153,6 +189,8 @@ func TestSaveCommand(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	cred.ID = ""
+	cred.CreatedAt, cred.ModifiedAt = time.Time{}, time.Time{}
 	if !reflect.DeepEqual(cred, &testcredential) {
 		t.Fatalf("expected on-disk vault to have test credential after save cmd, wanted %v got %v\n", testcredential, cred)
 	}
@@ -164,7 +202,7 @@ func TestEditCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	editcmd := edit(v)
+	editcmd := editCmd(v).Run
 
 	_, err = editcmd([]string{"testlocation"})
 	if err == nil {
@@ -199,9 +237,12 @@ func TestClipCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	clipcmd := clip(v)
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
 
-	_, err = clipcmd([]string{})
+	_, err = d.Send("clip")
 	if err == nil {
 		t.Fatal("clipcmd should return an error with no args")
 	}
@@ -211,19 +252,14 @@ func TestClipCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	res, err := clipcmd([]string{"testlocation"})
+	res, err := d.Send("clip testlocation")
 	if err != nil {
 		t.Fatal(err)
 	}
 	if res != "testuser@testlocation copied to clipboard, will clear in 30 seconds\n" {
 		t.Fatal("clip command should return success string")
 	}
-
-	clipcontents, err := clipboard.ReadAll()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if clipcontents != "testpass" {
+	if d.Clipboard.Contents() != "testpass" {
 		t.Fatal("clip command did not copy the passphrase into the clipboard")
 	}
 
@@ -232,19 +268,14 @@ func TestClipCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	res, err = clipcmd([]string{"testlocation", "test"})
+	res, err = d.Send("clip testlocation test")
 	if err != nil {
 		t.Fatal(err)
 	}
 	if res != "test@testlocation copied to clipboard, will clear in 30 seconds\n" {
 		t.Fatal("clip command should return success string")
 	}
-
-	clipcontents, err = clipboard.ReadAll()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if clipcontents != "test1" {
+	if d.Clipboard.Contents() != "test1" {
 		t.Fatal("clip command did not copy the metadata into the clipboard")
 	}
 }
@@ -259,7 +290,7 @@ func TestAddMetaCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	addmetacmd := addmeta(v)
+	addmetacmd := addmetaCmd(v).Run
 	_, err = addmetacmd([]string{})
 	if err == nil {
 		t.Fatal("expected add meta command to return an error with no args")
@@ -295,7 +326,7 @@ func TestEditMetaCommand(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	editmetacmd := editmeta(v)
+	editmetacmd := editmetaCmd(v).Run
 	_, err = editmetacmd([]string{})
 	if err == nil {
 		t.Fatal("expected edit meta command to return an error with no args")
@@ -396,13 +427,140 @@ func TestDeleteCommand(t *testing.T) {
 	}
 }
 
+func TestRenameCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("testlocation", vault.Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = renameCmd(v).Run([]string{"testlocation"}); err == nil {
+		t.Fatal("rename accepted a single argument")
+	}
+	res, err := renameCmd(v).Run([]string{"testlocation", "newlocation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "testlocation renamed to newlocation\n" {
+		t.Fatal("unexpected output:", res)
+	}
+	if cred, err := v.Get("newlocation"); err != nil || cred.Password != "testpass" {
+		t.Fatal("the credential was not renamed:", err)
+	}
+}
+
+func TestCopyCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("testlocation", vault.Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := copyCmd(v).Run([]string{"testlocation", "newlocation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "testlocation copied to newlocation\n" {
+		t.Fatal("unexpected output:", res)
+	}
+	for _, location := range []string{"testlocation", "newlocation"} {
+		if cred, err := v.Get(location); err != nil || cred.Password != "testpass" {
+			t.Fatal("expected a credential at", location, err)
+		}
+	}
+}
+
+func TestBulkEditCommand(t *testing.T) {
+	oldAsk := askYesNo
+	defer func() { askYesNo = oldAsk }()
+	confirm := true
+	askYesNo = func(string) (bool, error) { return confirm, nil }
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, location := range []string{"work.example.com", "home.example.com"} {
+		if err = v.Add(location, vault.Credential{Username: "user", Password: "secret"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var shown string
+	edit := func(replace string) func(string) (string, error) {
+		return func(text string) (string, error) {
+			shown = text
+			return strings.Replace(text, "tags: []", replace, 1), nil
+		}
+	}
+	if _, err = bulkedit(v, edit("tags: [work]"))([]string{"nothing"}); err != vault.ErrNoSuchCredential {
+		t.Fatal("expected ErrNoSuchCredential, got", err)
+	}
+	res, err := bulkedit(v, edit("tags: [work]"))([]string{"work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "1 credentials changed\n" || strings.Contains(shown, "secret") || strings.Contains(shown, "home") {
+		t.Fatalf("unexpected bulkedit result %q, edited %q", res, shown)
+	}
+	if locations, _ := v.Locations("work"); len(locations) != 1 || locations[0] != "work.example.com" {
+		t.Fatal("bulkedit did not tag the credential:", locations)
+	}
+	if _, err = bulkedit(v, edit("tags: [has space]"))([]string{"home"}); err == nil {
+		t.Fatal("bulkedit applied an invalid tag")
+	}
+	confirm = false
+	if res, err = bulkedit(v, edit("tags: [home]"))([]string{"home"}); err != nil || res != "changes discarded\n" {
+		t.Fatal("unexpected result declining bulkedit:", res, err)
+	}
+	if locations, _ := v.Locations("home"); len(locations) != 0 {
+		t.Fatal("declined changes were made")
+	}
+
+	dir, err := ioutil.TempDir("", "masterkey-yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.yaml")
+	if res, err = exportyaml(v)([]string{"--tag", "work", path}); err != nil || res != fmt.Sprintf("exported 1 credentials to %v\n", path) {
+		t.Fatal("unexpected exportyaml result:", res, err)
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs = []byte(strings.Replace(string(bs), "notes: \"\"", "notes: rotated yearly", 1))
+	if err = ioutil.WriteFile(path, bs, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = importyaml(v)([]string{"--dry-run", path}); err != nil || !strings.HasPrefix(res, "work.example.com: notes\n") {
+		t.Fatal("unexpected importyaml --dry-run result:", res, err)
+	}
+	if cred, _ := v.Get("work.example.com"); cred.Notes != "" {
+		t.Fatal("importyaml --dry-run changed the credential")
+	}
+	if _, err = importyaml(v)([]string{path}); err != nil {
+		t.Fatal(err)
+	}
+	if cred, _ := v.Get("work.example.com"); cred.Notes != "rotated yearly" || cred.Password != "secret" {
+		t.Fatalf("unexpected credential after importyaml: %+v", cred)
+	}
+}
+
 func TestDeleteMetaCommand(t *testing.T) {
 	v, err := vault.New("testpass")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	deletemetacmd := deletemeta(v)
+	deletemetacmd := deletemetaCmd(v).Run
 
 	_, err = deletemetacmd([]string{})
 	if err == nil {
@@ -453,79 +611,1341 @@ func TestFuzzyClip(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = clip(v)([]string{"gibs"})
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	for search, expected := range map[string]string{
+		"gibs": "testpassword2",
+		"acid": "testpassword1",
+		"beef": "testpassword0",
+	} {
+		_, err = d.Send("clip " + search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Clipboard.Contents() != expected {
+			t.Fatal("clip did not copy using an incomplete search string")
+		}
+	}
+}
+
+func TestFuzzyGet(t *testing.T) {
+	v, err := vault.New("testpass")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	clipcontents, err := clipboard.ReadAll()
+	err = v.Add("deadbeef", vault.Credential{Username: "testuser0", Password: "testpassword0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Add("acidburn", vault.Credential{Username: "testuser1", Password: "testpassword1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Add("gibson", vault.Credential{Username: "testuser2", Password: "testpassword2"})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if clipcontents != "testpassword2" {
-		t.Fatal("clip did not copy using an incomplete search string")
+	_, err = get(v)([]string{"gibs"})
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	_, err = clip(v)([]string{"acid"})
+	_, err = get(v)([]string{"acid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = get(v)([]string{"beef"})
 	if err != nil {
 		t.Fatal(err)
 	}
+}
 
-	clipcontents, err = clipboard.ReadAll()
+func TestDeleteMatchCommand(t *testing.T) {
+	v, err := vault.New("testpass")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if clipcontents != "testpassword1" {
-		t.Fatal("clip did not copy using an incomplete search string")
+	for _, loc := range []string{"work/github", "work/gitlab", "personal/github"} {
+		err = v.Add(loc, vault.Credential{Username: "testuser", Password: "testpass"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldAsk := askYesNo
+	defer func() { askYesNo = oldAsk }()
+	confirm := false
+	asked := 0
+	askYesNo = func(string) (bool, error) {
+		asked++
+		return confirm, nil
+	}
+
+	deletecmd := deletelocation(v)
+	_, err = deletecmd([]string{"--match", "nonexistent"})
+	if err != vault.ErrNoSuchCredential {
+		t.Fatal("expected delete --match with no matches to return ErrNoSuchCredential")
+	}
+	if _, err = deletecmd([]string{"--match", ""}); err == nil {
+		t.Fatal("expected delete --match with empty search text to fail")
+	}
+
+	res, err := deletecmd([]string{"--match", "work/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "nothing deleted\n" || asked != 1 {
+		t.Fatal("expected declining delete --match to delete nothing:", res, asked)
 	}
 
-	_, err = clip(v)([]string{"beef"})
+	confirm = true
+	res, err = deletecmd([]string{"--match", "work/"})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if res != "work/github deleted successfully.\nwork/gitlab deleted successfully.\n" {
+		t.Fatal("unexpected output from delete --match:", res)
+	}
 
-	clipcontents, err = clipboard.ReadAll()
+	locations, err := v.Locations()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !reflect.DeepEqual(locations, []string{"personal/github"}) {
+		t.Fatal("delete --match removed the wrong locations:", locations)
+	}
 
-	if clipcontents != "testpassword0" {
-		t.Fatal("clip did not copy using an incomplete search string")
+	asked = 0
+	if _, err = deletecmd([]string{"--match", "personal/"}); err != nil {
+		t.Fatal(err)
+	}
+	if asked != 0 {
+		t.Fatal("expected delete --match with one match not to ask for confirmation")
 	}
 }
 
-func TestFuzzyGet(t *testing.T) {
+func TestPeekCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Add("testlocation", vault.Credential{Username: "testuser", Password: "testpass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	cmd := peekCmd(v)
+	cmd.Action = peek(v, &out)
+	peekcmd := cmd.Run
+	if _, err = peekcmd([]string{}); err == nil {
+		t.Fatal("expected peek to fail with no args")
+	}
+	if _, err = peekcmd([]string{"testlocation", "notanumber"}); err == nil {
+		t.Fatal("expected peek to fail with an invalid duration")
+	}
+
+	res, err := peekcmd([]string{"testloc", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "" {
+		t.Fatal("peek should print directly to the terminal, not return the password")
+	}
+	if !strings.HasPrefix(out.String(), "testuser@testlocation: testpass\n") {
+		t.Fatal("peek did not print the password:", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "\033[1A\033[2K\033[1A\033[2K") {
+		t.Fatal("peek did not erase the password after the timeout")
+	}
+
+	if _, err = maskusername(v)([]string{"testlocation", "on"}); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if _, err = peekcmd([]string{"testlocation", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "t******r@testlocation: testpass\n") {
+		t.Fatal("peek did not mask a sensitive username:", out.String())
+	}
+}
+
+func TestTerminalRows(t *testing.T) {
+	tests := []struct {
+		line  string
+		width int
+		rows  int
+	}{
+		{"short", 80, 1},
+		{"", 80, 1},
+		{strings.Repeat("x", 80), 80, 1},
+		{strings.Repeat("x", 81), 80, 2},
+		{strings.Repeat("x", 200), 80, 3},
+		{strings.Repeat("x", 200), 0, 1},
+		{strings.Repeat("世", 50), 80, 2},
+	}
+	for _, test := range tests {
+		if rows := terminalRows(test.line, test.width); rows != test.rows {
+			t.Fatalf("terminalRows(%q, %v) = %v, wanted %v", test.line, test.width, rows, test.rows)
+		}
+	}
+}
+
+func TestLocationRulesCommand(t *testing.T) {
 	v, err := vault.New("testpass")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = v.Add("deadbeef", vault.Credential{Username: "testuser0", Password: "testpassword0"})
+	rules := locationrules(v)
+	res, err := rules([]string{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = v.Add("acidburn", vault.Credential{Username: "testuser1", Password: "testpassword1"})
+	if res != "max location length: 256\nlowercase hosts: off\n" {
+		t.Fatalf("unexpected default rules: %q", res)
+	}
+
+	if _, err = rules([]string{"10"}); err == nil {
+		t.Fatal("locationrules should require both arguments")
+	}
+	if _, err = rules([]string{"10", "on"}); err != nil {
+		t.Fatal(err)
+	}
+	settings := v.Settings()
+	if settings.MaxLocationLength != 10 || !settings.NormalizeHostnames {
+		t.Fatal("locationrules did not update the vault settings")
+	}
+
+	if _, err = add(v)([]string{"a very long location", "user", "pass"}); err != vault.ErrLocationTooLong {
+		t.Fatal("expected ErrLocationTooLong, got", err)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	v, err := vault.New("testpass")
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = v.Add("gibson", vault.Credential{Username: "testuser2", Password: "testpassword2"})
+	if err = v.Add("testlocation", vault.Credential{Username: "user", Password: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	historycmd := historyCmd(v).Run
+	if _, err = historycmd([]string{}); err == nil {
+		t.Fatal("history should return an error with no args")
+	}
+	res, err := historycmd([]string{"testloc"})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if res != "testlocation has no previous passwords\n" {
+		t.Fatalf("unexpected history result %q", res)
+	}
 
-	_, err = get(v)([]string{"gibs"})
+	for _, password := range []string{"second", "third"} {
+		if err = v.Edit("testlocation", vault.Credential{Username: "user", Password: password}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err = historycmd([]string{"testlocation"})
 	if err != nil {
 		t.Fatal(err)
 	}
+	lines := strings.Split(strings.TrimSuffix(res, "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "  second") || !strings.HasSuffix(lines[1], "  first") {
+		t.Fatalf("history should list the previous passwords newest first: %q", res)
+	}
+	if _, err = historycmd([]string{"nonexistent"}); err == nil {
+		t.Fatal("history should return an error for a nonexistent location")
+	}
+}
 
-	_, err = get(v)([]string{"acid"})
+func TestURLEmailCommand(t *testing.T) {
+	v, err := vault.New("testpass")
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = get(v)([]string{"beef"})
+	if err = v.Add("testlocation", vault.Credential{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	urlcmd := urlCmd(v).Run
+	emailcmd := emailCmd(v).Run
+	if _, err = urlcmd([]string{}); err == nil {
+		t.Fatal("url should return an error with no args")
+	}
+	if _, err = urlcmd([]string{"testlocation", "not a url"}); err != vault.ErrInvalidURL {
+		t.Fatal("expected ErrInvalidURL, got", err)
+	}
+	if _, err = emailcmd([]string{"testlocation", "not an address"}); err != vault.ErrInvalidEmail {
+		t.Fatal("expected ErrInvalidEmail, got", err)
+	}
+	res, err := urlcmd([]string{"testloc", "https://example.com/login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "URL for testlocation updated\n" {
+		t.Fatalf("unexpected url result %q", res)
+	}
+	if _, err = emailcmd([]string{"testlocation", "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = getCmd(v).Run([]string{"testlocation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "URL: https://example.com/login\n") || !strings.Contains(res, "Email: alice@example.com\n") {
+		t.Fatalf("get should print the URL and email: %q", res)
+	}
+
+	if _, err = urlcmd([]string{"testlocation"}); err != nil {
+		t.Fatal(err)
+	}
+	if cred, _ := v.Get("testlocation"); cred.URL != "" {
+		t.Fatal("url with no value should clear the URL")
+	}
+}
+
+func TestTagCommands(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, location := range []string{"github.com", "gitlab.com", "chase.com"} {
+		if err = v.Add(location, vault.Credential{Username: "user", Password: "pass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tagcmd := tagCmd(v).Run
+	if _, err = tagcmd([]string{"github.com"}); err == nil {
+		t.Fatal("tag should require at least one tag")
+	}
+	if _, err = tagcmd([]string{"github", "work", "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tagcmd([]string{"gitlab", "work"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.SetArchived("gitlab.com", true); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := listCmd(v).Run([]string{"--tag=work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "Locations stored in this vault: \ngithub.com\n" {
+		t.Fatalf("list --tag should list only unarchived credentials with the tag: %q", res)
+	}
+	if res, err = listCmd(v).Run([]string{"--tag=work", "--all"}); err != nil || res != "Locations stored in this vault: \ngithub.com\ngitlab.com\n" {
+		t.Fatalf("list --tag --all should include archived credentials: %q %v", res, err)
+	}
+
+	res, err = tagsCmd(v).Run(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "dev (1)\nwork (2)\n" {
+		t.Fatalf("unexpected tags result %q", res)
+	}
+	if res, err = getCmd(v).Run([]string{"github.com"}); err != nil || !strings.Contains(res, "Tags: dev, work\n") {
+		t.Fatalf("get should print the tags: %q %v", res, err)
+	}
+
+	if _, err = untagCmd(v).Run([]string{"github.com", "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	if cred, _ := v.Get("github.com"); !reflect.DeepEqual(cred.Tags, []string{"work"}) {
+		t.Fatal("untag did not remove the tag:", cred.Tags)
+	}
+}
+
+func TestFolderCommands(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, location := range []string{"aws-prod", "github.com", "chase.com"} {
+		if err = v.Add(location, vault.Credential{Username: "user", Password: "pass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	foldercmd := folderCmd(v).Run
+	res, err := foldercmd([]string{"aws-prod", "work/aws/prod"})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if res != "aws-prod moved to work/aws/prod\n" {
+		t.Fatalf("unexpected folder result %q", res)
+	}
+	if _, err = foldercmd([]string{"github", "work"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err = foldersCmd(v).Run(nil); err != nil {
+		t.Fatal(err)
+	}
+	if res != "work/ (2)\n  aws/ (1)\n    prod/ (1)\n" {
+		t.Fatalf("unexpected folders result %q", res)
+	}
+	if res, err = listCmd(v).Run([]string{"--folder=work"}); err != nil || res != "Locations stored in this vault: \naws-prod\ngithub.com\n" {
+		t.Fatalf("list --folder should list the credentials in the folder and its folders: %q %v", res, err)
+	}
+	if res, err = getCmd(v).Run([]string{"aws-prod"}); err != nil || !strings.Contains(res, "Folder: work/aws/prod\n") {
+		t.Fatalf("get should print the folder: %q %v", res, err)
+	}
+
+	if res, err = foldercmd([]string{"aws-prod"}); err != nil || res != "aws-prod moved to the top level\n" {
+		t.Fatalf("folder with no folder should move to the top level: %q %v", res, err)
+	}
+}
+
+func TestTOTPCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("github.com", vault.Credential{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	totpcmd := totpCmd(v).Run
+	if _, err = totpcmd([]string{"github.com"}); err != vault.ErrNoTOTP {
+		t.Fatal("expected ErrNoTOTP, got", err)
+	}
+	if _, err = totpcmd([]string{"github.com", "paste"}); err == nil {
+		t.Fatal("totp should only accept clip as its second argument")
+	}
+	if err = v.AddMeta("github.com", vault.TOTPMeta, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := totpcmd([]string{"github"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) < 6 || strings.Trim(res[:6], "0123456789") != "" || !strings.HasPrefix(res[6:], " (valid for ") {
+		t.Fatalf("unexpected totp output %q", res)
+	}
+
+	board := &secureclip.MemoryClipboard{}
+	secureclip.SetClipboard(board)
+	defer secureclip.SetClipboard(nil)
+	if res, err = totpcmd([]string{"github.com", "clip"}); err != nil {
+		t.Fatal(err)
+	}
+	if code := board.Contents(); len(code) != 6 || !strings.HasPrefix(res, "code for github.com copied to clipboard") {
+		t.Fatalf("unexpected totp clip result %q, clipboard %q", res, code)
+	}
+}
+
+func TestTOTPImportQR(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-totp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	screenshot, err := ioutil.ReadFile(filepath.Join("testdata", "otpauth.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldAsk := askYesNo
+	defer func() { askYesNo = oldAsk }()
+	askYesNo = func(string) (bool, error) { return true, nil }
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("github.com", vault.Credential{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	totpcmd := totpCmd(v).Run
+	if _, err = totpcmd([]string{"import-qr"}); err == nil {
+		t.Fatal("import-qr should require an image")
+	}
+
+	// the code names Example as its issuer and alice@example.com as its
+	// account
+	for _, test := range []struct {
+		args     []string
+		location string
+		username string
+	}{
+		{nil, "example", "alice@example.com"},
+		{[]string{"github.com"}, "github.com", "user"},
+	} {
+		path := filepath.Join(dir, "otpauth.png")
+		if err = ioutil.WriteFile(path, screenshot, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = totpcmd(append([]string{"import-qr", path}, test.args...)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Fatal("import-qr did not delete the screenshot")
+		}
+		cred, err := v.Get(test.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cred.Username != test.username || !strings.Contains(cred.TOTPSecret(), "secret=JBSWY3DPEHPK3PXP") {
+			t.Fatalf("unexpected credential at %v: %+v", test.location, cred)
+		}
+		if _, _, err = v.GenerateTOTP(test.location); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a secret is not replaced
+	path := filepath.Join(dir, "again.png")
+	if err = ioutil.WriteFile(path, screenshot, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = totpcmd([]string{"import-qr", path, "github.com"}); err == nil {
+		t.Fatal("import-qr replaced an existing TOTP secret")
+	}
+}
+
+func TestNotesCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("testlocation", vault.Credential{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var edited string
+	cmd := notesCmd(v)
+	cmd.Action = notes(v, func(text string) (string, error) {
+		edited = text
+		return "line one\nline two\n", nil
+	})
+	notescmd := cmd.Run
+	if _, err = notescmd([]string{}); err == nil {
+		t.Fatal("notes should return an error with no args")
+	}
+	res, err := notescmd([]string{"testloc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "notes for testlocation updated\n" || edited != "" {
+		t.Fatal("unexpected notes result", res)
+	}
+
+	res, err = get(v)([]string{"testlocation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "Username: user\nPassword: pass\nNotes:\nline one\nline two\n" {
+		t.Fatalf("get did not show notes: %q", res)
+	}
+
+	if _, err = notescmd([]string{"testlocation"}); err != nil {
+		t.Fatal(err)
+	}
+	if edited != "line one\nline two\n" {
+		t.Fatal("editor was not given the existing notes")
+	}
+}
+
+func TestIconCommand(t *testing.T) {
+	png := []byte("\x89PNG\x0d\x0a\x1a\x0a\x00\x00\x00\x0dIHDR")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/favicon.ico" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(png)
+	}))
+	defer srv.Close()
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("testlocation", vault.Credential{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	iconcmd := iconCmd(v).Run
+	if _, err = iconcmd([]string{"fetch"}); err == nil {
+		t.Fatal("icon should return an error with too few args")
+	}
+	res, err := iconcmd([]string{"fetch", "testloc", srv.URL + "/login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != fmt.Sprintf("icon for testlocation updated (%v bytes)\n", len(png)) {
+		t.Fatal("unexpected icon result", res)
+	}
+	cred, err := v.Get("testlocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cred.Icon, png) {
+		t.Fatal("icon fetch did not store the favicon")
+	}
+
+	if _, err = iconcmd([]string{"clear", "testlocation"}); err != nil {
+		t.Fatal(err)
+	}
+	cred, err = v.Get("testlocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Icon != nil {
+		t.Fatal("icon clear did not remove the icon")
+	}
+}
+
+func TestImportOffersShred(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldAsk := askYesNo
+	defer func() { askYesNo = oldAsk }()
+	oldTracker := plaintextFiles
+	defer func() { plaintextFiles = oldTracker }()
+	plaintextFiles = new(plaintextTracker)
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := "Title,URL,Username,Password\nsite%v,https://example.com,user,pass\n"
+	for i, shred := range []bool{true, false} {
+		path := filepath.Join(dir, fmt.Sprintf("export%v.csv", i))
+		if err = ioutil.WriteFile(path, []byte(fmt.Sprintf(export, i)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		askYesNo = func(string) (bool, error) { return shred, nil }
+
+		if _, err = importformat(v)(context.Background(), []string{"apple", path}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = os.Stat(path)
+		if shred && !os.IsNotExist(err) {
+			t.Fatal("import did not delete the plaintext file")
+		}
+		if !shred && err != nil {
+			t.Fatal("import deleted the plaintext file when asked not to")
+		}
+	}
+
+	reminder := plaintextFiles.reminder()
+	if !strings.Contains(reminder, "export1.csv") || strings.Contains(reminder, "export0.csv") {
+		t.Fatalf("unexpected plaintext reminder %q", reminder)
+	}
+}
+
+func TestImportCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldTracker := plaintextFiles
+	defer func() { plaintextFiles = oldTracker }()
+	plaintextFiles = new(plaintextTracker)
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "export.csv")
+	if err = ioutil.WriteFile(path, []byte("Title,URL,Username,Password\nsite,https://example.com,user,pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = importFormatCmd(v).RunContext(ctx, []string{"apple", path})
+	if err == nil || err.Error() != "import canceled after importing 0 of 1 credentials" {
+		t.Fatal("expected import to be canceled, got", err)
+	}
+	_, err = importCmd(v).RunContext(ctx, []string{path, "Title", "Username", "Password"})
+	if err == nil || err.Error() != "importcsv canceled after importing 0 credentials" {
+		t.Fatal("expected importcsv to be canceled, got", err)
+	}
+	if locations, _ := v.Locations(); len(locations) != 0 {
+		t.Fatal("canceled imports added credentials:", locations)
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Fatal("canceled imports should keep the export")
+	}
+	if !strings.Contains(plaintextFiles.reminder(), "export.csv") {
+		t.Fatal("canceled imports should remind about the export")
+	}
+}
+
+func TestQuestionCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("github", vault.Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("question add github mother's maiden name"); err == nil {
+		t.Fatal("expected unbalanced quotes to be rejected")
+	}
+	if _, err = d.Send(`question add github "mother's maiden name"`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Send("question add github first pet"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Send("question list github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "first pet\nmother's maiden name\n" {
+		t.Fatalf("unexpected question list %q", res)
+	}
+
+	res, err = d.Send("question clip github maiden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "mother's maiden name") {
+		t.Fatal("unexpected clip output", res)
+	}
+	_, answer, err := v.FindQuestion("github", "maiden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Clipboard.Contents() != answer {
+		t.Fatal("question clip did not copy the answer")
+	}
+
+	if _, err = d.Send("question delete github pet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Send("question clip github pet"); err != vault.ErrNoSuchQuestion {
+		t.Fatal("expected ErrNoSuchQuestion, got", err)
+	}
+	if _, err = d.Send("question frobnicate github pet"); err == nil {
+		t.Fatal("expected an error for an unknown action")
+	}
+}
+
+func TestTokensCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("github-ci", vault.Credential{Password: "ghp_abcdef"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("internal", vault.Credential{Password: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("tokens tag --expires 10d --scopes repo,workflow github-ci"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Send("tokens tag internal"); err == nil {
+		t.Fatal("expected tagging a token of unknown provider without --provider to fail")
+	}
+	if _, err = d.Send("tokens tag --provider vendor --expires 60d internal"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := d.Send("tokens expiring --within 30d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(res, "github-ci: GitHub token expires") || !strings.Contains(res, "scopes repo,workflow") || !strings.Contains(res, "github.com/settings/tokens") {
+		t.Fatalf("unexpected expiring output %q", res)
+	}
+	if strings.Contains(res, "internal") {
+		t.Fatalf("token expiring in 60 days listed within 30 days: %q", res)
+	}
+	res, err = d.Send("tokens expiring --within 9w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "internal: vendor token") {
+		t.Fatalf("unexpected expiring output %q", res)
+	}
+
+	if _, err = d.Send("tokens untag github-ci"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = d.Send("tokens expiring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "no tokens expire within 30d\n" {
+		t.Fatalf("unexpected expiring output %q", res)
+	}
+}
+
+func TestUnlockWrites(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	v.ProtectWrites(time.Time{})
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("add github testuser testpass"); err == nil {
+		t.Fatal("expected add to fail while write-protected")
+	}
+	if _, err = d.Send("unlock-writes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Send("add github testuser testpass"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListSortByUse(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	for _, location := range []string{"a", "b", "c"} {
+		if err = v.Add(location, vault.Credential{Password: "testpass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("list --sort=uses"); err == nil {
+		t.Fatal("expected sorting by use to fail without usage tracking")
+	}
+	if _, err = d.Send("trackusage on"); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"get c", "get c", "get b"} {
+		if _, err = d.Send(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := d.Send("list --sort=uses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(res, "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[1], "c (used 2 times") || !strings.HasPrefix(lines[2], "b (used 1 times") || lines[3] != "a (never used)" {
+		t.Fatalf("unexpected list output %q", res)
+	}
+	if _, err = d.Send("list --sort=size"); err == nil {
+		t.Fatal("expected an unknown sort order to be rejected")
+	}
+}
+
+func TestListSortByModified(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	for _, location := range []string{"a", "b", "c"} {
+		if err = v.Add(location, vault.Credential{Password: "testpass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = v.SetNotes("a", "changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("trackusage on"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Send("get b"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Send("list --sort=modified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(res, "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[1], "a (changed ") || !strings.HasPrefix(lines[2], "c (changed ") || !strings.HasPrefix(lines[3], "b (changed ") {
+		t.Fatalf("unexpected list output %q", res)
+	}
+}
+
+func TestUndoCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("undo"); err == nil {
+		t.Fatal("undo should fail with nothing to undo")
+	}
+	if err = v.Add("github.com", vault.Credential{Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Delete("github.com"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Send("undo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "undid the last change to github.com\n" {
+		t.Fatalf("unexpected undo output %q", res)
+	}
+	if _, err = v.Get("github.com"); err != nil {
+		t.Fatal("undo did not restore the credential:", err)
+	}
+	if res, err = d.Send("redo"); err != nil || res != "redid the last change to github.com\n" {
+		t.Fatalf("unexpected redo output %q: %v", res, err)
+	}
+	if _, err = v.Get("github.com"); err != vault.ErrNoSuchCredential {
+		t.Fatal("redo did not delete the credential again:", err)
+	}
+	if _, err = d.Send("redo extra"); err == nil {
+		t.Fatal("redo should take no arguments")
+	}
+}
+
+func TestSnapshotCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("github.com", vault.Credential{Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	res, err := d.Send("snapshot list")
+	if err != nil || res != "no snapshots\n" {
+		t.Fatalf("unexpected snapshot list output %q: %v", res, err)
+	}
+	if _, err = d.Send("snapshot create"); err == nil {
+		t.Fatal("snapshot create should require a name")
+	}
+	if res, err = d.Send("snapshot create before-import"); err != nil || res != "snapshot before-import created\n" {
+		t.Fatalf("unexpected snapshot create output %q: %v", res, err)
+	}
+	if res, err = d.Send("snapshot list"); err != nil || !strings.HasPrefix(res, "Snapshots:\nbefore-import (created ") {
+		t.Fatalf("unexpected snapshot list output %q: %v", res, err)
+	}
+	if err = v.Add("gitlab.com", vault.Credential{Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = d.Send("rollback before-import"); err != nil || res != "rolled back to snapshot before-import, changing gitlab.com\n" {
+		t.Fatalf("unexpected rollback output %q: %v", res, err)
+	}
+	if _, err = v.Get("gitlab.com"); err != vault.ErrNoSuchCredential {
+		t.Fatal("rollback did not remove the credential added after the snapshot:", err)
+	}
+	if _, err = d.Send("snapshot delete before-import"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Send("rollback before-import"); err == nil {
+		t.Fatal("rollback should fail once the snapshot is deleted")
+	}
+}
+
+func TestAuditStaleAndArchive(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	for _, location := range []string{"oldbank", "newbank"} {
+		if err = v.Add(location, vault.Credential{Password: "testpass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("audit --stale 1y"); err == nil {
+		t.Fatal("expected audit --stale to fail without usage tracking")
+	}
+	if _, err = d.Send("trackusage on"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Send("audit --stale 1y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "every credential has been used in the last 1y\n" {
+		t.Fatalf("unexpected audit output %q", res)
+	}
+
+	if _, err = d.Send("archive oldbank"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = d.Send("list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(res, "oldbank") || !strings.Contains(res, "newbank") {
+		t.Fatalf("unexpected list output %q", res)
+	}
+	res, err = d.Send("search bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "newbank\n" {
+		t.Fatalf("unexpected search output %q", res)
+	}
+	// archived credentials can still be used
+	if _, err = d.Send("get oldbank"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveAll(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	for _, location := range []string{"oldbank", "newbank"} {
+		if err = v.Add(location, vault.Credential{Password: "testpass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = v.SetArchived("oldbank", true); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	res, err := d.Send("list --all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "oldbank") {
+		t.Fatalf("list --all did not include the archived credential: %q", res)
+	}
+	res, err = d.Send("search --all bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "newbank\noldbank\n" {
+		t.Fatalf("unexpected search output %q", res)
+	}
+
+	if _, err = d.Send("unarchive oldbank"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = d.Send("search bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "newbank\noldbank\n" {
+		t.Fatalf("unarchived credential not searched: %q", res)
+	}
+}
+
+func TestAliasCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("github.com", vault.Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	if _, err = d.Send("alias add gh github.com"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Send("get gh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "testuser") {
+		t.Fatalf("get did not resolve the alias: %q", res)
+	}
+	res, err = d.Send("alias list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "gh -> github.com\n" {
+		t.Fatalf("unexpected alias list %q", res)
+	}
+	if _, err = d.Send("alias delete gh"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = d.Send("alias list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "this vault has no aliases\n" {
+		t.Fatalf("unexpected alias list %q", res)
+	}
+}
+
+func TestStatusSizes(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("small", vault.Credential{Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("large", vault.Credential{Password: strings.Repeat("x", 1000)}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	res, err := d.Send("status --sizes --top 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(res, "2 credentials") || !strings.Contains(res, "large: ") || strings.Contains(res, "small: ") || strings.Contains(res, "warning:") {
+		t.Fatalf("unexpected status output %q", res)
+	}
+	if _, err = d.Send("sizewarning lots"); err == nil {
+		t.Fatal("expected a non-numeric size to be rejected")
+	}
+	res, err = d.Send("sizewarning 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != fmt.Sprintf("size warning threshold set to %v bytes\n", vault.DefaultSizeWarning) {
+		t.Fatalf("unexpected sizewarning output %q", res)
+	}
+}
+
+func TestAuditFix(t *testing.T) {
+	defer func(f func(string) (bool, error)) { askYesNo = f }(askYesNo)
+	defer func(f func(string) error) { openBrowser = f }(openBrowser)
+	board := &secureclip.MemoryClipboard{}
+	secureclip.SetClipboard(board)
+	defer secureclip.SetClipboard(nil)
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	creds := map[string]string{
+		"example.com": "hunter2",
+		"reused.org":  "3yV9kQ2mX7pL4wR8sT1n",
+		"other.org":   "3yV9kQ2mX7pL4wR8sT1n",
+		"strong.org":  "Zq8uF3vN6xB1cH9jK4mW",
+	}
+	for location, password := range creds {
+		if err = v.Add(location, vault.Credential{Username: "user", Password: password}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var opened []string
+	openBrowser = func(url string) error {
+		opened = append(opened, url)
+		return nil
+	}
+	// replace and confirm example.com, then replace other.org, which fixes
+	// reused.org too, but don't confirm it
+	answers := []bool{true, true, true, true, true, false}
+	askYesNo = func(string) (bool, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+	res, err := auditFix(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "2 of 3 credentials fixed\n1 replacements are not yet changed on their sites. Run audit fix again to finish them.\n" {
+		t.Fatalf("unexpected audit fix output %q", res)
+	}
+	if !reflect.DeepEqual(opened, []string{"https://example.com/.well-known/change-password", "https://other.org/.well-known/change-password"}) {
+		t.Fatal("unexpected pages opened:", opened)
+	}
+	cred, err := v.Get("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Password == "hunter2" || cred.PreviousPassword() != "hunter2" || cred.RotationPending() || len(cred.Password) < 12 {
+		t.Fatal("example.com was not fixed:", cred)
+	}
+	cred, err = v.Get("other.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board.Contents() != cred.Password || !cred.RotationPending() {
+		t.Fatal("other.org was not left pending with its password on the clipboard")
+	}
+
+	// the unconfirmed replacement is offered again, without replacing it
+	answers = []bool{false, true}
+	if res, err = auditFix(v); err != nil {
+		t.Fatal(err)
+	}
+	if res != "1 of 1 credentials fixed\n" {
+		t.Fatalf("unexpected audit fix output %q", res)
+	}
+	if updated, err := v.Get("other.org"); err != nil || updated.Password != cred.Password {
+		t.Fatal("pending replacement was replaced again")
+	}
+	if res, err = auditFix(v); err != nil || res != "no weak or reused passwords found\n" {
+		t.Fatalf("unexpected audit fix output %q %v", res, err)
+	}
+}
+
+func TestEntryJSON(t *testing.T) {
+	defer func(f func(string) (bool, error)) { askYesNo = f }(askYesNo)
+	askYesNo = func(string) (bool, error) { return true, nil }
+	dir, err := ioutil.TempDir("", "masterkey-entry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("example.com", vault.Credential{Username: "alice", Password: "hunter2", Notes: "some notes"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.AddMeta("example.com", "pin", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.SetUsernameSensitive("example.com", true); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := get(v)([]string{"example.com", "--json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(res, vault.ReservedMetaPrefix) {
+		t.Fatal("get --json included reserved meta:", res)
+	}
+	path := filepath.Join(dir, "entry.json")
+	if err = ioutil.WriteFile(path, []byte(strings.Replace(res, `"example.com"`, `"copy.example.com"`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = add(v)([]string{"--from-json", path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("add --from-json did not delete the plaintext file")
+	}
+	original, err := v.Get("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := v.Get("copy.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.ID == original.ID || copied.Username != "alice" || copied.Password != "hunter2" || copied.Notes != "some notes" || !reflect.DeepEqual(copied.UserMeta(), original.UserMeta()) {
+		t.Fatal("credential did not round trip:", copied)
+	}
+
+	setPresentation(true)
+	defer setPresentation(false)
+	if _, err = get(v)([]string{"example.com", "--json"}); err != errPresentation {
+		t.Fatal("expected get --json to be disabled in presentation mode, got", err)
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+
+	res, err := d.Send("help")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(res, "Other:") {
+		t.Fatal("a command has no category:", res)
+	}
+	if !strings.Contains(res, "Clipboard and display:\n  clip [--for duration] [location] [meta name]\n") {
+		t.Fatal("clip was not listed under its category:", res)
+	}
+
+	res, err = d.Send("help clip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "copy the password at location to the clipboard") || !strings.Contains(res, "Examples:\n  clip github.com\n") {
+		t.Fatal("help clip did not describe clip:", res)
+	}
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// timeNetwork is the operation network requests are reported as.
+const timeNetwork = "network"
+
+// timingOrder is the order operations are listed in a timing report. Any
+// others follow, sorted.
+var timingOrder = []string{vault.TimeKDF, vault.TimeDecrypt, vault.TimeIndex, vault.TimeEncode, vault.TimeSave, timeNetwork}
+
+// timings collects how long the vault's operations, and network requests,
+// take while debugging is on, to help diagnose a slow vault.
+type timings struct {
+	mu     sync.Mutex
+	on     bool
+	totals map[string]time.Duration
+	counts map[string]int
+}
+
+// debugTimings is turned on by -verbose or `set debug on`, and reports the
+// timings of each shell command.
+var debugTimings = &timings{}
+
+// setDebug turns the timing of each shell command on or off.
+func setDebug(on bool) {
+	debugTimings.setOn(on)
+}
+
+func (t *timings) setOn(on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.on = on
+	t.totals, t.counts = nil, nil
+}
+
+// record adds `d` to the time taken by `op`. It is a vault.Timer.
+func (t *timings) record(op string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.on {
+		return
+	}
+	if t.totals == nil {
+		t.totals, t.counts = make(map[string]time.Duration), make(map[string]int)
+	}
+	t.totals[op] += d
+	t.counts[op]++
+}
+
+// report returns a line giving how long `command` took, and how much of that
+// was spent on each operation, then starts collecting afresh. It returns ""
+// while debugging is off.
+func (t *timings) report(command string, took time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.on {
+		return ""
+	}
+	var ops []string
+	for _, op := range timingOrder {
+		if t.counts[op] > 0 {
+			ops = append(ops, op)
+		}
+	}
+	var others []string
+	for op := range t.counts {
+		if !inStrings(timingOrder, op) {
+			others = append(others, op)
+		}
+	}
+	sort.Strings(others)
+
+	var parts []string
+	for _, op := range append(ops, others...) {
+		part := fmt.Sprintf("%v %v", op, roundDuration(t.totals[op]))
+		if t.counts[op] > 1 {
+			part += fmt.Sprintf(" x%v", t.counts[op])
+		}
+		parts = append(parts, part)
+	}
+	t.totals, t.counts = nil, nil
+
+	line := fmt.Sprintf("timing: %v took %v", command, roundDuration(took))
+	if len(parts) > 0 {
+		line += " (" + strings.Join(parts, ", ") + ")"
+	}
+	return line + "\n"
+}
+
+// roundDuration rounds `d` for display, keeping sub-millisecond durations
+// from being shown as 0s.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+func inStrings(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// timedTransport reports the time taken by each HTTP request to
+// debugTimings as a network operation.
+type timedTransport struct{}
+
+func (timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	defer func(start time.Time) {
+		debugTimings.record(timeNetwork, time.Since(start))
+	}(time.Now())
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// timedClient returns an HTTP client with `timeout` whose requests are timed
+// by debugTimings.
+func timedClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: timedTransport{}}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestTimingsReport(t *testing.T) {
+	tm := &timings{}
+	tm.record(vault.TimeKDF, time.Second)
+	if res := tm.report("get", time.Second); res != "" {
+		t.Fatal("timings were reported while debugging was off:", res)
+	}
+
+	tm.setOn(true)
+	tm.record(vault.TimeSave, 40*time.Millisecond)
+	tm.record(vault.TimeDecrypt, 10*time.Millisecond)
+	tm.record(vault.TimeDecrypt, 20*time.Millisecond)
+	tm.record(vault.TimeKDF, 1200*time.Millisecond)
+	res := tm.report("get", 1300*time.Millisecond)
+	if res != "timing: get took 1.3s (kdf 1.2s, decrypt 30ms x2, save 40ms)\n" {
+		t.Fatal("unexpected report:", res)
+	}
+	if res = tm.report("list", 500*time.Microsecond); res != "timing: list took 500µs\n" {
+		t.Fatal("the timings of the previous command were reported again:", res)
+	}
+}
+
+func TestTimedClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	debugTimings.setOn(true)
+	defer debugTimings.setOn(false)
+	resp, err := timedClient(time.Second).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if res := debugTimings.report("icon", time.Second); !strings.Contains(res, "(network ") {
+		t.Fatal("the request was not timed:", res)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// errEditorFailed is returned by editText if the editor exits unsuccessfully.
+var errEditorFailed = errors.New("editor exited with an error, changes discarded")
+
+// editorCommand returns the user's preferred editor, taken from $VISUAL or
+// $EDITOR, falling back to a platform default.
+func editorCommand() string {
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// editText opens `text` in the user's editor and returns the edited text. The
+// text is written to a file only the current user can read, in a directory
+// that is removed once the editor exits.
+func editText(text string) (string, error) {
+	args, err := shellwords.Parse(editorCommand())
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", errEditorFailed
+	}
+
+	dir, err := ioutil.TempDir("", "masterkey-edit")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(filename, []byte(text), 0600); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], filename)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", errEditorFailed
+	}
+
+	edited, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	// overwrite the plaintext before the directory is removed
+	ioutil.WriteFile(filename, make([]byte, len(edited)), 0600)
+	return string(edited), nil
+}
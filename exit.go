@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/avahowell/masterkey/filelock"
+	"github.com/avahowell/masterkey/vault"
+)
+
+// Exit codes, so that scripts wrapping masterkey can tell why it failed.
+const (
+	exitFailure   = 1 // any failure not listed below
+	exitNotFound  = 2 // the vault, or a credential in it, does not exist
+	exitWrongPass = 3 // the passphrase was incorrect
+	exitLocked    = 4 // the vault is open elsewhere, or locked
+	exitCorrupt   = 5 // the vault can not be decrypted, even with the correct passphrase
+)
+
+// errorCodes name the exit codes in errors written as JSON.
+var errorCodes = map[int]string{
+	exitFailure:   "failed",
+	exitNotFound:  "not-found",
+	exitWrongPass: "wrong-passphrase",
+	exitLocked:    "locked",
+	exitCorrupt:   "corrupt",
+}
+
+var (
+	// quiet is set by the -quiet flag to suppress informational messages.
+	quiet bool
+
+	// jsonErrors is set by the -json flag to write errors to stderr as
+	// JSON, for programs wrapping masterkey.
+	jsonErrors bool
+)
+
+// inform prints `s`, a message that only tells the user what masterkey is
+// doing, unless -quiet is set.
+func inform(s string) {
+	if !quiet {
+		fmt.Print(s)
+	}
+}
+
+type (
+	// codedError is an error that masterkey exits with a particular code
+	// on, used where the error it describes has been reworded.
+	codedError struct {
+		error
+		code int
+
+		// location is the file the error concerns, if any.
+		location string
+	}
+
+	// jsonError is an error as written with -json. Code names its exit
+	// code, and Location is the file, or the line of a script, it concerns.
+	jsonError struct {
+		Code     string `json:"code"`
+		Message  string `json:"message"`
+		Location string `json:"location,omitempty"`
+	}
+)
+
+// exitCode returns the code masterkey exits with when it fails with `err`.
+func exitCode(err error) int {
+	switch err := err.(type) {
+	case codedError:
+		return err.code
+	case scriptError:
+		return exitCode(err.err)
+	}
+	switch err {
+	case vault.ErrNoSuchCredential, vault.ErrNoSuchAlias, vault.ErrNoSuchSnapshot:
+		return exitNotFound
+	case vault.ErrWrongPassphrase:
+		return exitWrongPass
+	case filelock.ErrLocked, vault.ErrVaultLocked:
+		return exitLocked
+	case vault.ErrCorruptVault, vault.ErrCouldNotDecrypt, vault.ErrUnknownFormat:
+		return exitCorrupt
+	}
+	if os.IsNotExist(err) {
+		return exitNotFound
+	}
+	return exitFailure
+}
+
+// writeError writes `err` to `w`, as a line of JSON if -json is set.
+func writeError(w io.Writer, err error) {
+	if !jsonErrors {
+		fmt.Fprintln(w, err)
+		return
+	}
+	e := jsonError{Code: errorCodes[exitCode(err)], Message: err.Error()}
+	switch err := err.(type) {
+	case codedError:
+		e.Location = err.location
+	case scriptError:
+		e.Message = msg.Translate(err.err.Error())
+		e.Location = fmt.Sprintf("%v:%v", err.name, err.line)
+	case *os.PathError:
+		e.Location = err.Path
+	}
+	bs, _ := json.Marshal(e)
+	fmt.Fprintln(w, string(bs))
+}
+
+// die writes `err`, to stderr if -json is set, and exits with its code.
+func die(err error) {
+	out := os.Stdout
+	if jsonErrors {
+		out = os.Stderr
+	}
+	writeError(out, err)
+	pendingNotifications.Wait()
+	os.Exit(exitCode(err))
+}
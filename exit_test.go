@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/avahowell/masterkey/filelock"
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestExitCode(t *testing.T) {
+	_, notExist := os.Open("/nonexistent/vault.db")
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{errors.New("something went wrong"), exitFailure},
+		{vault.ErrNoSuchCredential, exitNotFound},
+		{notExist, exitNotFound},
+		{vault.ErrWrongPassphrase, exitWrongPass},
+		{openError("vault.db", vault.ErrWrongPassphrase), exitWrongPass},
+		{openError("vault.db", filelock.ErrLocked), exitLocked},
+		{vault.ErrVaultLocked, exitLocked},
+		{openError("vault.db", vault.ErrCorruptVault), exitCorrupt},
+		{vault.ErrUnknownFormat, exitCorrupt},
+	}
+	for _, test := range tests {
+		if code := exitCode(test.err); code != test.code {
+			t.Errorf("exitCode(%v) = %v, wanted %v", test.err, code, test.code)
+		}
+	}
+}
+
+func TestWriteErrorJSON(t *testing.T) {
+	defer func() { jsonErrors = false }()
+
+	var buf bytes.Buffer
+	writeError(&buf, scriptError{name: "tidy.mk", line: 3, err: vault.ErrNoSuchCredential})
+	if buf.String() != "tidy.mk:3: "+vault.ErrNoSuchCredential.Error()+"\n" {
+		t.Fatalf("unexpected error without -json: %q", buf.String())
+	}
+
+	jsonErrors = true
+	tests := []struct {
+		err      error
+		expected jsonError
+	}{
+		{errors.New("something went wrong"), jsonError{Code: "failed", Message: "something went wrong"}},
+		{scriptError{name: "tidy.mk", line: 3, err: vault.ErrNoSuchCredential}, jsonError{Code: "not-found", Message: vault.ErrNoSuchCredential.Error(), Location: "tidy.mk:3"}},
+		{openError("vault.db", vault.ErrWrongPassphrase), jsonError{Code: "wrong-passphrase", Message: "incorrect passphrase for vault.db", Location: "vault.db"}},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		writeError(&buf, test.err)
+		var e jsonError
+		if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e != test.expected {
+			t.Errorf("writeError(%v) wrote %+v, wanted %+v", test.err, e, test.expected)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// browserCSVHeader is the header row Chrome and Firefox expect in an imported
+// passwords CSV.
+var browserCSVHeader = []string{"name", "url", "username", "password"}
+
+// credentialURL returns the URL a browser should associate with the
+// credential at `location`: its SiteURL if it has one, otherwise the location
+// itself if it is a URL or hostname. Credentials with no URL can not be
+// autofilled and are skipped by the browsers' importers.
+func credentialURL(location string, cred *vault.Credential) string {
+	if u := cred.SiteURL(); u != "" {
+		return u
+	}
+	return locationURL(location)
+}
+
+// locationURL returns `location` as a URL if it is a URL or hostname, or ""
+// if it is not.
+func locationURL(location string) string {
+	if strings.Contains(location, "://") {
+		return location
+	}
+	if vault.HostnameRegexp.MatchString(location) {
+		return "https://" + location
+	}
+	return ""
+}
+
+// BrowserCSV writes every credential in `v` to `w` as a CSV that Chrome and
+// Firefox can import, with the columns name, url, username, and password.
+// Usernames that the vault masks are left empty unless `includeSensitive` is
+// set. Aliases that are URLs or hostnames are written as extra rows for the
+// credential they refer to, so that browsers fill it in on those sites too.
+// The number of rows written is returned.
+func BrowserCSV(v *vault.Vault, w io.Writer, includeSensitive bool) (int, error) {
+	locations, err := v.Locations()
+	if err != nil {
+		return 0, err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(browserCSVHeader); err != nil {
+		return 0, err
+	}
+	nexported := 0
+	for _, location := range locations {
+		cred, err := v.Get(location)
+		if err != nil {
+			return nexported, err
+		}
+		// accounts known only by their email address sign in with it
+		username := cred.Username
+		if username == "" {
+			username = cred.AccountEmail()
+		}
+		if !includeSensitive && v.MasksUsername(cred) {
+			username = ""
+		}
+		record := []string{location, credentialURL(location, cred), username, cred.Password}
+		if err := cw.Write(record); err != nil {
+			return nexported, err
+		}
+		nexported++
+		for _, alias := range cred.Aliases() {
+			url := locationURL(alias)
+			if url == "" {
+				continue
+			}
+			if err := cw.Write([]string{alias, url, username, cred.Password}); err != nil {
+				return nexported, err
+			}
+			nexported++
+		}
+	}
+	cw.Flush()
+	return nexported, cw.Error()
+}
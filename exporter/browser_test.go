@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestBrowserCSV(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := map[string]vault.Credential{
+		"github.com": {Username: "user1", Password: "pass1"},
+		"My Bank": {Username: "user2", Password: "pa,ss2", Meta: map[string]string{
+			"URL": "https://bank.example.com/login",
+		}},
+		"wifi": {Password: "pass3"},
+		"Mail": {Email: "user4@example.com", Password: "pass4", URL: "https://mail.example.com"},
+	}
+	for location, cred := range creds {
+		if err = v.Add(location, cred); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := BrowserCSV(v, &buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatal("expected 4 credentials to be exported, got", n)
+	}
+	expected := `name,url,username,password
+Mail,https://mail.example.com,user4@example.com,pass4
+My Bank,https://bank.example.com/login,user2,"pa,ss2"
+github.com,https://github.com,user1,pass1
+wifi,,,pass3
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected csv:\n%v", buf.String())
+	}
+}
+
+func TestBrowserCSVSensitiveUsernames(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("a.example.com", vault.Credential{Username: "user1", Password: "pass1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("b.example.com", vault.Credential{Username: "user2", Password: "pass2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.SetUsernameSensitive("a.example.com", true); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err = BrowserCSV(v, &buf, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := `name,url,username,password
+a.example.com,https://a.example.com,,pass1
+b.example.com,https://b.example.com,user2,pass2
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected csv:\n%v", buf.String())
+	}
+
+	buf.Reset()
+	if _, err = BrowserCSV(v, &buf, true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("user1")) {
+		t.Fatal("sensitive username was not included:", buf.String())
+	}
+}
+
+func TestBrowserCSVAliases(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("github.com", vault.Credential{Username: "user1", Password: "pass1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.AddAlias("gist.github.com", "github.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.AddAlias("gh", "github.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := BrowserCSV(v, &buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatal("expected 2 rows to be exported, got", n)
+	}
+	expected := `name,url,username,password
+github.com,https://github.com,user1,pass1
+gist.github.com,https://gist.github.com,user1,pass1
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected csv:\n%v", buf.String())
+	}
+}
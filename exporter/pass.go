@@ -0,0 +1,150 @@
+// Package exporter writes the credentials in a vault out in formats other
+// password managers and browsers understand.
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+var (
+	// ErrNoGPGID is returned from Pass if no gpg id was given and the store
+	// does not already have a .gpg-id file.
+	ErrNoGPGID = errors.New("a gpg id is required to create a new password store")
+
+	// ErrUnsafeLocation is returned from Pass if a location can not be
+	// written inside the store, for example because it contains "..".
+	ErrUnsafeLocation = errors.New("location can not be used as a pass entry name")
+
+	// gpgEncrypt encrypts `plaintext` to the recipients in `gpgIDs`, writing
+	// the result to `filename`.
+	gpgEncrypt = func(plaintext []byte, gpgIDs []string, filename string) error {
+		args := []string{"--batch", "--yes", "--quiet", "--encrypt", "--output", filename}
+		for _, id := range gpgIDs {
+			args = append(args, "--recipient", id)
+		}
+		cmd := exec.Command("gpg", args...)
+		cmd.Stdin = bytes.NewReader(plaintext)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("gpg failed: %v: %v", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+)
+
+// PassEntry returns the contents of a password-store entry for `cred`: the
+// password on the first line, followed by the username, the URL, email and
+// meta tags as `name: value` lines, and finally the notes.
+func PassEntry(cred *vault.Credential) string {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, cred.Password)
+	if cred.Username != "" {
+		fmt.Fprintf(&buf, "login: %v\n", cred.Username)
+	}
+	meta := cred.UserMeta()
+	for name, value := range map[string]string{"url": cred.URL, "email": cred.Email} {
+		if value == "" {
+			continue
+		}
+		for tag := range meta {
+			if strings.EqualFold(tag, name) {
+				delete(meta, tag)
+			}
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[name] = value
+	}
+	var names []string
+	for name := range meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%v: %v\n", name, meta[name])
+	}
+	if cred.Notes != "" {
+		fmt.Fprintln(&buf, strings.TrimRight(cred.Notes, "\n"))
+	}
+	return buf.String()
+}
+
+// passEntryPath returns the file in `storeDir` that the entry for `location`
+// is written to. Slashes in the location become directories, as in pass.
+func passEntryPath(storeDir, location string) (string, error) {
+	for _, part := range strings.Split(location, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `\:`) {
+			return "", ErrUnsafeLocation
+		}
+	}
+	return filepath.Join(storeDir, filepath.FromSlash(location)+".gpg"), nil
+}
+
+// Pass exports every credential in `v` to the password store at `storeDir`,
+// encrypting each entry to `gpgID` using gpg. If `gpgID` is empty, the ids
+// in the store's .gpg-id file are used; otherwise a .gpg-id file is created
+// if the store does not have one. Existing entries are overwritten. The
+// number of entries written is returned.
+func Pass(v *vault.Vault, storeDir string, gpgID string) (int, error) {
+	idFile := filepath.Join(storeDir, ".gpg-id")
+	var gpgIDs []string
+	if gpgID != "" {
+		gpgIDs = []string{gpgID}
+	} else {
+		ids, err := ioutil.ReadFile(idFile)
+		if os.IsNotExist(err) {
+			return 0, ErrNoGPGID
+		} else if err != nil {
+			return 0, err
+		}
+		gpgIDs = strings.Fields(string(ids))
+		if len(gpgIDs) == 0 {
+			return 0, ErrNoGPGID
+		}
+	}
+
+	if err := os.MkdirAll(storeDir, 0700); err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(idFile); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(idFile, []byte(gpgID+"\n"), 0600); err != nil {
+			return 0, err
+		}
+	}
+
+	locations, err := v.Locations()
+	if err != nil {
+		return 0, err
+	}
+	nexported := 0
+	for _, location := range locations {
+		filename, err := passEntryPath(storeDir, location)
+		if err != nil {
+			return nexported, fmt.Errorf("%v: %v", location, err)
+		}
+		cred, err := v.Get(location)
+		if err != nil {
+			return nexported, err
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			return nexported, err
+		}
+		if err := gpgEncrypt([]byte(PassEntry(cred)), gpgIDs, filename); err != nil {
+			return nexported, fmt.Errorf("%v: %v", location, err)
+		}
+		nexported++
+	}
+	return nexported, nil
+}
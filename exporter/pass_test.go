@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestPassEntry(t *testing.T) {
+	cred := &vault.Credential{
+		Username: "user",
+		Password: "pass",
+		Notes:    "some notes\n",
+		Meta: map[string]string{
+			"url":                            "https://example.com",
+			"email":                          "user@example.com",
+			vault.ReservedMetaPrefix + "foo": "bar",
+		},
+	}
+	expected := "pass\nlogin: user\nemail: user@example.com\nurl: https://example.com\nsome notes\n"
+	if entry := PassEntry(cred); entry != expected {
+		t.Fatalf("unexpected pass entry %q", entry)
+	}
+
+	// the credential's own URL and email take the place of meta tags
+	cred = &vault.Credential{
+		Password: "pass",
+		URL:      "https://example.com/login",
+		Email:    "user@example.com",
+		Meta:     map[string]string{"URL": "https://old.example.com"},
+	}
+	expected = "pass\nemail: user@example.com\nurl: https://example.com/login\n"
+	if entry := PassEntry(cred); entry != expected {
+		t.Fatalf("unexpected pass entry %q", entry)
+	}
+}
+
+func TestPass(t *testing.T) {
+	var encrypted []string
+	oldEncrypt := gpgEncrypt
+	defer func() { gpgEncrypt = oldEncrypt }()
+	gpgEncrypt = func(plaintext []byte, gpgIDs []string, filename string) error {
+		if !reflect.DeepEqual(gpgIDs, []string{"KEYID"}) {
+			t.Fatal("wrong gpg ids", gpgIDs)
+		}
+		encrypted = append(encrypted, filename)
+		return ioutil.WriteFile(filename, plaintext, 0600)
+	}
+
+	dir, err := ioutil.TempDir("", "masterkey-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storeDir := filepath.Join(dir, "store")
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("email/example.com", vault.Credential{Username: "user", Password: "pass1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("github.com", vault.Credential{Username: "user", Password: "pass2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Pass(v, storeDir, ""); err != ErrNoGPGID {
+		t.Fatal("expected ErrNoGPGID, got", err)
+	}
+	n, err := Pass(v, storeDir, "KEYID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(encrypted) != 2 {
+		t.Fatal("expected two entries to be exported, got", n)
+	}
+	entry, err := ioutil.ReadFile(filepath.Join(storeDir, "email", "example.com.gpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(entry), "pass1\n") {
+		t.Fatal("entry did not begin with the password")
+	}
+	ids, err := ioutil.ReadFile(filepath.Join(storeDir, ".gpg-id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ids) != "KEYID\n" {
+		t.Fatal("unexpected .gpg-id", string(ids))
+	}
+
+	// the store's .gpg-id is used when no id is given
+	if _, err = Pass(v, storeDir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = v.Add("../escape", vault.Credential{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Pass(v, storeDir, "KEYID"); err == nil {
+		t.Fatal("expected an error exporting a location containing ..")
+	}
+}
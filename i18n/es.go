@@ -0,0 +1,234 @@
+package i18n
+
+// spanish is the Spanish catalog. Command names, flags and the arguments
+// typed after them are left in English, since they are typed as shown.
+var spanish = map[string]string{
+	// repl
+	"list the commands by category, or show the usage, description and examples of command": "lista los comandos por categoría, o muestra el uso, la descripción y los ejemplos de command",
+	"exit the interactive prompt": "sale del intérprete interactivo",
+	"clear the terminal":          "limpia la terminal",
+	"Type `help command` for the description and examples of a command.": "Escribe `help command` para ver la descripción y los ejemplos de un comando.",
+	"no command named %v. Type `help` for a list of commands.":           "no hay ningún comando llamado %v. Escribe `help` para ver la lista de comandos.",
+	"Usage:":           "Uso:",
+	"Examples:":        "Ejemplos:",
+	"Shell":            "Intérprete",
+	"Other":            "Otros",
+	"cleared terminal": "terminal limpiada",
+	"command not recognized. Type `help` for a list of commands.": "comando no reconocido. Escribe `help` para ver la lista de comandos.",
+
+	// command categories
+	"Credentials":           "Credenciales",
+	"Clipboard and display": "Portapapeles y pantalla",
+	"Import and export":     "Importar y exportar",
+	"Sync":                  "Sincronización",
+	"Security":              "Seguridad",
+	"Vault settings":        "Ajustes de la bóveda",
+
+	// command usage
+	"list [--all] [--sort=name|modified|last-used|uses] [--tag=tag] [--folder=folder]: list the credentials stored inside this vault. Archived credentials are only listed with --all. --sort=modified lists the most recently changed first. Sorting by use requires trackusage to be on. --tag lists only the credentials with that tag, and --folder only those in that folder or the folders inside it.": "list [--all] [--sort=name|modified|last-used|uses] [--tag=tag] [--folder=folder]: lista las credenciales guardadas en esta bóveda. Las credenciales archivadas solo se listan con --all. --sort=modified lista primero las modificadas más recientemente. Ordenar por uso requiere que trackusage esté activado. --tag lista solo las credenciales con esa etiqueta, y --folder solo las de esa carpeta o las carpetas que contiene.",
+	"save the changes in this vault to disk": "guarda en el disco los cambios de esta bóveda",
+	"get [location] [--json]: get the credential at [location]. [location] can be a partial string: masterkey will search the vault and return the first result. --json prints the credential as JSON, in the form add --from-json reads.":                                                                                                                                "get [location] [--json]: muestra la credencial de [location]. [location] puede ser parte del nombre: masterkey buscará en la bóveda y devolverá el primer resultado. --json muestra la credencial como JSON, en la forma que lee add --from-json.",
+	"add [location] [username] [password] | add --from-json [file]: add a credential to the vault, or add the credential described by a JSON file, as printed by get --json: {\"location\", \"username\", \"password\", \"notes\", \"meta\": {name: value}, \"icon\": base64}, of which only location is required":                                                        "add [location] [username] [password] | add --from-json [file]: añade una credencial a la bóveda, o la credencial descrita por un archivo JSON, como el que muestra get --json: {\"location\", \"username\", \"password\", \"notes\", \"meta\": {name: value}, \"icon\": base64}, de los que solo location es obligatorio",
+	"gen [--symbols] [--exclude chars] [--no-symbols-from chars] [location] [username]: generate a password and add it to the vault. --symbols adds symbols to the letters and numbers it is made of, --exclude leaves out characters that are ambiguous in print or rejected by the site, such as O0l1I, and --no-symbols-from adds every symbol except the ones given.": "gen [--symbols] [--exclude chars] [--no-symbols-from chars] [location] [username]: genera una contraseña y la añade a la bóveda. --symbols añade símbolos a las letras y números que la forman, --exclude omite caracteres que se confunden al imprimirse o que el sitio rechaza, como O0l1I, y --no-symbols-from añade todos los símbolos salvo los indicados.",
+	"serve masterkey://location/field references, where field is username, password, notes or a meta name, to editors and masterkey resolve over a socket only you can use, until the shell exits. With no arguments, shows whether references are being served.":                                                                                                         "sirve referencias masterkey://location/field, donde field es username, password, notes o el nombre de un meta, a los editores y a masterkey resolve a través de un socket que solo tú puedes usar, hasta que se cierre el intérprete. Sin argumentos, indica si se están sirviendo referencias.",
+	"replace the password at location with a new one of the same length, using the same classes of characters and only the symbols the old one used, for sites whose password rules you no longer remember. The old password is shown by get until the next regen.":                                                                                                       "sustituye la contraseña de location por una nueva de la misma longitud, con las mismas clases de caracteres y solo los símbolos que usaba la anterior, para sitios cuyas reglas de contraseñas ya no recuerdas. get muestra la contraseña anterior hasta el siguiente regen.",
+	"change the credentials at location to username, password": "cambia la credencial de location a username, password",
+	"clip [--for duration] [location] [meta name]: copy the password at location to the clipboard, clearing it after duration, 30 seconds by default. meta name optional. Location and meta names can be partial strings, masterkey will search the vault and return the first result.": "clip [--for duration] [location] [meta name]: copia la contraseña de location al portapapeles y lo limpia pasado duration, 30 segundos por defecto. meta name es opcional. location y los nombres de meta pueden ser parte del nombre: masterkey buscará en la bóveda y devolverá el primer resultado.",
+	"policy [timeout|clipboard duration|default] [enforce on|off]: set how long this vault stays open with no activity, and how long copied secrets stay on the clipboard. Enforced timeouts can be shortened by flags and commands, but not lengthened.":                               "policy [timeout|clipboard duration|default] [enforce on|off]: establece cuánto tiempo permanece abierta esta bóveda sin actividad y cuánto tiempo permanecen en el portapapeles los secretos copiados. Los tiempos impuestos con enforce pueden acortarse con opciones y comandos, pero no alargarse.",
+	"print the password at location, then erase it from the terminal after [seconds] (default 10) or when a key is pressed. For environments where the clipboard can't be used.":                                                                                                        "muestra la contraseña de location y la borra de la terminal pasados [seconds] segundos (10 por defecto) o al pulsar una tecla. Para entornos donde no se puede usar el portapapeles.",
+	"edit the notes for the credential at [location] using $EDITOR": "edita las notas de la credencial de [location] con $EDITOR",
+	"totp [location] [clip]: print the current two-factor code for the credential at [location], or copy it to the clipboard with clip. The TOTP secret is read from the totp meta tag, as a base32 secret or an otpauth://totp/ URI.\ntotp import-qr [image] [location]: read the otpauth:// QR code in the PNG, JPEG or GIF screenshot at [image] and store its secret on the credential at [location], which is created if it does not exist. The location defaults to the issuer named in the code.": "totp [location] [clip]: muestra el código de verificación en dos pasos actual de la credencial de [location], o lo copia al portapapeles con clip. El secreto TOTP se lee de la etiqueta meta totp, como secreto en base32 o URI otpauth://totp/.\ntotp import-qr [image] [location]: lee el código QR otpauth:// de la captura de pantalla PNG, JPEG o GIF de [image] y guarda su secreto en la credencial de [location], que se crea si no existe. La ubicación por defecto es el emisor indicado en el código.",
+	"create a restore point called [name] holding the vault's credentials as they are now, list the restore points, or delete [name]. Restore points last until the vault is locked or masterkey exits, and are never saved.":                                                                                                                                                                                                                                                                            "crea un punto de restauración llamado [name] con las credenciales de la bóveda tal como están ahora, lista los puntos de restauración o elimina [name]. Los puntos de restauración duran hasta que se bloquea la bóveda o se sale de masterkey, y nunca se guardan.",
+	"restore the vault's credentials to the restore point [name] created by snapshot. undo reverts the rollback.":                                                                             "restaura las credenciales de la bóveda al punto de restauración [name] creado con snapshot. undo revierte la restauración.",
+	"source [--keep-going] [file]: run the commands in file, one per line, stopping at the first that fails unless --keep-going is given. Blank lines and lines starting with # are skipped.": "source [--keep-going] [file]: ejecuta los comandos de file, uno por línea, y se detiene en el primero que falle salvo que se indique --keep-going. Se omiten las líneas vacías y las que empiezan por #.",
+	"revert the last change made to the vault's credentials since it was last saved":                                                                                                          "deshace el último cambio hecho a las credenciales de la bóveda desde que se guardó por última vez",
+	"make the last change reverted by undo again":                                                                                                                                               "vuelve a hacer el último cambio deshecho con undo",
+	"add a copy of the credential at [location], with its password, notes and meta tags, at [new location]":                                                                                     "añade una copia de la credencial en [location], con su contraseña, notas y etiquetas meta, en [new location]",
+	"move the credential at [location] to [new location], keeping its meta tags, aliases and password history":                                                                                  "mueve la credencial en [location] a [new location], conservando sus etiquetas meta, alias e historial de contraseñas",
+	"set the URL of the credential at [location] to [url], or clear it if [url] is left out":                                                                                                    "establece la URL de la credencial de [location] a [url], o la borra si se omite [url]",
+	"set the email address of the credential at [location] to [address], or clear it if [address] is left out":                                                                                  "establece el correo electrónico de la credencial de [location] a [address], o lo borra si se omite [address]",
+	"move the credential at [location] into [folder], with nested folders separated by /, or to the top level if [folder] is left out":                                                          "mueve la credencial de [location] a [folder], con las carpetas anidadas separadas por /, o al nivel superior si se omite [folder]",
+	"list the folders in this vault, nested under their parents, with how many credentials are in each":                                                                                         "lista las carpetas de esta bóveda, anidadas bajo sus padres, y cuántas credenciales hay en cada una",
+	"tag the credential at [location] with each of [tag], to group it with others. list --tag lists the credentials with a tag.":                                                                "etiqueta la credencial de [location] con cada [tag], para agruparla con otras. list --tag lista las credenciales con una etiqueta.",
+	"remove each of [tag] from the credential at [location]":                                                                                                                                    "quita cada [tag] de la credencial de [location]",
+	"list the tags used in this vault, with how many credentials have each":                                                                                                                     "lista las etiquetas usadas en esta bóveda, y cuántas credenciales tienen cada una",
+	"list the passwords the credential at [location] had before its current one, newest first, with when each was replaced":                                                                     "lista las contraseñas que tuvo la credencial de [location] antes de la actual, de la más reciente a la más antigua, con la fecha en que se reemplazó cada una",
+	"set the icon for the credential at [location]. fetch downloads the favicon of [site] (default: the location), file reads the image at [path], and clear removes the icon.":                 "establece el icono de la credencial de [location]. fetch descarga el favicon de [site] (por defecto, location), file lee la imagen de [path] y clear quita el icono.",
+	"search [--all] [searchtext]: search the vault for locations containing searchtext. Archived credentials are only searched with --all.":                                                     "search [--all] [searchtext]: busca en la bóveda las ubicaciones que contienen searchtext. Las credenciales archivadas solo se buscan con --all.",
+	"delete [location]: remove [location] from the vault.\ndelete --match [searchtext]: remove every location containing searchtext from the vault, after confirming if more than one matches.": "delete [location]: elimina [location] de la bóveda.\ndelete --match [searchtext]: elimina de la bóveda todas las ubicaciones que contienen searchtext, tras confirmar si coincide más de una.",
+	"audit --stale [age] | audit fix: --stale lists credentials that have not been used in age, such as 1y or 90d, as candidates for deleting or archiving, and requires trackusage to be on. fix walks through weak and reused passwords one at a time, offering to generate a stronger replacement of the same shape, copy it, and open the site's change-password page, and remembers replacements not yet confirmed on the site.": "audit --stale [age] | audit fix: --stale lista las credenciales que no se han usado en age, como 1y o 90d, como candidatas a eliminarse o archivarse, y requiere que trackusage esté activado. fix recorre una a una las contraseñas débiles y reutilizadas, ofreciendo generar un reemplazo más fuerte de la misma forma, copiarlo y abrir la página del sitio para cambiar la contraseña, y recuerda los reemplazos que aún no se han confirmado en el sitio.",
+	"hide the credential at location from list, search and the terminal UI without deleting it":                                                                                                                                              "oculta la credencial de location en list, search y la interfaz de terminal sin eliminarla",
+	"restore an archived credential to list, search and the terminal UI":                                                                                                                                                                     "devuelve una credencial archivada a list, search y la interfaz de terminal",
+	"status [--sizes] [--top n]: show how many credentials the vault holds and how large it is. With --sizes, also list the n largest credentials (10 by default).":                                                                          "status [--sizes] [--top n]: muestra cuántas credenciales contiene la bóveda y cuánto ocupa. Con --sizes, lista además las n credenciales más grandes (10 por defecto).",
+	"warn when the encrypted vault grows larger than size (0 for the default). With no arguments, shows the current threshold.":                                                                                                              "avisa cuando la bóveda cifrada supera size (0 para el valor por defecto). Sin argumentos, muestra el límite actual.",
+	"record, encrypted in the vault, how often and when each credential is used, so that list and the terminal UI can show the most relevant first. Turning it off deletes the recorded usage.":                                              "registra, cifrado en la bóveda, cuándo y con qué frecuencia se usa cada credencial, para que list y la interfaz de terminal muestren primero las más relevantes. Desactivarlo elimina el uso registrado.",
+	"pad the vault before it is encrypted, so that its size does not reveal how many credentials it holds or change as they are added, at the cost of a larger file.":                                                                        "rellena la bóveda antes de cifrarla, para que su tamaño no revele cuántas credenciales contiene ni cambie al añadirlas, a costa de un archivo más grande.",
+	"require the master password to be entered again before destructive operations (delete --match, changepassword) on this vault.":                                                                                                          "pide de nuevo la contraseña maestra antes de operaciones destructivas (delete --match, changepassword) en esta bóveda.",
+	"locationrules [max length] [lowercase hosts on|off]: set the longest location that can be added (0 for the default) and whether hostnames and URLs are lowercased when added or looked up. With no arguments, shows the current rules.": "locationrules [max length] [lowercase hosts on|off]: establece la longitud máxima de las ubicaciones que se pueden añadir (0 para el valor por defecto) y si los nombres de host y las URL se pasan a minúsculas al añadirlos o buscarlos. Sin argumentos, muestra las reglas actuales.",
+	"add a metadata tag to the credential at [location]": "añade una etiqueta de metadatos a la credencial de [location]",
+	"edit an existing metadata tag at [location].":       "edita una etiqueta de metadatos existente de [location].",
+	"delete an existing metadata tag at [location].":     "elimina una etiqueta de metadatos existente de [location].",
+	"import a csv file.\nThe location key, username key, and password key are the CSV key names used to locate each value. Extra keys will be added to the vault as meta tags. Press Ctrl-C to stop, keeping the credentials imported so far.":                                    "importa un archivo csv.\nlocation key, username key y password key son los nombres de las columnas del CSV que contienen cada valor. Las demás columnas se añaden a la bóveda como etiquetas meta. Pulsa Ctrl-C para detenerlo, conservando las credenciales importadas hasta entonces.",
+	"exportpass [--store-dir dir] [--gpg-id id]: export every credential to a pass (password-store) directory, encrypted to the gpg id. The store defaults to $PASSWORD_STORE_DIR or ~/.password-store, and the gpg id to the store's .gpg-id.":                                   "exportpass [--store-dir dir] [--gpg-id id]: exporta todas las credenciales a un directorio de pass (password-store), cifradas para el id de gpg. El directorio es por defecto $PASSWORD_STORE_DIR o ~/.password-store, y el id de gpg el .gpg-id del directorio.",
+	"exportbrowser [--include-usernames] [path to csv]: export every credential to a CSV file that Chrome and Firefox can import. The file contains plaintext passwords, delete it once it has been imported. Masked usernames are left out unless --include-usernames is given.": "exportbrowser [--include-usernames] [path to csv]: exporta todas las credenciales a un archivo CSV que Chrome y Firefox pueden importar. El archivo contiene las contraseñas en claro: elimínalo una vez importado. Los nombres de usuario ocultos se omiten salvo que se indique --include-usernames.",
+	"import the export of another password manager. Supported formats: %v. Locations that are already taken have the username or a number appended. Press Ctrl-C to stop, keeping the credentials imported so far.":                                                               "importa la exportación de otro gestor de contraseñas. Formatos admitidos: %v. A las ubicaciones que ya existen se les añade el nombre de usuario o un número. Pulsa Ctrl-C para detenerlo, conservando las credenciales importadas hasta entonces.",
+	"change the master password for the vault": "cambia la contraseña maestra de la bóveda",
+	"set a second password that opens a decoy vault, kept hidden in the same file, instead of this one (decoy), or destroys this one and opens an empty vault (wipe), or remove it (off)": "establece una segunda contraseña que abre una bóveda señuelo, oculta en el mismo archivo, en lugar de esta (decoy), o destruye esta y abre una bóveda vacía (wipe), o la quita (off)",
+	"allow changes to a vault opened with -protect-writes": "permite cambios en una bóveda abierta con -protect-writes",
+	"question [add|clip|list|delete] [location] [question]: manage security questions. add stores a random answer to a question, clip copies the answer of the question matching the given text, list shows the questions at location, and delete removes one.":                                                                                                                                                                                                                           "question [add|clip|list|delete] [location] [question]: gestiona preguntas de seguridad. add guarda una respuesta aleatoria a una pregunta, clip copia la respuesta de la pregunta que coincide con el texto indicado, list muestra las preguntas de location y delete elimina una.",
+	"alias [add|delete|list] [alias] [location]: manage aliases. add makes alias refer to the credential at location, so that get, clip and the other commands accept it, delete removes an alias, and list shows every alias. Aliases are deleted along with their credential.":                                                                                                                                                                                                          "alias [add|delete|list] [alias] [location]: gestiona alias. add hace que alias se refiera a la credencial de location, para que get, clip y los demás comandos lo acepten, delete elimina un alias y list muestra todos los alias. Los alias se eliminan junto con su credencial.",
+	"tokens [tag|untag|expiring]: track when API tokens and SSH keys expire. tag [--provider name] [--expires date|90d|never] [--scopes a,b] [location] marks location as a token; the provider (github, aws, gcp, ssh or any other name) is guessed from the password if not given, and known providers default to their usual lifetime. untag [location] removes the mark. expiring [--within 30d] lists tokens that expire within the given time, with hints on where to rotate them.": "tokens [tag|untag|expiring]: controla cuándo caducan los tokens de API y las claves SSH. tag [--provider name] [--expires date|90d|never] [--scopes a,b] [location] marca location como token; si no se indica el proveedor (github, aws, gcp, ssh o cualquier otro nombre), se deduce de la contraseña, y los proveedores conocidos tienen por defecto su duración habitual. untag [location] quita la marca. expiring [--within 30d] lista los tokens que caducan dentro del plazo indicado, con indicaciones de dónde renovarlos.",
+	"maskusername [location] [on|off]: treat the username at location as sensitive, masking it in output and leaving it out of plaintext exports. Without a location, every username in the vault is masked.":                                                                                                                                                                                                                                                                             "maskusername [location] [on|off]: trata el nombre de usuario de location como sensible, ocultándolo al mostrarlo y omitiéndolo de las exportaciones en claro. Sin location, se ocultan todos los nombres de usuario de la bóveda.",
+	"change a session option. Options: presentation, which hides passwords, notes and meta values and partially masks usernames, for screen sharing, and debug, which reports how long each command took, as -verbose does.":                                                                                                                                                                                                                                                              "cambia una opción de la sesión. Opciones: presentation, que oculta contraseñas, notas y valores meta y oculta en parte los nombres de usuario, para compartir pantalla, y debug, que informa de cuánto tardó cada comando, como -verbose.",
+	"rekey [argon2 time] [argon2 memory in MiB]: re-encrypt and save the vault under a fresh salt and key, keeping the master password. The key derivation parameters are unchanged unless given.":                                                                                                                                                                                                                                                                                        "rekey [argon2 time] [argon2 memory in MiB]: vuelve a cifrar y guarda la bóveda con una sal y una clave nuevas, manteniendo la contraseña maestra. Los parámetros de derivación de la clave no cambian salvo que se indiquen.",
+	"merge the vaults at each location with the currently open vault. The vaults are opened in parallel.":                                                                                                                                                                                                                                                                                                                                                                                 "fusiona las bóvedas de cada location con la bóveda abierta. Las bóvedas se abren en paralelo.",
+	"remote [set url|enroll name|pair|devices|revoke name|sync|off]: sync the vault through a sync server started with masterkey syncserver. set stores the vault's URL on the server, such as https://example.com/vaults/personal. enroll enrolls this device under name, given a pairing code or, for the first device, the server's token. pair shows a code that enrolls another device, devices lists the enrolled devices, and revoke stops a lost device from reading or writing the vault on the server. sync merges the server's copy into the open vault and uploads the result, and off forgets the server. The server only ever sees the encrypted vault.": "remote [set url|enroll name|pair|devices|revoke name|sync|off]: sincroniza la bóveda a través de un servidor iniciado con masterkey syncserver. set guarda la URL de la bóveda en el servidor, como https://example.com/vaults/personal. enroll registra este dispositivo como name, dado un código de emparejamiento o, para el primer dispositivo, el token del servidor. pair muestra un código que registra otro dispositivo, devices lista los dispositivos registrados y revoke impide que un dispositivo perdido lea o escriba la bóveda en el servidor. sync fusiona la copia del servidor con la bóveda abierta y sube el resultado, y off olvida el servidor. El servidor solo ve la bóveda cifrada.",
+	"bring in the changes made to another copy of the currently open vault, such as a conflicted copy left by a file sync tool. The most recent change to each credential wins.": "incorpora los cambios hechos en otra copia de la bóveda abierta, como una copia en conflicto dejada por una herramienta de sincronización de archivos. Prevalece el cambio más reciente de cada credencial.",
+
+	// argument errors
+	"%v takes no arguments. See help for usage.":                   "%v no admite argumentos. Consulta help para ver su uso.",
+	"%v requires %v arguments. See help for usage.":                "%v requiere %v argumentos. Consulta help para ver su uso.",
+	"%v requires at least %v arguments. See help for usage.":       "%v requiere al menos %v argumentos. Consulta help para ver su uso.",
+	"%v requires %v to %v arguments. See help for usage.":          "%v requiere de %v a %v argumentos. Consulta help para ver su uso.",
+	"%v must be one of %v. See help for usage.":                    "%v debe ser uno de %v. Consulta help para ver su uso.",
+	"%v must be a whole number. See help for usage.":               "%v debe ser un número entero. Consulta help para ver su uso.",
+	"%v must be a duration such as 30s or 2m. See help for usage.": "%v debe ser una duración como 30s o 2m. Consulta help para ver su uso.",
+	"Arguments:":                   "Argumentos:",
+	"optional":                     "opcional",
+	"repeatable":                   "se puede repetir",
+	"one of %v":                    "uno de %v",
+	"a whole number":               "un número entero",
+	"a duration such as 30s or 2m": "una duración como 30s o 2m",
+
+	// command errors
+	"%v requires 1 argument. See help for usage.":                                                                               "%v requiere 1 argumento. Consulta help para ver su uso.",
+	"%v requires 0 or 2 arguments. See help for usage.":                                                                         "%v requiere 0 o 2 argumentos. Consulta help para ver su uso.",
+	"%v requires 1 or 2 arguments. See help for usage.":                                                                         "%v requiere 1 o 2 argumentos. Consulta help para ver su uso.",
+	"%v requires two arguments. See help for usage.":                                                                            "%v requiere dos argumentos. Consulta help para ver su uso.",
+	"%v requires at least 1 argument. See help for usage.":                                                                      "%v requiere al menos 1 argumento. Consulta help para ver su uso.",
+	"%v requires at least one argument. See help for usage.":                                                                    "%v requiere al menos un argumento. Consulta help para ver su uso.",
+	"%v requires at least three arguments. See help for usage.":                                                                 "%v requiere al menos tres argumentos. Consulta help para ver su uso.",
+	"%v requires 1 argument, the location. See help for usage.":                                                                 "%v requiere 1 argumento, la ubicación. Consulta help para ver su uso.",
+	"%v requires on or off. See help for usage.":                                                                                "%v requiere on u off. Consulta help para ver su uso.",
+	"%v requires a path. See help for usage.":                                                                                   "%v requiere una ruta. Consulta help para ver su uso.",
+	"%v requires --stale. See help for usage.":                                                                                  "%v requiere --stale. Consulta help para ver su uso.",
+	"%v requires 3 arguments, or 2 for list. See help for usage.":                                                               "%v requiere 3 argumentos, o 2 para list. Consulta help para ver su uso.",
+	"%v requires add with 2 arguments, delete with 1, or list. See help for usage.":                                             "%v requiere add con 2 argumentos, delete con 1, o list. Consulta help para ver su uso.",
+	"%v requires timeout or clipboard with a duration or default, enforce with on or off, or no arguments. See help for usage.": "%v requiere timeout o clipboard con una duración o default, enforce con on u off, o ningún argumento. Consulta help para ver su uso.",
+	"list only accepts --all, --sort, --tag and --folder. See help for usage.":                                                  "list solo admite --all, --sort, --tag y --folder. Consulta help para ver su uso.",
+	"status only accepts --sizes and a positive --top. See help for usage.":                                                     "status solo admite --sizes y un --top positivo. Consulta help para ver su uso.",
+	"exportpass only accepts --store-dir and --gpg-id. See help for usage.":                                                     "exportpass solo admite --store-dir y --gpg-id. Consulta help para ver su uso.",
+	"tokens expiring only accepts --within. See help for usage.":                                                                "tokens expiring solo admite --within. Consulta help para ver su uso.",
+	"unknown icon action %v. See help for usage.":                                                                               "acción de icon desconocida: %v. Consulta help para ver su uso.",
+	"unknown question action %v. See help for usage.":                                                                           "acción de question desconocida: %v. Consulta help para ver su uso.",
+	"unknown tokens action %v. See help for usage.":                                                                             "acción de tokens desconocida: %v. Consulta help para ver su uso.",
+	"unknown policy %v. See help for usage.":                                                                                    "política desconocida: %v. Consulta help para ver su uso.",
+	"unknown sort order %v, expected name, modified, last-used or uses":                                                         "orden desconocido: %v. Se esperaba name, modified, last-used o uses",
+	"%v is not a positive duration such as 2m or 10s":                                                                           "%v no es una duración positiva como 2m o 10s",
+	"invalid duration %v": "duración no válida: %v",
+	"--expires must be a date like 2006-01-02, a lifetime like 90d, or never":        "--expires debe ser una fecha como 2006-01-02, una duración como 90d, o never",
+	"could not tell which provider issued the token at %v, give one with --provider": "no se pudo saber qué proveedor emitió el token de %v; indícalo con --provider",
+	"this vault does not allow secrets on the clipboard for longer than %v":          "esta bóveda no permite secretos en el portapapeles durante más de %v",
+	"max length must be a non-negative number":                                       "la longitud máxima debe ser un número no negativo",
+	"size must be a number of MiB":                                                   "el tamaño debe ser un número de MiB",
+	"peek duration must be a positive number of seconds":                             "la duración de peek debe ser un número positivo de segundos",
+	"argon2 time must be a positive number":                                          "argon2 time debe ser un número positivo",
+	"argon2 memory must be a positive number of MiB":                                 "argon2 memory debe ser un número positivo de MiB",
+	"passwords did not match: %v":                                                    "las contraseñas no coinciden: %v",
+	"could not open %v: %v":                                                          "no se pudo abrir %v: %v",
+	"could not read %v: %v":                                                          "no se pudo leer %v: %v",
+	"exportyaml [--with-secrets] [--tag tag] [--folder folder] [path] [searchtext]: write the credentials whose locations contain searchtext, or every credential, to a YAML file for editing by hand and applying back with importyaml. --tag and --folder narrow them down. Passwords, and usernames the vault masks, are only written with --with-secrets.": "exportyaml [--with-secrets] [--tag tag] [--folder folder] [path] [searchtext]: escribe las credenciales cuya ubicación contiene searchtext, o todas, en un archivo YAML para editarlo a mano y aplicarlo de vuelta con importyaml. --tag y --folder las acotan. Las contraseñas, y los nombres de usuario que la bóveda enmascara, solo se escriben con --with-secrets.",
+	"importyaml [--dry-run] [path]: apply the changes made to a YAML file written by exportyaml to the credentials in it, after checking every entry, and list what changed. --dry-run lists the changes without making them. Credentials left out of the file are not changed, and nor are empty passwords and usernames.":                                    "importyaml [--dry-run] [path]: aplica a las credenciales del archivo YAML escrito con exportyaml los cambios hechos en él, tras comprobar cada entrada, y lista lo que cambió. --dry-run lista los cambios sin hacerlos. Las credenciales que no están en el archivo no cambian, ni tampoco las contraseñas y nombres de usuario vacíos.",
+	"bulkedit [--with-secrets] [--tag tag] [--folder folder] [searchtext]: edit the tags, meta tags, notes and other fields of the credentials whose locations contain searchtext, or every credential, together as YAML in $EDITOR, then review the changes before they are made.":                                                                            "bulkedit [--with-secrets] [--tag tag] [--folder folder] [searchtext]: edita las etiquetas, etiquetas meta, notas y demás campos de las credenciales cuya ubicación contiene searchtext, o de todas, juntas como YAML en $EDITOR, y luego revisa los cambios antes de hacerlos.",
+	"bulkedit only accepts --with-secrets, --tag, --folder and searchtext. See help for usage.": "bulkedit solo acepta --with-secrets, --tag, --folder y searchtext. Consulta help para ver su uso.",
+	"changes discarded: %v":                                                           "cambios descartados: %v",
+	"could not read a QR code from %v: %v":                                            "no se pudo leer un código QR de %v: %v",
+	"the QR code in %v is not a two-factor code: %v":                                  "el código QR de %v no es un código de verificación en dos pasos: %v",
+	"the QR code in %v does not name its issuer, so give the location to store it at": "el código QR de %v no indica su emisor, así que indica la ubicación donde guardarlo",
+	"%v already has a TOTP secret":                                                    "%v ya tiene un secreto TOTP",
+	"merging %v: %v":                                                                  "al fusionar %v: %v",
+	"import canceled after importing %v of %v credentials":                            "importación cancelada tras importar %v de %v credenciales",
+	"importcsv canceled after importing %v credentials":                               "importcsv cancelado tras importar %v credenciales",
+	"imported %v credentials before failing: %v":                                      "se importaron %v credenciales antes del fallo: %v",
+	"exported %v credentials before failing: %v":                                      "se exportaron %v credenciales antes del fallo: %v",
+	"delete --match requires non-empty search text":                                   "delete --match requiere un texto de búsqueda no vacío",
+	"master password did not match, operation cancelled":                              "la contraseña maestra no coincide, operación cancelada",
+	"this vault does not track usage. Turn it on with `trackusage on`":                "esta bóveda no registra el uso. Actívalo con `trackusage on`",
+	"credential at specified location does not exist in vault":                        "no existe ninguna credencial en la ubicación indicada",
+	"credential at specified location already exists":                                 "ya existe una credencial en la ubicación indicada",
+	"meta tag already exists":                                                         "la etiqueta meta ya existe",
+	"meta tag does not exist":                                                         "la etiqueta meta no existe",
+	"nothing to undo":                                                                 "no hay nada que deshacer",
+	"nothing to redo":                                                                 "no hay nada que rehacer",
+	"URL must be absolute, such as https://example.com/login":                         "la URL debe ser absoluta, como https://example.com/login",
+	"email must be an address such as alice@example.com":                              "el correo electrónico debe ser una dirección como alice@example.com",
+	"tags must not be empty or contain whitespace":                                    "las etiquetas no pueden estar vacías ni contener espacios",
+	"credential has no TOTP secret. Add one with `addmeta location totp secret`":      "la credencial no tiene secreto TOTP. Añade uno con `addmeta location totp secret`",
+	"TOTP secret is not a base32 secret or otpauth://totp/ URI":                       "el secreto TOTP no es un secreto en base32 ni una URI otpauth://totp/",
+	"no snapshot with that name":                                                      "no hay ninguna instantánea con ese nombre",
+
+	// command line
+	"Usage: masterkey [-new] vault\n       masterkey https://example.com/vaults/name\n       masterkey compact vault\n       masterkey upgrade vault|directory...\n       masterkey syncserver [-addr :8443] [-tls-cert file -tls-key file] directory\n       masterkey resolve [vault] < file > expanded\n       masterkey scan vault [file|directory...]\n       masterkey scan -staged vault\n       masterkey run [-keep-going] vault script\n       masterkey receive [-listen :0] vault\n       masterkey send -to address vault location...|--all\n       masterkey remote [-ssh command] [-masterkey path] [user@]host:vault": "Uso: masterkey [-new] vault\n     masterkey https://example.com/vaults/name\n     masterkey compact vault\n     masterkey upgrade vault|directory...\n     masterkey syncserver [-addr :8443] [-tls-cert file -tls-key file] directory\n     masterkey resolve [vault] < file > expanded\n     masterkey scan vault [file|directory...]\n     masterkey scan -staged vault\n     masterkey run [-keep-going] vault script\n     masterkey receive [-listen :0] vault\n     masterkey send -to address vault location...|--all\n     masterkey remote [-ssh command] [-masterkey path] [user@]host:vault",
+	"report how long each shell command took, and how much of that was spent deriving keys, decrypting, encoding, saving and on the network": "informa de cuánto tardó cada comando del intérprete, y cuánto de ello se dedicó a derivar claves, descifrar, codificar, guardar y a la red",
+	"do not warn about weak settings, such as cheap key derivation or a vault file other users can read, when opening the vault":             "no avisa de ajustes débiles, como una derivación de clave barata o un archivo de bóveda que otros usuarios pueden leer, al abrir la bóveda",
+	"print only results, warnings and errors, leaving out messages about what masterkey is doing":                                            "muestra solo resultados, avisos y errores, omitiendo los mensajes sobre lo que está haciendo masterkey",
+	"write errors to stderr as JSON objects with a code, message and location, for programs wrapping masterkey":                              "escribe los errores en stderr como objetos JSON con un código, un mensaje y una ubicación, para programas que usan masterkey",
+	"whether to create a new vault at the specified location":                                                                                "crea una bóveda nueva en la ubicación indicada",
+	"spawn the repl shell": "abre el intérprete de comandos",
+	"use numbered menus written line by line, for screen readers, instead of the terminal UI":                                                   "usa menús numerados escritos línea a línea, para lectores de pantalla, en lugar de la interfaz de terminal",
+	"how long to wait with no vault activity before exiting, unless the vault sets its own with policy":                                         "cuánto esperar sin actividad en la bóveda antes de salir, salvo que la bóveda fije su propio tiempo con policy",
+	"how long copied secrets stay on the clipboard, unless the vault sets its own with policy":                                                  "cuánto tiempo permanecen en el portapapeles los secretos copiados, salvo que la bóveda fije su propio tiempo con policy",
+	"save the vault shortly after every change, instead of only on exit":                                                                        "guarda la bóveda poco después de cada cambio, en lugar de solo al salir",
+	"when creating a vault, briefly show the last character typed in the passphrase":                                                            "al crear una bóveda, muestra brevemente el último carácter escrito de la contraseña",
+	"start in presentation mode, which hides passwords and partially masks usernames":                                                           "empieza en modo presentación, que oculta las contraseñas y en parte los nombres de usuario",
+	"open the vault read-only, for a duration such as 30s or until unlock-writes if set to on":                                                  "abre la bóveda en solo lectura durante un tiempo como 30s, o hasta unlock-writes si es on",
+	"when to re-encrypt the vault under a fresh salt: open, save (with the first change), or manual (only on changepassword or rekey)":          "cuándo volver a cifrar la bóveda con una sal nueva: open, save (con el primer cambio) o manual (solo con changepassword o rekey)",
+	"when the screen locks or the machine wakes from sleep: lock the vault (the shell exits, as it can not be locked), exit, or off":            "al bloquearse la pantalla o despertar el equipo: lock bloquea la bóveda (el intérprete sale, ya que no se puede bloquear), exit sale, u off",
+	"when creating a vault, create a directory holding one encrypted file per credential, so file sync tools only transfer changed credentials": "al crear una bóveda, crea un directorio con un archivo cifrado por credencial, para que las herramientas de sincronización solo transfieran las credenciales cambiadas",
+	"copy secrets to the clipboard of the terminal using OSC 52, as is done over SSH when the remote host has no clipboard":                     "copia los secretos al portapapeles de la terminal usando OSC 52, como se hace por SSH cuando el host remoto no tiene portapapeles",
+	"unknown -rotate policy %q, expected open, save or manual":                                                                                  "política de -rotate desconocida: %q. Se esperaba open, save o manual",
+	"unknown -screenlock action %q, expected lock, exit or off":                                                                                 "acción de -screenlock desconocida: %q. Se esperaba lock, exit u off",
+	"-protect-writes must be on or a positive duration such as 30s":                                                                             "-protect-writes debe ser on o una duración positiva como 30s",
+	"Password for %v: ":                      "Contraseña de %v: ",
+	"recovered %v unsaved changes from %v\n": "se recuperaron %v cambios sin guardar de %v\n",
+	"warning: copying to the clipboard through the terminal, but %v terminals do not support it, so copied secrets will not reach your clipboard\n": "aviso: se copia al portapapeles a través de la terminal, pero las terminales %v no lo admiten, así que los secretos copiados no llegarán a tu portapapeles\n",
+	"Opening %v...\n":                     "Abriendo %v...\n",
+	"clearing clipboard and saving vault": "limpiando el portapapeles y guardando la bóveda",
+	"%v is open by another masterkey instance! exit that instance first, or remove %v before opening this vault.": "¡%v está abierta en otra instancia de masterkey! Cierra esa instancia primero, o elimina %v antes de abrir esta bóveda.",
+	"incorrect passphrase for %v": "contraseña incorrecta para %v",
+	"warning: %v is %v bytes, larger than the %v byte size warning. Run status --sizes in the shell to find the largest credentials.\n": "aviso: %v ocupa %v bytes, más que el aviso de tamaño de %v bytes. Ejecuta status --sizes en el intérprete para ver las credenciales más grandes.\n",
+	"vaults can not be created on a sync server. Create one locally, then upload it with remote set and remote sync":                    "no se pueden crear bóvedas en un servidor de sincronización. Crea una localmente y súbela con remote set y remote sync",
+	"\nexiting because %v\n":      "\nsaliendo porque %v\n",
+	"the screen was locked":       "se bloqueó la pantalla",
+	"the machine woke from sleep": "el equipo despertó de la suspensión",
+	"%v is corrupt or has been modified and can not be decrypted, even with the correct passphrase. Restore it from a backup.": "%v está dañada o ha sido modificada y no se puede descifrar, ni siquiera con la contraseña correcta. Restáurala desde una copia de seguridad.",
+
+	// terminal UI
+	"Passwords":                             "Contraseñas",
+	"Copy":                                  "Copiar",
+	"Generate":                              "Generar",
+	"Add":                                   "Añadir",
+	"Edit":                                  "Editar",
+	"Save+Quit":                             "Guardar y salir",
+	"Search":                                "Buscar",
+	"Notes":                                 "Notas",
+	"Generate Login":                        "Generar acceso",
+	"Add Login":                             "Añadir acceso",
+	"Edit Login":                            "Editar acceso",
+	"Delete Login":                          "Eliminar acceso",
+	"Notes: %v":                             "Notas: %v",
+	"search: ":                              "buscar: ",
+	"Master Password":                       "Contraseña maestra",
+	"Delete %v? (y/n)":                      "¿Eliminar %v? (y/n)",
+	"copied %v to keyboard, clearing in %v": "%v copiada al portapapeles, se limpiará en %v",
+	"no notes. use the notes command in masterkey -repl to add some.": "no hay notas. Usa el comando notes de masterkey -repl para añadirlas.",
+	"presentation mode off":                                        "modo presentación desactivado",
+	"presentation mode on, secrets are hidden":                     "modo presentación activado, los secretos están ocultos",
+	"archived logins hidden":                                       "accesos archivados ocultos",
+	"showing archived logins":                                      "mostrando los accesos archivados",
+	"recovered %v unsaved changes":                                 "se recuperaron %v cambios sin guardar",
+	"vault locked, enter the master password to unlock":            "bóveda bloqueada, introduce la contraseña maestra para desbloquearla",
+	"deriving argon2id key, one moment":                            "derivando la clave argon2id, un momento",
+	"vault locked because %v, enter the master password to unlock": "bóveda bloqueada porque %v, introduce la contraseña maestra para desbloquearla",
+	"upgraded from an older format, saved on quit":                 "actualizada desde un formato anterior, se guardará al salir",
+}
@@ -0,0 +1,86 @@
+// Package i18n translates masterkey's user-facing messages. Messages are
+// written in English where they are used, and the English message is the key
+// into each language's catalog, so a message missing from a catalog is shown
+// in English rather than not at all.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// catalogs maps a language, as in the LANG environment variable, to its
+// translations.
+var catalogs = map[string]map[string]string{
+	"es": spanish,
+}
+
+// Printer formats messages in one language. A nil Printer formats them in
+// English.
+type Printer struct {
+	lang     string
+	messages map[string]string
+}
+
+// NewPrinter returns a Printer for `lang`, a locale such as es, es_ES or
+// es_ES.UTF-8. Unknown languages, and C and POSIX, are English.
+func NewPrinter(lang string) *Printer {
+	lang = strings.SplitN(lang, ".", 2)[0]
+	lang = strings.SplitN(lang, "@", 2)[0]
+	for _, candidate := range []string{lang, strings.SplitN(lang, "_", 2)[0]} {
+		if messages, ok := catalogs[candidate]; ok {
+			return &Printer{lang: candidate, messages: messages}
+		}
+	}
+	return &Printer{lang: "en"}
+}
+
+// Language returns the locale set for messages in the environment, taken
+// from LC_ALL, LC_MESSAGES or LANG, in that order.
+func Language() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang := os.Getenv(env); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// Language returns the language p translates into, such as es, or en if it
+// leaves messages in English.
+func (p *Printer) Language() string {
+	if p == nil {
+		return "en"
+	}
+	return p.lang
+}
+
+// Translate returns the translation of `message`, or `message` itself if it
+// has none.
+func (p *Printer) Translate(message string) string {
+	if p == nil {
+		return message
+	}
+	if translated, ok := p.messages[message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Sprintf formats the translation of `format` using `a`, like fmt.Sprintf.
+func (p *Printer) Sprintf(format string, a ...interface{}) string {
+	return fmt.Sprintf(p.Translate(format), a...)
+}
+
+// Printf prints the translation of `format` formatted using `a` to stdout,
+// like fmt.Printf.
+func (p *Printer) Printf(format string, a ...interface{}) (int, error) {
+	return fmt.Printf(p.Translate(format), a...)
+}
+
+// Errorf returns an error formatted from the translation of `format` using
+// `a`, like fmt.Errorf.
+func (p *Printer) Errorf(format string, a ...interface{}) error {
+	return fmt.Errorf(p.Translate(format), a...)
+}
@@ -0,0 +1,85 @@
+package i18n
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewPrinter(t *testing.T) {
+	for lang, expected := range map[string]string{
+		"es":              "es",
+		"es_MX":           "es",
+		"es_ES.UTF-8":     "es",
+		"es_ES@euro":      "es",
+		"en_US.UTF-8":     "en",
+		"C":               "en",
+		"POSIX":           "en",
+		"":                "en",
+		"xx_YY.ISO8859-1": "en",
+	} {
+		if got := NewPrinter(lang).Language(); got != expected {
+			t.Errorf("NewPrinter(%q) is %v, expected %v", lang, got, expected)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if old, ok := os.LookupEnv(env); ok {
+			defer os.Setenv(env, old)
+		} else {
+			defer os.Unsetenv(env)
+		}
+		os.Setenv(env, "")
+	}
+	os.Setenv("LANG", "de_DE.UTF-8")
+	if Language() != "de_DE.UTF-8" {
+		t.Fatal("LANG was not used:", Language())
+	}
+	os.Setenv("LC_MESSAGES", "es_ES.UTF-8")
+	if Language() != "es_ES.UTF-8" {
+		t.Fatal("LC_MESSAGES did not override LANG:", Language())
+	}
+	os.Setenv("LC_ALL", "C")
+	if Language() != "C" {
+		t.Fatal("LC_ALL did not override LC_MESSAGES:", Language())
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	p := NewPrinter("es")
+	if got := p.Translate("clear the terminal"); got != "limpia la terminal" {
+		t.Fatal("message was not translated:", got)
+	}
+	if got := p.Translate("not in the catalog"); got != "not in the catalog" {
+		t.Fatal("untranslated message was changed:", got)
+	}
+	if got := p.Errorf("%v requires 1 argument. See help for usage.", "delete").Error(); got != "delete requiere 1 argumento. Consulta help para ver su uso." {
+		t.Fatal("error was not translated:", got)
+	}
+
+	var english *Printer
+	if got := english.Sprintf("%v requires 1 argument. See help for usage.", "delete"); got != "delete requires 1 argument. See help for usage." {
+		t.Fatal("nil Printer changed the message:", got)
+	}
+	if got := NewPrinter("en").Translate("clear the terminal"); got != "clear the terminal" {
+		t.Fatal("English Printer changed the message:", got)
+	}
+}
+
+// TestCatalogVerbs checks that every translation formats the same arguments,
+// in the same order, as its message.
+func TestCatalogVerbs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+	for lang, messages := range catalogs {
+		for message, translated := range messages {
+			expected := verbs.FindAllString(message, -1)
+			got := verbs.FindAllString(translated, -1)
+			if strings.Join(got, " ") != strings.Join(expected, " ") {
+				t.Errorf("%v translation of %q formats %v, expected %v", lang, message, got, expected)
+			}
+		}
+	}
+}
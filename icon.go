@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// faviconTimeout bounds how long fetchFavicon waits for a site.
+const faviconTimeout = 10 * time.Second
+
+// fetchFavicon downloads /favicon.ico from `site`, which may be a hostname or
+// a URL. Hostnames are fetched over https.
+func fetchFavicon(site string) ([]byte, error) {
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%v is not a hostname or URL", site)
+	}
+	faviconURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/favicon.ico"}
+
+	client := timedClient(faviconTimeout)
+	resp, err := client.Get(faviconURL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch %v: %v", faviconURL.String(), resp.Status)
+	}
+
+	icon, err := ioutil.ReadAll(io.LimitReader(resp.Body, vault.MaxIconSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(icon) > vault.MaxIconSize {
+		return nil, vault.ErrIconTooLarge
+	}
+	return icon, nil
+}
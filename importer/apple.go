@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// Apple reads the CSV exported by the macOS Passwords app, Safari, or
+// Keychain Access, with the columns Title, URL, Username, Password, Notes,
+// and OTPAuth. It also accepts the output of `security dump-keychain -d`.
+// URLs are stored in the credential's URL and OTP URIs in the `otpauth` meta
+// tag.
+func Apple(r io.Reader) ([]Entry, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("keychain:")) {
+		return appleKeychainDump(bytes.NewReader(data))
+	}
+
+	records, err := csvRecords(bytes.NewReader(data), "password")
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, record := range records {
+		url := record["url"]
+		cred := vault.Credential{
+			Username: record["username"],
+			Password: record["password"],
+			Notes:    record["notes"],
+			URL:      url,
+		}
+		addMeta(&cred, "otpauth", record["otpauth"])
+		entries = append(entries, Entry{
+			Location:   locationFor(record["title"], url, "keychain item"),
+			Credential: cred,
+		})
+	}
+	return entries, nil
+}
+
+// appleKeychainDump reads the output of `security dump-keychain -d`. Only
+// internet and generic password items are read; keys and certificates are
+// ignored.
+func appleKeychainDump(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var class string
+	var attrs map[string]string
+	inData := false
+
+	flush := func(password string) {
+		if class != "inet" && class != "genp" {
+			return
+		}
+		cred := vault.Credential{Username: attrs["acct"], Password: password}
+		host := attrs["srvr"]
+		if class == "genp" {
+			host = attrs["svce"]
+		}
+		if class == "inet" && host != "" {
+			cred.URL = keychainURL(attrs["ptcl"], host, attrs["path"])
+		}
+		addMeta(&cred, "comment", attrs["icmt"])
+		entries = append(entries, Entry{
+			Location:   locationFor(attrs["0x00000007"], "", host),
+			Credential: cred,
+		})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "keychain:"):
+			class = ""
+			attrs = make(map[string]string)
+			inData = false
+		case strings.HasPrefix(line, "class:"):
+			class, _ = keychainValue(strings.TrimSpace(strings.TrimPrefix(line, "class:")))
+		case line == "data:":
+			inData = true
+		case inData:
+			password, _ := keychainValue(trimmed)
+			flush(password)
+			inData = false
+		case strings.HasPrefix(line, "    ") && attrs != nil:
+			eq := strings.Index(trimmed, "=")
+			typeStart := strings.Index(trimmed, "<")
+			if eq < 0 || typeStart < 0 || typeStart > eq {
+				continue
+			}
+			name := strings.Trim(strings.TrimSpace(trimmed[:typeStart]), `"`)
+			if value, ok := keychainValue(trimmed[eq+1:]); ok {
+				attrs[name] = value
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// keychainValue decodes a value from a keychain dump, which is either a
+// quoted string, `<NULL>`, or hex bytes followed by a quoted rendering, such
+// as `0x6869  "hi"`.
+func keychainValue(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "<NULL>" {
+		return "", false
+	}
+	if strings.HasPrefix(s, "0x") {
+		hexpart := s[2:]
+		if i := strings.IndexAny(hexpart, " \t"); i >= 0 {
+			hexpart = hexpart[:i]
+		}
+		if b, err := hex.DecodeString(hexpart); err == nil {
+			return string(b), true
+		}
+	}
+	if strings.HasPrefix(s, `"`) {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted, true
+		}
+		return strings.Trim(s, `"`), true
+	}
+	return s, true
+}
+
+// keychainURL builds a URL from the protocol, server, and path attributes of
+// an internet password item.
+func keychainURL(protocol string, server string, path string) string {
+	scheme := "https"
+	switch strings.TrimSpace(protocol) {
+	case "http":
+		scheme = "http"
+	case "ftp":
+		scheme = "ftp"
+	}
+	return scheme + "://" + server + path
+}
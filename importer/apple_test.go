@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestAppleCSV(t *testing.T) {
+	export := "\ufeffTitle,URL,Username,Password,Notes,OTPAuth\n" +
+		"github.com (user),https://github.com/,user,pass1,\"recovery\ncodes\",otpauth://totp/GitHub:user?secret=JBSWY3DPEHPK3PXP\n" +
+		",https://example.com/login,user2,pass2,,\n"
+	entries, err := Apple(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Location: "github.com (user)", Credential: vault.Credential{
+			Username: "user",
+			Password: "pass1",
+			Notes:    "recovery\ncodes",
+			URL:      "https://github.com/",
+			Meta:     map[string]string{"otpauth": "otpauth://totp/GitHub:user?secret=JBSWY3DPEHPK3PXP"},
+		}},
+		{Location: "example.com", Credential: vault.Credential{
+			Username: "user2",
+			Password: "pass2",
+			URL:      "https://example.com/login",
+		}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
+func TestAppleKeychainDump(t *testing.T) {
+	dump := `keychain: "/Users/user/Library/Keychains/login.keychain-db"
+version: 512
+class: "inet"
+attributes:
+    0x00000007 <blob>="github.com"
+    "acct"<blob>="user"
+    "path"<blob>="/login"
+    "ptcl"<uint32>="htps"
+    "srvr"<blob>="github.com"
+data:
+"pass\"word"
+keychain: "/Users/user/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    0x00000007 <blob>=<NULL>
+    "acct"<blob>="wifiuser"
+    "svce"<blob>="Home WiFi"
+data:
+0x70617373  "pass"
+keychain: "/Users/user/Library/Keychains/login.keychain-db"
+version: 512
+class: 0x80001000 
+attributes:
+    "alis"<blob>="certificate"
+data:
+<NULL>
+`
+	entries, err := Apple(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Location: "github.com", Credential: vault.Credential{
+			Username: "user",
+			Password: `pass"word`,
+			URL:      "https://github.com/login",
+		}},
+		{Location: "Home WiFi", Credential: vault.Credential{
+			Username: "wifiuser",
+			Password: "pass",
+		}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
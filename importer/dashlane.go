@@ -0,0 +1,150 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// Dashlane reads a Dashlane export. Both the JSON export and the CSV files
+// in Dashlane's CSV export (credentials.csv, securenotes.csv, and the
+// personal info, payments, and ids files) are accepted; pass each CSV file
+// to the importer in turn. Logins keep their url and email in the
+// credential's URL and Email, and logins and notes are filed in a folder
+// named after their category. Secure notes become credentials with no
+// password, and identities, cards, and other form-fill items store each of
+// their fields as meta tags, with the item type in the `type` meta tag.
+func Dashlane(r io.Reader) ([]Entry, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return dashlaneJSON(data)
+	}
+	return dashlaneCSV(data)
+}
+
+// dashlaneCSV reads one of the CSV files of a Dashlane export, deciding
+// which from its columns.
+func dashlaneCSV(data []byte) ([]Entry, error) {
+	records, err := csvRecords(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, record := range records {
+		var cred vault.Credential
+		_, isLogin := record["password"]
+		_, hasNote := record["note"]
+		switch {
+		case isLogin:
+			cred = vault.Credential{
+				Username: firstOf(record, "username", "email", "username2"),
+				Password: record["password"],
+				Notes:    record["note"],
+				URL:      record["url"],
+				Email:    record["email"],
+			}
+			addMeta(&cred, "totp", record["otpsecret"])
+			cred.Folder = vault.CleanFolder(record["category"])
+		case hasNote && len(record) <= 4:
+			cred = vault.Credential{Notes: record["note"]}
+			addMeta(&cred, "type", "secure note")
+			cred.Folder = vault.CleanFolder(record["category"])
+		default:
+			cred = dashlaneItem(record, firstOf(record, "type"))
+		}
+		entries = append(entries, Entry{
+			Location:   locationFor(firstOf(record, "title", "item_name", "name"), record["url"], "dashlane item"),
+			Credential: cred,
+		})
+	}
+	return entries, nil
+}
+
+// dashlaneJSON reads Dashlane's JSON export, which groups items by type.
+func dashlaneJSON(data []byte) ([]Entry, error) {
+	var export map[string][]map[string]interface{}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+
+	var types []string
+	for itemType := range export {
+		types = append(types, itemType)
+	}
+	sort.Strings(types)
+
+	var entries []Entry
+	for _, itemType := range types {
+		for _, item := range export[itemType] {
+			fields := make(map[string]string)
+			for name, value := range item {
+				if value == nil {
+					continue
+				}
+				fields[strings.ToLower(name)] = fmt.Sprint(value)
+			}
+
+			var cred vault.Credential
+			switch itemType {
+			case "AUTHENTIFIANT":
+				cred = vault.Credential{
+					Username: firstOf(fields, "login", "email", "secondarylogin"),
+					Password: fields["password"],
+					Notes:    fields["note"],
+					URL:      firstOf(fields, "url", "domain"),
+					Email:    fields["email"],
+				}
+			case "SECURENOTE":
+				cred = vault.Credential{Notes: firstOf(fields, "content", "note")}
+				addMeta(&cred, "type", "secure note")
+			default:
+				cred = dashlaneItem(fields, strings.ToLower(itemType))
+			}
+			entries = append(entries, Entry{
+				Location:   locationFor(firstOf(fields, "title", "name", "domain", "fullname"), fields["url"], strings.ToLower(itemType)),
+				Credential: cred,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// dashlaneItem converts a form-fill item, such as an identity or card, into a
+// credential storing each non-empty field as a meta tag.
+func dashlaneItem(fields map[string]string, itemType string) vault.Credential {
+	var cred vault.Credential
+	for name, value := range fields {
+		switch name {
+		case "title", "item_name", "type":
+		case "note":
+			cred.Notes = value
+		default:
+			addMeta(&cred, name, value)
+		}
+	}
+	if itemType == "" {
+		itemType = "item"
+	}
+	addMeta(&cred, "type", itemType)
+	return cred
+}
+
+// firstOf returns the first non-empty value in `fields` of the given names.
+func firstOf(fields map[string]string, names ...string) string {
+	for _, name := range names {
+		if fields[name] != "" {
+			return fields[name]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestDashlaneCSV(t *testing.T) {
+	credentials := `username,username2,username3,title,password,note,url,category,otpSecret,email
+user,,,GitHub,pass1,,https://github.com,Work,,user@example.com
+`
+	notes := `title,note
+Home,"wifi password is
+hunter2"
+`
+	personalInfo := `type,title,first_name,last_name,email
+name,Me,Jane,Doe,
+`
+	var entries []Entry
+	for _, export := range []string{credentials, notes, personalInfo} {
+		read, err := Dashlane(strings.NewReader(export))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, read...)
+	}
+	expected := []Entry{
+		{Location: "GitHub", Credential: vault.Credential{
+			Username: "user",
+			Password: "pass1",
+			URL:      "https://github.com",
+			Email:    "user@example.com",
+			Folder:   "Work",
+		}},
+		{Location: "Home", Credential: vault.Credential{
+			Notes: "wifi password is\nhunter2",
+			Meta:  map[string]string{"type": "secure note"},
+		}},
+		{Location: "Me", Credential: vault.Credential{
+			Meta: map[string]string{"type": "name", "first_name": "Jane", "last_name": "Doe"},
+		}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
+func TestDashlaneJSON(t *testing.T) {
+	export := `{
+	"AUTHENTIFIANT": [{"domain": "github.com", "login": "user", "password": "pass1", "title": "GitHub", "note": ""}],
+	"SECURENOTE": [{"title": "Home", "content": "hunter2"}],
+	"IDENTITY": [{"fullName": "Jane Doe", "birthDate": "1990-01-01", "pseudo": null}]
+}`
+	entries, err := Dashlane(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Location: "GitHub", Credential: vault.Credential{
+			Username: "user",
+			Password: "pass1",
+			URL:      "github.com",
+		}},
+		{Location: "Jane Doe", Credential: vault.Credential{
+			Meta: map[string]string{"type": "identity", "fullname": "Jane Doe", "birthdate": "1990-01-01"},
+		}},
+		{Location: "Home", Credential: vault.Credential{
+			Notes: "hunter2",
+			Meta:  map[string]string{"type": "secure note"},
+		}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
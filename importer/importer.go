@@ -0,0 +1,224 @@
+// Package importer reads the exports of other password managers into
+// masterkey credentials.
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+type (
+	// Entry is a credential read from another password manager's export,
+	// along with the location it should be stored at.
+	Entry struct {
+		Location   string
+		Credential vault.Credential
+	}
+
+	// ReadFunc reads the entries in an export.
+	ReadFunc func(io.Reader) ([]Entry, error)
+)
+
+var (
+	// ErrUnknownFormat is returned from Read if the format is not one of
+	// Formats.
+	ErrUnknownFormat = errors.New("unknown import format")
+
+	// ErrMissingColumn is returned if a CSV export does not have a column
+	// that the format requires.
+	ErrMissingColumn = errors.New("export is missing a required column")
+
+	// Formats maps the name of each supported export format to its reader.
+	Formats = map[string]ReadFunc{
+		"apple":    Apple,
+		"dashlane": Dashlane,
+		"lastpass": LastPass,
+	}
+)
+
+// FormatNames returns the names of the supported formats, sorted.
+func FormatNames() []string {
+	var names []string
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Read reads the entries in `r` using the reader for `format`.
+func Read(format string, r io.Reader) ([]Entry, error) {
+	read, exists := Formats[format]
+	if !exists {
+		return nil, ErrUnknownFormat
+	}
+	return read(r)
+}
+
+// Import adds `entries` to `v`. If an entry's location is already taken, it
+// is stored at "location (username)", or failing that "location (N)", so that
+// exports holding several accounts for one site are imported in full. The
+// number of entries imported is returned.
+func Import(v *vault.Vault, entries []Entry) (int, error) {
+	return ImportContext(context.Background(), v, entries)
+}
+
+// ImportContext is like Import, but stops before the next entry once `ctx` is
+// done, returning the number of entries imported so far and ctx.Err().
+// The entries are added in a single batch, and those added before an error
+// are kept.
+func ImportContext(ctx context.Context, v *vault.Vault, entries []Entry) (int, error) {
+	nimported := 0
+	var importErr error
+	err := v.Batch(func(tx *vault.Tx) error {
+		for _, entry := range entries {
+			if importErr = ctx.Err(); importErr != nil {
+				return nil
+			}
+			location, err := freeLocation(tx, entry.Location, entry.Credential.Username)
+			if err != nil {
+				importErr = err
+				return nil
+			}
+			if err := tx.Add(location, entry.Credential); err != nil {
+				importErr = fmt.Errorf("%v: %v", entry.Location, err)
+				return nil
+			}
+			nimported++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return nimported, importErr
+}
+
+// freeLocation returns a location based on `location` that is not in use in
+// the vault changed by `tx`.
+func freeLocation(tx *vault.Tx, location string, username string) (string, error) {
+	candidates := []string{location}
+	if username != "" {
+		candidates = append(candidates, fmt.Sprintf("%v (%v)", location, username))
+	}
+	for _, candidate := range candidates {
+		_, err := tx.Get(candidate)
+		if err == vault.ErrNoSuchCredential {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%v (%v)", location, n)
+		_, err := tx.Get(candidate)
+		if err == vault.ErrNoSuchCredential {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// csvRecords reads a CSV export with a header row, returning each row as a
+// map from lowercased column name to value. Every column in `required` must
+// be present.
+func csvRecords(r io.Reader, required ...string) ([]map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	for _, column := range required {
+		found := false
+		for _, name := range header {
+			if name == column {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%v: %v", ErrMissingColumn, column)
+		}
+	}
+
+	var records []map[string]string
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		record := make(map[string]string)
+		for i, value := range row {
+			if i < len(header) {
+				record[header[i]] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// addMeta sets the meta tag `name` on `cred` to `value`, unless `value` is
+// empty.
+func addMeta(cred *vault.Credential, name string, value string) {
+	if value == "" {
+		return
+	}
+	if cred.Meta == nil {
+		cred.Meta = make(map[string]string)
+	}
+	cred.Meta[name] = value
+}
+
+// locationFor returns a usable location for an entry titled `title` with the
+// given `url`, falling back to the URL's host, then `fallback`. Control
+// characters, which vault locations may not contain, are replaced by spaces.
+func locationFor(title string, url string, fallback string) string {
+	location := cleanLocation(title)
+	if location == "" {
+		location = cleanLocation(hostOf(url))
+	}
+	if location == "" {
+		location = fallback
+	}
+	return location
+}
+
+// cleanLocation replaces control characters in `s` with spaces and trims
+// surrounding whitespace.
+func cleanLocation(s string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s))
+}
+
+// hostOf returns the host part of `url`, or `url` itself if it has no scheme.
+func hostOf(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	if i := strings.IndexAny(url, "/?#"); i >= 0 {
+		url = url[:i]
+	}
+	return url
+}
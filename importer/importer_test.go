@@ -0,0 +1,52 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestImport(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []Entry{
+		{Location: "github.com", Credential: vault.Credential{Username: "user1", Password: "pass1"}},
+		{Location: "github.com", Credential: vault.Credential{Username: "user2", Password: "pass2"}},
+		{Location: "github.com", Credential: vault.Credential{Username: "user2", Password: "pass3"}},
+	}
+	n, err := Import(v, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatal("expected 3 entries to be imported, got", n)
+	}
+	for location, password := range map[string]string{
+		"github.com":         "pass1",
+		"github.com (user2)": "pass2",
+		"github.com (2)":     "pass3",
+	} {
+		cred, err := v.Get(location)
+		if err != nil {
+			t.Fatal(location, err)
+		}
+		if cred.Password != password {
+			t.Fatal("wrong password at", location)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	if _, err := Read("nonexistent", strings.NewReader("")); err != ErrUnknownFormat {
+		t.Fatal("expected ErrUnknownFormat, got", err)
+	}
+	if _, err := Read("apple", strings.NewReader("Title,URL\nx,y\n")); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Fatal("expected a missing column error, got", err)
+	}
+	if locationFor("line\nbreak ", "", "") != "line break" {
+		t.Fatal("locationFor did not clean control characters")
+	}
+}
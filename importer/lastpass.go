@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"io"
+	"strings"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// lastPassNoteURL is the url LastPass gives secure notes in its CSV export.
+const lastPassNoteURL = "http://sn"
+
+// LastPass reads the CSV exported by LastPass, with the columns url,
+// username, password, totp, extra, name, grouping, and fav. Logins keep
+// their url as the credential's URL and their extra field as notes. Secure
+// notes become credentials with no password; the fields of typed notes, such
+// as credit cards and addresses, become meta tags and the note type is stored
+// in the `type` meta tag. The LastPass folder, whose subfolders are separated
+// by backslashes, becomes the credential's folder.
+func LastPass(r io.Reader) ([]Entry, error) {
+	records, err := csvRecords(r, "url", "username", "password", "name")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, record := range records {
+		var cred vault.Credential
+		if record["url"] == lastPassNoteURL {
+			cred = lastPassNote(record["extra"])
+		} else {
+			cred = vault.Credential{
+				Username: record["username"],
+				Password: record["password"],
+				Notes:    record["extra"],
+				URL:      record["url"],
+			}
+			addMeta(&cred, "totp", record["totp"])
+		}
+		cred.Folder = vault.CleanFolder(strings.Replace(record["grouping"], `\`, vault.FolderSeparator, -1))
+		entries = append(entries, Entry{
+			Location:   locationFor(record["name"], record["url"], "lastpass item"),
+			Credential: cred,
+		})
+	}
+	return entries, nil
+}
+
+// lastPassNote converts the extra field of a LastPass secure note into a
+// credential. Typed notes begin with a NoteType line followed by `Field:value`
+// lines, and end with a free-form Notes field that can span several lines.
+func lastPassNote(extra string) vault.Credential {
+	if !strings.HasPrefix(extra, "NoteType:") {
+		cred := vault.Credential{Notes: extra}
+		addMeta(&cred, "type", "secure note")
+		return cred
+	}
+
+	var cred vault.Credential
+	lines := strings.Split(extra, "\n")
+	for i, line := range lines {
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			continue
+		}
+		name, value := line[:sep], line[sep+1:]
+		switch name {
+		case "NoteType":
+			addMeta(&cred, "type", strings.ToLower(value))
+		case "Notes":
+			cred.Notes = strings.Join(append([]string{value}, lines[i+1:]...), "\n")
+			return cred
+		case "Password":
+			cred.Password = value
+		case "Username":
+			cred.Username = value
+		default:
+			addMeta(&cred, name, value)
+		}
+	}
+	return cred
+}
@@ -0,0 +1,53 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestLastPass(t *testing.T) {
+	export := `url,username,password,totp,extra,name,grouping,fav
+https://github.com/login,user,pass1,JBSWY3DPEHPK3PXP,,GitHub,Work\Code,0
+http://sn,,,,"wifi password is
+hunter2",Home,,0
+http://sn,,,,"NoteType:Credit Card
+Name on Card:Jane Doe
+Number:4111111111111111
+Security Code:123
+Notes:first line
+second line",Visa,Finance,1
+`
+	entries, err := LastPass(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Location: "GitHub", Credential: vault.Credential{
+			Username: "user",
+			Password: "pass1",
+			URL:      "https://github.com/login",
+			Folder:   "Work/Code",
+			Meta:     map[string]string{"totp": "JBSWY3DPEHPK3PXP"},
+		}},
+		{Location: "Home", Credential: vault.Credential{
+			Notes: "wifi password is\nhunter2",
+			Meta:  map[string]string{"type": "secure note"},
+		}},
+		{Location: "Visa", Credential: vault.Credential{
+			Notes: "first line\nsecond line",
+			Meta: map[string]string{
+				"type":          "credit card",
+				"Name on Card":  "Jane Doe",
+				"Number":        "4111111111111111",
+				"Security Code": "123",
+			},
+			Folder: "Finance",
+		}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ttyPath is the terminal, which passwords are read from when stdin is
+// redirected.
+const ttyPath = "/dev/tty"
+
+// waitForKey waits up to `timeout` for a key to be pressed on stdin, which
+// must be in raw mode, and consumes it. It returns true if a key was pressed.
+func waitForKey(timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(os.Stdin.Fd()), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+	if err != nil && err != unix.EINTR {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	var b [1]byte
+	_, err = os.Stdin.Read(b[:])
+	return true, err
+}
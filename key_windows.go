@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// ttyPath is the terminal, which passwords are read from when stdin is
+// redirected.
+const ttyPath = "CONIN$"
+
+// waitForKey waits up to `timeout` for a key to be pressed on stdin, which
+// must be in raw mode, and consumes it. It returns true if a key was pressed.
+func waitForKey(timeout time.Duration) (bool, error) {
+	event, err := windows.WaitForSingleObject(windows.Handle(os.Stdin.Fd()), uint32(timeout/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	if event != windows.WAIT_OBJECT_0 {
+		return false, nil
+	}
+	var b [1]byte
+	_, err = os.Stdin.Read(b[:])
+	return true, err
+}
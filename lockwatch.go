@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/avahowell/masterkey/screenlock"
+)
+
+// screenLockActions are the values accepted by the -screenlock flag.
+var screenLockActions = map[string]bool{
+	"lock": true,
+	"exit": true,
+	"off":  true,
+}
+
+// watchScreenLock calls `lock` each time the screen is locked or the machine
+// wakes from sleep, or `stop` if `action` is exit, until the returned func is
+// called. Nothing is watched if `action` is off.
+func watchScreenLock(action string, lock func(screenlock.Event), stop func(screenlock.Event)) func() {
+	if action == "off" {
+		return func() {}
+	}
+	w := screenlock.Watch(screenlock.DefaultInterval)
+	go func() {
+		for ev := range w.Events {
+			if action == "exit" {
+				stop(ev)
+			} else {
+				lock(ev)
+			}
+		}
+	}()
+	return w.Close
+}
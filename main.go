@@ -6,87 +6,362 @@ import (
 	"os"
 	"time"
 
+	"github.com/avahowell/masterkey/autosave"
+	"github.com/avahowell/masterkey/clock"
 	"github.com/avahowell/masterkey/filelock"
+	"github.com/avahowell/masterkey/i18n"
 	"github.com/avahowell/masterkey/repl"
+	"github.com/avahowell/masterkey/screenlock"
 	"github.com/avahowell/masterkey/secureclip"
 	"github.com/avahowell/masterkey/vault"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-const usage = `Usage: masterkey [-new] vault`
+// maxPassphraseAttempts is the number of times the user may enter the wrong
+// passphrase before masterkey gives up.
+const maxPassphraseAttempts = 3
 
-func die(err error) {
-	fmt.Println(err)
-	os.Exit(1)
+const usage = `Usage: masterkey [-new] vault
+       masterkey https://example.com/vaults/name
+       masterkey compact vault
+       masterkey upgrade vault|directory...
+       masterkey syncserver [-addr :8443] [-tls-cert file -tls-key file] directory
+       masterkey resolve [vault] < file > expanded
+       masterkey scan vault [file|directory...]
+       masterkey scan -staged vault
+       masterkey run [-keep-going] vault script
+       masterkey receive [-listen :0] vault
+       masterkey send -to address vault location...|--all
+       masterkey remote [-ssh command] [-masterkey path] [user@]host:vault`
+
+// rotationPolicies maps the values accepted by the -rotate flag to the
+// vault's salt rotation policies.
+var rotationPolicies = map[string]vault.RotationPolicy{
+	"open":   vault.RotateOnOpen,
+	"save":   vault.RotateOnSave,
+	"manual": vault.RotateManually,
+}
+
+// msg translates messages into the language set in the environment.
+var msg = i18n.NewPrinter(i18n.Language())
+
+// openOptions are used to open the vault given on the command line.
+var openOptions []vault.OpenOption
+
+// subcommands are invoked as `masterkey <name> [args]` and run to completion
+// without starting the UI or the REPL.
+var subcommands = map[string]func(args []string) error{
+	"compact":    compactVault,
+	"upgrade":    upgradeVaults,
+	"syncserver": runSyncServer,
+	"resolve":    resolveRefs,
+	"scan":       scanFiles,
+	"run":        runScriptFile,
+	"send":       sendCredentials,
+	"receive":    receiveCredentials,
+	"remote":     remoteShell,
 }
 
 func askPassword(prompt string) (string, error) {
+	in := os.Stdin
+	if !terminal.IsTerminal(int(in.Fd())) {
+		// stdin is carrying data, such as for resolve, so read the
+		// password from the terminal itself
+		if tty, err := os.Open(ttyPath); err == nil {
+			defer tty.Close()
+			in = tty
+		}
+	}
 	fmt.Print(prompt)
-	pw, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	pw, err := terminal.ReadPassword(int(in.Fd()))
 	fmt.Println()
 	return string(pw), err
 }
 
 func setupRepl(v *vault.Vault, vaultPath string, timeout time.Duration) *repl.REPL {
 	r := repl.New(fmt.Sprintf("masterkey [%v] > ", vaultPath), timeout)
+	r.SetPrinter(msg)
 
 	r.AddCommand(importCmd(v))
+	r.AddCommand(importFormatCmd(v))
 	r.AddCommand(listCmd(v))
 	r.AddCommand(saveCmd(v, vaultPath))
 	r.AddCommand(getCmd(v))
 	r.AddCommand(addCmd(v))
 	r.AddCommand(genCmd(v))
 	r.AddCommand(editCmd(v))
+	r.AddCommand(regenCmd(v))
 	r.AddCommand(clipCmd(v))
+	r.AddCommand(peekCmd(v))
+	r.AddCommand(totpCmd(v))
+	r.AddCommand(notesCmd(v))
+	r.AddCommand(urlCmd(v))
+	r.AddCommand(emailCmd(v))
+	r.AddCommand(folderCmd(v))
+	r.AddCommand(foldersCmd(v))
+	r.AddCommand(tagCmd(v))
+	r.AddCommand(untagCmd(v))
+	r.AddCommand(tagsCmd(v))
+	r.AddCommand(historyCmd(v))
+	r.AddCommand(iconCmd(v))
 	r.AddCommand(searchCmd(v))
 	r.AddCommand(addmetaCmd(v))
 	r.AddCommand(editmetaCmd(v))
 	r.AddCommand(deletemetaCmd(v))
 	r.AddCommand(deleteCmd(v))
+	r.AddCommand(renameCmd(v))
+	r.AddCommand(copyCmd(v))
+	r.AddCommand(undoCmd(v))
+	r.AddCommand(redoCmd(v))
+	r.AddCommand(snapshotCmd(v))
+	r.AddCommand(rollbackCmd(v))
+	r.AddCommand(confirmDestructiveCmd(v))
+	r.AddCommand(paddingCmd(v))
+	r.AddCommand(statusCmd(v))
+	r.AddCommand(sizeWarningCmd(v))
+	r.AddCommand(trackUsageCmd(v))
+	r.AddCommand(auditCmd(v))
+	r.AddCommand(archiveCmd(v))
+	r.AddCommand(unarchiveCmd(v))
+	r.AddCommand(locationRulesCmd(v))
+	r.AddCommand(questionCmd(v))
+	r.AddCommand(aliasCmd(v))
+	r.AddCommand(tokensCmd(v))
+	r.AddCommand(maskUsernameCmd(v))
+	r.AddCommand(setCmd())
 	r.AddCommand(changePasswordCmd(v))
+	r.AddCommand(duressCmd(v))
+	r.AddCommand(policyCmd(v))
+	r.AddCommand(unlockWritesCmd(v))
+	r.AddCommand(rekeyCmd(v, vaultPath))
 	r.AddCommand(mergeCmd(v))
+	r.AddCommand(syncCmd(v))
+	r.AddCommand(remoteCmd(v, vaultPath))
+	r.AddCommand(exportPassCmd(v))
+	r.AddCommand(exportBrowserCmd(v))
+	r.AddCommand(exportYAMLCmd(v))
+	r.AddCommand(importYAMLCmd(v))
+	r.AddCommand(bulkEditCmd(v))
+	rs := &refServer{v: v}
+	r.AddCommand(refsCmd(rs))
+	r.AddCommand(sourceCmd(r, os.Stdout))
 
+	r.OnEval(func(command string, took time.Duration) {
+		fmt.Fprint(os.Stderr, debugTimings.report(command, took))
+	})
 	r.OnStop(func() {
-		fmt.Println("clearing clipboard and saving vault")
+		inform(msg.Translate("clearing clipboard and saving vault") + "\n")
+		rs.Close()
 		secureclip.Clear()
 		v.Save(vaultPath)
+		fmt.Print(plaintextFiles.reminder())
 	})
 
 	return r
 }
 
+// openVault prompts for the passphrase of the vault at vaultPath and opens it.
+// The user is re-prompted up to maxPassphraseAttempts times if they enter the
+// wrong passphrase.
+func openVault(vaultPath string) (*vault.Vault, error) {
+	v, _, err := unlockVault(vaultPath)
+	return v, err
+}
+
+// unlockVault is like openVault, but also returns the passphrase the vault
+// was opened with.
+func unlockVault(vaultPath string) (*vault.Vault, string, error) {
+	f, err := vault.ReadFile(vaultPath)
+	if err != nil {
+		return nil, "", openError(vaultPath, err)
+	}
+	defer f.Close()
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := askPassword(msg.Sprintf("Password for %v: ", vaultPath))
+		if err != nil {
+			return nil, "", err
+		}
+		inform(msg.Sprintf("Opening %v...\n", vaultPath))
+
+		start := time.Now()
+		v, err := f.Decrypt(passphrase, openOptions...)
+		fmt.Fprint(os.Stderr, debugTimings.report("open", time.Since(start)))
+		if err == vault.ErrWrongPassphrase && attempt < maxPassphraseAttempts {
+			fmt.Println(openError(vaultPath, err))
+			continue
+		}
+		if err == nil || err == vault.ErrWrongPassphrase {
+			failures := attempt - 1
+			if err != nil {
+				failures = attempt
+			}
+			notifyUnlockAsync(newUnlockAttempt(vaultPath, err == nil, failures))
+		}
+		if err == nil {
+			if err = offerUpgrade(f, v, vaultPath); err != nil {
+				v.Close()
+				return nil, "", err
+			}
+		}
+		if err == nil && v.Recovered() > 0 {
+			inform(msg.Sprintf("recovered %v unsaved changes from %v\n", v.Recovered(), vaultPath+".journal"))
+		}
+		if err == nil {
+			printAdvice(v, vaultPath)
+		}
+		if err == nil && v.TooLarge() {
+			msg.Printf("warning: %v is %v bytes, larger than the %v byte size warning. Run status --sizes in the shell to find the largest credentials.\n", vaultPath, v.Size(), v.SizeWarning())
+		}
+		if err == nil {
+			if protected, until := v.WriteProtected(); protected && until.IsZero() {
+				inform("vault is read-only until unlock-writes is run\n")
+			} else if protected {
+				inform(fmt.Sprintf("vault is read-only for %v, or until unlock-writes is run\n", time.Until(until).Round(time.Second)))
+			}
+		}
+		return v, passphrase, openError(vaultPath, err)
+	}
+}
+
+// openError translates an error returned from vault.Open into a message that
+// tells the user what went wrong and what to do about it.
+func openError(vaultPath string, err error) error {
+	switch err {
+	case filelock.ErrLocked:
+		return codedError{msg.Errorf("%v is open by another masterkey instance! exit that instance first, or remove %v before opening this vault.", vaultPath, vaultPath+".lck"), exitLocked, vaultPath}
+	case vault.ErrWrongPassphrase:
+		return codedError{msg.Errorf("incorrect passphrase for %v", vaultPath), exitWrongPass, vaultPath}
+	case vault.ErrCorruptVault:
+		return codedError{msg.Errorf("%v is corrupt or has been modified and can not be decrypted, even with the correct passphrase. Restore it from a backup.", vaultPath), exitCorrupt, vaultPath}
+	}
+	return err
+}
+
+// compactVault saves the vault at args[0] again, in the current format, and
+// reports the change in its size. Every save already re-encrypts the vault in
+// full from its live credentials, so compact does nothing a save would not.
+func compactVault(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("compact requires one argument, the path of the vault to compact")
+	}
+	vaultPath := args[0]
+
+	before, err := os.Stat(vaultPath)
+	if err != nil {
+		return err
+	}
+	v, err := openVault(vaultPath)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if err = v.Save(vaultPath); err != nil {
+		return err
+	}
+	after, err := os.Stat(vaultPath)
+	if err != nil {
+		return err
+	}
+
+	inform(fmt.Sprintf("%v compacted: %v bytes -> %v bytes (%v bytes reclaimed)\n", vaultPath, before.Size(), after.Size(), before.Size()-after.Size()))
+	return nil
+}
+
 func main() {
-	createVault := flag.Bool("new", false, "whether to create a new vault at the specified location")
-	repl := flag.Bool("repl", false, "spawn the repl shell")
-	timeout := flag.Duration("timeout", time.Minute*5, "how long to wait with no vault activity before exiting")
+	defer pendingNotifications.Wait()
+
+	createVault := flag.Bool("new", false, msg.Translate("whether to create a new vault at the specified location"))
+	repl := flag.Bool("repl", false, msg.Translate("spawn the repl shell"))
+	plain := flag.Bool("plain", false, msg.Translate("use numbered menus written line by line, for screen readers, instead of the terminal UI"))
+	timeout := flag.Duration("timeout", time.Minute*5, msg.Translate("how long to wait with no vault activity before exiting, unless the vault sets its own with policy"))
+	clipboardTimeout := flag.Duration("clipboard-timeout", secureclip.DefaultTimeout, msg.Translate("how long copied secrets stay on the clipboard, unless the vault sets its own with policy"))
+	autosaveVault := flag.Bool("autosave", false, msg.Translate("save the vault shortly after every change, instead of only on exit"))
+	revealLast := flag.Bool("reveal-last", false, msg.Translate("when creating a vault, briefly show the last character typed in the passphrase"))
+	presentationMode := flag.Bool("presentation", false, msg.Translate("start in presentation mode, which hides passwords and partially masks usernames"))
+	protectWrites := flag.String("protect-writes", "", msg.Translate("open the vault read-only, for a duration such as 30s or until unlock-writes if set to on"))
+	rotate := flag.String("rotate", "open", msg.Translate("when to re-encrypt the vault under a fresh salt: open, save (with the first change), or manual (only on changepassword or rekey)"))
+	screenLock := flag.String("screenlock", "lock", msg.Translate("when the screen locks or the machine wakes from sleep: lock the vault (the shell exits, as it can not be locked), exit, or off"))
+	flag.BoolVar(&jsonErrors, "json", false, msg.Translate("write errors to stderr as JSON objects with a code, message and location, for programs wrapping masterkey"))
+	verbose := flag.Bool("verbose", false, msg.Translate("report how long each shell command took, and how much of that was spent deriving keys, decrypting, encoding, saving and on the network"))
+	flag.BoolVar(&noAdvice, "no-advice", false, msg.Translate("do not warn about weak settings, such as cheap key derivation or a vault file other users can read, when opening the vault"))
+	flag.BoolVar(&quiet, "quiet", false, msg.Translate("print only results, warnings and errors, leaving out messages about what masterkey is doing"))
+	split := flag.Bool("split", false, msg.Translate("when creating a vault, create a directory holding one encrypted file per credential, so file sync tools only transfer changed credentials"))
+	osc52 := flag.Bool("osc52", false, msg.Translate("copy secrets to the clipboard of the terminal using OSC 52, as is done over SSH when the remote host has no clipboard"))
 
 	flag.Parse()
 
+	policy, ok := rotationPolicies[*rotate]
+	if !ok {
+		die(msg.Errorf("unknown -rotate policy %q, expected open, save or manual", *rotate))
+	}
+	openOptions = append(openOptions, vault.WithRotation(policy), vault.WithTimer(debugTimings.record))
+	setDebug(*verbose)
+	if !screenLockActions[*screenLock] {
+		die(msg.Errorf("unknown -screenlock action %q, expected lock, exit or off", *screenLock))
+	}
+	if *protectWrites != "" {
+		d := vault.UntilAllowed
+		if *protectWrites != "on" {
+			var err error
+			if d, err = time.ParseDuration(*protectWrites); err != nil || d <= 0 {
+				die(msg.Errorf("-protect-writes must be on or a positive duration such as 30s"))
+			}
+		}
+		openOptions = append(openOptions, vault.WithWriteProtection(d))
+	}
+	setPresentation(*presentationMode)
+	timeouts := timeoutFlags{timeout: *timeout, clipboard: *clipboardTimeout}
+	flag.Visit(func(f *flag.Flag) {
+		timeouts.timeoutSet = timeouts.timeoutSet || f.Name == "timeout"
+		timeouts.clipboardSet = timeouts.clipboardSet || f.Name == "clipboard-timeout"
+	})
+
+	if len(flag.Args()) > 1 || (len(flag.Args()) == 1 && flag.Args()[0] == "resolve") {
+		if sub, exists := subcommands[flag.Args()[0]]; exists {
+			if err := sub(flag.Args()[1:]); err != nil {
+				die(err)
+			}
+			return
+		}
+	}
+
 	if len(flag.Args()) != 1 {
-		fmt.Println(usage)
+		fmt.Println(msg.Translate(usage))
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
 	vaultPath := flag.Args()[0]
+	setupClipboard(*osc52)
 
-	if *createVault {
-		passphrase1, err := askPassword("Enter a passphrase for " + vaultPath + ": ")
-		if err != nil {
+	// a vault on a sync server is opened from its local cache
+	var cache *remoteCache
+	if isRemoteURL(vaultPath) {
+		if *createVault {
+			die(msg.Errorf("vaults can not be created on a sync server. Create one locally, then upload it with remote set and remote sync"))
+		}
+		var err error
+		if cache, err = openCache(vaultPath); err != nil {
 			die(err)
 		}
-		passphrase2, err := askPassword("Enter the same passphrase again: ")
+		vaultPath = cache.path
+	}
+
+	if *createVault {
+		passphrase, err := askNewPassphrase(vaultPath, *revealLast)
 		if err != nil {
 			die(err)
 		}
-		if passphrase1 != passphrase2 {
-			die(fmt.Errorf("passphrases do not match"))
-		}
-		v, err := vault.New(passphrase1)
+		v, err := vault.New(passphrase)
 		if err != nil {
 			die(err)
 		}
 		defer v.Close()
+		if *split {
+			v.SetLayout(vault.LayoutSplit)
+		}
 		err = v.Save(vaultPath)
 		if err != nil {
 			die(err)
@@ -94,27 +369,88 @@ func main() {
 		return
 	}
 
-	if *repl {
-		passphrase, err := askPassword("Password for " + vaultPath + ": ")
-		if err != nil {
-			die(err)
-		}
-		fmt.Printf("Opening %v...\n", vaultPath)
-
-		v, err := vault.Open(vaultPath, passphrase)
+	if *repl || *plain {
+		v, passphrase, err := unlockVault(vaultPath)
 		if err != nil {
-			if err == filelock.ErrLocked {
-				die(fmt.Errorf("%v is open by another masterkey instance! exit that instance first, or remove %v before opening this vault.", vaultPath, vaultPath+".lck"))
-			}
 			die(err)
 		}
 		defer v.Close()
+		if cache != nil {
+			fmt.Print(cache.start(v, passphrase))
+			defer func() {
+				fmt.Print(cache.Close())
+			}()
+		}
+		if *autosaveVault {
+			defer enableAutosave(v, vaultPath).Close()
+		}
 
-		r := setupRepl(v, vaultPath, *timeout)
+		idle, clipboard := effectiveTimeouts(v.Settings(), timeouts)
+		secureclip.SetTimeout(clipboard)
+		if *plain {
+			runPlain(v, vaultPath, idle, *screenLock)
+			return
+		}
+		r := setupRepl(v, vaultPath, idle)
+		exit := func(ev screenlock.Event) {
+			msg.Printf("\nexiting because %v\n", msg.Translate(ev.String()))
+			r.Stop()
+		}
+		defer watchScreenLock(*screenLock, exit, exit)()
 		r.Loop()
 
 		return
 	}
 
-	runUI(vaultPath, *timeout)
+	runUI(vaultPath, timeouts, *autosaveVault, *screenLock, cache)
+}
+
+// setupClipboard copies secrets through the terminal using OSC 52 if
+// `osc52` is set, or if masterkey is running over SSH on a host with no
+// clipboard, where copying to the system clipboard would fail.
+func setupClipboard(osc52 bool) {
+	if !osc52 && (!secureclip.OverSSH() || secureclip.Available()) {
+		return
+	}
+	secureclip.SetClipboard(secureclip.NewOSC52(os.Stdout))
+	if !secureclip.TerminalSupportsOSC52() {
+		msg.Printf("warning: copying to the clipboard through the terminal, but %v terminals do not support it, so copied secrets will not reach your clipboard\n", os.Getenv("TERM"))
+	}
+}
+
+// runPlain runs the plain interface on `v` until the user quits, then clears
+// the clipboard and saves the vault.
+func runPlain(v *vault.Vault, vaultPath string, timeout time.Duration, screenLock string) {
+	p := newPlainUI(v, os.Stdin, os.Stdout, timeout)
+	exit := func(ev screenlock.Event) {
+		msg.Printf("\nexiting because %v\n", msg.Translate(ev.String()))
+		p.stop()
+	}
+	stopWatching := watchScreenLock(screenLock, exit, exit)
+	err := p.run()
+	stopWatching()
+	if err == errPlainIdle {
+		fmt.Println(err)
+	}
+	inform(msg.Translate("clearing clipboard and saving vault") + "\n")
+	secureclip.Clear()
+	if err = v.Save(vaultPath); err != nil {
+		fmt.Println("could not save the vault:", err)
+	}
+	fmt.Print(plaintextFiles.reminder())
+}
+
+// enableAutosave saves `v` to `vaultPath` shortly after each change. The
+// returned Saver must be closed before the vault is, to flush any pending
+// save.
+func enableAutosave(v *vault.Vault, vaultPath string) *autosave.Saver {
+	s := autosave.New(func() error {
+		err := v.Save(vaultPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "autosave failed:", err)
+		}
+		return err
+	}, autosave.DefaultDelay, clock.Real)
+	v.OnChange(s.Changed)
+	return s
 }
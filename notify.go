@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// notifyEnv names the environment variable holding the hook run each time a
+// vault is unlocked, or fails to unlock.
+const notifyEnv = "MASTERKEY_NOTIFY"
+
+// notifyTimeout bounds how long the hook may run, and so how long masterkey
+// waits for it before exiting.
+const notifyTimeout = 10 * time.Second
+
+// pendingNotifications tracks the hooks started by notifyUnlockAsync, so that
+// they are not cut short when masterkey exits.
+var pendingNotifications sync.WaitGroup
+
+// unlockAttempt describes an attempt to unlock a vault, for the hook set in
+// MASTERKEY_NOTIFY.
+type unlockAttempt struct {
+	Vault string    `json:"vault"`
+	Host  string    `json:"host"`
+	User  string    `json:"user"`
+	Time  time.Time `json:"time"`
+	// Unlocked is true if the vault was unlocked. Failures is the number
+	// of wrong passphrases entered first.
+	Unlocked bool `json:"unlocked"`
+	Failures int  `json:"failures"`
+}
+
+// newUnlockAttempt returns an unlockAttempt on the vault at vaultPath, made
+// on this machine now.
+func newUnlockAttempt(vaultPath string, unlocked bool, failures int) unlockAttempt {
+	a := unlockAttempt{
+		Vault:    vaultPath,
+		Time:     time.Now(),
+		Unlocked: unlocked,
+		Failures: failures,
+	}
+	if abs, err := filepath.Abs(vaultPath); err == nil && !isRemoteURL(vaultPath) {
+		a.Vault = abs
+	}
+	a.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		a.User = u.Username
+	}
+	return a
+}
+
+// notifyUnlock passes `a` to the hook set in MASTERKEY_NOTIFY, if there is
+// one. A hook that is an http or https URL is sent `a` as JSON in a POST
+// request. Any other hook is run as a shell command, with `a` as JSON on its
+// stdin and in MASTERKEY_VAULT, MASTERKEY_HOST, MASTERKEY_USER,
+// MASTERKEY_TIME, MASTERKEY_RESULT and MASTERKEY_FAILURES, so that it can
+// send an email or show a desktop notification.
+func notifyUnlock(a unlockAttempt) error {
+	hook := os.Getenv(notifyEnv)
+	if hook == "" {
+		return nil
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if isRemoteURL(hook) {
+		req, err := http.NewRequest(http.MethodPost, hook, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("%v returned %v", hook, resp.Status)
+		}
+		return nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", hook)
+	}
+	result := "failure"
+	if a.Unlocked {
+		result = "success"
+	}
+	cmd.Env = append(os.Environ(),
+		"MASTERKEY_VAULT="+a.Vault,
+		"MASTERKEY_HOST="+a.Host,
+		"MASTERKEY_USER="+a.User,
+		"MASTERKEY_TIME="+a.Time.Format(time.RFC3339),
+		"MASTERKEY_RESULT="+result,
+		fmt.Sprintf("MASTERKEY_FAILURES=%v", a.Failures),
+	)
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// notifyUnlockAsync runs notifyUnlock in the background, so that a slow hook
+// does not hold up opening the vault, and warns on stderr if it fails.
+func notifyUnlockAsync(a unlockAttempt) {
+	pendingNotifications.Add(1)
+	go func() {
+		defer pendingNotifications.Done()
+		if err := notifyUnlock(a); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: the %v hook failed: %v\n", notifyEnv, err)
+		}
+	}()
+}
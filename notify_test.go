@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNotifyUnlock(t *testing.T) {
+	defer os.Unsetenv(notifyEnv)
+	a := newUnlockAttempt("vault.db", false, 3)
+	if !filepath.IsAbs(a.Vault) || a.Unlocked || a.Failures != 3 {
+		t.Fatalf("unexpected attempt %+v", a)
+	}
+
+	os.Unsetenv(notifyEnv)
+	if err := notifyUnlock(a); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan unlockAttempt, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var got unlockAttempt
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		received <- got
+	}))
+	defer srv.Close()
+	os.Setenv(notifyEnv, srv.URL)
+	if err := notifyUnlock(a); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got.Vault != a.Vault || got.Host != a.Host || got.Failures != 3 || got.Unlocked {
+		t.Fatalf("webhook received %+v, expected %+v", got, a)
+	}
+	notifyUnlockAsync(a)
+	pendingNotifications.Wait()
+	select {
+	case <-received:
+	default:
+		t.Fatal("expected the webhook to be called before pendingNotifications is done")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir, err := ioutil.TempDir("", "masterkey-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	os.Setenv(notifyEnv, `echo "$MASTERKEY_RESULT $MASTERKEY_FAILURES" > `+out+` && cat >> `+out)
+	if err = notifyUnlock(a); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(bs), "failure 3\n{") {
+		t.Fatalf("hook wrote %q", bs)
+	}
+
+	os.Setenv(notifyEnv, "exit 1")
+	if err = notifyUnlock(a); err == nil {
+		t.Fatal("expected a failing hook to return an error")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// revealDelay is how long the last character typed is shown before it is
+// masked, when revealing is enabled.
+const revealDelay = time.Second
+
+// errInterrupted is returned when the user presses C-c at a passphrase
+// prompt.
+var errInterrupted = errors.New("interrupted")
+
+// readPassphrase is replaced in tests.
+var readPassphrase = func(prompt string, revealLast bool) (string, error) {
+	if revealLast {
+		return askPasswordRevealLast(prompt)
+	}
+	return askPassword(prompt)
+}
+
+// askNewPassphrase asks for a new passphrase for the vault at vaultPath,
+// twice. If the two don't match, the user is told how they differ and asked
+// again, up to maxPassphraseAttempts times.
+func askNewPassphrase(vaultPath string, revealLast bool) (string, error) {
+	for attempt := 1; ; attempt++ {
+		pass1, err := readPassphrase("Enter a passphrase for "+vaultPath+": ", revealLast)
+		if err != nil {
+			return "", err
+		}
+		pass2, err := readPassphrase("Enter the same passphrase again: ", revealLast)
+		if err != nil {
+			return "", err
+		}
+		if pass1 == pass2 {
+			return pass1, nil
+		}
+		if attempt >= maxPassphraseAttempts {
+			return "", fmt.Errorf("passphrases do not match: %v", describeMismatch(pass1, pass2))
+		}
+		fmt.Printf("passphrases do not match: %v. Try again.\n", describeMismatch(pass1, pass2))
+	}
+}
+
+// describeMismatch describes how two passphrases differ without revealing
+// any of their characters: their lengths, and the position of the first
+// character that differs.
+func describeMismatch(pass1, pass2 string) string {
+	r1, r2 := []rune(pass1), []rune(pass2)
+	pos := 0
+	for pos < len(r1) && pos < len(r2) && r1[pos] == r2[pos] {
+		pos++
+	}
+	lengths := fmt.Sprintf("the first is %v characters long and the second is %v", len(r1), len(r2))
+	if len(r1) == len(r2) {
+		lengths = fmt.Sprintf("both are %v characters long", len(r1))
+	}
+	if pos == len(r1) || pos == len(r2) {
+		return fmt.Sprintf("%v, and one is the start of the other", lengths)
+	}
+	return fmt.Sprintf("%v, and they differ from character %v", lengths, pos+1)
+}
+
+// askPasswordRevealLast reads a password from the terminal like askPassword,
+// but echoes a * for each character and shows the last character typed for
+// revealDelay before masking it.
+func askPasswordRevealLast(prompt string) (string, error) {
+	fmt.Print(prompt)
+	state, err := terminal.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		terminal.Restore(int(os.Stdin.Fd()), state)
+		fmt.Println()
+	}()
+
+	var mu sync.Mutex
+	var pw []rune
+	var mask *time.Timer
+	revealed := false
+	// gen identifies the revealed character, so a mask timer that fires
+	// after another character was typed leaves it alone.
+	gen := 0
+	// hide masks the revealed character. mu must be held.
+	hide := func() {
+		if revealed {
+			fmt.Print("\b*")
+			revealed = false
+		}
+	}
+	defer func() {
+		mu.Lock()
+		if mask != nil {
+			mask.Stop()
+		}
+		hide()
+		mu.Unlock()
+	}()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		r, _, err := in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		mu.Lock()
+		if mask != nil {
+			mask.Stop()
+		}
+		hide()
+		switch {
+		case r == '\r' || r == '\n':
+			mu.Unlock()
+			return string(pw), nil
+		case r == 3: // C-c
+			mu.Unlock()
+			return "", errInterrupted
+		case r == 127 || r == '\b':
+			if len(pw) > 0 {
+				pw = pw[:len(pw)-1]
+				fmt.Print("\b \b")
+			}
+		case r == utf8.RuneError || r < ' ':
+			// ignore other control characters
+		default:
+			pw = append(pw, r)
+			fmt.Print(string(r))
+			revealed = true
+			gen++
+			current := gen
+			mask = time.AfterFunc(revealDelay, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if gen == current {
+					hide()
+				}
+			})
+		}
+		mu.Unlock()
+	}
+}
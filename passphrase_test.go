@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDescribeMismatch(t *testing.T) {
+	tests := []struct {
+		pass1, pass2 string
+		want         string
+	}{
+		{"hunter2", "hunter3", "both are 7 characters long, and they differ from character 7"},
+		{"hunter2", "hunter22", "the first is 7 characters long and the second is 8, and one is the start of the other"},
+		{"xhunter2", "hunter2", "the first is 8 characters long and the second is 7, and they differ from character 1"},
+		{"pässwörd", "pässword", "both are 8 characters long, and they differ from character 6"},
+	}
+	for _, test := range tests {
+		got := describeMismatch(test.pass1, test.pass2)
+		if got != test.want {
+			t.Errorf("describeMismatch(%q, %q): got %q, want %q", test.pass1, test.pass2, got, test.want)
+		}
+		if strings.Contains(got, "hunter") || strings.Contains(got, "ss") {
+			t.Errorf("describeMismatch(%q, %q) revealed passphrase content: %q", test.pass1, test.pass2, got)
+		}
+	}
+}
+
+func TestAskNewPassphrase(t *testing.T) {
+	defer func(f func(string, bool) (string, error)) { readPassphrase = f }(readPassphrase)
+	stub := func(answers ...string) {
+		readPassphrase = func(prompt string, revealLast bool) (string, error) {
+			answer := answers[0]
+			answers = answers[1:]
+			return answer, nil
+		}
+	}
+
+	stub("typo", "tpyo", "correct", "correct")
+	pass, err := askNewPassphrase("testvault", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass != "correct" {
+		t.Fatal("expected the re-entered passphrase, got", pass)
+	}
+
+	var answers []string
+	for i := 0; i < maxPassphraseAttempts; i++ {
+		answers = append(answers, "one", "two")
+	}
+	stub(answers...)
+	if _, err = askNewPassphrase("testvault", false); err == nil {
+		t.Fatal("expected an error after too many mismatches")
+	}
+}
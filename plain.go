@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/secureclip"
+	"github.com/avahowell/masterkey/vault"
+)
+
+var (
+	// errPlainIdle is returned by plainUI.run once no line has been entered
+	// for its timeout.
+	errPlainIdle = errors.New("no activity, exiting")
+
+	// errPlainStopped is returned by plainUI.run once stop is called.
+	errPlainStopped = errors.New("exiting")
+)
+
+// plainUI is an interactive interface made of numbered menus, written one
+// line at a time and never redrawn, for screen readers and terminals that
+// the terminal UI can not draw on. Every prompt ends with a colon and every
+// answer is a number or a line of text.
+type plainUI struct {
+	v       *vault.Vault
+	in      *bufio.Reader
+	out     io.Writer
+	timeout time.Duration
+	clock   clock.Clock
+
+	// askSecret reads a password without echoing it.
+	askSecret func(prompt string) (string, error)
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// plainLine is a line read from plainUI's input.
+type plainLine struct {
+	text string
+	err  error
+}
+
+// newPlainUI returns a plainUI for `v`, reading from `in` and writing to
+// `out`, that exits once no line has been entered for `timeout`.
+func newPlainUI(v *vault.Vault, in io.Reader, out io.Writer, timeout time.Duration) *plainUI {
+	return &plainUI{
+		v:         v,
+		in:        bufio.NewReader(in),
+		out:       out,
+		timeout:   timeout,
+		clock:     clock.Real,
+		askSecret: askPassword,
+		stopped:   make(chan struct{}),
+	}
+}
+
+// stop makes run return errPlainStopped, even while it waits for input.
+func (p *plainUI) stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopped)
+	})
+}
+
+// println writes a line of output.
+func (p *plainUI) println(a ...interface{}) {
+	fmt.Fprintln(p.out, a...)
+}
+
+// ask writes `prompt` and returns the line entered, without its newline.
+// A line is only read from the input once asked for, so that nothing meant
+// for askSecret is consumed.
+func (p *plainUI) ask(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt+": ")
+	lines := make(chan plainLine, 1)
+	go func() {
+		text, err := p.in.ReadString('\n')
+		if err == io.EOF && text != "" {
+			err = nil
+		}
+		lines <- plainLine{strings.TrimSpace(text), err}
+	}()
+	select {
+	case line := <-lines:
+		return line.text, line.err
+	case <-p.clock.After(p.timeout):
+		p.println()
+		return "", errPlainIdle
+	case <-p.stopped:
+		p.println()
+		return "", errPlainStopped
+	}
+}
+
+// choose lists `options`, numbered from 1, and returns the index of the one
+// chosen, or -1 if `back` is set and 0 is chosen to go back.
+func (p *plainUI) choose(title string, options []string, back string) (int, error) {
+	p.println(title)
+	for i, option := range options {
+		p.println(fmt.Sprintf("%v. %v", i+1, option))
+	}
+	if back != "" {
+		p.println("0. " + back)
+	}
+	lowest := 1
+	if back != "" {
+		lowest = 0
+	}
+	for {
+		answer, err := p.ask(fmt.Sprintf("Enter a number from %v to %v", lowest, len(options)))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n == 0 && back != "" {
+			return -1, nil
+		}
+		if err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		p.println(fmt.Sprintf("%q is not one of the numbers listed.", answer))
+	}
+}
+
+// run shows the main menu until the user quits, stop is called or the
+// timeout passes.
+func (p *plainUI) run() error {
+	for {
+		choice, err := p.choose("Main menu:", []string{"List credentials", "Search credentials", "Add a credential", "Quit"}, "")
+		if err != nil {
+			return err
+		}
+		switch choice {
+		case 0:
+			err = p.pick("")
+		case 1:
+			var text string
+			if text, err = p.ask("Enter part of the location to search for"); err == nil {
+				err = p.pick(text)
+			}
+		case 2:
+			err = p.add()
+		case 3:
+			return nil
+		}
+		if err == errPlainIdle || err == errPlainStopped || err == io.EOF {
+			return err
+		}
+		if err != nil {
+			p.println("Error: " + err.Error())
+		}
+	}
+}
+
+// pick lists the credentials whose location contains `search`, and shows
+// the menu of the one chosen.
+func (p *plainUI) pick(search string) error {
+	locations, err := p.v.Locations()
+	if err != nil {
+		return err
+	}
+	archived, err := archivedSet(p.v)
+	if err != nil {
+		return err
+	}
+	var found []string
+	for _, location := range locations {
+		if !archived[location] && strings.Contains(strings.ToLower(location), strings.ToLower(search)) {
+			found = append(found, location)
+		}
+	}
+	if len(found) == 0 {
+		p.println("No credentials found.")
+		return nil
+	}
+	choice, err := p.choose(fmt.Sprintf("%v credentials:", len(found)), found, "Back to the main menu")
+	if err != nil || choice < 0 {
+		return err
+	}
+	return p.credential(found[choice])
+}
+
+// credential shows the menu of the credential at `location` until the user
+// goes back.
+func (p *plainUI) credential(location string) error {
+	for {
+		cred, err := p.v.Get(location)
+		if err != nil {
+			return err
+		}
+		p.println("Location: " + location)
+		p.println("Username: " + credentialUsername(p.v, cred))
+		choice, err := p.choose("Credential menu:", []string{"Copy the password to the clipboard", "Read the password", "Read the notes", "Delete this credential"}, "Back to the main menu")
+		if err != nil || choice < 0 {
+			return err
+		}
+		switch choice {
+		case 0:
+			if err = secureclip.Clip(cred.Password); err != nil {
+				return err
+			}
+			p.v.RecordUse(location)
+			p.println("Password copied, it will be cleared in " + describeClipTimeout(secureclip.Timeout()) + ".")
+		case 1:
+			if presenting() {
+				return errPresentation
+			}
+			p.println("Password: " + cred.Password)
+			p.v.RecordUse(location)
+		case 2:
+			if presenting() {
+				return errPresentation
+			}
+			if cred.Notes == "" {
+				p.println("No notes.")
+			} else {
+				p.println("Notes:")
+				p.println(cred.Notes)
+			}
+		case 3:
+			answer, err := p.ask("Delete " + location + "? Enter yes to delete it")
+			if err != nil {
+				return err
+			}
+			if strings.ToLower(answer) != "yes" {
+				p.println("Not deleted.")
+				continue
+			}
+			if err = p.v.Delete(location); err != nil {
+				return err
+			}
+			p.println(location + " deleted.")
+			return nil
+		}
+	}
+}
+
+// add asks for a new credential and adds it to the vault.
+func (p *plainUI) add() error {
+	location, err := p.ask("Enter the location, such as a website")
+	if err != nil {
+		return err
+	}
+	username, err := p.ask("Enter the username")
+	if err != nil {
+		return err
+	}
+	password, err := p.askSecret("Enter the password, or leave it empty to generate one: ")
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		err = p.v.Generate(location, username)
+	} else {
+		err = p.v.Add(location, vault.Credential{Username: username, Password: password})
+	}
+	if err != nil {
+		return err
+	}
+	p.println(location + " added.")
+	return nil
+}
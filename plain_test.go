@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/secureclip"
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestPlainUI(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("github.com", vault.Credential{Username: "alice", Password: "hunter2", Notes: "recovery codes"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("gitlab.com", vault.Credential{Username: "bob", Password: "hunter3"}); err != nil {
+		t.Fatal(err)
+	}
+	clip := &secureclip.MemoryClipboard{}
+	secureclip.SetClipboard(clip)
+	defer secureclip.SetClipboard(nil)
+
+	input := strings.Join([]string{
+		"2", "hub", // search for github.com
+		"1", // choose it
+		"1", // copy the password
+		"3", // read the notes
+		"0", // back
+		"9", // not an option
+		"3", // add a credential
+		"example.com", "carol",
+		"1",                  // list credentials
+		"x", "3", "4", "yes", // delete gitlab.com
+		"4", // quit
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	p := newPlainUI(v, strings.NewReader(input), &out, time.Hour)
+	p.askSecret = func(string) (string, error) {
+		return "secret", nil
+	}
+	if err = p.run(); err != nil {
+		t.Fatal(err, out.String())
+	}
+
+	if clip.Contents() != "hunter2" {
+		t.Fatal("password was not copied")
+	}
+	for _, expected := range []string{
+		"1 credentials:\n1. github.com\n0. Back to the main menu\n",
+		"Username: alice\n",
+		"Notes:\nrecovery codes\n",
+		`"9" is not one of the numbers listed.`,
+		"example.com added.\n",
+		`"x" is not one of the numbers listed.`,
+		"gitlab.com deleted.\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("output did not contain %q:\n%v", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "\x1b") {
+		t.Fatal("output contains escape sequences")
+	}
+	if cred, err := v.Get("example.com"); err != nil || cred.Username != "carol" || cred.Password != "secret" {
+		t.Fatal("credential was not added:", cred, err)
+	}
+	if _, err = v.Get("gitlab.com"); err != vault.ErrNoSuchCredential {
+		t.Fatal("credential was not deleted:", err)
+	}
+}
+
+func TestPlainUITimeout(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	c := clock.NewFake(time.Now())
+	var out bytes.Buffer
+	r, w := io.Pipe()
+	defer w.Close()
+	p := newPlainUI(v, r, &out, time.Minute)
+	p.clock = c
+	done := make(chan error, 1)
+	go func() {
+		done <- p.run()
+	}()
+	for {
+		select {
+		case err = <-done:
+			if err != errPlainIdle {
+				t.Fatal("expected errPlainIdle, got", err)
+			}
+			return
+		case <-time.After(time.Millisecond):
+			c.Advance(time.Minute)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// plaintextTracker records the plaintext files, such as CSV imports and
+// exports, that were read or written during a session, so that the user can
+// be reminded of any that are left behind.
+type plaintextTracker struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+// plaintextFiles tracks the plaintext files touched by this session.
+var plaintextFiles = new(plaintextTracker)
+
+// askLine asks the user for a line of text on the terminal.
+func askLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	var answer []byte
+	b := make([]byte, 1)
+	for {
+		// read a byte at a time so no input meant for the REPL is consumed
+		n, err := os.Stdin.Read(b)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 || b[0] == '\n' {
+			break
+		}
+		answer = append(answer, b[0])
+	}
+	return strings.TrimSpace(string(answer)), nil
+}
+
+// askYesNo asks the user a yes or no question on the terminal.
+var askYesNo = func(prompt string) (bool, error) {
+	answer, err := askLine(prompt + " (y/n) ")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// add records `path` as a plaintext file.
+func (t *plaintextTracker) add(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.paths {
+		if p == path {
+			return
+		}
+	}
+	t.paths = append(t.paths, path)
+}
+
+// remaining returns the recorded plaintext files that still exist.
+func (t *plaintextTracker) remaining() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var remaining []string
+	for _, p := range t.paths {
+		if _, err := os.Stat(p); err == nil {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
+
+// reminder returns a warning listing the plaintext files left behind by the
+// session, or an empty string if there are none.
+func (t *plaintextTracker) reminder() string {
+	remaining := t.remaining()
+	if len(remaining) == 0 {
+		return ""
+	}
+	banner := strings.Repeat("!", 72)
+	s := banner + "\nWARNING: this session left plaintext passwords on disk in:\n"
+	for _, p := range remaining {
+		s += "    " + p + "\n"
+	}
+	s += "Delete these files once you no longer need them.\n" + banner + "\n"
+	return s
+}
+
+// shredFile overwrites the file at `path` with zeroes, flushes it to disk,
+// and removes it. On SSDs and copy-on-write or journaling filesystems the
+// overwrite may not reach every copy of the data, so this is a best effort.
+func shredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	zeroes := make([]byte, 32*1024)
+	for remaining := info.Size(); remaining > 0; {
+		n := int64(len(zeroes))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := f.Write(zeroes[:n]); err != nil {
+			f.Close()
+			return err
+		}
+		remaining -= n
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// offerShred asks the user whether to shred `path`, a plaintext file that
+// has just been imported, and does so if they agree. If they decline, the
+// file is recorded so that they are reminded of it when masterkey exits. It
+// returns a line describing the outcome.
+func offerShred(path string) (string, error) {
+	ok, err := askYesNo(fmt.Sprintf("%v contains plaintext passwords. Overwrite and delete it now?", path))
+	if err != nil || !ok {
+		plaintextFiles.add(path)
+		return fmt.Sprintf("%v was kept. Remember to delete it.\n", path), nil
+	}
+	if err := shredFile(path); err != nil {
+		plaintextFiles.add(path)
+		return "", fmt.Errorf("could not delete %v: %v", path, err)
+	}
+	return fmt.Sprintf("%v was overwritten and deleted.\n", path), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/avahowell/masterkey/repl"
+	"github.com/avahowell/masterkey/secureclip"
+	"github.com/avahowell/masterkey/vault"
+)
+
+// timeoutFlags are the -timeout and -clipboard-timeout flags, and whether
+// each was given on the command line.
+type timeoutFlags struct {
+	timeout      time.Duration
+	timeoutSet   bool
+	clipboard    time.Duration
+	clipboardSet bool
+}
+
+// effectiveTimeouts returns the idle timeout and clipboard timeout to use for
+// a vault with `settings`. The vault's timeouts replace the defaults, flags
+// replace the vault's timeouts, and if the vault enforces its timeouts,
+// flags may only shorten them.
+func effectiveTimeouts(settings vault.Settings, flags timeoutFlags) (time.Duration, time.Duration) {
+	pick := func(flag time.Duration, set bool, vaultValue time.Duration) time.Duration {
+		if vaultValue <= 0 {
+			return flag
+		}
+		if !set || (settings.EnforceTimeouts && flag > vaultValue) {
+			return vaultValue
+		}
+		return flag
+	}
+	return pick(flags.timeout, flags.timeoutSet, settings.Timeout),
+		pick(flags.clipboard, flags.clipboardSet, settings.ClipboardTimeout)
+}
+
+// clipDuration returns how long a secret copied with `--for d` should stay on
+// the clipboard, refusing durations longer than `v` enforces.
+func clipDuration(v *vault.Vault, d time.Duration) (time.Duration, error) {
+	if d <= 0 {
+		return secureclip.Timeout(), nil
+	}
+	if settings := v.Settings(); settings.EnforceTimeouts && settings.ClipboardTimeout > 0 && d > settings.ClipboardTimeout {
+		return 0, msg.Errorf("this vault does not allow secrets on the clipboard for longer than %v", settings.ClipboardTimeout)
+	}
+	return d, nil
+}
+
+// describeClipTimeout describes how long a secret stays on the clipboard, as
+// "30 seconds".
+func describeClipTimeout(d time.Duration) string {
+	if d%time.Second == 0 && d < time.Minute*2 {
+		return fmt.Sprintf("%v seconds", int(d/time.Second))
+	}
+	return d.String()
+}
+
+// describeTimeout describes a timeout from a vault's settings.
+func describeTimeout(d time.Duration, def string) string {
+	if d <= 0 {
+		return def
+	}
+	return d.String()
+}
+
+func policy(v *vault.Vault) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		settings := v.Settings()
+		if len(args) == 0 {
+			printstring := fmt.Sprintf("timeout: %v\n", describeTimeout(settings.Timeout, "the -timeout flag"))
+			printstring += fmt.Sprintf("clipboard timeout: %v\n", describeTimeout(settings.ClipboardTimeout, secureclip.DefaultTimeout.String()))
+			if settings.EnforceTimeouts {
+				printstring += "enforced: flags and commands can only shorten these\n"
+			}
+			return printstring, nil
+		}
+		if len(args) != 2 {
+			return "", msg.Errorf("%v requires timeout or clipboard with a duration or default, enforce with on or off, or no arguments. See help for usage.", "policy")
+		}
+
+		relaxing := false
+		switch args[0] {
+		case "timeout", "clipboard":
+			var d time.Duration
+			if args[1] != "default" {
+				var err error
+				if d, err = time.ParseDuration(args[1]); err != nil || d <= 0 {
+					return "", msg.Errorf("%v is not a positive duration such as 2m or 10s", args[1])
+				}
+			}
+			current := &settings.Timeout
+			if args[0] == "clipboard" {
+				current = &settings.ClipboardTimeout
+			}
+			relaxing = *current > 0 && (d <= 0 || d > *current)
+			*current = d
+		case "enforce":
+			if args[1] != "on" && args[1] != "off" {
+				return "", msg.Errorf("%v requires on or off. See help for usage.", "policy enforce")
+			}
+			relaxing = settings.EnforceTimeouts && args[1] == "off"
+			settings.EnforceTimeouts = args[1] == "on"
+		default:
+			return "", msg.Errorf("unknown policy %v. See help for usage.", args[0])
+		}
+
+		// an enforced policy can only be relaxed by someone who knows the
+		// master password, not just anyone at an unlocked terminal
+		if relaxing && v.Settings().EnforceTimeouts {
+			pass, err := askPassword("This vault enforces its timeouts. Enter the master password to relax them: ")
+			if err != nil {
+				return "", err
+			}
+			if !v.VerifyPassphrase(pass) {
+				return "", errNotConfirmed
+			}
+		}
+		if err := v.SetSettings(settings); err != nil {
+			return "", err
+		}
+		if args[0] == "clipboard" {
+			secureclip.SetTimeout(settings.ClipboardTimeout)
+		}
+		if args[0] == "timeout" {
+			return "timeout changed. It takes effect the next time the vault is opened.\n", nil
+		}
+		return "policy changed\n", nil
+	}
+}
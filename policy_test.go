@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/repltest"
+	"github.com/avahowell/masterkey/secureclip"
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestEffectiveTimeouts(t *testing.T) {
+	defaults := timeoutFlags{timeout: 5 * time.Minute, clipboard: 30 * time.Second}
+	tests := []struct {
+		settings  vault.Settings
+		flags     timeoutFlags
+		idle      time.Duration
+		clipboard time.Duration
+	}{
+		{vault.Settings{}, defaults, 5 * time.Minute, 30 * time.Second},
+		{vault.Settings{Timeout: time.Minute, ClipboardTimeout: 10 * time.Second}, defaults, time.Minute, 10 * time.Second},
+		{vault.Settings{Timeout: time.Minute}, timeoutFlags{timeout: time.Hour, timeoutSet: true, clipboard: 30 * time.Second}, time.Hour, 30 * time.Second},
+		{vault.Settings{Timeout: time.Minute, EnforceTimeouts: true}, timeoutFlags{timeout: time.Hour, timeoutSet: true, clipboard: 30 * time.Second}, time.Minute, 30 * time.Second},
+		{vault.Settings{Timeout: time.Minute, EnforceTimeouts: true}, timeoutFlags{timeout: 10 * time.Second, timeoutSet: true, clipboard: time.Hour, clipboardSet: true}, 10 * time.Second, time.Hour},
+	}
+	for i, test := range tests {
+		idle, clipboard := effectiveTimeouts(test.settings, test.flags)
+		if idle != test.idle || clipboard != test.clipboard {
+			t.Errorf("%v: got %v and %v, expected %v and %v", i, idle, clipboard, test.idle, test.clipboard)
+		}
+	}
+}
+
+func TestPolicyCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("testlocation", vault.Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	d := repltest.New(setupRepl(v, path, time.Hour))
+	defer d.Close()
+	defer secureclip.SetTimeout(0)
+
+	if _, err = d.Send("policy timeout soon"); err == nil {
+		t.Fatal("expected an invalid duration to be refused")
+	}
+	for _, cmd := range []string{"policy timeout 2m", "policy clipboard 10s", "policy enforce on"} {
+		if _, err = d.Send(cmd); err != nil {
+			t.Fatal(cmd, err)
+		}
+	}
+	settings := v.Settings()
+	if settings.Timeout != 2*time.Minute || settings.ClipboardTimeout != 10*time.Second || !settings.EnforceTimeouts {
+		t.Fatalf("policy did not change the settings: %+v", settings)
+	}
+	res, err := d.Send("policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "timeout: 2m0s\nclipboard timeout: 10s\nenforced: flags and commands can only shorten these\n" {
+		t.Fatalf("unexpected policy output %q", res)
+	}
+
+	if _, err = d.Send("clip --for 1m testlocation"); err == nil {
+		t.Fatal("clip kept a secret on the clipboard for longer than the vault allows")
+	}
+	res, err = d.Send("clip --for 5s testlocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "testuser@testlocation copied to clipboard, will clear in 5 seconds\n" {
+		t.Fatalf("unexpected clip output %q", res)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// maskedSecret is displayed in place of a secret in presentation mode.
+const maskedSecret = "********"
+
+// errPresentation is returned by commands that can only display secrets
+// while presentation mode is on.
+var errPresentation = errors.New("this command displays secrets and is disabled in presentation mode. Turn it off with `set presentation off`")
+
+// presentation is 1 while presentation mode is on. In presentation mode no
+// passwords, notes or meta values are displayed and usernames are partially
+// masked, so masterkey can be used while sharing a screen. Copying to the
+// clipboard still works.
+var presentation int32
+
+func presenting() bool {
+	return atomic.LoadInt32(&presentation) == 1
+}
+
+func setPresentation(on bool) {
+	var val int32
+	if on {
+		val = 1
+	}
+	atomic.StoreInt32(&presentation, val)
+}
+
+// displaySecret returns `secret`, or maskedSecret in presentation mode if it
+// is not empty.
+func displaySecret(secret string) string {
+	if presenting() && secret != "" {
+		return maskedSecret
+	}
+	return secret
+}
+
+// displayUsername returns `username`, partially masked in presentation mode.
+func displayUsername(username string) string {
+	if presenting() {
+		return maskUsername(username)
+	}
+	return username
+}
+
+// credentialUsername returns the username of `cred` as it should be
+// displayed: masked if the vault treats it as sensitive, or in presentation
+// mode.
+func credentialUsername(v *vault.Vault, cred *vault.Credential) string {
+	if v.MasksUsername(cred) {
+		return maskUsername(cred.Username)
+	}
+	return displayUsername(cred.Username)
+}
+
+// maskUsername masks all but the first and last characters of `username`.
+// If it is an email address, only the part before the @ is masked.
+func maskUsername(username string) string {
+	local, domain := username, ""
+	if at := strings.LastIndex(username, "@"); at > 0 {
+		local, domain = username[:at], username[at:]
+	}
+	n := utf8.RuneCountInString(local)
+	if n <= 2 {
+		return strings.Repeat("*", n) + domain
+	}
+	r := []rune(local)
+	return string(r[0]) + strings.Repeat("*", n-2) + string(r[n-1]) + domain
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestMaskUsername(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"ab":                "**",
+		"alice":             "a***e",
+		"alice@example.com": "a***e@example.com",
+		"@handle":           "@*****e",
+		"jo@example.com":    "**@example.com",
+		"éloïse":            "é****e",
+	}
+	for username, want := range tests {
+		if got := maskUsername(username); got != want {
+			t.Errorf("maskUsername(%q): got %q, want %q", username, got, want)
+		}
+	}
+}
+
+func TestPresentationMode(t *testing.T) {
+	defer setPresentation(false)
+
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	err = v.Add("testlocation", vault.Credential{Username: "alice@example.com", Password: "hunter2", Notes: "secret notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.AddMeta("testlocation", "pin", "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = set([]string{"presentation", "on"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := get(v)([]string{"testlocation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"alice", "hunter2", "secret notes", "1234"} {
+		if strings.Contains(res, secret) {
+			t.Fatalf("get displayed %q in presentation mode: %v", secret, res)
+		}
+	}
+	if !strings.Contains(res, "a***e@example.com") {
+		t.Fatal("get did not display the masked username:", res)
+	}
+	if _, err = peek(v, nil)([]string{"testlocation"}); err != errPresentation {
+		t.Fatal("expected errPresentation from peek, got", err)
+	}
+
+	if _, err = set([]string{"presentation", "off"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = get(v)([]string{"testlocation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "hunter2") {
+		t.Fatal("get did not display the password after presentation mode was turned off")
+	}
+
+	if _, err = setCmd().Run([]string{"nosuchoption", "on"}); err == nil {
+		t.Fatal("set accepted an unknown option")
+	}
+}
+
+func TestMaskUsernameCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("testlocation", vault.Credential{Username: "alice", Password: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = maskusername(v)([]string{"testlocation", "on"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := get(v)([]string{"testlocation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(res, "alice") || !strings.Contains(res, "a***e") {
+		t.Fatal("get did not mask a sensitive username:", res)
+	}
+	if !strings.Contains(res, "hunter2") {
+		t.Fatal("get masked the password of a credential with a sensitive username")
+	}
+
+	if _, err = maskusername(v)([]string{"testlocation", "off"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = maskusername(v)([]string{"on"}); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Settings().SensitiveUsernames {
+		t.Fatal("maskusername on did not mask every username")
+	}
+	if _, err = maskusername(v)([]string{"testlocation", "maybe"}); err == nil {
+		t.Fatal("maskusername accepted an invalid argument")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"errors"
 	"math/big"
+	"strings"
 )
 
 var (
@@ -14,6 +15,9 @@ var (
 	// CharsetAlphaNumSpecial defines a character set containing letters,
 	// numbers, and special characters.
 	CharsetAlphaNumSpecial = []byte("abcdefghijklmnopqrstuvwxyz0123456789{}_*()&^%$@!\\<>;'|[]=+-`~,.?")
+	// CharsetSymbols defines a character set containing only the special
+	// characters of CharsetAlphaNumSpecial.
+	CharsetSymbols = []byte("{}_*()&^%$@!\\<>;'|[]=+-`~,.?")
 
 	errBadLength           = errors.New("length argument must be greater than zero")
 	errInsufficientEntropy = errors.New("charset has insufficient entropy")
@@ -25,6 +29,9 @@ func GeneratePassphrase(charset []byte, length uint) (string, error) {
 	if length == 0 {
 		return "", errBadLength
 	}
+	if len(charset) < 2 {
+		return "", errInsufficientEntropy
+	}
 	var res string
 	for i := uint(0); i < length; i++ {
 		randIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
@@ -35,3 +42,32 @@ func GeneratePassphrase(charset []byte, length uint) (string, error) {
 	}
 	return res, nil
 }
+
+// Union returns a character set containing the characters of each of
+// `charsets`, in order, without duplicates.
+func Union(charsets ...[]byte) []byte {
+	seen := make(map[byte]bool)
+	var res []byte
+	for _, charset := range charsets {
+		for _, c := range charset {
+			if !seen[c] {
+				seen[c] = true
+				res = append(res, c)
+			}
+		}
+	}
+	return res
+}
+
+// Exclude returns a character set containing the characters of `charset`
+// that are not in `chars`, such as characters that are ambiguous in print or
+// that a site rejects.
+func Exclude(charset []byte, chars string) []byte {
+	var res []byte
+	for _, c := range charset {
+		if !strings.ContainsRune(chars, rune(c)) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
@@ -1,6 +1,7 @@
 package pwgen
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -12,6 +13,7 @@ func TestGeneratePassphrase(t *testing.T) {
 	}{
 		{0, CharsetAlpha, errBadLength},
 		{32, CharsetAlphaNum, nil},
+		{32, []byte("a"), errInsufficientEntropy},
 	}
 	for _, test := range tests {
 		if _, err := GeneratePassphrase(test.charset, test.length); err != test.expectedErr {
@@ -19,3 +21,61 @@ func TestGeneratePassphrase(t *testing.T) {
 		}
 	}
 }
+
+func TestCharsetOperations(t *testing.T) {
+	charset := Exclude(Union(CharsetAlphaNum, CharsetSymbols), "O0l1I\"'\\")
+	if string(Union([]byte("abc"), []byte("cba"), []byte("d"))) != "abcd" {
+		t.Fatal("union did not remove duplicates")
+	}
+	for _, c := range "0l1\"'\\" {
+		if strings.ContainsRune(string(charset), c) {
+			t.Fatalf("%q was not excluded", c)
+		}
+	}
+	if len(charset) != len(CharsetAlphaNum)+len(CharsetSymbols)-5 {
+		t.Fatal("exclude removed too many characters:", string(charset))
+	}
+	pw, err := GeneratePassphrase(charset, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(pw, "0l1\"'\\") {
+		t.Fatal("generated password contains an excluded character:", pw)
+	}
+}
+
+func TestShape(t *testing.T) {
+	s := Analyze("Hunter2!!é")
+	if s.Length != 10 || !s.Lower || !s.Upper || !s.Digits || string(s.Symbols) != "!" {
+		t.Fatalf("unexpected shape %+v", s)
+	}
+	if s.Describe() != "lowercase letters, uppercase letters, digits and the symbols !" {
+		t.Fatal("unexpected description:", s.Describe())
+	}
+	for i := 0; i < 100; i++ {
+		pw, err := GenerateShaped(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Analyze(pw)
+		if got.Length != s.Length || !got.Lower || !got.Upper || !got.Digits || string(got.Symbols) != "!" {
+			t.Fatalf("%q does not have the shape %+v", pw, s)
+		}
+	}
+
+	if bits := Analyze("abcd").Strength(); bits < 18.8 || bits > 18.81 {
+		t.Fatal("unexpected strength", bits)
+	}
+	if strong := Analyze("abcd").AtLeast(60); strong.Length != 13 || !strong.Lower || strong.Digits {
+		t.Fatalf("unexpected strengthened shape %+v", strong)
+	}
+	if _, err := GenerateShaped(Analyze("aA1!")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateShaped(Shape{Length: 2, Lower: true, Upper: true, Digits: true}); err != errShapeTooShort {
+		t.Fatal("expected errShapeTooShort, got", err)
+	}
+	if _, err := GenerateShaped(Analyze("")); err != errBadLength {
+		t.Fatal("expected errBadLength, got", err)
+	}
+}
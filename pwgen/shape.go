@@ -0,0 +1,165 @@
+package pwgen
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	// CharsetUpper defines a character set containing only uppercase
+	// letters.
+	CharsetUpper = []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	// CharsetDigits defines a character set containing only numbers.
+	CharsetDigits = []byte("0123456789")
+
+	errShapeTooShort = errors.New("password is too short to use every class of character it needs")
+)
+
+// Shape describes the composition of a password: its length, and the
+// classes of characters it uses. Generating a password with the same shape
+// as an old one is likely to satisfy the rules of the site it is for.
+type Shape struct {
+	Length uint
+	Lower  bool
+	Upper  bool
+	Digits bool
+	// Symbols holds each symbol the password uses. Sites often only
+	// accept some symbols, so only these are used again.
+	Symbols []byte
+}
+
+// Analyze returns the shape of `password`. Characters outside of ASCII count
+// towards its length, but are not used again.
+func Analyze(password string) Shape {
+	var s Shape
+	for _, r := range password {
+		s.Length++
+		switch {
+		case r >= 'a' && r <= 'z':
+			s.Lower = true
+		case r >= 'A' && r <= 'Z':
+			s.Upper = true
+		case r >= '0' && r <= '9':
+			s.Digits = true
+		case r > ' ' && r < 0x7f && !strings.ContainsRune(string(s.Symbols), r):
+			s.Symbols = append(s.Symbols, byte(r))
+		}
+	}
+	return s
+}
+
+// classes returns a character set for each class of characters the shape
+// uses.
+func (s Shape) classes() [][]byte {
+	var classes [][]byte
+	if s.Lower {
+		classes = append(classes, CharsetAlpha)
+	}
+	if s.Upper {
+		classes = append(classes, CharsetUpper)
+	}
+	if s.Digits {
+		classes = append(classes, CharsetDigits)
+	}
+	if len(s.Symbols) > 0 {
+		classes = append(classes, s.Symbols)
+	}
+	return classes
+}
+
+// Describe describes the classes of characters the shape uses, such as
+// "lowercase letters, digits and the symbols !@".
+func (s Shape) Describe() string {
+	var parts []string
+	if s.Lower {
+		parts = append(parts, "lowercase letters")
+	}
+	if s.Upper {
+		parts = append(parts, "uppercase letters")
+	}
+	if s.Digits {
+		parts = append(parts, "digits")
+	}
+	if len(s.Symbols) > 0 {
+		parts = append(parts, "the symbols "+string(s.Symbols))
+	}
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// Strength estimates the strength, in bits, of a random password with the
+// shape. Passwords that are not random, such as words, are weaker than this.
+func (s Shape) Strength() float64 {
+	charset := Union(s.classes()...)
+	if len(charset) < 2 {
+		return 0
+	}
+	return float64(s.Length) * math.Log2(float64(len(charset)))
+}
+
+// AtLeast returns the shape, lengthened if needed so that its Strength is at
+// least `bits`.
+func (s Shape) AtLeast(bits float64) Shape {
+	charset := Union(s.classes()...)
+	if len(charset) < 2 || s.Strength() >= bits {
+		return s
+	}
+	s.Length = uint(math.Ceil(bits / math.Log2(float64(len(charset)))))
+	return s
+}
+
+// GenerateShaped creates a new random password with the shape `s`, using at
+// least one character from every class of characters the shape uses.
+func GenerateShaped(s Shape) (string, error) {
+	if s.Length == 0 {
+		return "", errBadLength
+	}
+	classes := s.classes()
+	charset := Union(classes...)
+	if len(charset) < 2 {
+		return "", errInsufficientEntropy
+	}
+	if s.Length < uint(len(classes)) {
+		return "", errShapeTooShort
+	}
+
+	// one character from each class, and the rest from any class, in a
+	// random order
+	res := make([]byte, 0, s.Length)
+	for _, class := range classes {
+		c, err := randChar(class)
+		if err != nil {
+			return "", err
+		}
+		res = append(res, c)
+	}
+	for uint(len(res)) < s.Length {
+		c, err := randChar(charset)
+		if err != nil {
+			return "", err
+		}
+		res = append(res, c)
+	}
+	for i := len(res) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		res[i], res[j.Int64()] = res[j.Int64()], res[i]
+	}
+	return string(res), nil
+}
+
+// randChar returns a random character from `charset`.
+func randChar(charset []byte) (byte, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, err
+	}
+	return charset[i.Uint64()], nil
+}
@@ -0,0 +1,751 @@
+// Package qr decodes QR codes from images, such as screenshots of the QR
+// codes sites show when enrolling two-factor authentication. It is meant for
+// sharp images of a code facing the camera or screen: the code may be
+// scaled or rotated, but not seen at an angle.
+package qr
+
+import (
+	"errors"
+	"image"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned by Decode if the image does not contain a QR
+	// code.
+	ErrNotFound = errors.New("qr: no QR code was found in the image")
+
+	// ErrUnreadable is returned by Decode if a QR code was found but could
+	// not be read, because it is damaged, blurred or seen at an angle.
+	ErrUnreadable = errors.New("qr: the QR code could not be read")
+)
+
+// Decode finds a QR code in `img` and returns the text it holds.
+func Decode(img image.Image) (string, error) {
+	b := binarize(img)
+	finders := b.finders()
+	if len(finders) < 3 {
+		return "", ErrNotFound
+	}
+	g, err := b.grid(finders)
+	if err != nil {
+		return "", err
+	}
+	return g.decode()
+}
+
+// bitmap is an image reduced to dark and light pixels.
+type bitmap struct {
+	w, h int
+	dark []bool
+}
+
+// binarize reduces `img` to a bitmap, counting as dark the pixels darker
+// than halfway between its darkest and lightest pixels.
+func binarize(img image.Image) *bitmap {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	luma := make([]uint32, w*h)
+	lo, hi := uint32(math.MaxUint32), uint32(0)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// transparent pixels are shown over a light background
+			l := (299*r+587*g+114*b)/1000 + 0xffff - a
+			luma[y*w+x] = l
+			if l < lo {
+				lo = l
+			}
+			if l > hi {
+				hi = l
+			}
+		}
+	}
+	threshold := lo + (hi-lo)/2
+	bm := &bitmap{w: w, h: h, dark: make([]bool, w*h)}
+	for i, l := range luma {
+		bm.dark[i] = l < threshold
+	}
+	return bm
+}
+
+func (b *bitmap) at(x, y int) bool {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return false
+	}
+	return b.dark[y*b.w+x]
+}
+
+// point is a position in the image, in pixels.
+type point struct {
+	x, y float64
+}
+
+func (p point) add(q point) point     { return point{p.x + q.x, p.y + q.y} }
+func (p point) sub(q point) point     { return point{p.x - q.x, p.y - q.y} }
+func (p point) scale(s float64) point { return point{p.x * s, p.y * s} }
+func (p point) dot(q point) float64   { return p.x*q.x + p.y*q.y }
+func (p point) cross(q point) float64 { return p.x*q.y - p.y*q.x }
+func (p point) length() float64       { return math.Hypot(p.x, p.y) }
+func (p point) dist(q point) float64  { return p.sub(q).length() }
+
+// darkIn returns true if the pixel of `b` at `p` is dark.
+func (p point) darkIn(b *bitmap) bool {
+	return b.at(int(math.Floor(p.x)), int(math.Floor(p.y)))
+}
+
+// finder is one of the three square finder patterns in the corners of a QR
+// code, 7 modules across.
+type finder struct {
+	center point
+	module float64
+	count  int
+}
+
+// ratioMatches returns true if the runs in `runs` are in the 1:1:3:1:1
+// ratio of a line through the center of a finder pattern.
+func ratioMatches(runs [5]int) bool {
+	total := 0
+	for _, r := range runs {
+		if r == 0 {
+			return false
+		}
+		total += r
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	tolerance := module / 2
+	for i, want := range []float64{1, 1, 3, 1, 1} {
+		if math.Abs(float64(runs[i])-want*module) > want*tolerance+0.5 {
+			return false
+		}
+	}
+	return true
+}
+
+// finders scans the bitmap for finder patterns, and returns the three seen
+// most often, largest first if more are seen equally often.
+func (b *bitmap) finders() []finder {
+	var found []finder
+	for y := 0; y < b.h; y++ {
+		var runs [5]int
+		dark := false
+		for x := 0; x <= b.w; x++ {
+			if x < b.w && b.at(x, y) == dark {
+				runs[4]++
+				continue
+			}
+			// a run has ended at x, so check if the last five match
+			if dark && ratioMatches(runs) {
+				total := runs[0] + runs[1] + runs[2] + runs[3] + runs[4]
+				cx := float64(x) - float64(runs[4]+runs[3]) - float64(runs[2])/2
+				if cy, ok := b.verticalCenter(cx, float64(y), total); ok {
+					if cx, ok = b.horizontalCenter(cx, cy, total); ok {
+						found = addFinder(found, point{cx, cy}, float64(total)/7)
+					}
+				}
+			}
+			copy(runs[:], runs[1:])
+			runs[4] = 1
+			dark = !dark
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].count != found[j].count {
+			return found[i].count > found[j].count
+		}
+		return found[i].module > found[j].module
+	})
+	if len(found) > 3 {
+		found = found[:3]
+	}
+	return found
+}
+
+// addFinder records a sighting of a finder pattern at `center`, merging it
+// with one seen before in the same place.
+func addFinder(found []finder, center point, module float64) []finder {
+	for i, f := range found {
+		if f.center.dist(center) < f.module*2 && math.Abs(f.module-module) < f.module {
+			n := float64(f.count)
+			found[i].center = f.center.scale(n).add(center).scale(1 / (n + 1))
+			found[i].module = (f.module*n + module) / (n + 1)
+			found[i].count++
+			return found
+		}
+	}
+	return append(found, finder{center: center, module: module, count: 1})
+}
+
+// finderOffset checks for the five runs of a finder pattern along the line
+// through (x, y) in direction (dx, dy), and returns the offset along the
+// line from the pixel at (x, y) to the center of the middle run.
+func (b *bitmap) finderOffset(x, y float64, dx, dy int, total int) (float64, bool) {
+	var runs [5]int
+	px, py := int(x), int(y)
+	if !b.at(px, py) {
+		return 0, false
+	}
+	// from the center outwards in each direction: the dark middle, then
+	// light, then dark
+	back, fwd := 0, 0
+	for _, dir := range []int{-1, 1} {
+		state := 0
+		counts := [3]int{}
+		for i := 0; i < total*2; i++ {
+			if b.at(px+dir*dx*i, py+dir*dy*i) != (state%2 == 0) {
+				state++
+				if state == 3 {
+					break
+				}
+			}
+			counts[state]++
+		}
+		if state < 2 {
+			return 0, false
+		}
+		if dir < 0 {
+			runs[0], runs[1] = counts[2], counts[1]
+			back = counts[0]
+		} else {
+			runs[4], runs[3] = counts[2], counts[1]
+			fwd = counts[0]
+		}
+	}
+	// the center pixel was counted in both directions
+	runs[2] = back + fwd - 1
+	if !ratioMatches(runs) {
+		return 0, false
+	}
+	return float64(fwd-back)/2 + 0.5, true
+}
+
+// verticalCenter checks for a finder pattern running vertically through
+// (x, y) and returns the y of its center.
+func (b *bitmap) verticalCenter(x, y float64, total int) (float64, bool) {
+	offset, ok := b.finderOffset(x, y, 0, 1, total)
+	return math.Floor(y) + offset, ok
+}
+
+// horizontalCenter checks for a finder pattern running horizontally
+// through (x, y) and returns the x of its center.
+func (b *bitmap) horizontalCenter(x, y float64, total int) (float64, bool) {
+	offset, ok := b.finderOffset(x, y, 1, 0, total)
+	return math.Floor(x) + offset, ok
+}
+
+// grid is the modules of a QR code, read from the image.
+type grid struct {
+	size    int
+	version int
+	dark    [][]bool
+}
+
+func (g *grid) at(x, y int) bool {
+	return g.dark[y][x]
+}
+
+// grid samples the modules of the QR code whose finder patterns are
+// `finders`.
+func (b *bitmap) grid(finders []finder) (*grid, error) {
+	// the top left finder is the one at the right angle, and the top right
+	// is clockwise from it
+	var tl, tr, bl finder
+	best := math.Inf(1)
+	for i := range finders {
+		a, c := finders[(i+1)%3], finders[(i+2)%3]
+		u, v := a.center.sub(finders[i].center), c.center.sub(finders[i].center)
+		cos := math.Abs(u.dot(v)) / (u.length() * v.length())
+		if cos < best {
+			best = cos
+			tl, tr, bl = finders[i], a, c
+			if u.cross(v) < 0 {
+				tr, bl = c, a
+			}
+		}
+	}
+	if best > 0.3 {
+		return nil, ErrNotFound
+	}
+
+	module := (tl.module + tr.module + bl.module) / 3
+	across := (tl.center.dist(tr.center) + tl.center.dist(bl.center)) / 2 / module
+	size := int(math.Floor(across+0.5)) + 7
+	// sizes are 17 + 4 * version, so round to the nearest
+	switch size % 4 {
+	case 0:
+		size++
+	case 2:
+		size--
+	case 3:
+		size -= 2
+	}
+	version := (size - 17) / 4
+	if version < 1 || version > 40 {
+		return nil, ErrUnreadable
+	}
+
+	// the centers of the finders are 3.5 modules in from the corners
+	right := tr.center.sub(tl.center).scale(1 / float64(size-7))
+	down := bl.center.sub(tl.center).scale(1 / float64(size-7))
+	origin := tl.center.sub(right.scale(3.5)).sub(down.scale(3.5))
+	g := &grid{size: size, version: version, dark: make([][]bool, size)}
+	for y := 0; y < size; y++ {
+		g.dark[y] = make([]bool, size)
+		for x := 0; x < size; x++ {
+			p := origin.add(right.scale(float64(x) + 0.5)).add(down.scale(float64(y) + 0.5))
+			if p.x < 0 || p.y < 0 || p.x >= float64(b.w) || p.y >= float64(b.h) {
+				return nil, ErrUnreadable
+			}
+			g.dark[y][x] = p.darkIn(b)
+		}
+	}
+	return g, nil
+}
+
+// decode reads the text held by the grid.
+func (g *grid) decode() (string, error) {
+	level, mask, ok := g.formatInfo()
+	if !ok {
+		return "", ErrUnreadable
+	}
+	if g.version >= 7 {
+		if version, ok := g.versionInfo(); ok && version != g.version {
+			return "", ErrUnreadable
+		}
+	}
+
+	function := functionModules(g.version)
+	raw := make([]byte, rawDataModules(g.version)/8)
+	i := 0
+	for right := g.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < g.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = g.size - 1 - vert
+				}
+				if function[y][x] || i >= len(raw)*8 {
+					continue
+				}
+				if g.at(x, y) != masked(mask, x, y) {
+					raw[i/8] |= 0x80 >> uint(i%8)
+				}
+				i++
+			}
+		}
+	}
+
+	data, err := deinterleave(raw, g.version, level)
+	if err != nil {
+		return "", err
+	}
+	return decodeSegments(data, g.version)
+}
+
+// Error correction levels, in the order of their tables.
+const (
+	levelL = iota
+	levelM
+	levelQ
+	levelH
+)
+
+// formatInfo reads the error correction level and mask from either copy
+// of the format information, correcting up to 3 wrong bits.
+func (g *grid) formatInfo() (level, mask int, ok bool) {
+	var first, second uint
+	bit := func(x, y int) uint {
+		if g.at(x, y) {
+			return 1
+		}
+		return 0
+	}
+	for i := 0; i <= 5; i++ {
+		first |= bit(8, i) << uint(i)
+	}
+	first |= bit(8, 7) << 6
+	first |= bit(8, 8) << 7
+	first |= bit(7, 8) << 8
+	for i := 9; i < 15; i++ {
+		first |= bit(14-i, 8) << uint(i)
+	}
+	for i := 0; i < 8; i++ {
+		second |= bit(g.size-1-i, 8) << uint(i)
+	}
+	for i := 8; i < 15; i++ {
+		second |= bit(8, g.size-15+i) << uint(i)
+	}
+
+	bestDistance := 4
+	for data := uint(0); data < 32; data++ {
+		code := formatBits(data)
+		for _, read := range []uint{first, second} {
+			if d := popcount(code ^ read); d < bestDistance {
+				bestDistance = d
+				// levels are encoded as M, L, H, Q
+				level = []int{levelM, levelL, levelH, levelQ}[data>>3]
+				mask = int(data & 7)
+			}
+		}
+	}
+	return level, mask, bestDistance < 4
+}
+
+// formatBits returns the 15 bit format information for the 5 bits of
+// `data`, with its BCH error correction, masked.
+func formatBits(data uint) uint {
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem&0x3ff) ^ 0x5412
+}
+
+// versionInfo reads the version from the version information beside the
+// top right finder of codes from version 7 up, correcting up to 3 wrong
+// bits.
+func (g *grid) versionInfo() (int, bool) {
+	var read uint
+	for i := 0; i < 18; i++ {
+		if g.at(g.size-11+i%3, i/3) {
+			read |= 1 << uint(i)
+		}
+	}
+	for version := 7; version <= 40; version++ {
+		if popcount(versionBits(version)^read) <= 3 {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+// versionBits returns the 18 bit version information for `version`.
+func versionBits(version int) uint {
+	rem := uint(version)
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return uint(version)<<12 | rem&0xfff
+}
+
+func popcount(x uint) int {
+	n := 0
+	for ; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
+
+// masked returns true if mask pattern `mask` inverts the module at (x, y).
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// alignmentPositions returns the rows and columns of the centers of the
+// alignment patterns of a code of `version`.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*8 + n*3 + 5) / (n*4 - 4) * 2
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, 17+4*version-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// functionModules returns which modules of a code of `version` are part of
+// its fixed patterns or format and version information, rather than data.
+func functionModules(version int) [][]bool {
+	size := 17 + 4*version
+	function := make([][]bool, size)
+	for y := range function {
+		function[y] = make([]bool, size)
+	}
+	fill := func(x0, y0, w, h int) {
+		for y := y0; y < y0+h; y++ {
+			for x := x0; x < x0+w; x++ {
+				function[y][x] = true
+			}
+		}
+	}
+	// the finders with their separators and format information, and the
+	// dark module beside the bottom left finder
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	// the timing patterns
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+	positions := alignmentPositions(version)
+	for i, y := range positions {
+		for j, x := range positions {
+			// alignment patterns are left out where the finders are
+			if (i == 0 && j == 0) || (i == 0 && j == len(positions)-1) || (i == len(positions)-1 && j == 0) {
+				continue
+			}
+			fill(x-2, y-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return function
+}
+
+// rawDataModules returns the number of modules holding data and error
+// correction in a code of `version`.
+func rawDataModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// ecCodewords and ecBlocks are the number of error correction codewords in
+// each block, and the number of blocks, of a code of each version at each
+// error correction level.
+var (
+	ecCodewords = [4][41]int{
+		{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+		{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	}
+	ecBlocks = [4][41]int{
+		{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+		{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+		{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+		{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+	}
+)
+
+// blockLengths returns the lengths of the blocks the codewords of a code of
+// `version` at `level` are split into. The first blocks may be a codeword
+// shorter than the rest.
+func blockLengths(version, level int) []int {
+	total := rawDataModules(version) / 8
+	n := ecBlocks[level][version]
+	lengths := make([]int, n)
+	for i := range lengths {
+		lengths[i] = total / n
+		if i >= n-total%n {
+			lengths[i]++
+		}
+	}
+	return lengths
+}
+
+// deinterleave splits `raw` into its blocks, which are interleaved in the
+// code, corrects their errors, and returns their data codewords in order.
+func deinterleave(raw []byte, version, level int) ([]byte, error) {
+	lengths := blockLengths(version, level)
+	ecLen := ecCodewords[level][version]
+	blocks := make([][]byte, len(lengths))
+	for i, n := range lengths {
+		blocks[i] = make([]byte, n)
+	}
+
+	// data codewords are interleaved a column at a time, the longer
+	// blocks' extra codeword after the rest, then the error correction
+	k := 0
+	for col := 0; col < lengths[len(lengths)-1]-ecLen; col++ {
+		for i := range blocks {
+			if col < len(blocks[i])-ecLen {
+				blocks[i][col] = raw[k]
+				k++
+			}
+		}
+	}
+	for col := 0; col < ecLen; col++ {
+		for i := range blocks {
+			blocks[i][len(blocks[i])-ecLen+col] = raw[k]
+			k++
+		}
+	}
+
+	var data []byte
+	for _, block := range blocks {
+		if err := correct(block, ecLen); err != nil {
+			return nil, ErrUnreadable
+		}
+		data = append(data, block[:len(block)-ecLen]...)
+	}
+	return data, nil
+}
+
+// bitReader reads bits from the data codewords, most significant first.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) (int, bool) {
+	if n > r.remaining() {
+		return 0, false
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if r.data[r.pos/8]&(0x80>>uint(r.pos%8)) != 0 {
+			v |= 1
+		}
+		r.pos++
+	}
+	return v, true
+}
+
+// alphanumeric is the character set of alphanumeric segments.
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// Segment modes.
+const (
+	modeTerminator   = 0
+	modeNumeric      = 1
+	modeAlphanumeric = 2
+	modeByte         = 4
+	modeECI          = 7
+)
+
+// countBits returns the length of the character count of a segment in
+// `mode`, in a code of `version`.
+func countBits(mode, version int) int {
+	i := 0
+	if version >= 27 {
+		i = 2
+	} else if version >= 10 {
+		i = 1
+	}
+	switch mode {
+	case modeNumeric:
+		return []int{10, 12, 14}[i]
+	case modeAlphanumeric:
+		return []int{9, 11, 13}[i]
+	default:
+		return []int{8, 16, 16}[i]
+	}
+}
+
+// decodeSegments decodes the text in `data`, the data codewords of a code
+// of `version`. Byte segments are taken to hold UTF-8, as they do in
+// practice, whatever their ECI says.
+func decodeSegments(data []byte, version int) (string, error) {
+	r := &bitReader{data: data}
+	var text strings.Builder
+	for r.remaining() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case modeTerminator:
+			return text.String(), nil
+		case modeECI:
+			first, ok := r.read(8)
+			if !ok {
+				return "", ErrUnreadable
+			}
+			switch {
+			case first&0x80 == 0:
+			case first&0xc0 == 0x80:
+				_, ok = r.read(8)
+			default:
+				_, ok = r.read(16)
+			}
+			if !ok {
+				return "", ErrUnreadable
+			}
+			continue
+		case modeNumeric, modeAlphanumeric, modeByte:
+		default:
+			return "", ErrUnreadable
+		}
+
+		count, ok := r.read(countBits(mode, version))
+		if !ok {
+			return "", ErrUnreadable
+		}
+		switch mode {
+		case modeNumeric:
+			for ; count > 0 && ok; count -= 3 {
+				digits := count
+				if digits > 3 {
+					digits = 3
+				}
+				var v int
+				if v, ok = r.read([]int{0, 4, 7, 10}[digits]); ok {
+					s := []byte{'0', '0', '0'}
+					for i := digits - 1; i >= 0; i-- {
+						s[i] = byte('0' + v%10)
+						v /= 10
+					}
+					text.Write(s[:digits])
+				}
+			}
+		case modeAlphanumeric:
+			for ; count > 0 && ok; count -= 2 {
+				var v int
+				if count >= 2 {
+					if v, ok = r.read(11); ok && v < 45*45 {
+						text.WriteByte(alphanumeric[v/45])
+						text.WriteByte(alphanumeric[v%45])
+					} else {
+						ok = false
+					}
+				} else if v, ok = r.read(6); ok && v < 45 {
+					text.WriteByte(alphanumeric[v])
+				} else {
+					ok = false
+				}
+			}
+		case modeByte:
+			for ; count > 0 && ok; count-- {
+				var v int
+				if v, ok = r.read(8); ok {
+					text.WriteByte(byte(v))
+				}
+			}
+		}
+		if !ok {
+			return "", ErrUnreadable
+		}
+	}
+	return text.String(), nil
+}
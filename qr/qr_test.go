@@ -0,0 +1,310 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// helloWorld is the version 1-M code for HELLO WORLD: its data codewords,
+// then its error correction codewords.
+var helloWorld = []byte{
+	32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17,
+	196, 35, 39, 119, 235, 215, 231, 226, 93, 23,
+}
+
+// ecFor returns the `n` error correction codewords for `data`.
+func ecFor(data []byte, n int) []byte {
+	gen := []byte{1}
+	for i := 0; i < n; i++ {
+		next := make([]byte, len(gen)+1)
+		for j := range next {
+			if j < len(gen) {
+				next[j] = gen[j]
+			}
+			if j > 0 {
+				next[j] ^= gfMul(gen[j-1], gfPow(i))
+			}
+		}
+		gen = next
+	}
+	msg := append(append([]byte(nil), data...), make([]byte, n)...)
+	for i := range data {
+		if coef := msg[i]; coef != 0 {
+			for j := 1; j < len(gen); j++ {
+				msg[i+j] ^= gfMul(gen[j], coef)
+			}
+		}
+	}
+	return msg[len(data):]
+}
+
+func TestReedSolomon(t *testing.T) {
+	if ec := ecFor(helloWorld[:16], 10); !bytes.Equal(ec, helloWorld[16:]) {
+		t.Fatal("unexpected error correction codewords", ec)
+	}
+
+	block := append([]byte(nil), helloWorld...)
+	if err := correct(block, 10); err != nil || !bytes.Equal(block, helloWorld) {
+		t.Fatal("correct changed a block without errors:", err)
+	}
+	for _, positions := range [][]int{{0}, {25}, {3, 9}, {0, 7, 16, 20, 25}} {
+		block = append([]byte(nil), helloWorld...)
+		for _, i := range positions {
+			block[i] ^= byte(0x5a + i)
+		}
+		if err := correct(block, 10); err != nil {
+			t.Fatalf("could not correct errors at %v: %v", positions, err)
+		}
+		if !bytes.Equal(block, helloWorld) {
+			t.Fatalf("errors at %v were corrected wrongly", positions)
+		}
+	}
+
+	block = append([]byte(nil), helloWorld...)
+	for i := 0; i < 6; i++ {
+		block[i*4] ^= 0xff
+	}
+	if err := correct(block, 10); err == nil && bytes.Equal(block, helloWorld) {
+		t.Fatal("corrected more errors than is possible")
+	}
+}
+
+func TestDecodeSegments(t *testing.T) {
+	text, err := decodeSegments(helloWorld[:16], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "HELLO WORLD" {
+		t.Fatalf("decoded %q, wanted HELLO WORLD", text)
+	}
+}
+
+// bitWriter appends bits to a slice of bytes, most significant first.
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) write(v, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.data[w.n/8] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+// encode returns the modules of a code of `version` at `level`, using
+// `mask`, holding `text` in a byte segment.
+func encode(t *testing.T, text string, version, level, mask int) [][]bool {
+	lengths := blockLengths(version, level)
+	ecLen := ecCodewords[level][version]
+	capacity := 0
+	for _, n := range lengths {
+		capacity += n - ecLen
+	}
+
+	w := &bitWriter{}
+	w.write(modeByte, 4)
+	w.write(len(text), countBits(modeByte, version))
+	for i := 0; i < len(text); i++ {
+		w.write(int(text[i]), 8)
+	}
+	if len(w.data) > capacity {
+		t.Fatalf("%q does not fit in version %v", text, version)
+	}
+	w.write(0, 4)
+	for i := 0; len(w.data) < capacity; i++ {
+		w.data = append(w.data, []byte{0xec, 0x11}[i%2])
+	}
+	data := w.data[:capacity]
+
+	var blocks [][]byte
+	for _, n := range lengths {
+		d := data[:n-ecLen]
+		data = data[n-ecLen:]
+		blocks = append(blocks, append(append([]byte(nil), d...), ecFor(d, ecLen)...))
+	}
+	var raw []byte
+	for col := 0; col < lengths[len(lengths)-1]-ecLen; col++ {
+		for _, block := range blocks {
+			if col < len(block)-ecLen {
+				raw = append(raw, block[col])
+			}
+		}
+	}
+	for col := 0; col < ecLen; col++ {
+		for _, block := range blocks {
+			raw = append(raw, block[len(block)-ecLen+col])
+		}
+	}
+
+	size := 17 + 4*version
+	mods := make([][]bool, size)
+	for y := range mods {
+		mods[y] = make([]bool, size)
+	}
+	for i := 0; i < size; i++ {
+		mods[6][i] = i%2 == 0
+		mods[i][6] = i%2 == 0
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && y >= 0 && x < size && y < size {
+					d := abs(dx)
+					if abs(dy) > d {
+						d = abs(dy)
+					}
+					mods[y][x] = d != 2 && d != 4
+				}
+			}
+		}
+	}
+	positions := alignmentPositions(version)
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == len(positions)-1) || (i == len(positions)-1 && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					d := abs(dx)
+					if abs(dy) > d {
+						d = abs(dy)
+					}
+					mods[y+dy][x+dx] = d != 1
+				}
+			}
+		}
+	}
+
+	function := functionModules(version)
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if function[y][x] {
+					continue
+				}
+				bit := i < len(raw)*8 && raw[i/8]&(0x80>>uint(i%8)) != 0
+				mods[y][x] = bit != masked(mask, x, y)
+				i++
+			}
+		}
+	}
+
+	format := formatBits(uint([]int{1, 0, 3, 2}[level]<<3 | mask))
+	bit := func(v uint, i int) bool { return v>>uint(i)&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		mods[i][8] = bit(format, i)
+	}
+	mods[7][8] = bit(format, 6)
+	mods[8][8] = bit(format, 7)
+	mods[8][7] = bit(format, 8)
+	for i := 9; i < 15; i++ {
+		mods[8][14-i] = bit(format, i)
+	}
+	for i := 0; i < 8; i++ {
+		mods[8][size-1-i] = bit(format, i)
+	}
+	for i := 8; i < 15; i++ {
+		mods[size-15+i][8] = bit(format, i)
+	}
+	mods[size-8][8] = true
+	if version >= 7 {
+		v := versionBits(version)
+		for i := 0; i < 18; i++ {
+			a, b := size-11+i%3, i/3
+			mods[b][a] = bit(v, i)
+			mods[a][b] = bit(v, i)
+		}
+	}
+	return mods
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// render draws `mods` with a quiet zone of 4 modules, `scale` pixels to a
+// module, turned clockwise a quarter turn `turns` times.
+func render(mods [][]bool, scale, turns int) image.Image {
+	size := len(mods)
+	px := (size + 8) * scale
+	img := image.NewGray(image.Rect(0, 0, px, px))
+	for y := 0; y < px; y++ {
+		for x := 0; x < px; x++ {
+			mx, my := x/scale-4, y/scale-4
+			c := color.Gray{Y: 0xf0}
+			if mx >= 0 && my >= 0 && mx < size && my < size && mods[my][mx] {
+				c = color.Gray{Y: 0x20}
+			}
+			ix, iy := x, y
+			for i := 0; i < turns; i++ {
+				ix, iy = px-1-iy, ix
+			}
+			img.SetGray(ix, iy, c)
+		}
+	}
+	return img
+}
+
+func TestDecode(t *testing.T) {
+	uri := "otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example"
+	tests := []struct {
+		text                  string
+		version, level, mask  int
+		scale, turns, damaged int
+	}{
+		{"hello", 1, levelM, 0, 4, 0, 0},
+		{uri, 6, levelM, 3, 3, 0, 0},
+		{uri, 6, levelL, 5, 5, 1, 0},
+		{uri, 7, levelQ, 2, 4, 2, 0},
+		{uri, 8, levelH, 7, 3, 3, 20},
+		{strings.Repeat(uri, 3), 12, levelM, 4, 3, 0, 10},
+	}
+	for _, test := range tests {
+		mods := encode(t, test.text, test.version, test.level, test.mask)
+		// flip modules in the middle of the code, as a logo over it would
+		size := len(mods)
+		for i := 0; i < test.damaged; i++ {
+			x, y := size/2-3+i%6, size/2-3+i/6
+			mods[y][x] = !mods[y][x]
+		}
+		text, err := Decode(render(mods, test.scale, test.turns))
+		if err != nil {
+			t.Fatalf("version %v, mask %v, turned %v times: %v", test.version, test.mask, test.turns, err)
+		}
+		if text != test.text {
+			t.Fatalf("version %v: decoded %q, wanted %q", test.version, text, test.text)
+		}
+	}
+}
+
+func TestDecodeNotFound(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	if _, err := Decode(img); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+}
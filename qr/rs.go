@@ -0,0 +1,159 @@
+package qr
+
+import "errors"
+
+// errTooManyErrors is returned by correct if a block has more errors than
+// its error correction codewords can correct.
+var errTooManyErrors = errors.New("qr: too many errors to correct")
+
+// gfExp and gfLog are the antilogarithm and logarithm tables of GF(256)
+// using the QR code's polynomial, x^8 + x^4 + x^3 + x^2 + 1, with 2 as the
+// generator. gfExp is doubled in length to save reducing exponents.
+var gfExp, gfLog = func() (exp [512]byte, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+255-gfLog[b]]
+}
+
+// gfPow returns 2 raised to the power `e`, which may be negative.
+func gfPow(e int) byte {
+	e %= 255
+	if e < 0 {
+		e += 255
+	}
+	return gfExp[e]
+}
+
+// evalPoly evaluates the polynomial `p`, whose coefficients are given
+// lowest degree first, at `x`.
+func evalPoly(p []byte, x byte) byte {
+	var y byte
+	for i := len(p) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// correct corrects the errors in `block`, a Reed-Solomon codeword whose
+// last `ecLen` bytes are error correction, in place. Its first byte is the
+// coefficient of the highest power of x, as codewords are laid out in a QR
+// code.
+func correct(block []byte, ecLen int) error {
+	n := len(block)
+	// the codeword's coefficient for x^i is block[n-1-i]
+	coef := func(i int) byte { return block[n-1-i] }
+
+	syndromes := make([]byte, ecLen)
+	clean := true
+	for j := range syndromes {
+		var s byte
+		x := gfPow(j)
+		for i := n - 1; i >= 0; i-- {
+			s = gfMul(s, x) ^ coef(i)
+		}
+		syndromes[j] = s
+		clean = clean && s == 0
+	}
+	if clean {
+		return nil
+	}
+
+	// Berlekamp-Massey finds the error locator, whose roots are the
+	// inverses of the error locations
+	locator, prev := []byte{1}, []byte{1}
+	errs, shift := 0, 1
+	last := byte(1)
+	for k := 0; k < ecLen; k++ {
+		d := syndromes[k]
+		for i := 1; i <= errs && i < len(locator); i++ {
+			d ^= gfMul(locator[i], syndromes[k-i])
+		}
+		if d == 0 {
+			shift++
+			continue
+		}
+		scale := gfDiv(d, last)
+		next := make([]byte, max(len(locator), len(prev)+shift))
+		copy(next, locator)
+		for i, c := range prev {
+			next[i+shift] ^= gfMul(scale, c)
+		}
+		if 2*errs <= k {
+			prev, last = locator, d
+			errs = k + 1 - errs
+			shift = 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+	if 2*errs > ecLen {
+		return errTooManyErrors
+	}
+
+	// Chien search for the locations, then Forney for the magnitudes
+	omega := make([]byte, ecLen)
+	for i, s := range syndromes {
+		for j, l := range locator {
+			if i+j < ecLen {
+				omega[i+j] ^= gfMul(s, l)
+			}
+		}
+	}
+	var derivative []byte
+	for i := 1; i < len(locator); i++ {
+		if i%2 == 1 {
+			derivative = append(derivative, locator[i])
+		} else {
+			derivative = append(derivative, 0)
+		}
+	}
+	found := 0
+	for i := 0; i < n; i++ {
+		xinv := gfPow(-i)
+		if evalPoly(locator, xinv) != 0 {
+			continue
+		}
+		denominator := evalPoly(derivative, xinv)
+		if denominator == 0 {
+			return errTooManyErrors
+		}
+		block[n-1-i] ^= gfMul(gfPow(i), gfDiv(evalPoly(omega, xinv), denominator))
+		found++
+	}
+	if found != errs {
+		return errTooManyErrors
+	}
+	return nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/avahowell/masterkey/repl"
+	"github.com/avahowell/masterkey/vault"
+)
+
+// errRefsNotServed is returned by resolveRefs if no vault is serving
+// references and none was given to open.
+var errRefsNotServed = errors.New("no vault is serving references. Run refs on in a masterkey shell, or pass the vault to open")
+
+type (
+	// refRequest asks a reference server for the value of Ref.
+	refRequest struct {
+		Ref string `json:"ref"`
+	}
+
+	// refResponse carries the value of a reference, or why it could not be
+	// resolved.
+	refResponse struct {
+		Value string `json:"value,omitempty"`
+		Error string `json:"error,omitempty"`
+	}
+)
+
+// refsSocket returns the path of the socket references are served on. Its
+// directory is only accessible to the user.
+func refsSocket() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "masterkey", "refs.sock"), nil
+}
+
+// refServer serves the references of a vault to editors and `masterkey
+// resolve` over a unix socket. The protocol is one JSON object per line: a
+// client sends {"ref": "masterkey://location/field"} and receives {"value":
+// "..."} or {"error": "..."}, as many times as it likes on one connection.
+type refServer struct {
+	v *vault.Vault
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// Start starts serving references on the socket at `path`.
+func (s *refServer) Start(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// a socket left behind by a masterkey that exited uncleanly is removed,
+	// unless another masterkey is still serving on it
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("another masterkey is already serving references on %v", path)
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return err
+	}
+	s.listener = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return nil
+}
+
+// serve answers the requests made on `conn` until it is closed.
+func (s *refServer) serve(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req refRequest
+		var resp refResponse
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = "invalid request: " + err.Error()
+		} else if value, err := s.v.Resolve(req.Ref); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Value = value
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Serving returns the path references are being served on, or "" if they are
+// not.
+func (s *refServer) Serving() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops serving references and removes the socket.
+func (s *refServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.listener = nil
+	return err
+}
+
+// refClient resolves references using a refServer.
+type refClient struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+// dialRefs connects to the refServer on the socket at `path`.
+func dialRefs(path string) (*refClient, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &refClient{conn: conn, scanner: bufio.NewScanner(conn)}, nil
+}
+
+// Resolve returns the value of `ref`.
+func (c *refClient) Resolve(ref string) (string, error) {
+	if err := json.NewEncoder(c.conn).Encode(refRequest{Ref: ref}); err != nil {
+		return "", err
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("the reference server closed the connection")
+	}
+	var resp refResponse
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return "", err
+	}
+	if resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+	return resp.Value, nil
+}
+
+// Close closes the connection to the server.
+func (c *refClient) Close() error {
+	return c.conn.Close()
+}
+
+func refs(s *refServer) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		if len(args) == 0 {
+			if path := s.Serving(); path != "" {
+				return fmt.Sprintf("serving references on %v\n", path), nil
+			}
+			return "not serving references\n", nil
+		}
+		if args[0] == "on" {
+			path, err := refsSocket()
+			if err != nil {
+				return "", err
+			}
+			if err = s.Start(path); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("serving references on %v until the shell exits. Any program you run can read the vault's secrets through it.\n", path), nil
+		}
+		if err := s.Close(); err != nil {
+			return "", err
+		}
+		return "no longer serving references\n", nil
+	}
+}
+
+// resolveRefs expands the references in stdin to stdout. They are resolved
+// by the masterkey serving references, if there is one, or by opening the
+// vault given in args.
+func resolveRefs(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("resolve requires at most one argument, the vault to resolve references from")
+	}
+	path, err := refsSocket()
+	if err != nil {
+		return err
+	}
+	if c, err := dialRefs(path); err == nil {
+		defer c.Close()
+		return vault.ExpandRefs(os.Stdin, os.Stdout, c.Resolve)
+	}
+	if len(args) == 0 {
+		return errRefsNotServed
+	}
+
+	// stdout carries the expanded file, so prompts and messages go to
+	// stderr while the vault is opened
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	v, err := openVault(args[0])
+	os.Stdout = stdout
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	return vault.ExpandRefs(os.Stdin, os.Stdout, v.Resolve)
+}
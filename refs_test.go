@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestRefServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-refs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("example.com", vault.Credential{Username: "alice", Password: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "refs.sock")
+	s := &refServer{v: v}
+	if err = s.Start(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Fatal("socket is accessible to other users:", info.Mode())
+	}
+	if err = (&refServer{v: v}).Start(path); err == nil {
+		t.Fatal("expected a second server on the same socket to fail")
+	}
+
+	c, err := dialRefs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < 2; i++ {
+		value, err := c.Resolve("masterkey://example.com/password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "hunter2" {
+			t.Fatal("unexpected value", value)
+		}
+	}
+	if _, err = c.Resolve("masterkey://example.com/pin"); err == nil || err.Error() != vault.ErrMetaDoesNotExist.Error() {
+		t.Fatal("expected the server's error, got", err)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dialRefs(path); err == nil {
+		t.Fatal("expected the socket to be closed")
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/avahowell/masterkey/repl"
+	"github.com/avahowell/masterkey/syncserver"
+	"github.com/avahowell/masterkey/vault"
+	"golang.org/x/crypto/ed25519"
+)
+
+// maxRemoteAttempts is how many times remote sync retries when the server's
+// copy changes while it is merging.
+const maxRemoteAttempts = 3
+
+// syncTokenEnv names the environment variable holding a sync server's token.
+const syncTokenEnv = "MASTERKEY_SYNC_TOKEN"
+
+// deviceSuffix is appended to a vault's path to name the file holding this
+// device's key for its sync server. The key is kept out of the vault, which
+// is shared with the other devices.
+const deviceSuffix = ".device"
+
+var (
+	// errNoRemote is returned by remote commands if no sync server is set.
+	errNoRemote = errors.New("no sync server set. Set one with remote set")
+
+	// errNotEnrolled is returned by remote commands if this device has not
+	// been enrolled.
+	errNotEnrolled = errors.New("this device is not enrolled with the sync server. Enroll it with remote enroll")
+)
+
+// device is this device's identity on a sync server.
+type device struct {
+	Name string
+	Key  ed25519.PrivateKey
+}
+
+// loadDevice reads this device's identity for the vault at vaultPath.
+func loadDevice(vaultPath string) (*device, error) {
+	bs, err := ioutil.ReadFile(vaultPath + deviceSuffix)
+	if os.IsNotExist(err) {
+		return nil, errNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d device
+	if err = json.Unmarshal(bs, &d); err != nil || len(d.Key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%v is corrupt. Delete it and enroll this device again", vaultPath+deviceSuffix)
+	}
+	return &d, nil
+}
+
+// remoteClient returns a client for the sync server of `v`, as this device.
+func remoteClient(v *vault.Vault, vaultPath string) (*syncserver.Client, error) {
+	remoteURL := v.Settings().RemoteURL
+	if remoteURL == "" {
+		return nil, errNoRemote
+	}
+	if err := checkTLS(remoteURL); err != nil {
+		return nil, err
+	}
+	d, err := loadDevice(vaultPath)
+	if err != nil {
+		return nil, err
+	}
+	return &syncserver.Client{URL: remoteURL, Name: d.Name, Key: d.Key, HTTPClient: timedClient(0)}, nil
+}
+
+func remote(v *vault.Vault, vaultPath string) repl.ActionFunc {
+	return func(args []string) (string, error) {
+		settings := v.Settings()
+		switch {
+		case len(args) == 0:
+			if settings.RemoteURL == "" {
+				return errNoRemote.Error() + "\n", nil
+			}
+			d, err := loadDevice(vaultPath)
+			if err == errNotEnrolled {
+				return fmt.Sprintf("syncing through %v. This device is not enrolled.\n", settings.RemoteURL), nil
+			}
+			if err != nil {
+				return "", err
+			}
+			printstring := fmt.Sprintf("syncing through %v as %v\n", settings.RemoteURL, d.Name)
+			if pendingChanges(vaultPath) {
+				printstring += "changes saved while the server was unreachable have not been uploaded yet\n"
+			}
+			return printstring, nil
+
+		case len(args) == 2 && args[0] == "set":
+			u, err := url.Parse(args[1])
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || !strings.Contains(u.Path, "/vaults/") {
+				return "", fmt.Errorf("%v is not the http or https URL of a vault on a sync server, such as https://example.com/vaults/personal", args[1])
+			}
+			if err = checkTLS(args[1]); err != nil {
+				return "", err
+			}
+			settings.RemoteURL = args[1]
+			if err = v.SetSettings(settings); err != nil {
+				return "", err
+			}
+			printstring := fmt.Sprintf("syncing through %v.\n", args[1])
+			if _, err = loadDevice(vaultPath); err == errNotEnrolled {
+				printstring += "Enroll this device with remote enroll.\n"
+			}
+			return printstring, nil
+
+		case len(args) == 2 && args[0] == "enroll":
+			if settings.RemoteURL == "" {
+				return "", errNoRemote
+			}
+			if err := enrollDevice(settings.RemoteURL, vaultPath, args[1]); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("enrolled as %v. Run remote sync to sync now.\n", args[1]), nil
+
+		case len(args) == 1 && args[0] == "pair":
+			c, err := remoteClient(v, vaultPath)
+			if err != nil {
+				return "", err
+			}
+			code, err := c.Pair()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("pairing code: %v\nRun remote enroll on the new device within %v and enter this code.\n", code, syncserver.PairingCodeLifetime), nil
+
+		case len(args) == 1 && args[0] == "devices":
+			c, err := remoteClient(v, vaultPath)
+			if err != nil {
+				return "", err
+			}
+			devices, err := c.Devices()
+			if err != nil {
+				return "", err
+			}
+			printstring := ""
+			for _, d := range devices {
+				current := ""
+				if d.Name == c.Name {
+					current = " (this device)"
+				}
+				printstring += fmt.Sprintf("%v%v, enrolled %v\n", d.Name, current, d.Enrolled.Local().Format("2006-01-02"))
+			}
+			return printstring, nil
+
+		case len(args) == 2 && args[0] == "revoke":
+			c, err := remoteClient(v, vaultPath)
+			if err != nil {
+				return "", err
+			}
+			if err = c.Revoke(args[1]); err == syncserver.ErrNotFound {
+				return "", fmt.Errorf("no device called %v is enrolled", args[1])
+			} else if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%v revoked. It can no longer read or write the vault on the server, but keeps the copy it already has: consider changing the vault's password.\n", args[1]), nil
+
+		case len(args) == 1 && args[0] == "off":
+			settings.RemoteURL = ""
+			if err := v.SetSettings(settings); err != nil {
+				return "", err
+			}
+			if err := os.Remove(vaultPath + deviceSuffix); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+			return "sync server forgotten\n", nil
+
+		case len(args) == 1 && args[0] == "sync":
+			c, err := remoteClient(v, vaultPath)
+			if err != nil {
+				return "", err
+			}
+			res, err := syncRemote(v, c, "")
+			if err != nil {
+				return "", err
+			}
+			if err = setPending(vaultPath, false); err != nil {
+				return "", err
+			}
+			return describeSync(res), nil
+		}
+		return "", fmt.Errorf("remote requires set, enroll or revoke with 1 argument, pair, devices, sync, off, or no arguments. See help for usage.")
+	}
+}
+
+// enrollDevice creates a key for this device and enrolls it under `name`
+// with the sync server holding the vault at remoteURL. The key is saved
+// beside the vault at vaultPath.
+func enrollDevice(remoteURL string, vaultPath string, name string) error {
+	if err := checkTLS(remoteURL); err != nil {
+		return err
+	}
+	if d, err := loadDevice(vaultPath); err == nil {
+		return fmt.Errorf("this device is already enrolled as %v", d.Name)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	code, err := askPassword("Enter a pairing code from remote pair on an enrolled device, or the server's token if this is the first device: ")
+	if err != nil {
+		return err
+	}
+	c := &syncserver.Client{URL: remoteURL, Name: name, Key: key, HTTPClient: timedClient(0)}
+	if err = c.Enroll(code); err != nil {
+		return err
+	}
+	bs, err := json.Marshal(device{Name: name, Key: key})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(vaultPath+deviceSuffix, bs, 0600)
+}
+
+// syncRemote merges the copy of `v` held by the sync server `c` into `v`,
+// and uploads the result. If the server's copy changes in the meantime, it
+// is merged again. The server's copy is decrypted using `passphrase`, or
+// the user is asked for its passphrase if `passphrase` is empty.
+func syncRemote(v *vault.Vault, c *syncserver.Client, passphrase string) (vault.SyncResult, error) {
+	var res vault.SyncResult
+	for attempt := 1; ; attempt++ {
+		bs, version, err := c.Get()
+		if err != nil && err != syncserver.ErrNotFound {
+			return res, err
+		}
+		if err == nil {
+			if passphrase == "" {
+				if passphrase, err = askPassword("Enter the password for the server's copy of the vault: "); err != nil {
+					return res, err
+				}
+			}
+			vremote, err := vault.Decode(bs, passphrase)
+			if err != nil {
+				return res, fmt.Errorf("could not open the server's copy: %v", err)
+			}
+			res, err = v.Sync(vremote)
+			vremote.Close()
+			if err != nil {
+				return res, err
+			}
+		}
+
+		bs, err = v.Encode()
+		if err != nil {
+			return res, err
+		}
+		_, err = c.Put(bs, version)
+		if err == syncserver.ErrConflict && attempt < maxRemoteAttempts {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		return res, nil
+	}
+}
+
+// describeSync describes the changes a sync brought in.
+func describeSync(res vault.SyncResult) string {
+	changes := len(res.Added) + len(res.Updated) + len(res.Deleted) + len(res.Conflicts)
+	if len(res.Conflicts) > 0 {
+		return fmt.Sprintf("synced, %v changes brought in. Credentials added at a taken location were moved to: %v\n", changes, strings.Join(res.Conflicts, ", "))
+	}
+	return fmt.Sprintf("synced, %v changes brought in.\n", changes)
+}
+
+// runSyncServer runs a sync server storing vaults in the directory given in
+// args. The server's token, which enrolls the first device, is read from the
+// MASTERKEY_SYNC_TOKEN environment variable. The server only serves plain
+// HTTP on a loopback address, for a TLS proxy on the same machine.
+func runSyncServer(args []string) error {
+	fs := flag.NewFlagSet("syncserver", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	addr := fs.String("addr", ":8443", "")
+	certFile := fs.String("tls-cert", "", "")
+	keyFile := fs.String("tls-key", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return fmt.Errorf("syncserver requires one argument, the directory to store vaults in")
+	}
+	token := os.Getenv(syncTokenEnv)
+	if token == "" {
+		return fmt.Errorf("set %v to a token for enrolling the first device", syncTokenEnv)
+	}
+	if err := os.MkdirAll(fs.Arg(0), 0700); err != nil {
+		return err
+	}
+
+	tls := *certFile != "" || *keyFile != ""
+	if !tls && !isLoopback(*addr) {
+		return fmt.Errorf("syncserver requires -tls-cert and -tls-key, unless it listens on a loopback address such as 127.0.0.1:8443 behind a TLS proxy")
+	}
+
+	handler := syncserver.New(fs.Arg(0), token)
+	fmt.Printf("serving vaults in %v on %v\n", fs.Arg(0), *addr)
+	if tls {
+		return http.ListenAndServeTLS(*addr, *certFile, *keyFile, handler)
+	}
+	return http.ListenAndServe(*addr, handler)
+}
+
+// checkTLS returns an error if `remoteURL` is a plain http URL of a server
+// not on a loopback address, which the sync server itself refuses to serve,
+// so that pairing codes, tokens and signed requests never cross the network
+// in cleartext.
+func checkTLS(remoteURL string) error {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "http" && !isLoopback(net.JoinHostPort(u.Hostname(), "0")) {
+		return fmt.Errorf("%v does not use TLS. Use an https URL, or http only for a server on a loopback address such as 127.0.0.1", remoteURL)
+	}
+	return nil
+}
+
+// isLoopback returns true if `addr`, a host and port to listen on, can only
+// be reached from the same machine.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
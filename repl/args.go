@@ -0,0 +1,210 @@
+package repl
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avahowell/masterkey/i18n"
+	"github.com/chzyer/readline"
+)
+
+// ArgType is the kind of value an argument takes.
+type ArgType int
+
+const (
+	// String arguments take any value.
+	String ArgType = iota
+	// Int arguments take a non-negative whole number.
+	Int
+	// Duration arguments take a duration such as 30s or 2m.
+	Duration
+)
+
+// Arg describes an argument of a command.
+type Arg struct {
+	// Name is shown in the command's synopsis as [Name]. If it is empty, the
+	// choices are shown instead, as [a|b].
+	Name string
+
+	// Optional arguments may be left out, along with every argument after
+	// them.
+	Optional bool
+
+	// Variadic may be set on the last argument, to take one or more values,
+	// or any number if it is also Optional.
+	Variadic bool
+
+	// Type is the kind of value the argument takes.
+	Type ArgType
+
+	// Choices, if set, are the only values the argument takes.
+	Choices []string
+
+	// Complete returns the values the argument could take, to complete at
+	// the prompt. Arguments with choices are completed from them.
+	Complete func() []string
+}
+
+// NoArgs is the Args of a command that takes no arguments.
+var NoArgs = []Arg{}
+
+// label returns how `a` is shown in synopses and errors.
+func (a Arg) label() string {
+	name := a.Name
+	if name == "" {
+		name = strings.Join(a.Choices, "|")
+	}
+	if a.Variadic {
+		name += "..."
+	}
+	return "[" + name + "]"
+}
+
+// check returns an error if `value` is not a value `a` takes.
+func (a Arg) check(value string, p *i18n.Printer) error {
+	if len(a.Choices) > 0 {
+		for _, choice := range a.Choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return p.Errorf("%v must be one of %v. See help for usage.", a.label(), strings.Join(a.Choices, ", "))
+	}
+	switch a.Type {
+	case Int:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return p.Errorf("%v must be a whole number. See help for usage.", a.label())
+		}
+	case Duration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return p.Errorf("%v must be a duration such as 30s or 2m. See help for usage.", a.label())
+		}
+	}
+	return nil
+}
+
+// describe returns the values `a` takes, and whether it is optional, for
+// help. It is empty for a required argument that takes any value.
+func (a Arg) describe(p *i18n.Printer) string {
+	var parts []string
+	if a.Optional {
+		parts = append(parts, p.Translate("optional"))
+	}
+	if a.Variadic {
+		parts = append(parts, p.Translate("repeatable"))
+	}
+	switch {
+	case len(a.Choices) > 0:
+		parts = append(parts, p.Sprintf("one of %v", strings.Join(a.Choices, ", ")))
+	case a.Type == Int:
+		parts = append(parts, p.Translate("a whole number"))
+	case a.Type == Duration:
+		parts = append(parts, p.Translate("a duration such as 30s or 2m"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// synopsis returns the command's name followed by its arguments.
+func (c Command) synopsis() string {
+	synopsis := c.Name
+	for _, arg := range c.Args {
+		synopsis += " " + arg.label()
+	}
+	return synopsis
+}
+
+// checkArgs returns an error if `args` are not the arguments c.Args
+// describes. Commands without Args are not checked.
+func (c Command) checkArgs(args []string, p *i18n.Printer) error {
+	if c.Args == nil {
+		return nil
+	}
+	fewest, most := 0, len(c.Args)
+	for _, arg := range c.Args {
+		if !arg.Optional {
+			fewest++
+		}
+	}
+	if most > 0 && c.Args[most-1].Variadic {
+		most = -1
+	}
+	if len(args) < fewest || (most >= 0 && len(args) > most) {
+		switch {
+		case most == 0:
+			return p.Errorf("%v takes no arguments. See help for usage.", c.Name)
+		case most < 0 && fewest == 1:
+			return p.Errorf("%v requires at least 1 argument. See help for usage.", c.Name)
+		case most < 0:
+			return p.Errorf("%v requires at least %v arguments. See help for usage.", c.Name, fewest)
+		case fewest == most && fewest == 1:
+			return p.Errorf("%v requires 1 argument. See help for usage.", c.Name)
+		case fewest == most:
+			return p.Errorf("%v requires %v arguments. See help for usage.", c.Name, fewest)
+		default:
+			return p.Errorf("%v requires %v to %v arguments. See help for usage.", c.Name, fewest, most)
+		}
+	}
+	for i, value := range args {
+		arg := c.Args[len(c.Args)-1]
+		if i < len(c.Args) {
+			arg = c.Args[i]
+		}
+		if err := arg.check(value, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run checks `args` against c.Args, then runs c.Action with them, as the
+// REPL does when the command is entered.
+func (c Command) Run(args []string) (string, error) {
+	return c.RunContext(context.Background(), args)
+}
+
+// RunContext is like Run, but runs c.ContextAction, if the command has one,
+// with `ctx`.
+func (c Command) RunContext(ctx context.Context, args []string) (string, error) {
+	return c.run(ctx, args, nil)
+}
+
+// run is RunContext, translating argument errors using `p`.
+func (c Command) run(ctx context.Context, args []string, p *i18n.Printer) (string, error) {
+	if err := c.checkArgs(args, p); err != nil {
+		return "", err
+	}
+	if c.ContextAction != nil {
+		return c.ContextAction(ctx, args)
+	}
+	return c.Action(args)
+}
+
+// completer returns the completer for the command's name and arguments.
+func (c Command) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem(c.Name, argCompleters(c.Args)...)
+}
+
+// argCompleters returns the completers for the first of `args`, each
+// followed by the completers for the rest. An argument without choices or
+// Complete ends completion.
+func argCompleters(args []Arg) []readline.PrefixCompleterInterface {
+	if len(args) == 0 {
+		return nil
+	}
+	arg, next := args[0], argCompleters(args[1:])
+	if len(arg.Choices) > 0 {
+		var items []readline.PrefixCompleterInterface
+		for _, choice := range arg.Choices {
+			items = append(items, readline.PcItem(choice, next...))
+		}
+		return items
+	}
+	if arg.Complete != nil {
+		return []readline.PrefixCompleterInterface{readline.PcItemDynamic(func(string) []string {
+			return arg.Complete()
+		}, next...)}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckArgs(t *testing.T) {
+	location := Arg{Name: "location"}
+	tests := []struct {
+		args  []Arg
+		given []string
+		err   string
+	}{
+		{nil, []string{"anything", "at", "all"}, ""},
+		{NoArgs, nil, ""},
+		{NoArgs, []string{"a"}, "cmd takes no arguments. See help for usage."},
+		{[]Arg{location}, []string{"a"}, ""},
+		{[]Arg{location}, nil, "cmd requires 1 argument. See help for usage."},
+		{[]Arg{location, {Name: "user"}}, []string{"a"}, "cmd requires 2 arguments. See help for usage."},
+		{[]Arg{location, {Name: "seconds", Optional: true, Type: Int}}, []string{"a", "b", "c"}, "cmd requires 1 to 2 arguments. See help for usage."},
+		{[]Arg{location, {Name: "seconds", Optional: true, Type: Int}}, []string{"a", "10"}, ""},
+		{[]Arg{location, {Name: "seconds", Optional: true, Type: Int}}, []string{"a", "-1"}, "[seconds] must be a whole number. See help for usage."},
+		{[]Arg{{Name: "after", Type: Duration}}, []string{"10m"}, ""},
+		{[]Arg{{Name: "after", Type: Duration}}, []string{"10"}, "[after] must be a duration such as 30s or 2m. See help for usage."},
+		{[]Arg{{Choices: []string{"on", "off"}}}, []string{"of"}, "[on|off] must be one of on, off. See help for usage."},
+		{[]Arg{{Name: "path", Variadic: true}}, nil, "cmd requires at least 1 argument. See help for usage."},
+		{[]Arg{{Name: "path", Variadic: true}}, []string{"a", "b", "c"}, ""},
+		{[]Arg{{Name: "n", Variadic: true, Optional: true, Type: Int}}, nil, ""},
+		{[]Arg{{Name: "n", Variadic: true, Optional: true, Type: Int}}, []string{"1", "2", "x"}, "[n...] must be a whole number. See help for usage."},
+	}
+	for _, test := range tests {
+		err := Command{Name: "cmd", Args: test.args}.checkArgs(test.given, nil)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("checkArgs(%q) with %v returned %v, expected %q", test.given, test.args, err, test.err)
+		}
+	}
+}
+
+func TestREPLArgs(t *testing.T) {
+	r := New("test >", defaultTimeout)
+	var called bool
+	r.AddCommand(Command{
+		Name:  "peek",
+		Usage: "print the password at location",
+		Args: []Arg{
+			{Name: "location", Complete: func() []string { return []string{"github.com", "gitlab.com"} }},
+			{Name: "seconds", Optional: true, Type: Int},
+		},
+		Action: func(args []string) (string, error) {
+			called = true
+			return "", nil
+		},
+	})
+
+	if _, err := r.eval("peek", false); err == nil || called {
+		t.Fatal("peek ran without its required argument")
+	}
+	if _, err := r.eval("peek github.com soon", false); err == nil || called {
+		t.Fatal("peek ran with an invalid argument")
+	}
+	if _, err := r.eval("peek github.com 5", false); err != nil || !called {
+		t.Fatal("peek did not run with valid arguments:", err)
+	}
+
+	if !strings.Contains(r.Usage(), "  peek [location] [seconds]\n") {
+		t.Fatal("synopsis was not generated:", r.Usage())
+	}
+	help, err := r.Help("peek")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Usage:\n  peek [location] [seconds]\n\nprint the password at location\n\nArguments:\n  [location]\n  [seconds]  optional, a whole number\n"
+	if help != expected {
+		t.Fatalf("expected %q, got %q", expected, help)
+	}
+
+	completions, _ := r.prefixCompleter.Do([]rune("peek gith"), len("peek gith"))
+	if len(completions) != 1 || string(completions[0]) != "ub.com " {
+		t.Fatalf("expected peek gith to complete to github.com, got %q", completions)
+	}
+	completions, _ = r.prefixCompleter.Do([]rune("help pe"), len("help pe"))
+	if len(completions) != 1 || string(completions[0]) != "ek " {
+		t.Fatalf("expected help pe to complete to peek, got %q", completions)
+	}
+}
@@ -0,0 +1,121 @@
+package repl
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/avahowell/masterkey/i18n"
+)
+
+const (
+	// ShellCategory is the category of the REPL's own commands, and of
+	// other commands that control the shell rather than the vault.
+	ShellCategory = "Shell"
+
+	// otherCategory lists the commands that have no category.
+	otherCategory = "Other"
+)
+
+// describe returns the synopses and description of `c`, translated by `p`.
+func (c Command) describe(p *i18n.Printer) (synopses []string, description string) {
+	if c.Args != nil {
+		return []string{c.synopsis()}, p.Translate(c.Usage)
+	}
+	return splitUsage(c.Name, p.Translate(c.Usage))
+}
+
+// splitUsage splits the usage of the command `name` into its synopses and
+// its description.
+func splitUsage(name, usage string) (synopses []string, description string) {
+	var lines []string
+	for _, line := range strings.Split(usage, "\n") {
+		colon := strings.Index(line, ": ")
+		if strings.HasPrefix(line, name) && colon >= 0 {
+			synopses = append(synopses, line[:colon])
+			line = line[colon+2:]
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(synopses) == 0 {
+		synopses = []string{name}
+	}
+	return synopses, strings.Join(lines, "\n")
+}
+
+// commandNames returns the names of the REPL's commands, sorted.
+func (r *REPL) commandNames() []string {
+	var names []string
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Usage returns the synopsis of every command in the REPL, grouped by
+// category and translated by its printer.
+func (r *REPL) Usage() string {
+	byCategory := make(map[string][]Command)
+	var categories []string
+	for _, command := range r.commands {
+		category := command.Category
+		if category == "" {
+			category = otherCategory
+		}
+		if _, exists := byCategory[category]; !exists {
+			categories = append(categories, category)
+		}
+		byCategory[category] = append(byCategory[category], command)
+	}
+	sort.Strings(categories)
+
+	printstring := ""
+	for _, category := range categories {
+		commands := byCategory[category]
+		sort.Slice(commands, func(i, j int) bool {
+			return commands[i].Name < commands[j].Name
+		})
+		printstring += r.printer.Translate(category) + ":\n"
+		for _, command := range commands {
+			synopses, _ := command.describe(r.printer)
+			for _, synopsis := range synopses {
+				printstring += "  " + synopsis + "\n"
+			}
+		}
+		printstring += "\n"
+	}
+	printstring += r.printer.Translate("Type `help command` for the description and examples of a command.") + "\n"
+	return printstring
+}
+
+// Help returns the synopses, description and examples of the command
+// `name`, translated by the REPL's printer.
+func (r *REPL) Help(name string) (string, error) {
+	command, exists := r.commands[name]
+	if !exists {
+		return "", r.printer.Errorf("no command named %v. Type `help` for a list of commands.", name)
+	}
+	synopses, description := command.describe(r.printer)
+	printstring := r.printer.Translate("Usage:") + "\n"
+	for _, synopsis := range synopses {
+		printstring += "  " + synopsis + "\n"
+	}
+	if description != "" {
+		printstring += "\n" + description + "\n"
+	}
+	if len(command.Args) > 0 {
+		printstring += "\n" + r.printer.Translate("Arguments:") + "\n"
+		for _, arg := range command.Args {
+			printstring += strings.TrimRight("  "+arg.label()+"  "+arg.describe(r.printer), " ") + "\n"
+		}
+	}
+	if len(command.Examples) > 0 {
+		printstring += "\n" + r.printer.Translate("Examples:") + "\n"
+		for _, example := range command.Examples {
+			printstring += "  " + example + "\n"
+		}
+	}
+	return printstring, nil
+}
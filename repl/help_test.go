@@ -0,0 +1,62 @@
+package repl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitUsage(t *testing.T) {
+	tests := []struct {
+		usage       string
+		synopses    []string
+		description string
+	}{
+		{"get [location]: get the credential at [location]", []string{"get [location]"}, "get the credential at [location]"},
+		{"get [location] [--json]: prints {\"a\": b}", []string{"get [location] [--json]"}, "prints {\"a\": b}"},
+		{"get [location]: get it.\nget --all: get them all.", []string{"get [location]", "get --all"}, "get it.\nget them all."},
+		{"get [path]: read a file.\nThe file is: read.", []string{"get [path]"}, "read a file.\nThe file is: read."},
+		{"", []string{"get"}, ""},
+	}
+	for _, test := range tests {
+		synopses, description := splitUsage("get", test.usage)
+		if !reflect.DeepEqual(synopses, test.synopses) || description != test.description {
+			t.Errorf("splitUsage(%q) = %q, %q, expected %q, %q", test.usage, synopses, description, test.synopses, test.description)
+		}
+	}
+}
+
+func TestREPLHelp(t *testing.T) {
+	r := New("test >", defaultTimeout)
+	r.AddCommand(Command{
+		Name:     "get",
+		Usage:    "get [location]: get the credential at [location]",
+		Category: "Credentials",
+		Examples: []string{"get github.com"},
+	})
+	r.AddCommand(Command{
+		Name:  "frobnicate",
+		Usage: "frobnicate: frobnicate the vault",
+	})
+
+	expected := "Credentials:\n  get [location]\n\nOther:\n  frobnicate\n\nShell:\n  clear\n  exit\n  help [command]\n\n"
+	if usage := r.Usage(); !strings.HasPrefix(usage, expected) {
+		t.Fatalf("expected usage to start with %q, got %q", expected, usage)
+	}
+
+	help, err := r.eval("help get", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "Usage:\n  get [location]\n\nget the credential at [location]\n\nExamples:\n  get github.com\n"
+	if help != expected {
+		t.Fatalf("expected %q, got %q", expected, help)
+	}
+
+	if _, err = r.eval("help nothing", false); err == nil {
+		t.Fatal("expected an error for an unknown command")
+	}
+	if _, err = r.eval("help get clear", false); err == nil {
+		t.Fatal("expected an error for two commands")
+	}
+}
@@ -1,12 +1,17 @@
 package repl
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/i18n"
 	"github.com/chzyer/readline"
 	"github.com/mattn/go-shellwords"
 )
@@ -26,17 +31,52 @@ type (
 		output          io.Writer
 		rl              *readline.Instance
 		stopfunc        func()
+		evalfunc        func(command string, took time.Duration)
+		stopOnce        sync.Once
+		idleOnce        sync.Once
 		lastCommandTime int64
 		timeout         time.Duration
+		printer         *i18n.Printer
+
+		// clockMu guards clock. clockChanged wakes the idle timer when the
+		// clock is replaced.
+		clockMu      sync.Mutex
+		clock        clock.Clock
+		clockChanged chan struct{}
 	}
 
 	// Command is a command that can be registered with the REPL. It consists
 	// of a name, an action that is run when the name is input to the REPL, and
-	// a usage string.
+	// a usage string, along with the category and examples shown by help.
 	Command struct {
 		Name   string
 		Action ActionFunc
-		Usage  string
+
+		// ContextAction, if set, is run instead of Action. Its context is
+		// canceled if Ctrl-C is pressed at the prompt while it runs, so
+		// that a long command can stop early and report what it did,
+		// instead of Ctrl-C ending the program.
+		ContextAction ContextActionFunc
+
+		// Usage describes the command. If Args is nil, it is instead one or
+		// more lines of the form `name [args]: description`: the part of
+		// each line before the colon is a synopsis of the command, and the
+		// rest describes it. Lines that do not start with the name continue
+		// the description.
+		Usage string
+
+		// Args describes the arguments the command takes. If it is set, the
+		// REPL checks the arguments given before running Action, completes
+		// them at the prompt, and generates the command's synopsis. Commands
+		// that parse flags leave it nil and check their own arguments.
+		Args []Arg
+
+		// Category groups the command in the list shown by help. Commands
+		// without one are listed under Other.
+		Category string
+
+		// Examples are command lines shown by `help name`.
+		Examples []string
 	}
 
 	// ActionFunc defines the signature of an action associated with a command.
@@ -44,6 +84,11 @@ type (
 	// passed to the command. Actions should return a string representing the
 	// result of the action, or an error if the action fails.
 	ActionFunc func([]string) (string, error)
+
+	// ContextActionFunc is an ActionFunc that can be canceled through its
+	// context. It should return promptly once the context is done, with
+	// the context's error or an error describing how far it got.
+	ContextActionFunc func(context.Context, []string) (string, error)
 )
 
 // New instantiates a new REPL using the provided `prompt` and `timeout`.
@@ -54,45 +99,112 @@ func New(prompt string, timeout time.Duration) *REPL {
 		input:           os.Stdin,
 		output:          os.Stdout,
 		timeout:         timeout,
-		lastCommandTime: time.Now().Unix(),
+		lastCommandTime: time.Now().UnixNano(),
 		stopChan:        make(chan struct{}),
+		clock:           clock.Real,
+		clockChanged:    make(chan struct{}, 1),
 	}
 
 	// Add default commands clear, exit, and help
 	r.AddCommand(Command{
-		Name:  "help",
-		Usage: "help: displays available commands and their usage",
+		Name:     "help",
+		Usage:    "list the commands by category, or show the usage, description and examples of command",
+		Args:     []Arg{{Name: "command", Optional: true, Complete: r.commandNames}},
+		Category: ShellCategory,
+		Examples: []string{"help", "help clip"},
 		Action: func(args []string) (string, error) {
+			if len(args) == 1 {
+				return r.Help(args[0])
+			}
 			return r.Usage(), nil
 		},
 	})
 
 	r.AddCommand(Command{
-		Name:  "exit",
-		Usage: "exit: exit the interactive prompt",
+		Name:     "exit",
+		Usage:    "exit the interactive prompt",
+		Args:     NoArgs,
+		Category: ShellCategory,
 		Action: func(args []string) (string, error) {
 			return "", r.Stop()
 		},
 	})
 
 	r.AddCommand(Command{
-		Name:  "clear",
-		Usage: "clear: clear the terminal",
+		Name:     "clear",
+		Usage:    "clear the terminal",
+		Args:     NoArgs,
+		Category: ShellCategory,
 		Action: func(args []string) (string, error) {
 			readline.ClearScreen(r.output)
-			return "cleared terminal", nil
+			return r.printer.Translate("cleared terminal"), nil
 		},
 	})
 
 	return r
 }
 
+// StartIdleTimer stops the REPL once no command has been evaluated for the
+// REPL's timeout, counted from now. Loop calls it; callers that drive the
+// REPL through Eval instead must call it themselves. Calling it more than
+// once has no further effect.
+func (r *REPL) StartIdleTimer() {
+	r.idleOnce.Do(func() {
+		atomic.StoreInt64(&r.lastCommandTime, r.getClock().Now().UnixNano())
+		go r.idleTimer()
+	})
+}
+
+// idleTimer stops the REPL once no command has been evaluated for the
+// REPL's timeout.
+func (r *REPL) idleTimer() {
+	for {
+		clk := r.getClock()
+		last := time.Unix(0, atomic.LoadInt64(&r.lastCommandTime))
+		remaining := r.timeout - clk.Now().Sub(last)
+		if remaining <= 0 {
+			r.Stop()
+			return
+		}
+		select {
+		case <-r.stopChan:
+			return
+		case <-r.clockChanged:
+		case <-clk.After(remaining):
+		}
+	}
+}
+
+// getClock returns the clock the REPL measures its timeout against.
+func (r *REPL) getClock() clock.Clock {
+	r.clockMu.Lock()
+	defer r.clockMu.Unlock()
+	return r.clock
+}
+
+// SetClock replaces the clock the REPL measures its timeout against, and
+// restarts the timeout from the clock's current time.
+func (r *REPL) SetClock(c clock.Clock) {
+	r.clockMu.Lock()
+	r.clock = c
+	atomic.StoreInt64(&r.lastCommandTime, c.Now().UnixNano())
+	r.clockMu.Unlock()
+
+	select {
+	case r.clockChanged <- struct{}{}:
+	default:
+	}
+}
+
 // Stop exits the REPL and runs the configured `OnStop` func, if one exists.
+// Calling Stop more than once has no further effect.
 func (r *REPL) Stop() error {
-	close(r.stopChan)
-	if r.stopfunc != nil {
-		r.stopfunc()
-	}
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+		if r.stopfunc != nil {
+			r.stopfunc()
+		}
+	})
 	return nil
 }
 
@@ -101,13 +213,17 @@ func (r *REPL) OnStop(sf func()) {
 	r.stopfunc = sf
 }
 
-// Usage returns the usage for every command in the REPL.
-func (r *REPL) Usage() string {
-	printstring := ""
-	for _, command := range r.commands {
-		printstring += command.Usage + "\n"
-	}
-	return printstring
+// OnEval registers a function to be called after each command is run, with
+// the command's name and how long it took.
+func (r *REPL) OnEval(ef func(command string, took time.Duration)) {
+	r.evalfunc = ef
+}
+
+// SetPrinter sets the printer that translates the REPL's messages, the usage
+// of its commands, and the errors they return. The default leaves them in
+// English.
+func (r *REPL) SetPrinter(p *i18n.Printer) {
+	r.printer = p
 }
 
 // AddCommand registers the command provided in `cmd` with the REPL.
@@ -115,16 +231,41 @@ func (r *REPL) AddCommand(cmd Command) {
 	r.commands[cmd.Name] = cmd
 
 	var completers []readline.PrefixCompleterInterface
-	for name := range r.commands {
-		completers = append(completers, readline.PcItem(name))
+	for _, command := range r.commands {
+		completers = append(completers, command.completer())
 	}
 
 	r.prefixCompleter = readline.NewPrefixCompleter(completers...)
 }
 
-// eval evaluates a line that was input to the REPL.
-func (r *REPL) eval(line string) (string, error) {
-	atomic.StoreInt64(&r.lastCommandTime, time.Now().Unix())
+// SetOutput sets the writer the REPL prints results and errors to. The
+// default is os.Stdout.
+func (r *REPL) SetOutput(w io.Writer) {
+	r.output = w
+}
+
+// Stopped returns true if the REPL has been stopped, either by Stop, the
+// exit command, or its timeout.
+func (r *REPL) Stopped() bool {
+	select {
+	case <-r.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Eval evaluates a single line of input as if it had been entered at the
+// prompt, and returns the result of the command. Unlike at the prompt, Ctrl-C
+// does not cancel the command.
+func (r *REPL) Eval(line string) (string, error) {
+	return r.eval(line, false)
+}
+
+// eval evaluates a line that was input to the REPL. If `interruptible` is
+// set, Ctrl-C cancels commands with a ContextAction while they run.
+func (r *REPL) eval(line string, interruptible bool) (string, error) {
+	atomic.StoreInt64(&r.lastCommandTime, r.getClock().Now().UnixNano())
 	if line == "" {
 		return "", nil
 	}
@@ -136,10 +277,20 @@ func (r *REPL) eval(line string) (string, error) {
 
 	cmd, exists := r.commands[command]
 	if !exists {
-		return "", fmt.Errorf("command not recognized. Type `help` for a list of commands.")
+		return "", r.printer.Errorf("command not recognized. Type `help` for a list of commands.")
 	}
 
-	res, err := cmd.Action(args[1:])
+	ctx := context.Background()
+	if interruptible && cmd.ContextAction != nil {
+		var stop func()
+		ctx, stop = interruptContext()
+		defer stop()
+	}
+	start := time.Now()
+	res, err := cmd.run(ctx, args[1:], r.printer)
+	if r.evalfunc != nil {
+		r.evalfunc(command, time.Since(start))
+	}
 	if err != nil {
 		return "", err
 	}
@@ -158,6 +309,8 @@ func (r *REPL) Loop() error {
 	}
 	r.rl = rl
 
+	r.StartIdleTimer()
+
 	type result struct {
 		line string
 		err  error
@@ -172,8 +325,6 @@ func (r *REPL) Loop() error {
 		select {
 		case <-r.stopChan:
 			return nil
-		case <-time.After(r.timeout):
-			r.Stop()
 		case input := <-lineresult:
 			if input.err != nil {
 				if input.err == readline.ErrInterrupt {
@@ -181,9 +332,9 @@ func (r *REPL) Loop() error {
 				}
 				break
 			}
-			res, err := r.eval(input.line)
+			res, err := r.eval(input.line, true)
 			if err != nil {
-				fmt.Fprintln(r.output, err.Error())
+				fmt.Fprintln(r.output, r.printer.Translate(err.Error()))
 				continue
 			}
 			fmt.Fprint(r.output, res)
@@ -191,3 +342,23 @@ func (r *REPL) Loop() error {
 	}
 	return nil
 }
+
+// interruptContext returns a context that is canceled when the program is
+// interrupted, as by Ctrl-C, instead of the program exiting. Interrupts are
+// handled as usual again once `stop` is called.
+func interruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(interrupts)
+		cancel()
+	}
+}
@@ -1,10 +1,17 @@
 package repl
 
 import (
+	"context"
 	"errors"
+	"os"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/i18n"
 )
 
 func TestREPLArgQuotes(t *testing.T) {
@@ -20,7 +27,7 @@ func TestREPLArgQuotes(t *testing.T) {
 		Usage: "",
 	})
 
-	_, err := r.eval("testcmd \"test arg with quotes and spaces\" testarg2")
+	_, err := r.eval("testcmd \"test arg with quotes and spaces\" testarg2", false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -30,7 +37,7 @@ func TestREPLArgQuotes(t *testing.T) {
 		t.Fatalf("args incorrectly passed to repl command, got %v wanted %v\n", callArgs, expectedArgs)
 	}
 
-	_, err = r.eval("testcmd test1 test2 \"test with spaces\"")
+	_, err = r.eval("testcmd test1 test2 \"test with spaces\"", false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -40,20 +47,32 @@ func TestREPLArgQuotes(t *testing.T) {
 	}
 }
 
+// waitStopped waits a short while for r to stop, returning true if it does.
+func waitStopped(r *REPL) bool {
+	select {
+	case <-r.stopChan:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
 // TestREPLTimeout verifies that the REPL exits after its configured timeout
 // elapses.
 func TestREPLTimeout(t *testing.T) {
-	t.Skip("dependency broke this test")
-
+	c := clock.NewFake(time.Unix(0, 0))
 	r := New("test >", time.Second*5)
-	time.Sleep(time.Second * 6)
-	select {
-	case <-r.stopChan:
-	default:
+	r.SetClock(c)
+	r.StartIdleTimer()
+	c.Advance(time.Second * 6)
+	if !waitStopped(r) {
 		t.Fatal("repl was still running after timeout elapsed")
 	}
 
+	c = clock.NewFake(time.Unix(0, 0))
 	r = New("test >", time.Second*5)
+	r.SetClock(c)
+	r.StartIdleTimer()
 	r.AddCommand(Command{
 		Name: "testcmd",
 		Action: func(args []string) (string, error) {
@@ -62,29 +81,44 @@ func TestREPLTimeout(t *testing.T) {
 		Usage: "",
 	})
 
-	time.Sleep(time.Second * 4)
-	_, err := r.eval("testcmd")
+	c.Advance(time.Second * 4)
+	_, err := r.eval("testcmd", false)
 	if err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(time.Second * 4)
-	select {
-	case <-r.stopChan:
+	c.Advance(time.Second * 4)
+	if r.Stopped() {
 		t.Fatal("repl stopped prematurely")
-	default:
+	}
+	c.Advance(time.Second * 2)
+	if !waitStopped(r) {
+		t.Fatal("repl was still running after timeout elapsed")
 	}
 
+	c = clock.NewFake(time.Unix(0, 0))
 	r = New("test >", time.Second*5)
-	time.Sleep(time.Second * 4)
-	_, err = r.eval("")
+	r.SetClock(c)
+	r.StartIdleTimer()
+	c.Advance(time.Second * 4)
+	_, err = r.eval("", false)
 	if err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(time.Second * 4)
-	select {
-	case <-r.stopChan:
+	c.Advance(time.Second * 4)
+	if r.Stopped() {
 		t.Fatal("repl stopped prematurely")
-	default:
+	}
+}
+
+// TestREPLNoLoop verifies that a REPL that is never looped is not stopped
+// by its timeout.
+func TestREPLNoLoop(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	r := New("test >", time.Second*5)
+	r.SetClock(c)
+	c.Advance(time.Second * 6)
+	if waitStopped(r) {
+		t.Fatal("repl that was never looped stopped after its timeout")
 	}
 }
 
@@ -103,7 +137,7 @@ func TestREPLCmd(t *testing.T) {
 		Usage: "test usage",
 	})
 
-	res, err := r.eval("testcmd arg1 arg2")
+	res, err := r.eval("testcmd arg1 arg2", false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -130,7 +164,7 @@ func TestREPLCmdError(t *testing.T) {
 		Usage: "testusage",
 	})
 
-	res, err := r.eval("testcmd")
+	res, err := r.eval("testcmd", false)
 	if err != testerr {
 		t.Fatal("testcmd did not return testerr")
 	}
@@ -139,3 +173,92 @@ func TestREPLCmdError(t *testing.T) {
 	}
 
 }
+
+func TestREPLOnEval(t *testing.T) {
+	r := New("test >", defaultTimeout)
+	testerr := errors.New("testerr")
+	r.AddCommand(Command{
+		Name: "testcmd",
+		Action: func(args []string) (string, error) {
+			time.Sleep(10 * time.Millisecond)
+			return "", testerr
+		},
+		Usage: "testusage",
+	})
+
+	var evaluated string
+	var took time.Duration
+	r.OnEval(func(command string, d time.Duration) {
+		evaluated, took = command, d
+	})
+	if _, err := r.eval("testcmd arg1", false); err != testerr {
+		t.Fatal("testcmd did not return testerr")
+	}
+	if evaluated != "testcmd" || took < 10*time.Millisecond {
+		t.Fatalf("OnEval was called with %q, %v", evaluated, took)
+	}
+
+	evaluated = ""
+	if _, err := r.eval("notacommand", false); err == nil {
+		t.Fatal("eval accepted an unknown command")
+	}
+	if evaluated != "" {
+		t.Fatal("OnEval was called for an unknown command")
+	}
+}
+
+func TestREPLPrinter(t *testing.T) {
+	r := New("test >", defaultTimeout)
+	r.SetPrinter(i18n.NewPrinter("es_ES.UTF-8"))
+
+	help, err := r.Help("clear")
+	if err != nil || !strings.Contains(help, "limpia la terminal\n") {
+		t.Fatal("usage was not translated:", help, err)
+	}
+	if !strings.HasPrefix(r.Usage(), "Intérprete:\n") {
+		t.Fatal("category was not translated:", r.Usage())
+	}
+	_, err = r.eval("notacommand", false)
+	if err == nil || !strings.HasPrefix(err.Error(), "comando no reconocido.") {
+		t.Fatal("error was not translated:", err)
+	}
+}
+
+func TestContextAction(t *testing.T) {
+	r := New("test >", defaultTimeout)
+	r.AddCommand(Command{
+		Name: "slow",
+		Args: NoArgs,
+		ContextAction: func(ctx context.Context, args []string) (string, error) {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(10 * time.Second):
+				return "finished", nil
+			}
+		},
+	})
+
+	// Eval does not catch interrupts, so only cancel through RunContext
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.commands["slow"].RunContext(ctx, nil); err != context.Canceled {
+		t.Fatal("expected the command to be canceled, got", err)
+	}
+
+	// at the prompt, an interrupt cancels the command instead of exiting
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupts can not be sent to a process on Windows")
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		p.Signal(os.Interrupt)
+	}()
+	if _, err := r.eval("slow", true); err != context.Canceled {
+		t.Fatal("expected an interrupt to cancel the command, got", err)
+	}
+}
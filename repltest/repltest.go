@@ -0,0 +1,88 @@
+// Package repltest drives a masterkey REPL programmatically, without a TTY, a
+// real clipboard, or the wall clock, so that commands can be tested
+// end-to-end.
+package repltest
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/repl"
+	"github.com/avahowell/masterkey/secureclip"
+)
+
+// Driver feeds lines to a REPL and records everything it prints. While a
+// Driver is active, secureclip copies to its Clipboard instead of the system
+// clipboard, and both the REPL and secureclip measure timeouts against its
+// Clock.
+type Driver struct {
+	Clipboard *secureclip.MemoryClipboard
+	Clock     *clock.Fake
+
+	r      *repl.REPL
+	output bytes.Buffer
+}
+
+// New creates a Driver for `r`, installs its fake clipboard and clock, and
+// starts the REPL's idle timer.
+// Close must be called to restore the system clipboard and wall clock.
+func New(r *repl.REPL) *Driver {
+	d := &Driver{
+		Clipboard: new(secureclip.MemoryClipboard),
+		Clock:     clock.NewFake(time.Unix(0, 0)),
+		r:         r,
+	}
+	r.SetOutput(&d.output)
+	r.SetClock(d.Clock)
+	secureclip.SetClipboard(d.Clipboard)
+	secureclip.SetClock(d.Clock)
+	r.StartIdleTimer()
+	return d
+}
+
+// Send evaluates `line` and returns the command's result. The result, or the
+// error, is also appended to the transcript returned by Output, exactly as
+// the REPL would print it.
+func (d *Driver) Send(line string) (string, error) {
+	res, err := d.r.Eval(line)
+	if err != nil {
+		fmt.Fprintln(&d.output, err.Error())
+		return "", err
+	}
+	fmt.Fprint(&d.output, res)
+	return res, nil
+}
+
+// Run sends each of `lines` in turn, stopping early if the REPL stops. It
+// returns the first error returned by a command, but continues to send the
+// remaining lines as an interactive user would.
+func (d *Driver) Run(lines ...string) error {
+	var firstErr error
+	for _, line := range lines {
+		if d.r.Stopped() {
+			break
+		}
+		if _, err := d.Send(line); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Output returns everything the REPL has printed so far.
+func (d *Driver) Output() string {
+	return d.output.String()
+}
+
+// Stopped returns true if the REPL has stopped.
+func (d *Driver) Stopped() bool {
+	return d.r.Stopped()
+}
+
+// Close restores the system clipboard and wall clock.
+func (d *Driver) Close() {
+	secureclip.SetClipboard(nil)
+	secureclip.SetClock(nil)
+}
@@ -0,0 +1,90 @@
+package repltest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/repl"
+	"github.com/avahowell/masterkey/secureclip"
+)
+
+func TestDriver(t *testing.T) {
+	r := repl.New("test >", time.Hour)
+	r.AddCommand(repl.Command{
+		Name: "echo",
+		Action: func(args []string) (string, error) {
+			return args[0] + "\n", nil
+		},
+	})
+	r.AddCommand(repl.Command{
+		Name: "fail",
+		Action: func(args []string) (string, error) {
+			return "", errors.New("failed")
+		},
+	})
+	r.AddCommand(repl.Command{
+		Name: "copy",
+		Action: func(args []string) (string, error) {
+			return "", secureclip.Clip(args[0])
+		},
+	})
+
+	d := New(r)
+	defer d.Close()
+
+	err := d.Run("echo hello", "fail", "copy secret", "exit", "echo unreachable")
+	if err == nil || err.Error() != "failed" {
+		t.Fatal("expected Run to return the first command error, got", err)
+	}
+	if d.Output() != "hello\nfailed\n" {
+		t.Fatalf("unexpected transcript: %q", d.Output())
+	}
+	if d.Clipboard.Contents() != "secret" {
+		t.Fatal("copy did not write to the fake clipboard")
+	}
+	if !d.Stopped() {
+		t.Fatal("exit did not stop the REPL")
+	}
+
+	if err = secureclip.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Clipboard.Contents() != "" {
+		t.Fatal("secureclip.Clear did not clear the fake clipboard")
+	}
+}
+
+func TestDriverClock(t *testing.T) {
+	r := repl.New("test >", time.Minute)
+	r.AddCommand(repl.Command{
+		Name: "copy",
+		Action: func(args []string) (string, error) {
+			return "", secureclip.Clip(args[0])
+		},
+	})
+
+	d := New(r)
+	defer d.Close()
+
+	if _, err := d.Send("copy secret"); err != nil {
+		t.Fatal(err)
+	}
+	d.Clock.Advance(time.Second * 30)
+	deadline := time.Now().Add(time.Second)
+	for d.Clipboard.Contents() != "" {
+		if time.Now().After(deadline) {
+			t.Fatal("clipboard was not cleared after the clip timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	d.Clock.Advance(time.Second * 30)
+	deadline = time.Now().Add(time.Second)
+	for !d.Stopped() {
+		if time.Now().After(deadline) {
+			t.Fatal("repl did not stop after its timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
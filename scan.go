@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/avahowell/masterkey/secretscan"
+	"github.com/avahowell/masterkey/vault"
+)
+
+// minScanLength is the length below which passwords are not searched for,
+// since short ones turn up in ordinary text by chance.
+const minScanLength = 6
+
+// scanSource is a file to search for passwords.
+type scanSource struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+// passwordMatcher returns a matcher for the passwords in `v`, and the
+// locations using each of them.
+func passwordMatcher(v *vault.Vault) (*secretscan.Matcher, [][]string, error) {
+	index := make(map[string]int)
+	var secrets [][]byte
+	var usedAt [][]string
+	err := v.Each(func(location string, cred *vault.Credential) error {
+		if len(cred.Password) < minScanLength {
+			return nil
+		}
+		i, ok := index[cred.Password]
+		if !ok {
+			i = len(secrets)
+			index[cred.Password] = i
+			secrets = append(secrets, []byte(cred.Password))
+			usedAt = append(usedAt, nil)
+		}
+		usedAt[i] = append(usedAt[i], location)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return secretscan.New(secrets), usedAt, nil
+}
+
+// fileSources returns the regular files named by `paths`, and the files in
+// the directories among them, leaving out .git directories.
+func fileSources(paths []string) ([]scanSource, error) {
+	var sources []scanSource
+	for _, path := range paths {
+		err := filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			sources = append(sources, scanSource{name: name, open: func() (io.ReadCloser, error) {
+				return os.Open(name)
+			}})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// stagedSources returns the files added or changed in git's index, read
+// from the index rather than the working tree, since that is what will be
+// committed.
+func stagedSources() ([]scanSource, error) {
+	out, err := exec.Command("git", "diff", "--cached", "--name-only", "-z", "--diff-filter=ACM").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the staged files: %v", err)
+	}
+	var sources []scanSource
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name == "" {
+			continue
+		}
+		name := name
+		sources = append(sources, scanSource{name: name, open: func() (io.ReadCloser, error) {
+			bs, err := exec.Command("git", "show", ":"+name).Output()
+			if err != nil {
+				return nil, fmt.Errorf("could not read the staged %v: %v", name, err)
+			}
+			return ioutil.NopCloser(bytes.NewReader(bs)), nil
+		}})
+	}
+	return sources, nil
+}
+
+// findPasswords searches `sources` using `m` and returns a line describing
+// each password found, as `file:line: password of location`. The passwords
+// themselves are never included.
+func findPasswords(m *secretscan.Matcher, usedAt [][]string, sources []scanSource) ([]string, error) {
+	var found []string
+	for _, source := range sources {
+		r, err := source.open()
+		if err != nil {
+			return nil, err
+		}
+		err = m.Scan(r, func(match secretscan.Match) {
+			found = append(found, fmt.Sprintf("%v:%v: password of %v", source.name, match.Line, strings.Join(usedAt[match.Secret], ", ")))
+		})
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read %v: %v", source.name, err)
+		}
+	}
+	return found, nil
+}
+
+// scanFiles searches the files named in args, or the files staged for
+// commit if -staged is passed, for the passwords stored in the vault, and
+// fails if any are found. With -staged, it can be used as a git pre-commit
+// hook.
+func scanFiles(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	staged := fs.Bool("staged", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 || (*staged && fs.NArg() > 1) {
+		return fmt.Errorf("scan requires the vault, followed by the files or directories to scan, or -staged and the vault")
+	}
+
+	var sources []scanSource
+	var err error
+	if *staged {
+		sources, err = stagedSources()
+	} else if fs.NArg() == 1 {
+		sources, err = fileSources([]string{"."})
+	} else {
+		sources, err = fileSources(fs.Args()[1:])
+	}
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	m, usedAt, err := passwordMatcher(v)
+	if err != nil {
+		return err
+	}
+	found, err := findPasswords(m, usedAt, sources)
+	if err != nil {
+		return err
+	}
+	for _, line := range found {
+		fmt.Println(line)
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("found %v passwords from the vault. Remove them, and change them if they were shared", len(found))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestFindPasswords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	creds := map[string]string{
+		"example.com": "hunter22",
+		"example.org": "hunter22",
+		"mail.com":    "correcthorse",
+		"short.com":   "abc",
+	}
+	for location, password := range creds {
+		if err = v.Add(location, vault.Credential{Username: "alice", Password: password}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"config.yml":        "user: alice\npassword: correcthorse\n",
+		"sub/notes.txt":     "abc\nabc\n\nthe password is hunter22",
+		"clean.txt":         "nothing to see here",
+		".git/objects/blob": "hunter22",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources, err := fileSources([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, usedAt, err := passwordMatcher(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := findPasswords(m, usedAt, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "config.yml") + ":2: password of mail.com",
+		filepath.Join(dir, "sub/notes.txt") + ":4: password of example.com, example.org",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("expected %v, got %v", expected, found)
+	}
+}
@@ -0,0 +1,135 @@
+// Package screenlock reports when the desktop session is locked and when the
+// machine wakes from sleep, so that an open vault can be locked with it. On
+// Linux, logind's session signals are followed using gdbus, and the session
+// is checked with loginctl each time one arrives. Elsewhere, or if gdbus is
+// not available, the session is polled, using loginctl on Linux, ioreg on
+// macOS, and the presence of LogonUI.exe on Windows. Sleep is detected on
+// every platform from the wall clock jumping ahead of the monotonic clock,
+// which stops while the machine sleeps.
+package screenlock
+
+import (
+	"time"
+)
+
+// DefaultInterval is how often a Watcher polls the session, and checks for
+// sleep.
+const DefaultInterval = 2 * time.Second
+
+// Event is something that happened to the desktop session.
+type Event int
+
+const (
+	// Locked is sent when the session is locked.
+	Locked Event = iota
+	// Woke is sent when the machine wakes from sleep.
+	Woke
+)
+
+// String implements fmt.Stringer.
+func (e Event) String() string {
+	if e == Woke {
+		return "the machine woke from sleep"
+	}
+	return "the screen was locked"
+}
+
+// Watcher watches the desktop session and sends an Event on Events each time
+// it is locked or the machine wakes.
+type Watcher struct {
+	// Events receives the events seen, and is closed by Close. Events are
+	// dropped if the previous one has not been received yet.
+	Events chan Event
+
+	interval time.Duration
+	locked   func() bool
+	changes  <-chan struct{}
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+// Watch starts watching the desktop session, checking for sleep every
+// `interval`, until Close is called. The session is polled every `interval`
+// too, unless the platform can signal when it changes.
+func Watch(interval time.Duration) *Watcher {
+	return watch(interval, sessionLocked, sessionChanges)
+}
+
+// watch is Watch, using `locked` to tell whether the session is locked. The
+// channel returned by `subscribe` receives each time the session may have
+// changed, and is closed if it stops doing so; until it is closed, or if it
+// is nil, the session is not polled. `stop` is closed when the Watcher is.
+func watch(interval time.Duration, locked func() bool, subscribe func(stop <-chan struct{}) <-chan struct{}) *Watcher {
+	w := &Watcher{
+		Events:   make(chan Event, 1),
+		interval: interval,
+		locked:   locked,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	w.changes = subscribe(w.closing)
+	go w.run()
+	return w
+}
+
+// run watches the session until the Watcher is closed.
+func (w *Watcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	wasLocked := w.locked()
+	check := func() {
+		isLocked := w.locked()
+		if isLocked && !wasLocked {
+			w.send(Locked)
+		}
+		wasLocked = isLocked
+	}
+	changes := w.changes
+	last := time.Now()
+	for {
+		select {
+		case <-w.closing:
+			return
+		case _, ok := <-changes:
+			if !ok {
+				// the signals stopped, so poll from now on
+				changes = nil
+			}
+			check()
+			continue
+		case <-ticker.C:
+		}
+		now := time.Now()
+		if slept(last, now, w.interval) {
+			w.send(Woke)
+		}
+		last = now
+		if changes == nil {
+			check()
+		}
+	}
+}
+
+// send sends `ev` on Events, unless an earlier event is still waiting.
+func (w *Watcher) send(ev Event) {
+	select {
+	case w.Events <- ev:
+	default:
+	}
+}
+
+// Close stops watching the session and closes Events.
+func (w *Watcher) Close() {
+	close(w.closing)
+	<-w.done
+	close(w.Events)
+}
+
+// slept returns true if the machine slept between `last` and `now`, two
+// readings of time.Now taken about `interval` apart: the wall clock carries
+// on while the machine sleeps, but the monotonic clock does not.
+func slept(last, now time.Time, interval time.Duration) bool {
+	wall := now.Round(0).Sub(last.Round(0))
+	return wall-now.Sub(last) > interval+5*time.Second
+}
@@ -0,0 +1,17 @@
+package screenlock
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// sessionLocked returns true if the console session's screen is locked.
+func sessionLocked() bool {
+	out, err := exec.Command("ioreg", "-n", "Root", "-d1").Output()
+	return err == nil && bytes.Contains(out, []byte(`"CGSSessionScreenIsLocked"=Yes`))
+}
+
+// sessionChanges returns nil, as the session is polled on macOS.
+func sessionChanges(stop <-chan struct{}) <-chan struct{} {
+	return nil
+}
@@ -0,0 +1,59 @@
+package screenlock
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sessionLocked returns true if logind reports the session as locked.
+func sessionLocked() bool {
+	session := os.Getenv("XDG_SESSION_ID")
+	if session == "" {
+		session = "auto"
+	}
+	out, err := exec.Command("loginctl", "show-session", session, "-p", "LockedHint", "--value").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "yes"
+}
+
+// sessionChanges follows the signals logind sends on the system bus, using
+// gdbus monitor, and sends on the returned channel each time one concerns a
+// session, such as Lock or a change to LockedHint. The channel is closed once
+// gdbus exits, which it does if there is no system bus, and gdbus is killed
+// when `stop` is closed. nil is returned if gdbus can not be run.
+func sessionChanges(stop <-chan struct{}) <-chan struct{} {
+	cmd := exec.Command("gdbus", "monitor", "--system", "--dest", "org.freedesktop.login1")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil
+	}
+	if err = cmd.Start(); err != nil {
+		return nil
+	}
+	changes := make(chan struct{}, 1)
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+	go func() {
+		defer close(changes)
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			if !strings.Contains(scanner.Text(), "org.freedesktop.login1.Session") {
+				continue
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+		cmd.Wait()
+		close(exited)
+	}()
+	return changes
+}
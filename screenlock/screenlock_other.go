@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package screenlock
+
+// sessionLocked always returns false: only sleep is detected on this
+// platform.
+func sessionLocked() bool {
+	return false
+}
+
+// sessionChanges returns nil: only sleep is detected on this platform.
+func sessionChanges(stop <-chan struct{}) <-chan struct{} {
+	return nil
+}
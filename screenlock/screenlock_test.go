@@ -0,0 +1,95 @@
+package screenlock
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	var locked int32
+	w := watch(time.Millisecond, func() bool {
+		return atomic.LoadInt32(&locked) == 1
+	}, func(<-chan struct{}) <-chan struct{} { return nil })
+
+	select {
+	case ev := <-w.Events:
+		t.Fatal("unexpected event:", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+	atomic.StoreInt32(&locked, 1)
+	select {
+	case ev := <-w.Events:
+		if ev != Locked {
+			t.Fatal("expected Locked, got", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("locking the session sent no event")
+	}
+	select {
+	case ev := <-w.Events:
+		t.Fatal("a session that stayed locked sent another event:", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.Close()
+	if _, ok := <-w.Events; ok {
+		t.Fatal("Close did not close Events")
+	}
+}
+
+func TestWatcherChanges(t *testing.T) {
+	var locked, checks int32
+	changes := make(chan struct{})
+	w := watch(time.Millisecond, func() bool {
+		atomic.AddInt32(&checks, 1)
+		return atomic.LoadInt32(&locked) == 1
+	}, func(<-chan struct{}) <-chan struct{} { return changes })
+	defer w.Close()
+
+	for atomic.LoadInt32(&checks) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	atomic.StoreInt32(&locked, 1)
+	select {
+	case ev := <-w.Events:
+		t.Fatal("polled the session while following its changes:", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if n := atomic.LoadInt32(&checks); n != 1 {
+		t.Fatalf("checked the session %v times without a change, expected only once at the start", n)
+	}
+	changes <- struct{}{}
+	select {
+	case ev := <-w.Events:
+		if ev != Locked {
+			t.Fatal("expected Locked, got", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a change to a locked session sent no event")
+	}
+
+	// once the changes stop, the session is polled instead
+	atomic.StoreInt32(&locked, 0)
+	close(changes)
+	time.Sleep(20 * time.Millisecond)
+	atomic.StoreInt32(&locked, 1)
+	select {
+	case ev := <-w.Events:
+		if ev != Locked {
+			t.Fatal("expected Locked, got", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("locking the session sent no event after its changes stopped")
+	}
+}
+
+func TestSlept(t *testing.T) {
+	last := time.Now()
+	if slept(last, time.Now(), DefaultInterval) {
+		t.Fatal("reported sleep without any")
+	}
+	// times without a monotonic reading measure the same on both clocks
+	if slept(last.Round(0), last.Round(0).Add(time.Hour), DefaultInterval) {
+		t.Fatal("reported sleep for wall clock time that passed while awake")
+	}
+}
@@ -0,0 +1,17 @@
+package screenlock
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// sessionLocked returns true if the lock screen, LogonUI.exe, is running.
+func sessionLocked() bool {
+	out, err := exec.Command("tasklist", "/FI", "IMAGENAME eq LogonUI.exe", "/NH").Output()
+	return err == nil && bytes.Contains(bytes.ToLower(out), []byte("logonui.exe"))
+}
+
+// sessionChanges returns nil, as the session is polled on Windows.
+func sessionChanges(stop <-chan struct{}) <-chan struct{} {
+	return nil
+}
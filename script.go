@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/avahowell/masterkey/repl"
+)
+
+// scriptError is the error `err` of the command on `line` of the script
+// `name`.
+type scriptError struct {
+	name string
+	line int
+	err  error
+}
+
+func (e scriptError) Error() string {
+	return fmt.Sprintf("%v:%v: %v", e.name, e.line, msg.Translate(e.err.Error()))
+}
+
+// runScript evaluates each line of the script read from `in` using `r`, and
+// writes the results to `out`. Blank lines, and lines starting with #, are
+// skipped. The script stops at the first command that fails, unless
+// `keepGoing` is set, in which case each failure is written to `out`, or to
+// stderr as JSON if -json is set, and the returned error counts them. It also
+// stops once a command, such as exit, stops `r`. Errors are scriptErrors,
+// which keep the exit code of the command's error.
+func runScript(r *repl.REPL, name string, in io.Reader, out io.Writer, keepGoing bool) error {
+	scanner := bufio.NewScanner(in)
+	lineNumber, failed := 0, 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res, err := r.Eval(line)
+		fmt.Fprint(out, res)
+		if err != nil {
+			err = scriptError{name: name, line: lineNumber, err: err}
+			if !keepGoing {
+				return err
+			}
+			// with -json, errors go to stderr, apart from the output
+			errs := out
+			if jsonErrors {
+				errs = os.Stderr
+			}
+			writeError(errs, err)
+			failed++
+		}
+		if r.Stopped() {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if failed == 1 {
+		return fmt.Errorf("1 command in %v failed", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v commands in %v failed", failed, name)
+	}
+	return nil
+}
+
+// runScriptFile runs `masterkey run [-keep-going] vault script`, which opens
+// the vault, runs the shell commands in the script, then clears the
+// clipboard and saves the vault as exiting the shell does.
+func runScriptFile(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	keepGoing := fs.Bool("keep-going", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return fmt.Errorf("run requires two arguments, the vault and the script of shell commands to run")
+	}
+	vaultPath, scriptPath := fs.Arg(0), fs.Arg(1)
+
+	script, err := os.Open(scriptPath)
+	if err != nil {
+		return err
+	}
+	defer script.Close()
+
+	v, err := openVault(vaultPath)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	// the script is not interactive, so it is never timed out
+	r := setupRepl(v, vaultPath, time.Duration(math.MaxInt64))
+	err = runScript(r, scriptPath, script, os.Stdout, *keepGoing)
+	r.Stop()
+	return err
+}
+
+// sourceCmd runs a script of commands in the shell `r`, writing the results
+// to `out`.
+func sourceCmd(r *repl.REPL, out io.Writer) repl.Command {
+	return repl.Command{
+		Name: "source",
+		Action: func(args []string) (string, error) {
+			fs := flag.NewFlagSet("source", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			keepGoing := fs.Bool("keep-going", false, "")
+			if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+				return "", msg.Errorf("%v requires 1 argument. See help for usage.", "source")
+			}
+			script, err := os.Open(fs.Arg(0))
+			if err != nil {
+				return "", err
+			}
+			defer script.Close()
+			return "", runScript(r, fs.Arg(0), script, out, *keepGoing)
+		},
+		Usage:    "source [--keep-going] [file]: run the commands in file, one per line, stopping at the first that fails unless --keep-going is given. Blank lines and lines starting with # are skipped.",
+		Category: repl.ShellCategory,
+		Examples: []string{"source maintenance.mk", "source --keep-going tag-tokens.mk"},
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestRunScript(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	path, cleanup := tempVaultPath(t)
+	defer cleanup()
+	r := setupRepl(v, path, time.Hour)
+
+	script := `# add two credentials
+add github.com user hunter2
+
+add gitlab.com user hunter3
+delete nonexistent.com
+addmeta github.com pin 1234
+`
+	var out bytes.Buffer
+	err = runScript(r, "test.mk", strings.NewReader(script), &out, false)
+	if err == nil || !strings.HasPrefix(err.Error(), "test.mk:5: ") {
+		t.Fatal("expected the script to stop at line 5, got", err)
+	}
+	if exitCode(err) != exitNotFound {
+		t.Fatal("the script's error did not keep the exit code of the failed command:", exitCode(err))
+	}
+	if _, err = v.Get("gitlab.com"); err != nil {
+		t.Fatal("commands before the failure were not run:", err)
+	}
+	if cred, _ := v.Get("github.com"); cred.Meta["pin"] != "" {
+		t.Fatal("commands after the failure were run")
+	}
+
+	out.Reset()
+	script = "delete nonexistent.com\naddmeta github.com pin 1234\nnotacommand\n"
+	err = runScript(r, "test.mk", strings.NewReader(script), &out, true)
+	if err == nil || err.Error() != "2 commands in test.mk failed" {
+		t.Fatal("expected two failures, got", err)
+	}
+	if cred, _ := v.Get("github.com"); cred.Meta["pin"] != "1234" {
+		t.Fatal("-keep-going did not run the commands after the failure")
+	}
+	if !strings.Contains(out.String(), "test.mk:1: ") || !strings.Contains(out.String(), "test.mk:3: ") {
+		t.Fatalf("failures were not reported: %q", out.String())
+	}
+
+	r.OnStop(func() {})
+	if err = runScript(r, "test.mk", strings.NewReader("exit\ndelete github.com\n"), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Get("github.com"); err != nil {
+		t.Fatal("commands after exit were run")
+	}
+}
+
+func TestSourceCommand(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	dir, err := ioutil.TempDir("", "masterkey-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "script.mk")
+	if err = ioutil.WriteFile(path, []byte("add github.com user hunter2\nget github.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	source := sourceCmd(setupRepl(v, filepath.Join(dir, "testvault"), time.Hour), &out).Action
+	if _, err = source([]string{}); err == nil {
+		t.Fatal("source should require a file")
+	}
+	if _, err = source([]string{path}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Password: hunter2") {
+		t.Fatalf("unexpected source output %q", out.String())
+	}
+	if _, err = source([]string{"--keep-going", filepath.Join(dir, "nonexistent.mk")}); err == nil {
+		t.Fatal("source should fail for a nonexistent file")
+	}
+}
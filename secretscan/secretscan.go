@@ -0,0 +1,137 @@
+// Package secretscan finds occurrences of known secrets in text, so that
+// they can be caught before they are committed or shared. Every secret is
+// searched for at once, in a single pass over the text, using the
+// Aho-Corasick algorithm.
+package secretscan
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+type (
+	// Matcher searches text for a set of secrets.
+	Matcher struct {
+		nodes []node
+		// lengths and newlines hold the length of each secret, and the
+		// number of line breaks before its last byte.
+		lengths  []int
+		newlines []int
+	}
+
+	// node is a state of the Aho-Corasick automaton: the longest prefix of
+	// a secret that the text read so far ends with.
+	node struct {
+		next map[byte]int
+		// fail is the state for the longest proper suffix of this state
+		// that is also a prefix of a secret.
+		fail int
+		// matches are the secrets ending at this state, including those
+		// reached by following fail.
+		matches []int
+	}
+
+	// Match is an occurrence of a secret in the text.
+	Match struct {
+		// Secret is the index of the secret found, in the slice passed to
+		// New.
+		Secret int
+		// Offset is the byte offset of the start of the occurrence.
+		Offset int64
+		// Line is the line number of the start of the occurrence,
+		// starting at 1.
+		Line int
+	}
+)
+
+// New returns a Matcher for `secrets`. Empty secrets are never found.
+func New(secrets [][]byte) *Matcher {
+	m := &Matcher{
+		nodes:    []node{{next: make(map[byte]int)}},
+		lengths:  make([]int, len(secrets)),
+		newlines: make([]int, len(secrets)),
+	}
+	for i, secret := range secrets {
+		if len(secret) == 0 {
+			continue
+		}
+		m.lengths[i] = len(secret)
+		m.newlines[i] = bytes.Count(secret[:len(secret)-1], []byte{'\n'})
+		state := 0
+		for _, b := range secret {
+			next, ok := m.nodes[state].next[b]
+			if !ok {
+				next = len(m.nodes)
+				m.nodes = append(m.nodes, node{next: make(map[byte]int)})
+				m.nodes[state].next[b] = next
+			}
+			state = next
+		}
+		m.nodes[state].matches = append(m.nodes[state].matches, i)
+	}
+
+	// link each state to its longest proper suffix, breadth first so that
+	// shallower states are linked before deeper ones
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range m.nodes[state].next {
+			fail := m.nodes[state].fail
+			for {
+				if next, ok := m.nodes[fail].next[b]; ok {
+					m.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = m.nodes[fail].fail
+			}
+			m.nodes[child].matches = append(m.nodes[child].matches, m.nodes[m.nodes[child].fail].matches...)
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// Scan reads `r` to its end, calling `found` with each occurrence of a
+// secret, in the order they end.
+func (m *Matcher) Scan(r io.Reader, found func(Match)) error {
+	br := bufio.NewReader(r)
+	line := 1
+	state := 0
+	for offset := int64(0); ; offset++ {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for {
+			if next, ok := m.nodes[state].next[b]; ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = m.nodes[state].fail
+		}
+		for _, secret := range m.nodes[state].matches {
+			found(Match{
+				Secret: secret,
+				Offset: offset + 1 - int64(m.lengths[secret]),
+				Line:   line - m.newlines[secret],
+			})
+		}
+		if b == '\n' {
+			line++
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package secretscan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	secrets := [][]byte{[]byte("he"), []byte("she"), []byte("his"), []byte("hers"), nil, []byte("a\nb")}
+	m := New(secrets)
+	var matches []Match
+	err := m.Scan(strings.NewReader("ushers\nxa\nb his"), func(match Match) {
+		matches = append(matches, match)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Match{
+		{Secret: 1, Offset: 1, Line: 1},
+		{Secret: 0, Offset: 2, Line: 1},
+		{Secret: 3, Offset: 2, Line: 1},
+		{Secret: 5, Offset: 8, Line: 2},
+		{Secret: 2, Offset: 12, Line: 3},
+	}
+	if !reflect.DeepEqual(matches, expected) {
+		t.Fatalf("expected %v, got %v", expected, matches)
+	}
+}
+
+func TestScanNoSecrets(t *testing.T) {
+	err := New(nil).Scan(strings.NewReader("nothing to find"), func(Match) {
+		t.Fatal("found a match with no secrets")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
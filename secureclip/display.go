@@ -0,0 +1,10 @@
+//go:build windows || darwin
+// +build windows darwin
+
+package secureclip
+
+// hasDisplay returns true if a graphical session, and so a clipboard, is
+// reachable. Windows and macOS always provide a clipboard.
+func hasDisplay() bool {
+	return true
+}
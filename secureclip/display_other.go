@@ -0,0 +1,12 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package secureclip
+
+import "os"
+
+// hasDisplay returns true if a graphical session, and so a clipboard, is
+// reachable. xclip and xsel need an X11 or Wayland display to talk to.
+func hasDisplay() bool {
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
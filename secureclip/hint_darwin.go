@@ -0,0 +1,31 @@
+//go:build darwin
+// +build darwin
+
+package secureclip
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// concealScript is a JavaScript for Automation script which reads a secret
+// from stdin and places it on the general pasteboard alongside the
+// org.nspasteboard.ConcealedType marker, which clipboard managers honor by
+// not recording the item in their history. The secret is passed on stdin
+// so it never appears in the process list.
+const concealScript = `
+ObjC.import('AppKit');
+var data = $.NSFileHandle.fileHandleWithStandardInput.readDataToEndOfFile;
+var secret = $.NSString.alloc.initWithDataEncoding(data, $.NSUTF8StringEncoding);
+var pb = $.NSPasteboard.generalPasteboard;
+pb.clearContents;
+pb.setStringForType(secret, $.NSPasteboardTypeString);
+pb.setStringForType($(''), $('org.nspasteboard.ConcealedType'));
+`
+
+// writeSecret copies text to the clipboard, marked as concealed.
+func writeSecret(text string) error {
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-e", concealScript)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
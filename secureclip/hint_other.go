@@ -0,0 +1,16 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package secureclip
+
+import (
+	"github.com/atotto/clipboard"
+)
+
+// writeSecret copies text to the clipboard. xclip and xsel, which the
+// clipboard package drives on these platforms, can only offer a single
+// target, so the x-kde-passwordManagerHint target can not be set alongside
+// the text and clipboard managers may record it.
+func writeSecret(text string) error {
+	return clipboard.WriteAll(text)
+}
@@ -0,0 +1,120 @@
+//go:build windows
+// +build windows
+
+package secureclip
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	cfUnicodetext = 13
+	gmemMoveable  = 0x0002
+)
+
+var (
+	user32                  = syscall.NewLazyDLL("user32")
+	openClipboard           = user32.NewProc("OpenClipboard")
+	closeClipboard          = user32.NewProc("CloseClipboard")
+	emptyClipboard          = user32.NewProc("EmptyClipboard")
+	setClipboardData        = user32.NewProc("SetClipboardData")
+	registerClipboardFormat = user32.NewProc("RegisterClipboardFormatW")
+
+	kernel32     = syscall.NewLazyDLL("kernel32")
+	globalAlloc  = kernel32.NewProc("GlobalAlloc")
+	globalFree   = kernel32.NewProc("GlobalFree")
+	globalLock   = kernel32.NewProc("GlobalLock")
+	globalUnlock = kernel32.NewProc("GlobalUnlock")
+	moveMemory   = kernel32.NewProc("RtlMoveMemory")
+
+	// historyFormats are the clipboard formats that, when present, stop
+	// clipboard history, Cloud Clipboard, and well-behaved clipboard
+	// monitors from retaining the clipboard's contents. Each is set to a
+	// DWORD zero.
+	historyFormats = []string{
+		"ExcludeClipboardContentFromMonitorProcessing",
+		"CanIncludeInClipboardHistory",
+		"CanUploadToCloudClipboard",
+	}
+)
+
+// waitOpenClipboard opens the clipboard, waiting for up to a second to do so.
+func waitOpenClipboard() error {
+	limit := time.Now().Add(time.Second)
+	var err error
+	for time.Now().Before(limit) {
+		var r uintptr
+		r, _, err = openClipboard.Call(0)
+		if r != 0 {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return err
+}
+
+// globalCopy copies size bytes starting at src into a new moveable global
+// memory object suitable for SetClipboardData.
+func globalCopy(src unsafe.Pointer, size int) (uintptr, error) {
+	h, _, err := globalAlloc.Call(gmemMoveable, uintptr(size))
+	if h == 0 {
+		return 0, err
+	}
+	l, _, err := globalLock.Call(h)
+	if l == 0 {
+		globalFree.Call(h)
+		return 0, err
+	}
+	moveMemory.Call(l, uintptr(src), uintptr(size))
+	globalUnlock.Call(h)
+	return h, nil
+}
+
+// writeSecret copies text to the clipboard as CF_UNICODETEXT alongside the
+// formats that exclude it from clipboard history and Cloud Clipboard.
+func writeSecret(text string) error {
+	if err := waitOpenClipboard(); err != nil {
+		return err
+	}
+	defer closeClipboard.Call()
+
+	if r, _, err := emptyClipboard.Call(); r == 0 {
+		return err
+	}
+
+	data, err := syscall.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+	h, err := globalCopy(unsafe.Pointer(&data[0]), len(data)*2)
+	if err != nil {
+		return err
+	}
+	if r, _, err := setClipboardData.Call(cfUnicodetext, h); r == 0 {
+		globalFree.Call(h)
+		return err
+	}
+
+	var zero uint32
+	for _, name := range historyFormats {
+		namep, err := syscall.UTF16PtrFromString(name)
+		if err != nil {
+			return err
+		}
+		format, _, err := registerClipboardFormat.Call(uintptr(unsafe.Pointer(namep)))
+		if format == 0 {
+			return err
+		}
+		h, err := globalCopy(unsafe.Pointer(&zero), 4)
+		if err != nil {
+			return err
+		}
+		if r, _, err := setClipboardData.Call(format, h); r == 0 {
+			globalFree.Call(h)
+			return err
+		}
+	}
+	return nil
+}
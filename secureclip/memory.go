@@ -0,0 +1,32 @@
+package secureclip
+
+import "sync"
+
+// MemoryClipboard is a Clipboard that lives in memory. It is useful for tests
+// and on machines with no display, where the system clipboard is not
+// available.
+type MemoryClipboard struct {
+	mu       sync.Mutex
+	contents string
+}
+
+// ReadAll implements Clipboard.
+func (m *MemoryClipboard) ReadAll() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.contents, nil
+}
+
+// WriteAll implements Clipboard.
+func (m *MemoryClipboard) WriteAll(text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.contents = text
+	return nil
+}
+
+// Contents returns the current contents of the clipboard.
+func (m *MemoryClipboard) Contents() string {
+	contents, _ := m.ReadAll()
+	return contents
+}
@@ -0,0 +1,111 @@
+package secureclip
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxOSC52 is the longest OSC 52 sequence, in bytes, that OSC52 writes.
+// Terminals and multiplexers drop longer ones, xterm and hterm from around
+// 100 KB, so secrets encoding to more than this are refused instead.
+const maxOSC52 = 74994
+
+// ErrTooLarge is returned by an OSC52 clipboard if the text is too long to
+// copy through the terminal.
+var ErrTooLarge = errors.New("too long to copy through the terminal")
+
+// OSC52 is a Clipboard that copies to the clipboard of the terminal
+// masterkey is displayed in, using the OSC 52 escape sequence, so that
+// secrets can be copied from a remote host over SSH. Inside tmux or GNU
+// screen the sequence is passed through to the outer terminal.
+//
+// Terminals do not let the clipboard be read back, so ReadAll returns the
+// text last written, and Clear always clears the clipboard, even if
+// something else has been copied since.
+type OSC52 struct {
+	w io.Writer
+
+	// tmux and screen are set if the sequence has to be passed through
+	// that multiplexer.
+	tmux, screen bool
+
+	mu   sync.Mutex
+	last string
+}
+
+// NewOSC52 returns an OSC52 clipboard writing its escape sequences to `w`,
+// normally the terminal, passing them through tmux or screen if the
+// environment shows masterkey is running inside one.
+func NewOSC52(w io.Writer) *OSC52 {
+	return &OSC52{
+		w:      w,
+		tmux:   os.Getenv("TMUX") != "",
+		screen: os.Getenv("STY") != "",
+	}
+}
+
+// ReadAll implements Clipboard, returning the text last written.
+func (o *OSC52) ReadAll() (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.last, nil
+}
+
+// WriteAll implements Clipboard. ErrTooLarge is returned if `text` is too
+// long to copy.
+func (o *OSC52) WriteAll(text string) error {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if len(seq) > maxOSC52 {
+		return ErrTooLarge
+	}
+	switch {
+	case o.tmux:
+		// tmux passes on a DCS sequence prefixed with tmux; whose escapes
+		// are doubled
+		seq = "\x1bPtmux;" + strings.Replace(seq, "\x1b", "\x1b\x1b", -1) + "\x1b\\"
+	case o.screen:
+		// screen limits the length of a DCS sequence, so the sequence is
+		// passed through in chunks
+		var chunks []string
+		for len(seq) > 0 {
+			n := 76
+			if n > len(seq) {
+				n = len(seq)
+			}
+			chunks = append(chunks, "\x1bP"+seq[:n]+"\x1b\\")
+			seq = seq[n:]
+		}
+		seq = strings.Join(chunks, "")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := io.WriteString(o.w, seq); err != nil {
+		return err
+	}
+	o.last = text
+	return nil
+}
+
+// OverSSH returns true if masterkey is running in an SSH session, where the
+// system clipboard, if any, is that of the remote host rather than the one
+// the user is sitting at.
+func OverSSH() bool {
+	return os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != ""
+}
+
+// TerminalSupportsOSC52 returns false if the terminal named by $TERM is
+// known not to support OSC 52, such as the Linux console. Most terminal
+// emulators support it, though some only once it is enabled in their
+// settings.
+func TerminalSupportsOSC52() bool {
+	switch term := os.Getenv("TERM"); {
+	case term == "", term == "dumb", term == "linux", term == "cons25", strings.HasPrefix(term, "vt"):
+		return false
+	}
+	return true
+}
@@ -1,36 +1,183 @@
 package secureclip
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/atotto/clipboard"
+	"github.com/avahowell/masterkey/clock"
 )
 
+// ErrUnavailable is returned by Clip if the system clipboard is in use but
+// there is no display or clipboard utility to reach it through.
+var ErrUnavailable = errors.New("no clipboard is available: no display was found, or xsel/xclip is not installed")
+
+// Clipboard is a clipboard that secrets can be copied to. The system
+// clipboard is used unless another is installed using SetClipboard.
+type Clipboard interface {
+	ReadAll() (string, error)
+	WriteAll(text string) error
+}
+
+// systemClipboard is the operating system's clipboard.
+type systemClipboard struct{}
+
+// ReadAll implements Clipboard.
+func (systemClipboard) ReadAll() (string, error) { return clipboard.ReadAll() }
+
+// WriteAll implements Clipboard. Where the platform supports it, text is
+// marked so that clipboard history and cloud clipboard features do not
+// retain it.
+func (systemClipboard) WriteAll(text string) error { return writeSecret(text) }
+
+// DefaultTimeout is how long a secret copied by Clip stays on the clipboard,
+// unless changed using SetTimeout.
+const DefaultTimeout = 30 * time.Second
+
 var (
-	lastClip    = time.Now().Unix()
-	clipTimeout = time.Second * 30
+	// board is the clipboard that Clip and Clear operate on.
+	board Clipboard = systemClipboard{}
+	// clk is the clock the clipboard timeout is measured against.
+	clk = clock.Real
+
+	// clearAt is when the secret most recently copied by Clip is due to be
+	// cleared, in nanoseconds since the epoch.
+	clearAt     = time.Now().UnixNano()
+	clipTimeout = DefaultTimeout
+
+	// mu guards the clipboard against interleaved Clip and Clear calls, and
+	// protects board, clk, clipTimeout, clipHash, and clipped.
+	mu sync.Mutex
+	// clipHash is the SHA-256 hash of the secret most recently copied by
+	// Clip. Only the hash is retained so the secret does not linger in
+	// memory.
+	clipHash [sha256.Size]byte
+	// clipped is true if the clipboard may still contain a secret copied
+	// by Clip.
+	clipped bool
 )
 
 // Clip copies the passphrase given by `passphrase` to the clipboard. The
-// clipboard will be cleared 30 seconds after the last `Clip` call.
+// clipboard will be cleared once the timeout set by SetTimeout, 30 seconds by
+// default, has passed since the last `Clip` call, unless something else has
+// been copied to it in the meantime.
 func Clip(passphrase string) error {
-	err := clipboard.WriteAll(passphrase)
+	return ClipFor(passphrase, 0)
+}
+
+// ClipFor is like Clip, but clears the clipboard after `d`, rather than the
+// timeout set by SetTimeout, if `d` is positive.
+func ClipFor(passphrase string, d time.Duration) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := board.(systemClipboard); ok && !systemAvailable() {
+		return ErrUnavailable
+	}
+	err := board.WriteAll(passphrase)
 	if err != nil {
 		return err
 	}
-	atomic.StoreInt64(&lastClip, time.Now().Unix())
+	clipHash = sha256.Sum256([]byte(passphrase))
+	clipped = true
+	if d <= 0 {
+		d = clipTimeout
+	}
+	c := clk
+	atomic.StoreInt64(&clearAt, c.Now().Add(d).UnixNano())
+	expired := c.After(d)
 	go func() {
-		time.Sleep(clipTimeout)
-		lc := atomic.LoadInt64(&lastClip)
-		if time.Since(time.Unix(lc, 0)) > clipTimeout {
-			clipboard.WriteAll("")
+		<-expired
+		if !c.Now().Before(time.Unix(0, atomic.LoadInt64(&clearAt))) {
+			Clear()
 		}
 	}()
 	return nil
 }
 
-// Clear clears the clipboard.
+// Clear clears the clipboard if it still contains the secret most recently
+// copied by Clip. If the user has since copied something else, from
+// masterkey or from another application, the clipboard is left untouched.
 func Clear() error {
-	return clipboard.WriteAll("")
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !clipped {
+		return nil
+	}
+	contents, err := board.ReadAll()
+	if err != nil {
+		return err
+	}
+	clipped = false
+	contentsHash := sha256.Sum256([]byte(contents))
+	if subtle.ConstantTimeCompare(contentsHash[:], clipHash[:]) != 1 {
+		return nil
+	}
+	return board.WriteAll("")
+}
+
+// Available returns true if Clip can copy to the current clipboard. It is
+// false when the system clipboard is in use on a headless machine.
+func Available() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := board.(systemClipboard); ok {
+		return systemAvailable()
+	}
+	return true
+}
+
+// systemAvailable returns true if the system clipboard can be reached.
+func systemAvailable() bool {
+	return hasDisplay() && !clipboard.Unsupported
+}
+
+// SetClipboard replaces the clipboard used by Clip and Clear with c. If c is
+// nil, the system clipboard is restored.
+func SetClipboard(c Clipboard) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if c == nil {
+		c = systemClipboard{}
+	}
+	board = c
+	clipped = false
+}
+
+// SetClock replaces the clock that Clip measures its timeout against with c.
+// If c is nil, the wall clock is restored.
+func SetClock(c clock.Clock) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if c == nil {
+		c = clock.Real
+	}
+	clk = c
+}
+
+// SetTimeout changes how long secrets copied by Clip stay on the clipboard to
+// `d`. If `d` is not positive, DefaultTimeout is restored.
+func SetTimeout(d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if d <= 0 {
+		d = DefaultTimeout
+	}
+	clipTimeout = d
+}
+
+// Timeout returns how long secrets copied by Clip stay on the clipboard.
+func Timeout() time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+	return clipTimeout
 }
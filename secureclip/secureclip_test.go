@@ -1,52 +1,227 @@
 package secureclip
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/atotto/clipboard"
+	"github.com/avahowell/masterkey/clock"
 )
 
+// setup installs an in-memory clipboard and a fake clock, so the tests run
+// instantly and without a display. The returned func restores the defaults.
+func setup() (*MemoryClipboard, *clock.Fake, func()) {
+	m := new(MemoryClipboard)
+	c := clock.NewFake(time.Unix(0, 0))
+	SetClipboard(m)
+	SetClock(c)
+	return m, c, func() {
+		SetClipboard(nil)
+		SetClock(nil)
+	}
+}
+
+// waitContents waits a short while for the clipboard to hold `expected`.
+func waitContents(m *MemoryClipboard, expected string) bool {
+	deadline := time.Now().Add(time.Second)
+	for m.Contents() != expected {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
 func TestSecureClip(t *testing.T) {
-	clipTimeout = time.Second * 3
+	m, c, restore := setup()
+	defer restore()
+
 	err := Clip("test")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	time.Sleep(clipTimeout + time.Second)
-	contents, err := clipboard.ReadAll()
-	if err != nil {
-		t.Fatal(err)
+	if m.Contents() != "test" {
+		t.Fatal("Clip did not copy to the clipboard")
 	}
-	if contents != "" {
+
+	c.Advance(clipTimeout)
+	if !waitContents(m, "") {
 		t.Fatal("did not clear clipboard contents after timeout")
 	}
 }
 
 func TestSecureClipStaggeredCalls(t *testing.T) {
-	clipTimeout = time.Second * 2
+	m, c, restore := setup()
+	defer restore()
+
 	if err := Clip("test1"); err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(time.Second)
+	c.Advance(clipTimeout / 2)
 	if err := Clip("test2"); err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(time.Second)
-	contents, err := clipboard.ReadAll()
-	if err != nil {
+	c.Advance(clipTimeout / 2)
+	time.Sleep(time.Millisecond * 10)
+	if m.Contents() != "test2" {
+		t.Fatal("clipboard prematurely cleared")
+	}
+	c.Advance(clipTimeout / 2)
+	if !waitContents(m, "") {
+		t.Fatal("clipboard was not cleared")
+	}
+}
+
+// TestSecureClipExternalWrite verifies that Clear leaves the clipboard alone
+// if another application has copied to it since the last Clip.
+func TestSecureClipExternalWrite(t *testing.T) {
+	m, c, restore := setup()
+	defer restore()
+
+	if err := Clip("secret"); err != nil {
 		t.Fatal(err)
 	}
-	if contents != "test2" {
-		t.Fatal("clipboard prematurely cleared")
+	if err := m.WriteAll("external"); err != nil {
+		t.Fatal(err)
 	}
-	time.Sleep(time.Second * 2)
-	contents, err = clipboard.ReadAll()
-	if err != nil {
+
+	if err := Clear(); err != nil {
 		t.Fatal(err)
 	}
-	if contents != "" {
+	if m.Contents() != "external" {
+		t.Fatal("Clear wiped content copied by another application")
+	}
+
+	c.Advance(clipTimeout)
+	time.Sleep(time.Millisecond * 10)
+	if m.Contents() != "external" {
+		t.Fatal("clip timeout wiped content copied by another application")
+	}
+}
+
+// TestSecureClipExternalWriteThenClip verifies that a Clip following an
+// external write is still cleared.
+func TestSecureClipExternalWriteThenClip(t *testing.T) {
+	m, c, restore := setup()
+	defer restore()
+
+	if err := Clip("secret1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteAll("external"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Clip("secret2"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Advance(clipTimeout)
+	if !waitContents(m, "") {
 		t.Fatal("clipboard was not cleared")
 	}
 }
+
+// TestSecureClipUnavailable verifies that Clip refuses to copy on a machine
+// with no system clipboard.
+func TestSecureClipUnavailable(t *testing.T) {
+	if Available() {
+		t.Skip("a system clipboard is available")
+	}
+	if err := Clip("secret"); err != ErrUnavailable {
+		t.Fatal("expected ErrUnavailable, got", err)
+	}
+
+	m, _, restore := setup()
+	defer restore()
+	if !Available() {
+		t.Fatal("an in-memory clipboard should always be available")
+	}
+	if err := Clip("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Contents() != "secret" {
+		t.Fatal("Clip did not copy to the in-memory clipboard")
+	}
+}
+
+// TestSecureClipFor verifies that ClipFor and SetTimeout change how long a
+// secret stays on the clipboard.
+func TestSecureClipFor(t *testing.T) {
+	m, c, restore := setup()
+	defer restore()
+	defer SetTimeout(0)
+
+	SetTimeout(time.Second * 10)
+	if Timeout() != time.Second*10 {
+		t.Fatal("SetTimeout did not change the timeout")
+	}
+	if err := ClipFor("secret", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	c.Advance(time.Second * 10)
+	time.Sleep(time.Millisecond * 10)
+	if m.Contents() != "secret" {
+		t.Fatal("ClipFor cleared the clipboard early")
+	}
+	c.Advance(time.Minute)
+	if !waitContents(m, "") {
+		t.Fatal("ClipFor did not clear the clipboard")
+	}
+
+	if err := Clip("secret"); err != nil {
+		t.Fatal(err)
+	}
+	c.Advance(time.Second * 10)
+	if !waitContents(m, "") {
+		t.Fatal("Clip did not use the timeout set by SetTimeout")
+	}
+	SetTimeout(0)
+	if Timeout() != DefaultTimeout {
+		t.Fatal("SetTimeout(0) did not restore the default")
+	}
+}
+
+func TestOSC52(t *testing.T) {
+	var buf bytes.Buffer
+	o := &OSC52{w: &buf}
+	if err := o.WriteAll("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "\x1b]52;c;c2VjcmV0\a" {
+		t.Fatalf("unexpected sequence %q", buf.String())
+	}
+	if contents, _ := o.ReadAll(); contents != "secret" {
+		t.Fatal("ReadAll did not return the text last written")
+	}
+
+	buf.Reset()
+	o.tmux = true
+	if err := o.WriteAll("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "\x1bPtmux;\x1b\x1b]52;c;c2VjcmV0\a\x1b\\" {
+		t.Fatalf("unexpected tmux sequence %q", buf.String())
+	}
+
+	buf.Reset()
+	o.tmux, o.screen = false, true
+	if err := o.WriteAll(strings.Repeat("s", 100)); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\x1bP"); n != 2 {
+		t.Fatalf("expected the screen sequence in 2 chunks, got %v: %q", n, buf.String())
+	}
+
+	buf.Reset()
+	if err := o.WriteAll(strings.Repeat("s", maxOSC52)); err != ErrTooLarge {
+		t.Fatal("expected ErrTooLarge, got", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("a secret too large to copy was written")
+	}
+	if contents, _ := o.ReadAll(); contents != strings.Repeat("s", 100) {
+		t.Fatal("a failed write changed the text last written")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/avahowell/masterkey/importer"
+	"github.com/avahowell/masterkey/transfer"
+	"github.com/avahowell/masterkey/vault"
+)
+
+// transferTimeout bounds how long receive waits for the sender, and how long
+// the transfer itself may take.
+const transferTimeout = 10 * time.Minute
+
+// sendCredentials runs `masterkey send -to address vault location...|--all`,
+// which sends credentials directly to a machine running masterkey receive.
+func sendCredentials(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	to := fs.String("to", "", "")
+	if err := fs.Parse(args); err != nil || *to == "" || fs.NArg() < 2 {
+		return fmt.Errorf("send requires -to, the address shown by masterkey receive, the vault, and the locations to send or --all")
+	}
+	vaultPath, locations := fs.Arg(0), fs.Args()[1:]
+
+	v, err := openVault(vaultPath)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	if len(locations) == 1 && locations[0] == "--all" {
+		if locations, err = v.Locations(); err != nil {
+			return err
+		}
+	}
+	code, err := askPassword("Code shown by masterkey receive: ")
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", *to, transferTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(transferTimeout))
+	if err = sendEntries(conn, code, v, locations); err != nil {
+		return err
+	}
+	fmt.Printf("sent %v credentials to %v\n", len(locations), *to)
+	return nil
+}
+
+// sendEntries sends the credentials at `locations` in `v` over `conn`.
+func sendEntries(conn io.ReadWriter, code string, v *vault.Vault, locations []string) error {
+	var entries []importer.Entry
+	for _, location := range locations {
+		cred, err := v.Get(location)
+		if err != nil {
+			return fmt.Errorf("%v: %v", location, err)
+		}
+		entries = append(entries, importer.Entry{Location: location, Credential: *cred})
+	}
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return transfer.Send(conn, code, payload)
+}
+
+// receiveCredentials runs `masterkey receive [-listen address] vault`, which
+// waits for a single masterkey send and adds the credentials it sends to the
+// vault.
+func receiveCredentials(args []string) error {
+	fs := flag.NewFlagSet("receive", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	listen := fs.String("listen", ":0", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return fmt.Errorf("receive requires one argument, the vault to add the received credentials to")
+	}
+	vaultPath := fs.Arg(0)
+
+	v, err := openVault(vaultPath)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	code, err := transfer.NewCode()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	fmt.Println("Waiting for credentials. On the other machine, run")
+	for _, addr := range lanAddresses(ln.Addr().(*net.TCPAddr).Port) {
+		fmt.Printf("  masterkey send -to %v vault location...|--all\n", addr)
+	}
+	fmt.Printf("and enter the code %v\n", code)
+
+	// only one connection is accepted, so the code can only be guessed once
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(transferTimeout))
+	conn, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(transferTimeout))
+	n, err := receiveEntries(conn, code, v)
+	if err != nil {
+		return err
+	}
+	if err = v.Save(vaultPath); err != nil {
+		return err
+	}
+	fmt.Printf("received %v credentials into %v\n", n, vaultPath)
+	return nil
+}
+
+// receiveEntries adds the credentials received over `conn` to `v`, at new
+// locations if theirs are taken, and returns how many were added.
+func receiveEntries(conn io.ReadWriter, code string, v *vault.Vault) (int, error) {
+	payload, err := transfer.Receive(conn, code)
+	if err != nil {
+		return 0, err
+	}
+	var entries []importer.Entry
+	if err = json.Unmarshal(payload, &entries); err != nil {
+		return 0, err
+	}
+	return importer.Import(v, entries)
+}
+
+// lanAddresses returns the addresses, with `port`, that other machines on
+// the network can reach this one at.
+func lanAddresses(port int) []string {
+	var addrs []string
+	ifaddrs, _ := net.InterfaceAddrs()
+	for _, ifaddr := range ifaddrs {
+		ipnet, ok := ifaddr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.To4() == nil {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(ipnet.IP.String(), strconv.Itoa(port)))
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, net.JoinHostPort("localhost", strconv.Itoa(port)))
+	}
+	return addrs
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestSendReceiveEntries(t *testing.T) {
+	src, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := vault.New("otherpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err = src.Add("github.com", vault.Credential{Username: "alice", Password: "hunter2", Notes: "work", Meta: map[string]string{"pin": "1234"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.Add("example.com", vault.Credential{Username: "bob", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = dst.Add("github.com", vault.Credential{Username: "alice-old", Password: "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := net.Pipe()
+	sendErr := make(chan error, 1)
+	go func() {
+		err := sendEntries(a, "1234-5678", src, []string{"github.com"})
+		a.Close()
+		sendErr <- err
+	}()
+	n, err := receiveEntries(b, "1234-5678", dst)
+	b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-sendErr; err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatal("expected 1 credential to be received, got", n)
+	}
+
+	// the location was taken, so it was received alongside the original
+	cred, err := dst.Get("github.com (alice)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Password != "hunter2" || cred.Notes != "work" || cred.Meta["pin"] != "1234" {
+		t.Fatalf("received the wrong credential: %+v", cred)
+	}
+	if _, err = dst.Get("example.com"); err != vault.ErrNoSuchCredential {
+		t.Fatal("a credential that was not sent was received")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// remoteShell runs `masterkey remote [-ssh command] [-masterkey path]
+// [user@]host:vault`, which opens the shell on a vault kept on another host
+// by running masterkey there over SSH, without copying the vault file down.
+// Secrets are copied to the local clipboard using OSC 52. The SSH command
+// defaults to ssh, so ProxyCommand, ProxyJump and the other settings in
+// ~/.ssh/config apply, and can be replaced to pass other options, such as
+// -ssh "ssh -J bastion".
+func remoteShell(args []string) error {
+	fs := flag.NewFlagSet("remote", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	sshCommand := fs.String("ssh", "ssh", "")
+	masterkeyPath := fs.String("masterkey", "masterkey", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return fmt.Errorf("remote requires one argument, the host and path of the vault, such as user@host:vault.db")
+	}
+	host, vaultPath, err := splitRemoteVault(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ssh := strings.Fields(*sshCommand)
+	if len(ssh) == 0 {
+		return fmt.Errorf("-ssh must name the command to connect with")
+	}
+
+	// -t gives the remote masterkey a terminal to read the passphrase from
+	cmdArgs := append(ssh[1:], "-t", host, remoteShellCommand(*masterkeyPath, vaultPath))
+	cmd := exec.Command(ssh[0], cmdArgs...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// splitRemoteVault splits `target`, such as user@host:vault.db, into the
+// host to connect to and the path of the vault on it. An IPv6 address is
+// written in brackets, as in user@[::1]:vault.db; otherwise the host ends at
+// the last colon. Hosts starting with - are rejected, as ssh would read them
+// as an option.
+func splitRemoteVault(target string) (string, string, error) {
+	invalid := fmt.Errorf("%q is not a host and vault, such as user@host:vault.db", target)
+	var host, vaultPath string
+	if open := strings.Index(target, "["); open >= 0 && !strings.Contains(target[:open], ":") {
+		end := strings.Index(target, "]:")
+		if end < open {
+			return "", "", invalid
+		}
+		host, vaultPath = target[:open]+target[open+1:end], target[end+2:]
+	} else {
+		i := strings.LastIndex(target, ":")
+		if i < 0 {
+			return "", "", invalid
+		}
+		host, vaultPath = target[:i], target[i+1:]
+	}
+	if host == "" || vaultPath == "" || strings.HasSuffix(host, "@") {
+		return "", "", invalid
+	}
+	if strings.HasPrefix(host, "-") {
+		return "", "", fmt.Errorf("%q can not be used as a host, as it starts with -", host)
+	}
+	return host, vaultPath, nil
+}
+
+// remoteShellCommand returns the command the remote host's shell runs to
+// open the shell on `vaultPath` using the masterkey at `masterkeyPath`. A
+// leading ~/ in either is left unquoted, so that it is expanded to the
+// remote home directory.
+func remoteShellCommand(masterkeyPath, vaultPath string) string {
+	return shellQuote(masterkeyPath) + " -repl -osc52 " + shellQuote(vaultPath)
+}
+
+// shellQuote quotes `s` for a POSIX shell, apart from a leading ~/.
+func shellQuote(s string) string {
+	if strings.HasPrefix(s, "~/") {
+		return "~/" + shellQuote(s[2:])
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
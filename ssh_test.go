@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestSplitRemoteVault(t *testing.T) {
+	host, vaultPath, err := splitRemoteVault("me@server:vaults/main.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "me@server" || vaultPath != "vaults/main.db" {
+		t.Fatal("unexpected host and vault", host, vaultPath)
+	}
+	tests := []struct {
+		target, host, vault string
+	}{
+		{"me@[fe80::1]:vault.db", "me@fe80::1", "vault.db"},
+		{"[::1]:vaults/main.db", "::1", "vaults/main.db"},
+		{"fe80::1:vault.db", "fe80::1", "vault.db"},
+	}
+	for _, test := range tests {
+		host, vaultPath, err := splitRemoteVault(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host != test.host || vaultPath != test.vault {
+			t.Fatalf("splitRemoteVault(%q) = %v, %v, wanted %v, %v", test.target, host, vaultPath, test.host, test.vault)
+		}
+	}
+	for _, target := range []string{"server", ":vault.db", "server:", "[::1:vault.db", "me@[::1]:", "me@:vault.db", "-oProxyCommand=sh:vault.db"} {
+		if _, _, err = splitRemoteVault(target); err == nil {
+			t.Fatalf("expected an error splitting %q", target)
+		}
+	}
+}
+
+func TestRemoteShellCommand(t *testing.T) {
+	tests := []struct {
+		masterkey, vault, command string
+	}{
+		{"masterkey", "vault.db", `'masterkey' -repl -osc52 'vault.db'`},
+		{"~/bin/masterkey", "~/my vault.db", `~/'bin/masterkey' -repl -osc52 ~/'my vault.db'`},
+		{"masterkey", "it's.db; rm -rf ~", `'masterkey' -repl -osc52 'it'\''s.db; rm -rf ~'`},
+	}
+	for _, test := range tests {
+		if command := remoteShellCommand(test.masterkey, test.vault); command != test.command {
+			t.Fatalf("remoteShellCommand(%q, %q) = %v, wanted %v", test.masterkey, test.vault, command, test.command)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package syncserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	// ErrNotFound is returned from Get if the server holds no vault at the
+	// client's URL.
+	ErrNotFound = errors.New("the sync server holds no copy of this vault yet")
+
+	// ErrConflict is returned from Put if the server's copy of the vault
+	// has changed since it was last fetched.
+	ErrConflict = errors.New("the sync server's copy of the vault has changed")
+
+	// ErrUnauthorized is returned if the server does not recognise the
+	// device, for example because it was revoked, or rejects a pairing
+	// code.
+	ErrUnauthorized = errors.New("the sync server rejected this device. It may have been revoked, or the pairing code may have expired")
+
+	// ErrDeviceExists is returned from Enroll if a device with the same name
+	// is already enrolled.
+	ErrDeviceExists = errors.New("a device with that name is already enrolled with the sync server")
+)
+
+// Client fetches and stores a vault on a sync server, as an enrolled device.
+type Client struct {
+	// URL is the URL of the vault, such as
+	// https://example.com/vaults/personal.
+	URL string
+	// Name and Key are the device's name and private key.
+	Name string
+	Key  ed25519.PrivateKey
+	// HTTPClient is used to make requests. If it is nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// serverURL returns the URL of `path` on the client's server.
+func (c *Client) serverURL(path string) (string, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndex(u.Path, vaultPrefix)
+	if i < 0 {
+		return "", fmt.Errorf("%v is not the URL of a vault on a sync server", c.URL)
+	}
+	u.Path = u.Path[:i] + path
+	return u.String(), nil
+}
+
+// do makes a request to `rawurl`, signed by the client's device.
+func (c *Client) do(method, rawurl string, body []byte, header http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, rawurl, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	sign(req, body, c.Name, c.Key)
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return nil, nil, ErrUnauthorized
+	case http.StatusNotFound:
+		return nil, nil, ErrNotFound
+	case http.StatusPreconditionFailed:
+		return nil, nil, ErrConflict
+	case http.StatusConflict:
+		return nil, nil, ErrDeviceExists
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, nil, fmt.Errorf("sync server returned %v: %s", resp.Status, bytes.TrimSpace(bs))
+	}
+	return resp, bs, nil
+}
+
+// Get returns the server's copy of the vault and its version.
+func (c *Client) Get() ([]byte, string, error) {
+	resp, bs, err := c.do(http.MethodGet, c.URL, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return bs, resp.Header.Get("ETag"), nil
+}
+
+// Put replaces the server's copy of the vault, whose version must be
+// `version`, with `bs`, and returns the new version. An empty version
+// creates the vault on the server. ErrConflict is returned if the server's
+// copy is not at `version`.
+func (c *Client) Put(bs []byte, version string) (string, error) {
+	header := make(http.Header)
+	if version == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", version)
+	}
+	resp, _, err := c.do(http.MethodPut, c.URL, bs, header)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// Enroll enrolls the client's device with the server, using a pairing code
+// from Pair, or the server's token to enroll the first device.
+func (c *Client) Enroll(code string) error {
+	body, err := json.Marshal(enrollRequest{Code: code, Name: c.Name, PublicKey: c.Key.Public().(ed25519.PublicKey)})
+	if err != nil {
+		return err
+	}
+	rawurl, err := c.serverURL(devicesPrefix + "enroll")
+	if err != nil {
+		return err
+	}
+	_, _, err = c.do(http.MethodPost, rawurl, body, nil)
+	return err
+}
+
+// Pair returns a one-time pairing code that enrolls another device. It
+// expires after PairingCodeLifetime.
+func (c *Client) Pair() (string, error) {
+	rawurl, err := c.serverURL(devicesPrefix + "pair")
+	if err != nil {
+		return "", err
+	}
+	_, bs, err := c.do(http.MethodPost, rawurl, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var code pairingCode
+	if err = json.Unmarshal(bs, &code); err != nil {
+		return "", err
+	}
+	return code.Code, nil
+}
+
+// Devices returns the devices enrolled with the server, in the order they
+// were enrolled.
+func (c *Client) Devices() ([]Device, error) {
+	rawurl, err := c.serverURL(devicesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	_, bs, err := c.do(http.MethodGet, rawurl, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var devices []Device
+	if err = json.Unmarshal(bs, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// Revoke revokes the device called `name`. It can no longer read or write
+// vaults on the server. ErrNotFound is returned if no such device is
+// enrolled.
+func (c *Client) Revoke(name string) error {
+	rawurl, err := c.serverURL(devicesPrefix + name)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.do(http.MethodDelete, rawurl, nil, nil)
+	return err
+}
@@ -0,0 +1,345 @@
+package syncserver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// devicesFile is the file in the server's directory listing the
+	// enrolled devices. Its name can not be taken by a vault.
+	devicesFile = "devices.json"
+
+	// PairingCodeLifetime is how long a pairing code can be used for.
+	PairingCodeLifetime = 10 * time.Minute
+
+	// maxEnrollFailures is the number of failed enrollments after which
+	// every pending pairing code is cancelled, so that codes can not be
+	// guessed.
+	maxEnrollFailures = 10
+
+	// maxClockSkew is how far the time a request was signed may be from
+	// the server's clock.
+	maxClockSkew = 5 * time.Minute
+
+	// maxEnrollSize is the largest enrollment request the server accepts.
+	maxEnrollSize = 4096
+
+	// dateHeader carries the time a request was signed, nonceHeader a
+	// random value that makes each request unique, so that it can not be
+	// replayed, and bodyHashHeader the hash of its body, so that the
+	// request can be authenticated before its body is read.
+	dateHeader     = "X-Masterkey-Date"
+	nonceHeader    = "X-Masterkey-Nonce"
+	bodyHashHeader = "X-Masterkey-Content-SHA256"
+
+	// pairingAlphabet leaves out characters that are easily confused.
+	pairingAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+type (
+	// Device is a device enrolled with a sync server. Each device signs
+	// its requests with its own key, so that a lost device can be revoked
+	// without affecting the others.
+	Device struct {
+		Name      string
+		PublicKey ed25519.PublicKey
+		Enrolled  time.Time
+	}
+
+	// enrollRequest is the body of a request to enroll a device.
+	enrollRequest struct {
+		// Code is a pairing code, or the server's token.
+		Code      string
+		Name      string
+		PublicKey ed25519.PublicKey
+	}
+
+	// pairingCode is the response to a request for a pairing code.
+	pairingCode struct {
+		Code    string
+		Expires time.Time
+	}
+)
+
+// signature returns the message a device signs for `req`: its method, path,
+// time, nonce, preconditions and the hash of its body.
+func signature(req *http.Request) []byte {
+	return []byte(strings.Join([]string{
+		req.Method,
+		req.URL.Path,
+		req.Header.Get(dateHeader),
+		req.Header.Get(nonceHeader),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get(bodyHashHeader),
+	}, "\n"))
+}
+
+// bodyHash returns the hash of a request body, as carried in bodyHashHeader.
+func bodyHash(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// sign signs `req`, whose body is `body`, as the device `name` using `key`.
+// Its preconditions must already be set.
+func sign(req *http.Request, body []byte, name string, key ed25519.PrivateKey) {
+	var nonce [16]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		panic(err)
+	}
+	req.Header.Set(dateHeader, time.Now().UTC().Format(time.RFC3339))
+	req.Header.Set(nonceHeader, hex.EncodeToString(nonce[:]))
+	req.Header.Set(bodyHashHeader, bodyHash(body))
+	sig := ed25519.Sign(key, signature(req))
+	req.Header.Set("Authorization", "Device "+name+":"+base64.StdEncoding.EncodeToString(sig))
+}
+
+// readBody reads the body of `r`, up to `limit` bytes. If `r` was signed by
+// a device, the body must be the one it signed.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if hash := r.Header.Get(bodyHashHeader); hash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(bodyHash(body))) != 1 {
+		http.Error(w, "request body does not match its signature", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// newPairingCode returns a random pairing code, such as ABCD-EFGH.
+func newPairingCode() string {
+	var b [8]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(err)
+	}
+	code := make([]byte, 0, 9)
+	for i, c := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, pairingAlphabet[int(c)%len(pairingAlphabet)])
+	}
+	return string(code)
+}
+
+// loadDevicesLocked reads the enrolled devices, if they have not been read
+// yet. s.mu must be held.
+func (s *Server) loadDevicesLocked() error {
+	if s.devices != nil {
+		return nil
+	}
+	s.devices = make(map[string]Device)
+	bs, err := ioutil.ReadFile(filepath.Join(s.dir, devicesFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		s.devices = nil
+		return err
+	}
+	var devices []Device
+	if err = json.Unmarshal(bs, &devices); err != nil {
+		s.devices = nil
+		return err
+	}
+	for _, d := range devices {
+		s.devices[d.Name] = d
+	}
+	return nil
+}
+
+// saveDevicesLocked writes the enrolled devices. s.mu must be held.
+func (s *Server) saveDevicesLocked() error {
+	bs, err := json.Marshal(s.deviceListLocked())
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(s.dir, devicesFile), bs)
+}
+
+// deviceListLocked returns the enrolled devices in the order they were
+// enrolled. s.mu must be held.
+func (s *Server) deviceListLocked() []Device {
+	devices := make([]Device, 0, len(s.devices))
+	for _, d := range s.devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Enrolled.Before(devices[j].Enrolled)
+	})
+	return devices
+}
+
+// isToken returns true if `token` is the server's token.
+func (s *Server) isToken(token string) bool {
+	hash := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(hash[:], s.tokenHash[:]) == 1
+}
+
+// device returns the enrolled device that signed `r`. Only the request's
+// headers are checked; readBody checks that its body is the one signed. A
+// request is accepted once: its nonce is remembered until its time is too
+// old to be accepted anyway.
+func (s *Server) device(r *http.Request) (Device, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Device ") {
+		return Device{}, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(auth, "Device "), ":", 2)
+	if len(parts) != 2 {
+		return Device{}, false
+	}
+	sig, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Device{}, false
+	}
+	signed, err := time.Parse(time.RFC3339, r.Header.Get(dateHeader))
+	if err != nil || time.Since(signed) > maxClockSkew || time.Until(signed) > maxClockSkew {
+		return Device{}, false
+	}
+	nonce := r.Header.Get(nonceHeader)
+	if len(nonce) != 32 || len(r.Header.Get(bodyHashHeader)) != sha256.Size*2 {
+		return Device{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.loadDevicesLocked()
+	d, ok := s.devices[parts[0]]
+	if err != nil || !ok || !ed25519.Verify(d.PublicKey, signature(r), sig) {
+		return Device{}, false
+	}
+	now := time.Now()
+	for n, expires := range s.nonces {
+		if now.After(expires) {
+			delete(s.nonces, n)
+		}
+	}
+	if _, replayed := s.nonces[nonce]; replayed {
+		return Device{}, false
+	}
+	s.nonces[nonce] = signed.Add(maxClockSkew)
+	return d, true
+}
+
+// serveDevices handles requests under /devices/.
+func (s *Server) serveDevices(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, devicesPrefix)
+	if r.Method == http.MethodPost && name == "enroll" {
+		body, ok := readBody(w, r, maxEnrollSize)
+		if !ok {
+			return
+		}
+		s.enroll(w, body)
+		return
+	}
+
+	// everything else may be done by an enrolled device, or with the
+	// server's token. None of it has a body.
+	_, isDevice := s.device(r)
+	if !isDevice && !s.isToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadDevicesLocked(); err != nil {
+		http.Error(w, "could not read devices", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		writeJSON(w, s.deviceListLocked())
+	case r.Method == http.MethodPost && name == "pair":
+		code := pairingCode{Code: newPairingCode(), Expires: time.Now().Add(PairingCodeLifetime)}
+		s.pairing[code.Code] = code.Expires
+		writeJSON(w, code)
+	case r.Method == http.MethodDelete && validName.MatchString(name):
+		if _, exists := s.devices[name]; !exists {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.devices, name)
+		if err := s.saveDevicesLocked(); err != nil {
+			http.Error(w, "could not write devices", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// enroll enrolls a device, given a pairing code or the server's token.
+func (s *Server) enroll(w http.ResponseWriter, body []byte) {
+	var req enrollRequest
+	if err := json.Unmarshal(body, &req); err != nil || !validName.MatchString(req.Name) || len(req.PublicKey) != ed25519.PublicKeySize {
+		http.Error(w, "invalid enrollment request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
+	expires, paired := s.pairing[code]
+	if paired {
+		delete(s.pairing, code)
+	}
+	if !(paired && time.Now().Before(expires)) && !s.isToken(req.Code) {
+		s.enrollFailures++
+		if s.enrollFailures >= maxEnrollFailures {
+			s.pairing = make(map[string]time.Time)
+			s.enrollFailures = 0
+		}
+		http.Error(w, "invalid or expired pairing code", http.StatusUnauthorized)
+		return
+	}
+	if err := s.loadDevicesLocked(); err != nil {
+		http.Error(w, "could not read devices", http.StatusInternalServerError)
+		return
+	}
+	if _, exists := s.devices[req.Name]; exists {
+		http.Error(w, "a device with that name is already enrolled", http.StatusConflict)
+		return
+	}
+	s.devices[req.Name] = Device{Name: req.Name, PublicKey: req.PublicKey, Enrolled: time.Now()}
+	if err := s.saveDevicesLocked(); err != nil {
+		delete(s.devices, req.Name)
+		http.Error(w, "could not write devices", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes `v` to `w` as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		http.Error(w, "could not encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,170 @@
+// Package syncserver implements a rendezvous point for keeping copies of a
+// vault on several devices in sync, and a client for it. The server only
+// ever sees encrypted vault files: it stores them by name, and tags each
+// with a version so that a client can not overwrite a copy it has not seen.
+// Merging is left to the clients, which download the server's copy, merge it
+// into their own using vault.Sync and upload the result.
+package syncserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxVaultSize is the largest vault file the server accepts.
+const MaxVaultSize = 64 << 20
+
+const (
+	// vaultPrefix is the path under which vaults are served.
+	vaultPrefix = "/vaults/"
+	// devicesPrefix is the path under which devices are managed.
+	devicesPrefix = "/devices/"
+)
+
+// validName matches the names vaults and devices can be given.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Server is an http.Handler that stores vault files in a directory.
+//
+// GET /vaults/<name> returns the vault called name, with its version as the
+// ETag. PUT /vaults/<name> replaces it, and must carry the version being
+// replaced in an If-Match header, or If-None-Match: * if the vault is being
+// created. If the stored version is different, the PUT fails with 412
+// Precondition Failed and the client must merge the stored copy first.
+// Vaults can only be read and written by enrolled devices, which sign each
+// request, including its preconditions, with their own key. Each signed
+// request is accepted once.
+//
+// Devices are managed under /devices/. POST /devices/enroll enrolls a device
+// given a pairing code, or the server's token to enroll the first device.
+// Enrolled devices, or requests carrying the server's token as a bearer
+// token, may list devices with GET /devices/, get a pairing code for a new
+// device with POST /devices/pair, and revoke a device with DELETE
+// /devices/<name>.
+type Server struct {
+	dir       string
+	tokenHash [sha256.Size]byte
+
+	// mu guards the fields below, and serializes writes to vaults so that
+	// a version check and the write it guards happen together.
+	mu             sync.Mutex
+	devices        map[string]Device
+	pairing        map[string]time.Time
+	enrollFailures int
+	// nonces holds the nonces of accepted requests, and when each can be
+	// forgotten.
+	nonces map[string]time.Time
+}
+
+// New returns a Server storing vaults in `dir`, which accepts `token` for
+// enrolling devices.
+func New(dir string, token string) *Server {
+	return &Server{
+		dir:       dir,
+		tokenHash: sha256.Sum256([]byte(token)),
+		pairing:   make(map[string]time.Time),
+		nonces:    make(map[string]time.Time),
+	}
+}
+
+// version returns the version tag of a vault file with the contents `bs`.
+func version(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, devicesPrefix) {
+		s.serveDevices(w, r)
+		return
+	}
+
+	// the request is authenticated before its body is read
+	if _, ok := s.device(r); !ok {
+		w.Header().Set("WWW-Authenticate", "Device")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, vaultPrefix) || !validName.MatchString(strings.TrimPrefix(r.URL.Path, vaultPrefix)) {
+		http.NotFound(w, r)
+		return
+	}
+	filename := filepath.Join(s.dir, strings.TrimPrefix(r.URL.Path, vaultPrefix))
+
+	switch r.Method {
+	case http.MethodGet:
+		bs, err := ioutil.ReadFile(filename)
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "could not read vault", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", version(bs))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(bs)
+
+	case http.MethodPut:
+		body, ok := readBody(w, r, MaxVaultSize)
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		current, err := ioutil.ReadFile(filename)
+		switch {
+		case os.IsNotExist(err):
+			if r.Header.Get("If-None-Match") != "*" {
+				http.Error(w, "vault does not exist", http.StatusPreconditionFailed)
+				return
+			}
+		case err != nil:
+			http.Error(w, "could not read vault", http.StatusInternalServerError)
+			return
+		case r.Header.Get("If-Match") != version(current):
+			http.Error(w, "vault has changed", http.StatusPreconditionFailed)
+			return
+		}
+		if err = writeFile(filename, body); err != nil {
+			http.Error(w, "could not write vault", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", version(body))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeFile atomically replaces `filename` with `bs`.
+func writeFile(filename string, bs []byte) error {
+	tempfile, err := ioutil.TempFile(filepath.Dir(filename), "masterkey-temp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempfile.Name())
+	defer tempfile.Close()
+	if _, err = tempfile.Write(bs); err != nil {
+		return err
+	}
+	if err = tempfile.Sync(); err != nil {
+		return err
+	}
+	if err = tempfile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempfile.Name(), filename)
+}
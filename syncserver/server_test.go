@@ -0,0 +1,211 @@
+package syncserver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// newTestClient returns a client for the vault `name` on `ts` with a new
+// device key.
+func newTestClient(t *testing.T, ts *httptest.Server, device string) *Client {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{URL: ts.URL + "/vaults/personal", Name: device, Key: key}
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-syncserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(New(dir, "testtoken"))
+	defer ts.Close()
+
+	c := newTestClient(t, ts, "laptop")
+	if _, _, err = c.Get(); err != ErrUnauthorized {
+		t.Fatal("expected ErrUnauthorized before enrolling, got", err)
+	}
+	if err = c.Enroll("wrongtoken"); err != ErrUnauthorized {
+		t.Fatal("expected ErrUnauthorized enrolling with the wrong token, got", err)
+	}
+	if err = c.Enroll("testtoken"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = c.Get(); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound getting a new vault, got", err)
+	}
+	v1, err := c.Put([]byte("ciphertext1"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Put([]byte("ciphertext2"), ""); err != ErrConflict {
+		t.Fatal("expected ErrConflict creating an existing vault, got", err)
+	}
+	bs, version, err := c.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, []byte("ciphertext1")) || version != v1 {
+		t.Fatal("unexpected vault from server:", string(bs), version, v1)
+	}
+	v2, err := c.Put([]byte("ciphertext2"), v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2 == v1 {
+		t.Fatal("expected the version to change")
+	}
+	if _, err = c.Put([]byte("ciphertext3"), v1); err != ErrConflict {
+		t.Fatal("expected ErrConflict replacing an old version, got", err)
+	}
+
+	escape := &Client{URL: ts.URL + "/vaults/..%2fescape", Name: c.Name, Key: c.Key}
+	if _, err = escape.Put([]byte("ciphertext3"), ""); err != ErrNotFound {
+		t.Fatal("expected an invalid name to be rejected, got", err)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-syncserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(New(dir, "testtoken"))
+	defer ts.Close()
+
+	laptop := newTestClient(t, ts, "laptop")
+	if err = laptop.Enroll("testtoken"); err != nil {
+		t.Fatal(err)
+	}
+	code, err := laptop.Pair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone := newTestClient(t, ts, "phone")
+	if err = phone.Enroll("WRONG-CODE"); err != ErrUnauthorized {
+		t.Fatal("expected ErrUnauthorized with the wrong pairing code, got", err)
+	}
+	if err = phone.Enroll(code); err != nil {
+		t.Fatal(err)
+	}
+	impostor := newTestClient(t, ts, "impostor")
+	if err = impostor.Enroll(code); err != ErrUnauthorized {
+		t.Fatal("expected a pairing code to be usable only once, got", err)
+	}
+	duplicate := newTestClient(t, ts, "phone")
+	if err = duplicate.Enroll("testtoken"); err != ErrDeviceExists {
+		t.Fatal("expected ErrDeviceExists, got", err)
+	}
+	// a device can not sign as another
+	impostor.Name = "phone"
+	if _, _, err = impostor.Get(); err != ErrUnauthorized {
+		t.Fatal("expected a request signed with the wrong key to be rejected, got", err)
+	}
+
+	if _, err = phone.Put([]byte("ciphertext"), ""); err != nil {
+		t.Fatal(err)
+	}
+	devices, err := laptop.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 || devices[0].Name != "laptop" || devices[1].Name != "phone" {
+		t.Fatal("unexpected devices:", devices)
+	}
+
+	// a revoked device can no longer pull the vault, even after a restart
+	if err = laptop.Revoke("phone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = phone.Get(); err != ErrUnauthorized {
+		t.Fatal("expected a revoked device to be rejected, got", err)
+	}
+	if err = laptop.Revoke("phone"); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound revoking a revoked device, got", err)
+	}
+	restarted := httptest.NewServer(New(dir, "testtoken"))
+	defer restarted.Close()
+	laptop.URL = restarted.URL + "/vaults/personal"
+	phone.URL = laptop.URL
+	if _, _, err = laptop.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = phone.Get(); err != ErrUnauthorized {
+		t.Fatal("expected a revoked device to stay revoked, got", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-syncserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(New(dir, "testtoken"))
+	defer ts.Close()
+
+	c := newTestClient(t, ts, "laptop")
+	if err = c.Enroll("testtoken"); err != nil {
+		t.Fatal(err)
+	}
+	v1, err := c.Put([]byte("ciphertext1"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a captured request can not be sent again, or with its preconditions
+	// or body changed
+	put := func(body []byte, version string) *http.Request {
+		req, err := http.NewRequest(http.MethodPut, c.URL, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-Match", version)
+		sign(req, body, c.Name, c.Key)
+		return req
+	}
+	send := func(req *http.Request, body []byte) int {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	req := put([]byte("ciphertext2"), v1)
+	if status := send(req, []byte("ciphertext2")); status != http.StatusNoContent {
+		t.Fatal("expected the signed request to succeed, got", status)
+	}
+	if status := send(req, []byte("ciphertext2")); status != http.StatusUnauthorized {
+		t.Fatal("expected a replayed request to be rejected, got", status)
+	}
+	req = put([]byte("ciphertext3"), v1)
+	req.Header.Set("If-Match", version([]byte("ciphertext2")))
+	if status := send(req, []byte("ciphertext3")); status != http.StatusUnauthorized {
+		t.Fatal("expected a request with a changed precondition to be rejected, got", status)
+	}
+	req = put([]byte("ciphertext3"), version([]byte("ciphertext2")))
+	if status := send(req, []byte("ciphertext1")); status != http.StatusBadRequest {
+		t.Fatal("expected a request with a changed body to be rejected, got", status)
+	}
+	bs, _, err := c.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, []byte("ciphertext2")) {
+		t.Fatal("unexpected vault from server:", string(bs))
+	}
+}
@@ -0,0 +1,152 @@
+package transfer
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// errInvalidPoint is returned if the other side sends a share that is not a
+// point on the curve.
+var errInvalidPoint = errors.New("the other side sent an invalid key share")
+
+// The identities of the two sides, bound into the transcript.
+const (
+	senderID   = "masterkey send"
+	receiverID = "masterkey receive"
+)
+
+var (
+	curve = elliptic.P256()
+
+	// pointM and pointN are the fixed points of SPAKE2 for P-256 given in
+	// RFC 9382, whose discrete logarithms are unknown, in uncompressed form.
+	pointM = mustUnmarshal("04886e2f97ace46e55ba9dd7242579f2993b64e16ef3dcab95afd497333d8fa12f5ff355163e43ce224e0b0e65ff02ac8e5c7be09419c785e0ca547d55a12e2d20")
+	pointN = mustUnmarshal("04d8bbd6c639c62937b04d997f38c3770719c629d7014d49a24b4f98baa1292b4907d60aa6bfade45008a636337f5168c64d9bd36034808cd564490b1e656edbe7")
+)
+
+type (
+	point struct {
+		x, y *big.Int
+	}
+
+	// spake2 is one side of a SPAKE2 exchange (RFC 9382) over P-256, which
+	// derives a shared key from a short code without revealing anything
+	// that would let an eavesdropper, or the other side, guess the code
+	// offline.
+	spake2 struct {
+		sender bool
+		w      *big.Int
+		secret []byte
+		share  []byte
+	}
+
+	// spake2Keys are the keys derived by a completed exchange: `key`
+	// encrypts the transfer, and each side proves it derived the same keys
+	// with its confirmation.
+	spake2Keys struct {
+		key                      []byte
+		senderConf, receiverConf []byte
+	}
+)
+
+func mustUnmarshal(s string) point {
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	x, y := elliptic.Unmarshal(curve, bs)
+	if x == nil {
+		panic("invalid SPAKE2 point " + s)
+	}
+	return point{x, y}
+}
+
+// newSpake2 starts an exchange using `code`, as the sender or the receiver.
+func newSpake2(code string, sender bool) (*spake2, error) {
+	h := sha256.Sum256([]byte("masterkey transfer code " + code))
+	w := new(big.Int).Mod(new(big.Int).SetBytes(h[:]), curve.Params().N)
+
+	secret, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	blind := pointM
+	if !sender {
+		blind = pointN
+	}
+	bx, by := curve.ScalarMult(blind.x, blind.y, w.Bytes())
+	x, y = curve.Add(x, y, bx, by)
+	return &spake2{
+		sender: sender,
+		w:      w,
+		secret: secret,
+		share:  elliptic.Marshal(curve, x, y),
+	}, nil
+}
+
+// finish completes the exchange given the other side's share.
+func (s *spake2) finish(otherShare []byte) (spake2Keys, error) {
+	x, y := elliptic.Unmarshal(curve, otherShare)
+	if x == nil {
+		return spake2Keys{}, errInvalidPoint
+	}
+
+	// remove the other side's blinding, then apply our secret
+	blind := pointN
+	if !s.sender {
+		blind = pointM
+	}
+	bx, by := curve.ScalarMult(blind.x, blind.y, s.w.Bytes())
+	by = new(big.Int).Sub(curve.Params().P, by)
+	x, y = curve.Add(x, y, bx, by)
+	kx, ky := curve.ScalarMult(x, y, s.secret)
+	if kx.Sign() == 0 && ky.Sign() == 0 {
+		return spake2Keys{}, errInvalidPoint
+	}
+
+	senderShare, receiverShare := s.share, otherShare
+	if !s.sender {
+		senderShare, receiverShare = otherShare, s.share
+	}
+	var tt []byte
+	// w is encoded at its full width, left-padded with zeros
+	wb := s.w.Bytes()
+	w := make([]byte, 32)
+	copy(w[len(w)-len(wb):], wb)
+	for _, part := range [][]byte{[]byte(senderID), []byte(receiverID), senderShare, receiverShare, elliptic.Marshal(curve, kx, ky), w} {
+		var n [8]byte
+		binary.LittleEndian.PutUint64(n[:], uint64(len(part)))
+		tt = append(append(tt, n[:]...), part...)
+	}
+
+	hash := sha256.Sum256(tt)
+	ke, ka := hash[:16], hash[16:]
+	confKeys := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ka, nil, []byte("ConfirmationKeys")), confKeys); err != nil {
+		return spake2Keys{}, err
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ke, nil, []byte("masterkey transfer")), key); err != nil {
+		return spake2Keys{}, err
+	}
+	return spake2Keys{
+		key:          key,
+		senderConf:   mac(confKeys[:16], tt),
+		receiverConf: mac(confKeys[16:], tt),
+	}, nil
+}
+
+func mac(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,164 @@
+// Package transfer moves data between two machines over a direct
+// connection, encrypted under a key agreed from a short one-time code. The
+// code is never sent, and an attacker who does not know it gets a single
+// guess per transfer.
+package transfer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// maxFrame is the largest message either side accepts.
+const maxFrame = 64 << 20
+
+var (
+	// ErrWrongCode is returned if the two sides of a transfer were not
+	// given the same code.
+	ErrWrongCode = errors.New("the code does not match the one shown by the receiving machine")
+
+	// ErrFrameTooLarge is returned if the other side sends a message
+	// larger than maxFrame.
+	ErrFrameTooLarge = errors.New("the other side sent too much data")
+)
+
+// NewCode returns a random code of 8 digits, such as 4821-0937, for the
+// receiver to show and the sender to enter.
+func NewCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1e8))
+	if err != nil {
+		return "", err
+	}
+	s := fmt.Sprintf("%08d", n)
+	return s[:4] + "-" + s[4:], nil
+}
+
+// normalizeCode removes the dashes and spaces a code may be entered with.
+func normalizeCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// Send sends `payload` over `conn` to the other side, which calls Receive
+// with the same `code`. ErrWrongCode is returned, and nothing is sent, if
+// the codes differ.
+func Send(conn io.ReadWriter, code string, payload []byte) error {
+	s, err := newSpake2(normalizeCode(code), true)
+	if err != nil {
+		return err
+	}
+	if err = writeFrame(conn, s.share); err != nil {
+		return err
+	}
+	share, err := readFrame(conn)
+	if err != nil {
+		return err
+	}
+	keys, err := s.finish(share)
+	if err != nil {
+		return err
+	}
+	conf, err := readFrame(conn)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(conf, keys.receiverConf) {
+		return ErrWrongCode
+	}
+	if err = writeFrame(conn, keys.senderConf); err != nil {
+		return err
+	}
+
+	aead, err := chacha20poly1305.NewX(keys.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	return writeFrame(conn, aead.Seal(nonce, nonce, payload, nil))
+}
+
+// Receive receives the payload sent over `conn` by the other side, which
+// calls Send with the same `code`. ErrWrongCode is returned if the codes
+// differ.
+func Receive(conn io.ReadWriter, code string) ([]byte, error) {
+	s, err := newSpake2(normalizeCode(code), false)
+	if err != nil {
+		return nil, err
+	}
+	share, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.finish(share)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFrame(conn, s.share); err != nil {
+		return nil, err
+	}
+	if err = writeFrame(conn, keys.receiverConf); err != nil {
+		return nil, err
+	}
+	// the sender hangs up if our confirmation does not match its own
+	conf, err := readFrame(conn)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && !hmac.Equal(conf, keys.senderConf)) {
+		return nil, ErrWrongCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(keys.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrWrongCode
+	}
+	payload, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongCode
+	}
+	return payload, nil
+}
+
+// writeFrame writes `bs` to `w`, preceded by its length.
+func writeFrame(w io.Writer, bs []byte) error {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(bs)))
+	if _, err := w.Write(append(n[:], bs...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFrame reads a message written by writeFrame from `r`.
+func readFrame(r io.Reader) ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size > maxFrame {
+		return nil, ErrFrameTooLarge
+	}
+	bs := make([]byte, size)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
@@ -0,0 +1,77 @@
+package transfer
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"testing"
+)
+
+// transfer sends `payload` from a sender given `sendCode` to a receiver given
+// `receiveCode`, returning what the receiver got and the errors of both.
+func transfer(sendCode, receiveCode string, payload []byte) ([]byte, error, error) {
+	a, b := net.Pipe()
+	sendErr := make(chan error, 1)
+	go func() {
+		err := Send(a, sendCode, payload)
+		a.Close()
+		sendErr <- err
+	}()
+	received, err := Receive(b, receiveCode)
+	b.Close()
+	return received, <-sendErr, err
+}
+
+func TestTransfer(t *testing.T) {
+	payload := []byte(`[{"Location":"github.com"}]`)
+	received, sendErr, receiveErr := transfer("4821-0937", "4821 0937", payload)
+	if sendErr != nil || receiveErr != nil {
+		t.Fatal(sendErr, receiveErr)
+	}
+	if !bytes.Equal(received, payload) {
+		t.Fatal("received the wrong payload:", string(received))
+	}
+
+	received, sendErr, receiveErr = transfer("4821-0937", "4821-0938", payload)
+	if sendErr != ErrWrongCode || receiveErr != ErrWrongCode {
+		t.Fatal("expected ErrWrongCode on both sides, got", sendErr, receiveErr)
+	}
+	if received != nil {
+		t.Fatal("the payload was received with the wrong code")
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	code, err := NewCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^\d{4}-\d{4}$`).MatchString(code) {
+		t.Fatal("unexpected code:", code)
+	}
+}
+
+func TestSpake2Keys(t *testing.T) {
+	sender, err := newSpake2("12345678", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := newSpake2("12345678", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderKeys, err := sender.finish(receiver.share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiverKeys, err := receiver.finish(sender.share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(senderKeys.key, receiverKeys.key) || !bytes.Equal(senderKeys.senderConf, receiverKeys.senderConf) {
+		t.Fatal("the two sides derived different keys")
+	}
+	if _, err = sender.finish([]byte("not a point")); err != errInvalidPoint {
+		t.Fatal("expected errInvalidPoint, got", err)
+	}
+}
@@ -1,19 +1,30 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/avahowell/masterkey/autosave"
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/screenlock"
 	"github.com/avahowell/masterkey/secureclip"
 	"github.com/avahowell/masterkey/vault"
 
 	ui "github.com/gizak/termui"
 )
 
+// spinnerFrames are shown in turn, every spinnerInterval, while the vault's
+// key is being derived.
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+const spinnerInterval = 150 * time.Millisecond
+
 type uiConfig struct {
 	timeout   time.Duration
 	vaultPath string
@@ -22,9 +33,11 @@ type uiConfig struct {
 type masterkeyUI struct {
 	selectedIdx       int
 	lastInputTime     int64
+	clock             clock.Clock
 	genDialog         *ui.Par
 	delDialog         *ui.Par
 	addDialog         *ui.Par
+	notesDialog       *ui.Par
 	flash             *ui.Par
 	searchBar         *ui.Par
 	list              *ui.List
@@ -45,23 +58,86 @@ type masterkeyUI struct {
 	addDialogLocation string
 	addDialogUsername string
 	addDialogPassword string
+	addDialogMasked   bool
 	displayAddDialog  bool
-	v                 *vault.Vault
+	displayNotes      bool
+	locked            bool
+	unlocking         bool
+	lockInput         string
+	lockStatus        string
+	saver             *autosave.Saver
+	cache             *remoteCache
+	// rank orders the list, if the vault tracks usage, by how recently
+	// each location had been used when the UI started. The order is not
+	// updated as locations are used, so the list doesn't move under the
+	// cursor.
+	rank map[string]int
+	// showArchived includes archived locations in the list.
+	showArchived bool
+	v            *vault.Vault
+}
+
+// usageRank returns the position of each location in the vault, most
+// recently used first, or nil if the vault does not track usage.
+func usageRank(v *vault.Vault) map[string]int {
+	if !v.Settings().TrackUsage {
+		return nil
+	}
+	locations, err := v.LocationsByLastUsed()
+	if err != nil {
+		return nil
+	}
+	rank := make(map[string]int)
+	for i, loc := range locations {
+		rank[loc] = i
+	}
+	return rank
 }
 
-func getListItems(v *vault.Vault, selectedIdx int, listHeight int) ([]string, []string) {
-	locations, err := v.Locations()
+// getListItems returns the list items for the vault's locations, ordered by
+// `rank` and then alphabetically, and the locations in the same order.
+// Archived locations are left out unless `showArchived` is set.
+func getListItems(v *vault.Vault, rank map[string]int, showArchived bool, selectedIdx int, listHeight int) ([]string, []string) {
+	all, err := v.Locations()
 	if err != nil {
 		panic(err)
 	}
-	sort.Strings(locations)
+	archivedLocations, err := v.ArchivedLocations()
+	if err != nil {
+		panic(err)
+	}
+	archived := make(map[string]bool)
+	for _, loc := range archivedLocations {
+		archived[loc] = true
+	}
+	var locations []string
+	for _, loc := range all {
+		if showArchived || !archived[loc] {
+			locations = append(locations, loc)
+		}
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		ri, iok := rank[locations[i]]
+		rj, jok := rank[locations[j]]
+		if iok && jok {
+			return ri < rj
+		}
+		if iok != jok {
+			return iok
+		}
+		return locations[i] < locations[j]
+	})
 	var listItems []string
 	for i, loc := range locations {
+		label := loc
+		if archived[loc] {
+			label += " (archived)"
+		}
 		var item string
 		if i == selectedIdx {
-			item = fmt.Sprintf("> %v <", loc)
+			item = fmt.Sprintf("> %v <", label)
 		} else {
-			item = fmt.Sprintf("%v", loc)
+			item = fmt.Sprintf("%v", label)
 		}
 		listItems = append(listItems, item)
 	}
@@ -80,42 +156,46 @@ func newMasterkeyUI(v *vault.Vault, vaultPath string) (*masterkeyUI, error) {
 	ls := ui.NewList()
 	ls.ItemFgColor = ui.ColorYellow
 	ls.Height = ui.TermHeight() - 2
-	ls.BorderLabel = "Passwords"
-	listItems, _ := getListItems(v, 0, ls.Height)
+	ls.BorderLabel = msg.Translate("Passwords")
+	rank := usageRank(v)
+	listItems, _ := getListItems(v, rank, false, 0, ls.Height)
 	ls.Items = listItems
 
 	// search bar
-	spar := ui.NewPar("search: ")
+	spar := ui.NewPar(msg.Translate("search: "))
 	spar.Height = 1
 	spar.Width = 60
 	spar.Border = false
 	spar.Float = ui.AlignBottom
 
 	// buttons
-	enterButton := ui.NewPar("[ enter ](fg-black,bg-white) Copy")
+	enterButton := ui.NewPar("[ enter ](fg-black,bg-white) " + msg.Translate("Copy"))
 	enterButton.Height = 1
 	enterButton.Border = false
-	generateButton := ui.NewPar("[ G ](fg-black,bg-white) Generate")
+	generateButton := ui.NewPar("[ G ](fg-black,bg-white) " + msg.Translate("Generate"))
 	generateButton.Height = 1
 	generateButton.Border = false
-	addButton := ui.NewPar("[ A ](fg-black,bg-white) Add")
+	addButton := ui.NewPar("[ A ](fg-black,bg-white) " + msg.Translate("Add"))
 	addButton.Height = 1
 	addButton.Border = false
-	editButton := ui.NewPar("[ E ](fg-black,bg-white) Edit")
+	editButton := ui.NewPar("[ E ](fg-black,bg-white) " + msg.Translate("Edit"))
 	editButton.Height = 1
 	editButton.Border = false
-	quitButton := ui.NewPar("[ Q ](fg-black,bg-white) Save+Quit")
+	quitButton := ui.NewPar("[ Q ](fg-black,bg-white) " + msg.Translate("Save+Quit"))
 	quitButton.Height = 1
 	quitButton.Border = false
-	searchButton := ui.NewPar("[ / ](fg-black,bg-white) Search")
+	searchButton := ui.NewPar("[ / ](fg-black,bg-white) " + msg.Translate("Search"))
 	searchButton.Height = 1
 	searchButton.Border = false
+	notesButton := ui.NewPar("[ I ](fg-black,bg-white) " + msg.Translate("Notes"))
+	notesButton.Height = 1
+	notesButton.Border = false
 
 	// dialogs
 	genDialogLocation := ""
 	genDialogUsername := ""
 	genDialog := ui.NewPar("")
-	genDialog.BorderLabel = "Generate Login"
+	genDialog.BorderLabel = msg.Translate("Generate Login")
 	genDialog.Float = ui.AlignCenter
 	genDialog.Text = fmt.Sprintf(`Location: %v
 		Username: %v`, genDialogLocation, genDialogUsername)
@@ -123,7 +203,7 @@ func newMasterkeyUI(v *vault.Vault, vaultPath string) (*masterkeyUI, error) {
 	genDialog.Width = 30
 
 	addDialog := ui.NewPar("")
-	addDialog.BorderLabel = "Add Login"
+	addDialog.BorderLabel = msg.Translate("Add Login")
 	addDialog.Float = ui.AlignCenter
 	addDialog.Text = fmt.Sprintf(`Location: %v
 				Username: %v
@@ -132,12 +212,17 @@ func newMasterkeyUI(v *vault.Vault, vaultPath string) (*masterkeyUI, error) {
 	addDialog.Width = 30
 
 	delDialog := ui.NewPar("")
-	delDialog.BorderLabel = "Delete Login"
+	delDialog.BorderLabel = msg.Translate("Delete Login")
 	delDialog.Float = ui.AlignCenter
 	delDialog.Height = 3
 
 	delDialog.Width = 30
 
+	notesDialog := ui.NewPar("")
+	notesDialog.Float = ui.AlignCenter
+	notesDialog.Height = 12
+	notesDialog.Width = 60
+
 	// flash dialog
 	flash := ui.NewPar("")
 	flash.Height = 1
@@ -154,21 +239,25 @@ func newMasterkeyUI(v *vault.Vault, vaultPath string) (*masterkeyUI, error) {
 			ui.NewCol(2, 0, generateButton),
 			ui.NewCol(2, 0, addButton),
 			ui.NewCol(2, 0, editButton),
-			ui.NewCol(2, 0, searchButton),
+			ui.NewCol(1, 0, searchButton),
+			ui.NewCol(1, 0, notesButton),
 			ui.NewCol(2, 0, quitButton),
 		),
 	)
 
 	return &masterkeyUI{
-		lastInputTime: time.Now().Unix(),
+		lastInputTime: time.Now().UnixNano(),
+		clock:         clock.Real,
 		selectedIdx:   0,
 		vaultPath:     vaultPath,
 		genDialog:     genDialog,
 		delDialog:     delDialog,
 		addDialog:     addDialog,
+		notesDialog:   notesDialog,
 		searchBar:     spar,
 		flash:         flash,
 		list:          ls,
+		rank:          rank,
 		v:             v,
 	}, nil
 }
@@ -255,7 +344,7 @@ func (m *masterkeyUI) genDialogInputHandler(inputKey string) error {
 		}
 	}
 	m.genDialog.Text = fmt.Sprintf(`Location: %v
-				Username: %v`, m.genDialogLocation, m.genDialogUsername)
+				Username: %v`, m.genDialogLocation, displayUsername(m.genDialogUsername))
 	return nil
 }
 
@@ -314,7 +403,7 @@ func (m *masterkeyUI) addDialogInputHandler(inputKey string, editMode bool) erro
 	}
 	m.addDialog.Text = fmt.Sprintf(`Location: %v
 				Username: %v
-				Password: %v`, m.addDialogLocation, m.addDialogUsername, m.addDialogPassword)
+				Password: %v`, m.addDialogLocation, m.addDialogUsernameText(), displaySecret(m.addDialogPassword))
 	return nil
 
 }
@@ -353,8 +442,12 @@ func (m *masterkeyUI) inputHandler(inputKey string) error {
 		if err != nil {
 			return err
 		}
-		secureclip.Clip(cred.Password)
-		m.flash.Text = "copied " + m.locations[m.selectedIdx] + " to keyboard, clearing in 30s"
+		if err = secureclip.Clip(cred.Password); err != nil {
+			m.flash.Text = err.Error()
+		} else {
+			m.v.RecordUse(m.locations[m.selectedIdx])
+			m.flash.Text = msg.Sprintf("copied %v to keyboard, clearing in %v", m.locations[m.selectedIdx], secureclip.Timeout())
+		}
 		m.displayFlash = true
 	} else if inputKey == "g" { // gen
 		m.displayGenDialog = true
@@ -363,33 +456,170 @@ func (m *masterkeyUI) inputHandler(inputKey string) error {
 		cred, _ := m.v.Get(m.addDialogLocation)
 		m.addDialogUsername = cred.Username
 		m.addDialogPassword = cred.Password
+		m.addDialogMasked = m.v.MasksUsername(cred)
 		m.addDialog.Text = fmt.Sprintf(`Location: %v
 				Username: %v
-				Password: %v`, m.addDialogLocation, m.addDialogUsername, m.addDialogPassword)
+				Password: %v`, m.addDialogLocation, m.addDialogUsernameText(), displaySecret(m.addDialogPassword))
 		m.addDialogInput = 1
-		m.addDialog.BorderLabel = "Edit Login"
+		m.addDialog.BorderLabel = msg.Translate("Edit Login")
 		m.displayEditDialog = true
+	} else if inputKey == "i" { // notes
+		cred, err := m.v.Get(m.locations[m.selectedIdx])
+		if err != nil {
+			return err
+		}
+		m.notesDialog.BorderLabel = msg.Sprintf("Notes: %v", m.locations[m.selectedIdx])
+		m.notesDialog.Text = displaySecret(cred.Notes)
+		if cred.Notes == "" {
+			m.notesDialog.Text = msg.Translate("no notes. use the notes command in masterkey -repl to add some.")
+		}
+		m.displayNotes = true
 	} else if inputKey == "a" { // add
-		m.addDialog.BorderLabel = "Add Login"
+		m.addDialogMasked = false
+		m.addDialog.BorderLabel = msg.Translate("Add Login")
 		m.displayAddDialog = true
 	} else if inputKey == "d" {
 		m.displayDelDialog = true
-		m.delDialog.Text = fmt.Sprintf("Delete %v? (y/n)", m.locations[m.selectedIdx])
+		m.delDialog.Text = msg.Sprintf("Delete %v? (y/n)", m.locations[m.selectedIdx])
+	} else if inputKey == "P" { // presentation mode
+		setPresentation(!presenting())
+		m.flash.Text = msg.Translate("presentation mode off")
+		if presenting() {
+			m.flash.Text = msg.Translate("presentation mode on, secrets are hidden")
+		}
+		m.displayFlash = true
+	} else if inputKey == "H" { // show or hide archived
+		m.showArchived = !m.showArchived
+		m.selectedIdx = 0
+		m.flash.Text = msg.Translate("archived logins hidden")
+		if m.showArchived {
+			m.flash.Text = msg.Translate("showing archived logins")
+		}
+		m.displayFlash = true
+	} else if inputKey == "L" { // lock
+		m.lock()
 	} else if inputKey == "q" {
 		ui.StopLoop()
 	}
 	return nil
 }
 
+// addDialogUsernameText returns the username shown in the add and edit
+// dialogs, masked if it is sensitive or in presentation mode.
+func (m *masterkeyUI) addDialogUsernameText() string {
+	if m.addDialogMasked {
+		return maskUsername(m.addDialogUsername)
+	}
+	return displayUsername(m.addDialogUsername)
+}
+
+// lock flushes any pending autosave, clears the clipboard, wipes the vault's
+// key, and the passphrase of its server's copy, and shows the lock screen. Everything else about the UI is kept, so
+// the user returns to where they were once they unlock it.
+func (m *masterkeyUI) lock() {
+	if m.saver != nil {
+		m.saver.Flush()
+	}
+	secureclip.Clear()
+	m.v.Lock()
+	if m.cache != nil {
+		m.cache.lock()
+	}
+	m.locked = true
+	m.lockInput = ""
+	m.lockStatus = msg.Translate("vault locked, enter the master password to unlock")
+}
+
+// lockFor locks the UI, if it is not locked already, because of `ev`.
+func (m *masterkeyUI) lockFor(ev screenlock.Event) {
+	if m.locked {
+		return
+	}
+	m.lock()
+	m.lockStatus = msg.Sprintf("vault locked because %v, enter the master password to unlock", msg.Translate(ev.String()))
+	m.render()
+}
+
+// lockInputHandler handles the keys pressed on the lock screen.
+func (m *masterkeyUI) lockInputHandler(inputKey string) {
+	if m.unlocking {
+		return
+	}
+	if inputKey == "C-8" { // backspace
+		if len(m.lockInput) > 0 {
+			m.lockInput = m.lockInput[:len(m.lockInput)-1]
+		}
+	} else if inputKey == "C-c" {
+		ui.StopLoop()
+	} else if inputKey == "<space>" {
+		m.lockInput += " "
+	} else if inputKey == "<enter>" {
+		m.unlocking = true
+		go m.unlock(m.lockInput)
+		m.lockInput = ""
+	} else {
+		m.lockInput += inputKey
+	}
+}
+
+// unlock derives the vault's key from `pw`, animating a spinner on the lock
+// screen meanwhile, and returns to where the user was if it is correct.
+func (m *masterkeyUI) unlock(pw string) {
+	stop := spin(func(frame string) {
+		m.lockStatus = frame + " " + msg.Translate("deriving argon2id key, one moment")
+		m.render()
+	})
+	err := m.v.Unlock(pw)
+	stop()
+
+	m.unlocking = false
+	if err != nil {
+		m.lockStatus = err.Error()
+	} else {
+		m.locked = false
+		if m.cache != nil {
+			m.cache.unlock(pw)
+		}
+	}
+	m.render()
+}
+
+// spin calls render with successive spinnerFrames every spinnerInterval
+// until the returned function is called, which waits for it to stop.
+func spin(render func(frame string)) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			render(spinnerFrames[frame%len(spinnerFrames)])
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
 func (m *masterkeyUI) run() error {
-	m.list.Items, m.locations = getListItems(m.v, m.selectedIdx, m.list.Height)
+	m.list.Items, m.locations = getListItems(m.v, m.rank, m.showArchived, m.selectedIdx, m.list.Height)
 	ui.Handle("/sys/kbd", func(e ui.Event) {
-		atomic.StoreInt64(&m.lastInputTime, time.Now().Unix())
+		atomic.StoreInt64(&m.lastInputTime, m.clock.Now().UnixNano())
 		inputKey := e.Data.(ui.EvtKbd).KeyStr
 
-		// search functionality
-		if m.searching {
+		if m.locked {
+			m.lockInputHandler(inputKey)
+		} else if m.searching { // search functionality
 			m.searchInputHandler(inputKey)
+		} else if m.displayNotes { // any key closes the notes
+			m.displayNotes = false
 		} else if m.displayDelDialog {
 			m.delDialogInputHandler(inputKey)
 		} else if m.displayGenDialog { // gen dialog functionality
@@ -401,30 +631,7 @@ func (m *masterkeyUI) run() error {
 		} else {
 			m.inputHandler(inputKey)
 		}
-		m.list.Items, m.locations = getListItems(m.v, m.selectedIdx, m.list.Height)
-		m.searchBar.Text = "search: " + m.searchText
-		ui.Clear()
-		ui.Render(ui.Body)
-		if m.searching {
-			ui.Render(m.searchBar)
-		}
-		if m.displayFlash {
-			m.displayFlash = false
-			ui.Render(m.flash)
-		}
-		if m.displayGenDialog {
-			ui.Render(m.genDialog)
-		}
-		if m.displayAddDialog {
-			ui.Render(m.addDialog)
-		}
-		if m.displayEditDialog {
-			m.addDialogLocation = m.locations[m.selectedIdx]
-			ui.Render(m.addDialog)
-		}
-		if m.displayDelDialog {
-			ui.Render(m.delDialog)
-		}
+		m.render()
 	})
 	ui.Handle("/sys/wnd/resize", func(ui.Event) {
 		if ui.TermWidth() > 20 {
@@ -435,6 +642,10 @@ func (m *masterkeyUI) run() error {
 		}
 
 		ui.Body.Align()
+		if m.locked {
+			m.render()
+			return
+		}
 		ui.Clear()
 		ui.Render(ui.Body)
 		if m.displayGenDialog {
@@ -444,18 +655,60 @@ func (m *masterkeyUI) run() error {
 	ui.Clear()
 	ui.Body.Align()
 	ui.Render(ui.Body)
+	if n := m.v.Recovered(); n > 0 {
+		m.flash.Text = msg.Sprintf("recovered %v unsaved changes", n)
+	}
+	if m.flash.Text != "" {
+		ui.Render(m.flash)
+	}
 	ui.Loop()
 
 	return nil
 }
 
+// render redraws the UI, or the lock screen if the vault is locked.
+func (m *masterkeyUI) render() {
+	if m.locked {
+		ui.Clear()
+		ui.Render(masterPasswordInput(len(m.lockInput), m.lockStatus)...)
+		return
+	}
+	m.list.Items, m.locations = getListItems(m.v, m.rank, m.showArchived, m.selectedIdx, m.list.Height)
+	m.searchBar.Text = msg.Translate("search: ") + m.searchText
+	ui.Clear()
+	ui.Render(ui.Body)
+	if m.searching {
+		ui.Render(m.searchBar)
+	}
+	if m.displayFlash {
+		m.displayFlash = false
+		ui.Render(m.flash)
+	}
+	if m.displayGenDialog {
+		ui.Render(m.genDialog)
+	}
+	if m.displayAddDialog {
+		ui.Render(m.addDialog)
+	}
+	if m.displayEditDialog {
+		m.addDialogLocation = m.locations[m.selectedIdx]
+		ui.Render(m.addDialog)
+	}
+	if m.displayDelDialog {
+		ui.Render(m.delDialog)
+	}
+	if m.displayNotes {
+		ui.Render(m.notesDialog)
+	}
+}
+
 func masterPasswordInput(pwLen int, errorstring string) []ui.Bufferer {
 	input := ui.NewPar("")
 	input.Height = 3
 	input.Width = 50
 	input.Text = strings.Repeat("*", pwLen)
 	input.TextFgColor = ui.ColorWhite
-	input.BorderLabel = "Master Password"
+	input.BorderLabel = msg.Translate("Master Password")
 	input.BorderFg = ui.ColorCyan
 	input.Float = ui.AlignCenter
 	errorbox := ui.NewPar(errorstring)
@@ -467,21 +720,111 @@ func masterPasswordInput(pwLen int, errorstring string) []ui.Bufferer {
 
 	return []ui.Bufferer{errorbox, input}
 }
-func runUI(vaultPath string, timeout time.Duration) {
-	err := ui.Init()
+func runUI(vaultPath string, timeouts timeoutFlags, autosaveVault bool, screenLock string, cache *remoteCache) {
+	f, err := vault.ReadFile(vaultPath)
+	if err != nil {
+		die(openError(vaultPath, err))
+	}
+	defer f.Close()
+
+	err = ui.Init()
 	if err != nil {
 		panic(err)
 	}
 	defer ui.Close()
 
 	var v *vault.Vault
-
+	var vpass string
+	var loginErr error
+
+	// the login handlers run concurrently, and while a key is being derived
+	// the spinner is animated from another goroutine, so the login state is
+	// guarded by mu. cancel is non-nil while a key is being derived.
+	var mu sync.Mutex
+	var cancel context.CancelFunc
 	pw := ""
+	attempts := 0
 	errorstring := ""
 	pwInput := masterPasswordInput(len(pw), errorstring)
+
+	// unlock derives the key for `passphrase` in the background, animating
+	// a spinner until it is done or cancelled. mu must be held.
+	unlock := func(passphrase string) {
+		ctx, c := context.WithCancel(context.Background())
+		cancel = c
+		done := make(chan error, 1)
+		go func() {
+			vopen, err := f.DecryptContext(ctx, passphrase, openOptions...)
+			mu.Lock()
+			if err == nil {
+				v = vopen
+				vpass = passphrase
+			}
+			mu.Unlock()
+			done <- err
+		}()
+		go func() {
+			ticker := time.NewTicker(spinnerInterval)
+			defer ticker.Stop()
+			for frame := 0; ; frame++ {
+				mu.Lock()
+				if ctx.Err() != nil {
+					// cancelled, the prompt has already been restored
+					mu.Unlock()
+					return
+				}
+				errorstring = fmt.Sprintf("%v deriving argon2id key, press Esc to cancel", spinnerFrames[frame%len(spinnerFrames)])
+				pwInput = masterPasswordInput(len(pw), errorstring)
+				ui.Render(pwInput...)
+				mu.Unlock()
+
+				select {
+				case <-ticker.C:
+					continue
+				case err := <-done:
+					mu.Lock()
+					cancel = nil
+					if err == context.Canceled {
+						mu.Unlock()
+						return
+					}
+					if err == nil {
+						ui.StopLoop()
+						mu.Unlock()
+						return
+					}
+					errorstring = openError(vaultPath, err).Error()
+					if err == vault.ErrWrongPassphrase {
+						attempts++
+					}
+					if attempts >= maxPassphraseAttempts {
+						loginErr = fmt.Errorf("too many incorrect passphrase attempts for %v", vaultPath)
+						ui.StopLoop()
+					}
+					pwInput = masterPasswordInput(len(pw), errorstring)
+					ui.Render(pwInput...)
+					mu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+
 	ui.Handle("/sys/kbd", func(e ui.Event) {
+		mu.Lock()
+		defer mu.Unlock()
 		inputKey := e.Data.(ui.EvtKbd).KeyStr
-		if inputKey == "C-8" { // backspace
+		if cancel != nil {
+			// only Esc and C-c are handled while a key is being derived
+			if inputKey == "<escape>" || inputKey == "C-c" {
+				cancel()
+				cancel = nil
+				errorstring = "unlock cancelled"
+			}
+			if inputKey == "C-c" {
+				ui.StopLoop()
+			}
+		} else if inputKey == "C-8" { // backspace
 			if len(pw) > 0 {
 				pw = pw[:len(pw)-1]
 			}
@@ -491,17 +834,9 @@ func runUI(vaultPath string, timeout time.Duration) {
 			pw = pw + " "
 		} else if inputKey == "<enter>" {
 			// handle login
-			errorstring = "deriving argon2id key, one moment"
-			pwInput = masterPasswordInput(len(pw), errorstring)
-			ui.Render(pwInput...)
-			vopen, err := vault.Open(vaultPath, pw)
-			if err != nil {
-				errorstring = err.Error()
-			} else {
-				v = vopen
-				pw = ""
-				ui.StopLoop()
-			}
+			unlock(pw)
+			pw = ""
+			return
 		} else {
 			pw = pw + inputKey
 		}
@@ -509,6 +844,8 @@ func runUI(vaultPath string, timeout time.Duration) {
 		ui.Render(pwInput...)
 	})
 	ui.Handle("/sys/wnd/resize", func(ui.Event) {
+		mu.Lock()
+		defer mu.Unlock()
 		if ui.TermWidth() > 20 {
 			ui.Body.Width = ui.TermWidth()
 		}
@@ -519,32 +856,71 @@ func runUI(vaultPath string, timeout time.Duration) {
 	ui.Render(pwInput...)
 	ui.Loop()
 
+	mu.Lock()
+	if cancel != nil {
+		cancel()
+	}
+	mu.Unlock()
 	if v == nil {
+		if loginErr != nil {
+			ui.Close()
+			f.Close()
+			die(loginErr)
+		}
 		return
 	}
 
 	// we have an initialzed vault now
 	defer func() {
 		v.Save(vaultPath)
+		if cache != nil {
+			cache.Close()
+		}
 		secureclip.Clear()
 		v.Close()
 	}()
+	var saver *autosave.Saver
+	if autosaveVault {
+		saver = enableAutosave(v, vaultPath)
+		defer saver.Close()
+	}
 
 	mui, err := newMasterkeyUI(v, vaultPath)
 	if err != nil {
 		panic(err)
 	}
-
-	go func() {
-		for {
-			time.Sleep(time.Second)
-
-			if time.Since(time.Unix(atomic.LoadInt64(&mui.lastInputTime), 0)) > timeout {
-				ui.StopLoop()
-				return
-			}
+	mui.saver = saver
+	if f.Outdated() {
+		mui.flash.Text = msg.Translate("upgraded from an older format, saved on quit")
+	}
+	if cache != nil {
+		mui.cache = cache
+		cache.report = func(msg string) {
+			mui.flash.Text = strings.TrimSpace(msg)
+			mui.render()
 		}
-	}()
+		mui.flash.Text = strings.TrimSpace(cache.start(v, vpass))
+	}
+
+	timeout, clipboard := effectiveTimeouts(v.Settings(), timeouts)
+	secureclip.SetTimeout(clipboard)
+	go mui.idleTimeout(timeout, ui.StopLoop)
+	defer watchScreenLock(screenLock, mui.lockFor, func(screenlock.Event) {
+		ui.StopLoop()
+	})()
 
 	mui.run()
 }
+
+// idleTimeout calls stop once no key has been pressed for `timeout`.
+func (m *masterkeyUI) idleTimeout(timeout time.Duration, stop func()) {
+	for {
+		last := time.Unix(0, atomic.LoadInt64(&m.lastInputTime))
+		remaining := timeout - m.clock.Now().Sub(last)
+		if remaining <= 0 {
+			stop()
+			return
+		}
+		<-m.clock.After(remaining)
+	}
+}
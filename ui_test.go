@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/clock"
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestUIIdleTimeout(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	m := &masterkeyUI{
+		clock:         c,
+		lastInputTime: c.Now().UnixNano(),
+	}
+
+	stopped := make(chan struct{})
+	go m.idleTimeout(time.Minute, func() { close(stopped) })
+
+	c.Advance(time.Second * 59)
+	select {
+	case <-stopped:
+		t.Fatal("ui stopped before the timeout elapsed")
+	default:
+	}
+
+	c.Advance(time.Second)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("ui did not stop after the timeout elapsed")
+	}
+}
+
+func TestSpin(t *testing.T) {
+	frames := make(chan string, 1)
+	stop := spin(func(frame string) {
+		select {
+		case frames <- frame:
+		default:
+		}
+	})
+	if frame := <-frames; frame != spinnerFrames[0] {
+		t.Fatal("expected the first frame to be rendered, got", frame)
+	}
+	stop()
+
+	// drain a frame rendered before stop, then make sure no more follow.
+	select {
+	case <-frames:
+	default:
+	}
+	select {
+	case frame := <-frames:
+		t.Fatal("frame rendered after stop:", frame)
+	case <-time.After(2 * spinnerInterval):
+	}
+}
+
+func TestListItemsUsageRank(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	for _, location := range []string{"a", "b", "c", "d"} {
+		if err = v.Add(location, vault.Credential{Password: "testpass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if usageRank(v) != nil {
+		t.Fatal("expected no rank for a vault that does not track usage")
+	}
+
+	rank := map[string]int{"c": 0, "a": 1}
+	_, locations := getListItems(v, rank, false, 0, 20)
+	if !reflect.DeepEqual(locations, []string{"c", "a", "b", "d"}) {
+		t.Fatal("unexpected order", locations)
+	}
+	_, locations = getListItems(v, nil, false, 0, 20)
+	if !reflect.DeepEqual(locations, []string{"a", "b", "c", "d"}) {
+		t.Fatal("unexpected order", locations)
+	}
+}
+
+func TestListItemsArchived(t *testing.T) {
+	v, err := vault.New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	for _, location := range []string{"a", "b", "c"} {
+		if err = v.Add(location, vault.Credential{Password: "testpass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = v.SetArchived("b", true); err != nil {
+		t.Fatal(err)
+	}
+
+	_, locations := getListItems(v, nil, false, 0, 20)
+	if !reflect.DeepEqual(locations, []string{"a", "c"}) {
+		t.Fatal("archived location listed", locations)
+	}
+	items, locations := getListItems(v, nil, true, 0, 20)
+	if !reflect.DeepEqual(locations, []string{"a", "b", "c"}) {
+		t.Fatal("archived location not listed", locations)
+	}
+	if items[1] != "b (archived)" {
+		t.Fatalf("unexpected item %q", items[1])
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+// describeOutdated describes the format of an outdated vault file.
+func describeOutdated(f *vault.File) string {
+	if f.Legacy() {
+		return "the original vault format, whose key is derived using scrypt"
+	}
+	return "an older vault format"
+}
+
+// offerUpgrade tells the user that the vault at vaultPath, opened from `f`,
+// is in an outdated format and offers to save it in the current format now,
+// rather than whenever it is next saved.
+func offerUpgrade(f *vault.File, v *vault.Vault, vaultPath string) error {
+	if !f.Outdated() {
+		return nil
+	}
+	fmt.Printf("%v is in %v. It has been upgraded in memory.\n", vaultPath, describeOutdated(f))
+	ok, err := askYesNo("Save it in the current format now?")
+	if err != nil || !ok {
+		return err
+	}
+	if err = v.Save(vaultPath); err != nil {
+		return err
+	}
+	inform(fmt.Sprintf("%v upgraded\n", vaultPath))
+	return nil
+}
+
+// vaultFiles returns the files named by `paths`, expanding directories to
+// the files directly inside them, and the split vaults among them. Lock
+// files, journals, device keys, pending markers, temporary files and hidden
+// files are left out.
+func vaultFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() || vault.IsSplit(path) {
+			files = append(files, path)
+			continue
+		}
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if info.IsDir() && vault.IsSplit(filepath.Join(path, name)) {
+				files = append(files, filepath.Join(path, name))
+				continue
+			}
+			if info.IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "masterkey-temp") ||
+				strings.HasSuffix(name, ".lck") || strings.HasSuffix(name, ".journal") || strings.HasSuffix(name, deviceSuffix) ||
+				strings.HasSuffix(name, pendingSuffix) {
+				continue
+			}
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+	return files, nil
+}
+
+// upgradeVaults rewrites each outdated vault named in args, or found in a
+// directory named in args, in the current format. The passphrase of each is
+// asked for first, then their keys are derived in parallel.
+func upgradeVaults(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("upgrade requires at least one argument, a vault or a directory of vaults")
+	}
+	files, err := vaultFiles(args)
+	if err != nil {
+		return err
+	}
+
+	var reqs []vault.DecryptRequest
+	var paths []string
+	defer func() {
+		for _, req := range reqs {
+			req.File.Close()
+		}
+	}()
+	current := 0
+	for _, path := range files {
+		f, err := vault.ReadFile(path)
+		if err == vault.ErrUnknownFormat {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("skipping %v: %v\n", path, openError(path, err))
+			continue
+		}
+		if !f.Outdated() {
+			f.Close()
+			current++
+			continue
+		}
+		fmt.Printf("%v is in %v.\n", path, describeOutdated(f))
+		pass, err := askPassword("Password for " + path + ": ")
+		if err != nil {
+			f.Close()
+			return err
+		}
+		reqs = append(reqs, vault.DecryptRequest{File: f, Passphrase: pass})
+		paths = append(paths, path)
+	}
+
+	vaults, errs := vault.DecryptAll(reqs, 0)
+	upgraded := 0
+	for i, v := range vaults {
+		if errs[i] != nil {
+			fmt.Printf("could not upgrade %v: %v\n", paths[i], openError(paths[i], errs[i]))
+			continue
+		}
+		err := v.Save(paths[i])
+		v.Close()
+		if err != nil {
+			fmt.Printf("could not upgrade %v: %v\n", paths[i], err)
+			continue
+		}
+		upgraded++
+	}
+	fmt.Printf("%v vaults upgraded, %v already current, %v failed\n", upgraded, current, len(reqs)-upgraded)
+	if upgraded < len(reqs) {
+		return fmt.Errorf("some vaults could not be upgraded")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/avahowell/masterkey/vault"
+)
+
+func TestVaultFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.db", "b.db", "b.db.lck", "a.db.journal", ".hidden", "masterkey-temp123"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := vaultFiles([]string{dir, "vault/testdata/oldvault.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "a.db"), filepath.Join(dir, "b.db"), "vault/testdata/oldvault.db"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("expected %v, got %v", expected, files)
+	}
+}
+
+func TestOfferUpgrade(t *testing.T) {
+	defer func(f func(string) (bool, error)) { askYesNo = f }(askYesNo)
+	askYesNo = func(string) (bool, error) { return true, nil }
+
+	dir, err := ioutil.TempDir("", "masterkey-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vaultPath := filepath.Join(dir, "old.db")
+	bs, err := ioutil.ReadFile("vault/testdata/oldvault.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(vaultPath, bs, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := vault.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := f.Decrypt("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = offerUpgrade(f, v, vaultPath)
+	v.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = vault.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Outdated() {
+		t.Fatal("vault was not saved in the current format")
+	}
+}
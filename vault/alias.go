@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// aliasesMeta is the reserved meta tag that lists the aliases of a
+// credential, one per line. Storing aliases with the credential they refer
+// to means they are deleted along with it.
+const aliasesMeta = ReservedMetaPrefix + "aliases"
+
+var (
+	// ErrAliasExists is returned when an alias is added at a location that
+	// is already a credential or an alias, or a credential is added at the
+	// location of an alias.
+	ErrAliasExists = errors.New("an alias or credential already exists at that location")
+
+	// ErrNoSuchAlias is returned from DeleteAlias if the alias does not
+	// exist.
+	ErrNoSuchAlias = errors.New("alias does not exist")
+
+	// ErrIsAlias is returned from Delete if the location is an alias, so
+	// that a credential can not be deleted by one of its aliases.
+	ErrIsAlias = errors.New("location is an alias, delete the alias instead")
+)
+
+// Aliases returns the aliases of the credential, sorted.
+func (c Credential) Aliases() []string {
+	if c.Meta[aliasesMeta] == "" {
+		return nil
+	}
+	return strings.Split(c.Meta[aliasesMeta], "\n")
+}
+
+// setAliases stores `aliases` in the credential's reserved meta.
+func (c *Credential) setAliases(aliases []string) {
+	if len(aliases) == 0 {
+		delete(c.Meta, aliasesMeta)
+		return
+	}
+	sort.Strings(aliases)
+	if c.Meta == nil {
+		c.Meta = make(map[string]string)
+	}
+	c.Meta[aliasesMeta] = strings.Join(aliases, "\n")
+}
+
+// aliasTarget returns the location of the credential in `creds` that has
+// `alias` as an alias.
+func aliasTarget(creds map[string]*Credential, alias string) (string, bool) {
+	for location, cred := range creds {
+		for _, a := range cred.Aliases() {
+			if a == alias {
+				return location, true
+			}
+		}
+	}
+	return "", false
+}
+
+// AddAlias makes `alias` refer to the credential at `location`, so that Get,
+// Find and the other methods that take a location resolve `alias` to it.
+// Like locations, aliases must be valid according to the vault's Settings
+// and are normalized before use.
+func (v *Vault) AddAlias(alias string, location string) error {
+	if err := validateLocation(alias, v.Settings().MaxLocationLength); err != nil {
+		return err
+	}
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	alias = v.normalizeLocation(alias)
+	if _, exists := creds[alias]; exists {
+		return ErrAliasExists
+	}
+	if _, exists := aliasTarget(creds, alias); exists {
+		return ErrAliasExists
+	}
+	location = v.resolveLocation(creds, location)
+	cred, exists := creds[location]
+	if !exists {
+		return ErrNoSuchCredential
+	}
+
+	cred.setAliases(append(cred.Aliases(), alias))
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
+}
+
+// DeleteAlias removes `alias`. The credential it referred to is unchanged.
+func (v *Vault) DeleteAlias(alias string) error {
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	location, exists := aliasTarget(creds, alias)
+	if !exists {
+		location, exists = aliasTarget(creds, v.normalizeLocation(alias))
+		alias = v.normalizeLocation(alias)
+	}
+	if !exists {
+		return ErrNoSuchAlias
+	}
+
+	cred := creds[location]
+	var aliases []string
+	for _, a := range cred.Aliases() {
+		if a != alias {
+			aliases = append(aliases, a)
+		}
+	}
+	cred.setAliases(aliases)
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
+}
+
+// Aliases returns every alias in the vault, mapped to the location it refers
+// to.
+func (v *Vault) Aliases() (map[string]string, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	aliases := make(map[string]string)
+	for location, cred := range creds {
+		for _, alias := range cred.Aliases() {
+			aliases[alias] = location
+		}
+	}
+	return aliases, nil
+}
@@ -0,0 +1,39 @@
+package vault
+
+import "sort"
+
+// archivedMeta is the reserved meta tag set on archived credentials.
+const archivedMeta = ReservedMetaPrefix + "archived"
+
+// Archived returns true if the credential has been archived using
+// SetArchived.
+func (c Credential) Archived() bool {
+	return c.Meta[archivedMeta] == "true"
+}
+
+// SetArchived archives the credential at `location`, or restores it. Archived
+// credentials are kept in the vault, but left out of everyday listings.
+func (v *Vault) SetArchived(location string, archived bool) error {
+	value := ""
+	if archived {
+		value = "true"
+	}
+	return v.setReservedMeta(location, archivedMeta, value)
+}
+
+// ArchivedLocations returns the locations of the archived credentials in the
+// vault, sorted.
+func (v *Vault) ArchivedLocations() ([]string, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	var locations []string
+	for location, cred := range creds {
+		if cred.Archived() {
+			locations = append(locations, location)
+		}
+	}
+	sort.Strings(locations)
+	return locations, nil
+}
@@ -0,0 +1,154 @@
+package vault
+
+import "time"
+
+// Tx is a set of changes made to a vault by the function passed to Batch.
+// Its methods work like the Vault methods of the same name, but their
+// changes are only seen through the Tx until Batch commits them.
+type Tx struct {
+	v     *Vault
+	creds map[string]*Credential
+
+	// old holds the credential at each location the Tx changed, as it was
+	// before the first change, for Undo.
+	old     map[string]*Credential
+	entries []journalEntry
+	events  []Event
+}
+
+// Batch calls `fn` with a Tx and commits the changes it makes as a single
+// change, so that the vault is decrypted and encrypted once however many
+// credentials are added, edited or deleted. If `fn` returns an error, none
+// of its changes are made. A single Undo reverts them all.
+func (v *Vault) Batch(fn func(tx *Tx) error) error {
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	tx := &Tx{v: v, creds: creds, old: make(map[string]*Credential)}
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if len(tx.entries) == 0 {
+		return nil
+	}
+
+	step := newUndoStep(tx.old, tx.entries)
+	if err = v.write(creds, tx.entries...); err != nil {
+		return err
+	}
+	v.pushUndo(step)
+	for _, ev := range tx.events {
+		v.publish(ev)
+	}
+	return nil
+}
+
+// set replaces the credential at `location` with `cred`, or deletes it if
+// `cred` is nil, and records the change as an event of type `typ`.
+func (tx *Tx) set(location string, cred *Credential, typ EventType) {
+	if _, changed := tx.old[location]; !changed {
+		tx.old[location] = tx.creds[location]
+	}
+	if cred == nil {
+		delete(tx.creds, location)
+	} else {
+		tx.creds[location] = cred
+	}
+	tx.entries = append(tx.entries, journalEntry{Location: location, Credential: cred})
+	tx.events = append(tx.events, Event{Type: typ, Location: location})
+}
+
+// Get returns a copy of the credential at `location`, including the changes
+// made by the Tx.
+func (tx *Tx) Get(location string) (*Credential, error) {
+	cred, exists := tx.creds[tx.v.resolveLocation(tx.creds, location)]
+	if !exists {
+		return nil, ErrNoSuchCredential
+	}
+	c := *cred
+	return &c, nil
+}
+
+// Add adds `credential` at `location`, as Vault.Add does.
+func (tx *Tx) Add(location string, credential Credential) error {
+	if err := validateLocation(location, tx.v.Settings().MaxLocationLength); err != nil {
+		return err
+	}
+	if err := checkTags(credential.Tags); err != nil {
+		return err
+	}
+	credential.Meta = stripReservedMeta(credential.Meta)
+	credential.Tags = normalizeTags(credential.Tags)
+	credential.Folder = CleanFolder(credential.Folder)
+	credential.ID = ""
+	credential.History = nil
+	credential.CreatedAt, credential.ModifiedAt = time.Time{}, time.Time{}
+	return tx.add(tx.v.normalizeLocation(location), credential)
+}
+
+// add adds `credential` at `location` as-is.
+func (tx *Tx) add(location string, credential Credential) error {
+	if _, exists := tx.creds[location]; exists {
+		return ErrCredentialExists
+	}
+	if _, exists := aliasTarget(tx.creds, location); exists {
+		return ErrAliasExists
+	}
+
+	// keep the ID of a credential merged from another vault, unless it
+	// is already in use
+	for _, cred := range tx.creds {
+		if cred.ID == credential.ID {
+			credential.ID = ""
+			break
+		}
+	}
+	if !validID(credential.ID) {
+		credential.ID = newID()
+	}
+
+	tx.set(location, &credential, EventAdd)
+	return nil
+}
+
+// Edit replaces the credential at `location` with `credential`, as
+// Vault.Edit does.
+func (tx *Tx) Edit(location string, credential Credential) error {
+	location = tx.v.resolveLocation(tx.creds, location)
+	oldcred, ok := tx.creds[location]
+	if !ok {
+		return ErrNoSuchCredential
+	}
+
+	password := credential.Password
+	credential.Password = oldcred.Password
+	credential.Notes = oldcred.Notes
+	credential.URL = oldcred.URL
+	credential.Email = oldcred.Email
+	credential.Icon = oldcred.Icon
+	credential.Meta = oldcred.Meta
+	credential.Folder = oldcred.Folder
+	credential.Tags = oldcred.Tags
+	credential.ID = oldcred.ID
+	credential.History = oldcred.History
+	credential.CreatedAt = oldcred.CreatedAt
+	credential.setPassword(password)
+
+	tx.set(location, &credential, EventEdit)
+	return nil
+}
+
+// Delete removes the credential at `location`, as Vault.Delete does.
+func (tx *Tx) Delete(location string) error {
+	resolved := tx.v.resolveLocation(tx.creds, location)
+	if _, exists := tx.creds[resolved]; exists && resolved != location && resolved != tx.v.normalizeLocation(location) {
+		return ErrIsAlias
+	}
+	if _, exists := tx.creds[resolved]; !exists {
+		return ErrNoSuchCredential
+	}
+
+	tx.set(resolved, nil, EventDelete)
+	return nil
+}
@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrEntryID is returned from ApplyEntries if an entry's ID is not that of
+// the credential at its location, such as when it has been renamed or
+// replaced since the entry was written.
+var ErrEntryID = errors.New("id does not match the credential at that location")
+
+// EntryChange describes how ApplyEntries changes the credential at
+// Location: Fields names the fields that change, such as tags or notes.
+type EntryChange struct {
+	Location string
+	Fields   []string
+}
+
+// ApplyEntries updates the credentials at the locations of `entries` to
+// match them, as edited from the entries of NewEntry, as a single Batch.
+// Every field but the icon is replaced, except that an empty username or
+// password is left as it is, so that entries written without secrets can be
+// applied. Credentials without an entry are left alone.
+//
+// The entries are checked before anything changes: every location must
+// exist, and appear once, each ID given must be the credential's, and tags
+// and meta tags must be valid. If `dryRun` is set, the changes are
+// returned but not made.
+func (v *Vault) ApplyEntries(entries []Entry, dryRun bool) ([]EntryChange, error) {
+	var changes []EntryChange
+	err := v.Batch(func(tx *Tx) error {
+		seen := make(map[string]bool)
+		for _, entry := range entries {
+			location := entry.Location
+			old, exists := tx.creds[location]
+			if !exists {
+				return fmt.Errorf("%v: %v", location, ErrNoSuchCredential)
+			}
+			if seen[location] {
+				return fmt.Errorf("%v appears more than once", location)
+			}
+			seen[location] = true
+			if entry.ID != "" && entry.ID != old.ID {
+				return fmt.Errorf("%v: %v", location, ErrEntryID)
+			}
+			if err := checkTags(entry.Tags); err != nil {
+				return fmt.Errorf("%v: %v", location, err)
+			}
+			for name := range entry.Meta {
+				if IsReservedMeta(name) {
+					return fmt.Errorf("%v: meta tag %v is reserved", location, name)
+				}
+			}
+
+			cred := *old
+			var fields []string
+			setString := func(name string, field *string, value string) {
+				if *field != value {
+					*field = value
+					fields = append(fields, name)
+				}
+			}
+			if entry.Username != "" {
+				setString("username", &cred.Username, entry.Username)
+			}
+			if entry.Password != "" && entry.Password != cred.Password {
+				cred.History = append([]PasswordChange(nil), old.History...)
+				cred.setPassword(entry.Password)
+				fields = append(fields, "password")
+			}
+			setString("url", &cred.URL, entry.URL)
+			setString("email", &cred.Email, entry.Email)
+			setString("folder", &cred.Folder, CleanFolder(entry.Folder))
+			if tags := normalizeTags(entry.Tags); !sameStrings(tags, old.Tags) {
+				cred.Tags = tags
+				fields = append(fields, "tags")
+			}
+			if meta := old.UserMeta(); !(len(meta) == 0 && len(entry.Meta) == 0) && !reflect.DeepEqual(meta, entry.Meta) {
+				cred.Meta = make(map[string]string)
+				for name, value := range old.Meta {
+					if IsReservedMeta(name) {
+						cred.Meta[name] = value
+					}
+				}
+				for name, value := range entry.Meta {
+					cred.Meta[name] = value
+				}
+				fields = append(fields, "meta")
+			}
+			setString("notes", &cred.Notes, entry.Notes)
+
+			if len(fields) == 0 {
+				continue
+			}
+			changes = append(changes, EntryChange{Location: location, Fields: fields})
+			if !dryRun {
+				tx.set(location, &cred, EventEdit)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// sameStrings returns true if `a` and `b` hold the same strings in the same
+// order, treating nil and empty as the same.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,366 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// DuressAction is what happens when a vault is opened using its duress
+// passphrase, rather than its master passphrase.
+type DuressAction byte
+
+const (
+	// DuressNone means no duress passphrase is set.
+	DuressNone DuressAction = iota
+	// DuressDecoy opens the decoy vault in place of the real one: a second
+	// set of credentials, empty to begin with, that is stored sealed under
+	// the duress passphrase in the same file. Saving the decoy leaves the
+	// real vault untouched.
+	DuressDecoy
+	// DuressWipe overwrites the vault file and its journal with random
+	// data and deletes them, then opens an empty vault in their place.
+	DuressWipe
+)
+
+const (
+	// shortDuressLen is the length of the sealed duress passphrases
+	// written before formatV4: the argon2id parameters, salt and nonce,
+	// followed by the action sealed under the key derived from the duress
+	// passphrase.
+	shortDuressLen = 4 + 4 + 1 + 24 + 24 + 1 + secretbox.Overhead
+
+	// decoySize is the space in a sealed duress passphrase for the decoy
+	// vault's credentials. The space is always filled with padding, so the
+	// size of the file does not change with the decoy's contents.
+	decoySize = 16 << 10
+
+	// duressLen is the length of the sealed duress passphrase stored in
+	// vault files since formatV4, which also holds the decoy's credentials.
+	duressLen = shortDuressLen + decoySize
+)
+
+var (
+	// ErrDuressIsPassphrase is returned from SetDuressPassphrase if the
+	// duress passphrase is the master passphrase, and from
+	// ChangePassphrase if the new passphrase is the duress passphrase.
+	ErrDuressIsPassphrase = errors.New("the duress passphrase must differ from the master passphrase")
+
+	// ErrInvalidDuressAction is returned from SetDuressPassphrase if the
+	// action is not DuressDecoy or DuressWipe.
+	ErrInvalidDuressAction = errors.New("the duress action must be decoy or wipe")
+
+	// ErrDecoyTooLarge is returned from Save if the decoy vault's
+	// credentials do not fit in the space kept for them in the vault file.
+	ErrDecoyTooLarge = errors.New("the decoy vault is too large to save. It can hold up to 16 KiB of credentials")
+)
+
+// duressError is returned by openVault if the passphrase is the vault's
+// duress passphrase. It carries what the decoy vault needs to be opened and
+// saved.
+type duressError struct {
+	action DuressAction
+	decoy  map[string]*Credential
+	key    duressKey
+	file   vaultFile
+}
+
+func (e duressError) Error() string {
+	return "duress passphrase entered"
+}
+
+// duressKey is a key derived from a duress passphrase, along with the
+// argon2id parameters and salt it was derived using, which begin the sealed
+// duress passphrase.
+type duressKey struct {
+	header [33]byte
+	key    [32]byte
+}
+
+// newDuressKey derives a key from `passphrase` using `params` and a fresh
+// salt.
+func newDuressKey(passphrase string, params KDFParams) duressKey {
+	var k duressKey
+	binary.BigEndian.PutUint32(k.header[0:], params.Time)
+	binary.BigEndian.PutUint32(k.header[4:], params.Memory)
+	k.header[8] = params.Lanes
+	if _, err := io.ReadFull(rand.Reader, k.header[9:]); err != nil {
+		panic(err)
+	}
+	copy(k.key[:], argon2.IDKey([]byte(passphrase), k.header[9:], params.Time, params.Memory, params.Lanes, keyLen))
+	return k
+}
+
+// seal returns `action` and the decoy vault's credentials, `decoy`, sealed
+// under the key, using a fresh nonce. ErrDecoyTooLarge is returned if the
+// credentials do not fit in decoySize.
+func (k duressKey) seal(action DuressAction, decoy map[string]*Credential) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(action))
+	if err := gob.NewEncoder(&buf).Encode(decoy); err != nil {
+		return nil, err
+	}
+	if buf.Len() > 1+decoySize {
+		return nil, ErrDecoyTooLarge
+	}
+	// decoding ignores the padding after the credentials
+	buf.Write(make([]byte, 1+decoySize-buf.Len()))
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		panic(err)
+	}
+	blob := make([]byte, 0, duressLen)
+	blob = append(blob, k.header[:]...)
+	blob = append(blob, nonce[:]...)
+	return secretbox.Seal(blob, buf.Bytes(), &nonce, &k.key), nil
+}
+
+// sealDuress returns `action`, and an empty decoy vault, sealed under a key
+// derived from `passphrase` using `params` and a fresh salt.
+func sealDuress(passphrase string, action DuressAction, params KDFParams) []byte {
+	blob, err := newDuressKey(passphrase, params).seal(action, make(map[string]*Credential))
+	if err != nil {
+		panic(err)
+	}
+	return blob
+}
+
+// duressPlaceholder returns random data that can not be told apart from a
+// sealed duress passphrase using `params`. It is stored in vaults without a
+// duress passphrase, so that the vault file does not reveal whether one is
+// set.
+func duressPlaceholder(params KDFParams) []byte {
+	blob := make([]byte, duressLen)
+	binary.BigEndian.PutUint32(blob[0:], params.Time)
+	binary.BigEndian.PutUint32(blob[4:], params.Memory)
+	blob[8] = params.Lanes
+	if _, err := io.ReadFull(rand.Reader, blob[9:]); err != nil {
+		panic(err)
+	}
+	return blob
+}
+
+// openDuress returns the action sealed in `blob` if `passphrase` is the
+// duress passphrase it was sealed with, and DuressNone otherwise.
+func openDuress(blob []byte, passphrase string) DuressAction {
+	action, _, _ := unsealDuress(blob, passphrase)
+	return action
+}
+
+// unsealDuress returns the action and decoy credentials sealed in `blob`,
+// and the key they were sealed under, if `passphrase` is the duress
+// passphrase it was sealed with. DuressNone is returned otherwise. Duress
+// passphrases sealed before formatV4 have no decoy credentials, so nil is
+// returned for them.
+func unsealDuress(blob []byte, passphrase string) (DuressAction, map[string]*Credential, duressKey) {
+	var k duressKey
+	if len(blob) != duressLen && len(blob) != shortDuressLen {
+		return DuressNone, nil, k
+	}
+	params := KDFParams{
+		Time:   binary.BigEndian.Uint32(blob[0:]),
+		Memory: binary.BigEndian.Uint32(blob[4:]),
+		Lanes:  blob[8],
+	}
+	if params.Time == 0 || params.Lanes == 0 || params.Memory < 8*uint32(params.Lanes) {
+		return DuressNone, nil, k
+	}
+	var nonce [24]byte
+	copy(k.header[:], blob)
+	copy(k.key[:], argon2.IDKey([]byte(passphrase), blob[9:33], params.Time, params.Memory, params.Lanes, keyLen))
+	copy(nonce[:], blob[33:57])
+	payload, ok := secretbox.Open(nil, blob[57:], &nonce, &k.key)
+	if !ok || len(payload) == 0 {
+		return DuressNone, nil, k
+	}
+	action := DuressAction(payload[0])
+	if len(payload) == 1 {
+		return action, nil, k
+	}
+	decoy := make(map[string]*Credential)
+	if err := gob.NewDecoder(bytes.NewReader(payload[1:])).Decode(&decoy); err != nil {
+		return DuressNone, nil, k
+	}
+	return action, decoy, k
+}
+
+// duressBlob returns the sealed duress passphrase to write to the vault's
+// file, creating a placeholder if none is set. Placeholders written before
+// formatV4 are replaced by ones of the current length.
+func (v *Vault) duressBlob() []byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.duress == nil || (v.settings.DuressAction == DuressNone && len(v.duress) != duressLen) {
+		v.duress = duressPlaceholder(KDFParams{Time: v.argonTime, Memory: v.argonMemory, Lanes: v.argonLanes})
+	}
+	return v.duress
+}
+
+// SetDuressPassphrase sets the vault's duress passphrase, replacing any set
+// before. Opening the vault with it carries out `action` instead of opening
+// the vault. The duress passphrase is stored in the vault file, outside the
+// encrypted data, so it takes effect once the vault is saved.
+func (v *Vault) SetDuressPassphrase(passphrase string, action DuressAction) error {
+	if action != DuressDecoy && action != DuressWipe {
+		return ErrInvalidDuressAction
+	}
+	if v.VerifyPassphrase(passphrase) {
+		return ErrDuressIsPassphrase
+	}
+	if err := v.checkWritable(); err != nil {
+		return err
+	}
+	blob := sealDuress(passphrase, action, v.KDFParams())
+	v.mu.Lock()
+	v.duress = blob
+	v.mu.Unlock()
+	settings := v.Settings()
+	settings.DuressAction = action
+	return v.SetSettings(settings)
+}
+
+// ClearDuressPassphrase removes the vault's duress passphrase.
+func (v *Vault) ClearDuressPassphrase() error {
+	if err := v.checkWritable(); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.duress = duressPlaceholder(KDFParams{Time: v.argonTime, Memory: v.argonMemory, Lanes: v.argonLanes})
+	v.mu.Unlock()
+	settings := v.Settings()
+	settings.DuressAction = DuressNone
+	return v.SetSettings(settings)
+}
+
+// Decoy returns true if the vault is the decoy vault opened by a duress
+// passphrase whose action is DuressDecoy. Saving it stores its credentials
+// in the duress passphrase sealed in the file, leaving the real vault's data
+// untouched, although changes to the real vault that were recovered from its
+// journal but not yet saved are lost. Decoys opened using a duress
+// passphrase set by a version of masterkey before decoys could hold
+// credentials are always empty, and saving them has no effect.
+func (v *Vault) Decoy() bool {
+	return v.decoy
+}
+
+// decoyFile is what a decoy vault needs to save its credentials: the file it
+// was opened from, the key its duress passphrase derives, and whether the
+// file is the header of a split vault.
+type decoyFile struct {
+	vf    vaultFile
+	key   duressKey
+	split bool
+}
+
+// openDuress carries out the action of the duress passphrase `passphrase`,
+// described by `d`, and returns the vault opened in place of the file's.
+func (f *File) openDuress(d duressError, passphrase string) (*Vault, error) {
+	if d.action == DuressWipe {
+		if err := f.wipe(); err != nil {
+			return nil, err
+		}
+	}
+	vault, err := New(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if d.action != DuressDecoy {
+		return vault, nil
+	}
+	vault.decoy = true
+	if d.decoy == nil {
+		return vault, nil
+	}
+	vault.decoyFile = &decoyFile{vf: d.file, key: d.key, split: f.split != nil}
+	if err = vault.encrypt(d.decoy); err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
+
+// saveDecoy saves the decoy vault's credentials into the duress passphrase
+// sealed in the vault file, or split vault header, at `filename`.
+func (v *Vault) saveDecoy(filename string) error {
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	blob, err := v.decoyFile.key.seal(DuressDecoy, creds)
+	if err != nil {
+		return err
+	}
+	vf := v.decoyFile.vf
+	vf.Duress = blob
+	var buf bytes.Buffer
+	if err = writeVaultFile(&buf, vf); err != nil {
+		return err
+	}
+	if v.decoyFile.split {
+		err = DirStorage(filename).WriteFile(splitHeader, buf.Bytes())
+	} else {
+		err = DirStorage(filepath.Dir(filename)).WriteFile(filepath.Base(filename), buf.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+	v.decoyFile.vf = vf
+	v.clearUndo()
+	v.notifySaved(filename)
+	return nil
+}
+
+// wipe overwrites the file's vault and its journal with random data, then
+// deletes them. On SSDs and copy-on-write filesystems the old data may
+// survive on the disk, but can no longer be read through the filesystem.
+func (f *File) wipe() error {
+	if err := wipeFile(f.path + journalSuffix); err != nil {
+		return err
+	}
+	if f.split == nil {
+		return wipeFile(f.path)
+	}
+	err := filepath.Walk(f.path, func(name string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		return wipeFile(name)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(f.path)
+}
+
+// wipeFile overwrites the file at `path` with random data and deletes it.
+func wipeFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		_, err = io.CopyN(file, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrEntryLocation is returned from UnmarshalEntry if the entry has no
+// location.
+var ErrEntryLocation = errors.New("entry has no location")
+
+// Entry is the JSON form of a single credential, so that other tools can
+// read and write credentials one at a time:
+//
+//	{
+//	  "location": "example.com",
+//	  "username": "alice",
+//	  "password": "hunter2",
+//	  "notes": "recovery codes: ...",
+//	  "url": "https://example.com/login",
+//	  "email": "alice@example.com",
+//	  "meta": {"pin": "1234"},
+//	  "folder": "work/aws",
+//	  "tags": ["work"],
+//	  "icon": "<base64 encoded image>",
+//	  "id": "0d9c5d8e-..."
+//	}
+//
+// Only location is required. Reserved meta tags are never written, and are
+// ignored when read, as is the ID, which the vault assigns.
+type Entry struct {
+	Location string            `json:"location"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+	URL      string            `json:"url,omitempty"`
+	Email    string            `json:"email,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Folder   string            `json:"folder,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Icon     []byte            `json:"icon,omitempty"`
+	ID       string            `json:"id,omitempty"`
+}
+
+// MarshalEntry returns the JSON form of `cred`, stored at `location`.
+func MarshalEntry(location string, cred *Credential) ([]byte, error) {
+	return json.MarshalIndent(NewEntry(location, cred), "", "  ")
+}
+
+// NewEntry returns the Entry for `cred`, stored at `location`.
+func NewEntry(location string, cred *Credential) Entry {
+	meta := cred.UserMeta()
+	if len(meta) == 0 {
+		meta = nil
+	}
+	return Entry{
+		Location: location,
+		Username: cred.Username,
+		Password: cred.Password,
+		Notes:    cred.Notes,
+		URL:      cred.URL,
+		Email:    cred.Email,
+		Meta:     meta,
+		Folder:   cred.Folder,
+		Tags:     cred.Tags,
+		Icon:     cred.Icon,
+		ID:       cred.ID,
+	}
+}
+
+// UnmarshalEntry parses the JSON form of a credential, as written by
+// MarshalEntry, and returns its location and the credential. Unknown fields
+// are rejected, so that misspelt fields are not silently dropped.
+func UnmarshalEntry(bs []byte) (string, Credential, error) {
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.DisallowUnknownFields()
+	var entry Entry
+	if err := dec.Decode(&entry); err != nil {
+		return "", Credential{}, err
+	}
+	if entry.Location == "" {
+		return "", Credential{}, ErrEntryLocation
+	}
+	return entry.Location, Credential{
+		Username: entry.Username,
+		Password: entry.Password,
+		Notes:    entry.Notes,
+		URL:      entry.URL,
+		Email:    entry.Email,
+		Meta:     stripReservedMeta(entry.Meta),
+		Folder:   CleanFolder(entry.Folder),
+		Tags:     entry.Tags,
+		Icon:     entry.Icon,
+	}, nil
+}
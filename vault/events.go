@@ -0,0 +1,104 @@
+package vault
+
+import "sync"
+
+// EventType identifies what happened to a vault in an Event.
+type EventType int
+
+// The types of Event sent to subscribers.
+const (
+	// EventAdd is sent when a credential is added.
+	EventAdd EventType = iota
+	// EventEdit is sent when a credential, its notes, icon or meta tags
+	// change.
+	EventEdit
+	// EventDelete is sent when a credential is deleted.
+	EventDelete
+	// EventSettings is sent when the vault's settings change.
+	EventSettings
+	// EventSave is sent when the vault is saved.
+	EventSave
+	// EventLock is sent when the vault is locked.
+	EventLock
+	// EventUnlock is sent when the vault is unlocked.
+	EventUnlock
+)
+
+var eventTypeNames = map[EventType]string{
+	EventAdd:      "add",
+	EventEdit:     "edit",
+	EventDelete:   "delete",
+	EventSettings: "settings",
+	EventSave:     "save",
+	EventLock:     "lock",
+	EventUnlock:   "unlock",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Event describes a change to a vault.
+type Event struct {
+	Type EventType
+	// Location is the location of the credential that was added, edited
+	// or deleted.
+	Location string
+	// Path is the file the vault was saved to, for EventSave.
+	Path string
+}
+
+// subscribers holds the channels events are sent to. It has its own lock so
+// that events can be published while the vault's lock is held elsewhere.
+type subscribers struct {
+	mu  sync.Mutex
+	chs map[chan<- Event]struct{}
+}
+
+// Subscribe causes events describing changes to the vault to be sent on
+// `ch`. Like os/signal.Notify, the vault does not block sending to `ch`: an
+// event is dropped if `ch` is not ready to receive it, so the caller should
+// give `ch` enough buffer to keep up.
+func (v *Vault) Subscribe(ch chan<- Event) {
+	v.subs.mu.Lock()
+	defer v.subs.mu.Unlock()
+	if v.subs.chs == nil {
+		v.subs.chs = make(map[chan<- Event]struct{})
+	}
+	v.subs.chs[ch] = struct{}{}
+}
+
+// Unsubscribe stops events being sent on `ch`. When it returns, no more
+// events will be sent on `ch`.
+func (v *Vault) Unsubscribe(ch chan<- Event) {
+	v.subs.mu.Lock()
+	defer v.subs.mu.Unlock()
+	delete(v.subs.chs, ch)
+}
+
+// publish sends `ev` to each subscriber that is ready to receive it.
+func (v *Vault) publish(ev Event) {
+	v.subs.mu.Lock()
+	defer v.subs.mu.Unlock()
+	for ch := range v.subs.chs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// event returns the Event describing `entry`, a change to an existing
+// credential or the vault's settings.
+func (entry journalEntry) event() Event {
+	switch {
+	case entry.Settings != nil:
+		return Event{Type: EventSettings}
+	case entry.Credential == nil:
+		return Event{Type: EventDelete, Location: entry.Location}
+	}
+	return Event{Type: EventEdit, Location: entry.Location}
+}
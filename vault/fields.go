@@ -0,0 +1,90 @@
+package vault
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrInvalidURL is returned from SetURL if the URL is not absolute.
+	ErrInvalidURL = errors.New("URL must be absolute, such as https://example.com/login")
+
+	// ErrInvalidEmail is returned from SetEmail if the address can not be
+	// parsed.
+	ErrInvalidEmail = errors.New("email must be an address such as alice@example.com")
+)
+
+// SetURL replaces the URL of the credential at `location` with `u`, which
+// must be absolute, or clears it if `u` is empty.
+func (v *Vault) SetURL(location string, u string) error {
+	if u != "" {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return ErrInvalidURL
+		}
+	}
+	return v.setField(location, func(cred *Credential) {
+		cred.URL = u
+	})
+}
+
+// SetEmail replaces the email address of the credential at `location` with
+// `email`, or clears it if `email` is empty.
+func (v *Vault) SetEmail(location string, email string) error {
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return ErrInvalidEmail
+		}
+	}
+	return v.setField(location, func(cred *Credential) {
+		cred.Email = email
+	})
+}
+
+// SiteURL returns the URL of the credential's site: its URL or, for
+// credentials whose URL was only ever kept as a meta tag, its url meta tag.
+func (c Credential) SiteURL() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	return c.userMetaFold("url")
+}
+
+// AccountEmail returns the email address of the credential's account: its
+// Email or, failing that, its email meta tag.
+func (c Credential) AccountEmail() string {
+	if c.Email != "" {
+		return c.Email
+	}
+	return c.userMetaFold("email")
+}
+
+// userMetaFold returns the value of the user meta tag `name`, in any case.
+func (c Credential) userMetaFold(name string) string {
+	for tag, value := range c.UserMeta() {
+		if strings.EqualFold(tag, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// setField changes the credential at `location` using `set`.
+func (v *Vault) setField(location string, set func(*Credential)) error {
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	location = v.resolveLocation(creds, location)
+
+	cred, exists := creds[location]
+	if !exists {
+		return ErrNoSuchCredential
+	}
+	set(cred)
+
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"sort"
+	"strings"
+)
+
+// FolderSeparator separates the names of nested folders, as in
+// work/aws/prod.
+const FolderSeparator = "/"
+
+// CleanFolder returns `folder` with the whitespace around each name, and
+// empty names, removed. It returns "" for the top level.
+func CleanFolder(folder string) string {
+	var names []string
+	for _, name := range strings.Split(folder, FolderSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, FolderSeparator)
+}
+
+// inFolder returns true if `folder` is `parent` or one of the folders nested
+// inside it. Every folder is inside the top level, "".
+func inFolder(folder, parent string) bool {
+	return parent == "" || folder == parent || strings.HasPrefix(folder, parent+FolderSeparator)
+}
+
+// InFolder returns true if the credential is in `folder`, or a folder nested
+// inside it.
+func (c Credential) InFolder(folder string) bool {
+	return inFolder(c.Folder, CleanFolder(folder))
+}
+
+// SetFolder moves the credential at `location` into `folder`, such as
+// work/aws/prod, or to the top level if `folder` is empty.
+func (v *Vault) SetFolder(location string, folder string) error {
+	return v.setField(location, func(cred *Credential) {
+		cred.Folder = CleanFolder(folder)
+	})
+}
+
+// Folders returns every folder in the vault, including the folders that only
+// hold other folders, sorted so that each folder comes before the folders
+// nested inside it. It also returns the number of credentials in each
+// folder, including those in folders nested inside it.
+func (v *Vault) Folders() ([]string, map[string]int, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, nil, err
+	}
+	counts := make(map[string]int)
+	for _, cred := range creds {
+		if cred.Folder == "" {
+			continue
+		}
+		names := strings.Split(cred.Folder, FolderSeparator)
+		for i := range names {
+			counts[strings.Join(names[:i+1], FolderSeparator)]++
+		}
+	}
+	folders := make([]string, 0, len(counts))
+	for folder := range counts {
+		folders = append(folders, folder)
+	}
+	// compare name by name, so that work/aws sorts before work-archive
+	sort.Slice(folders, func(i, j int) bool {
+		a, b := strings.Split(folders[i], FolderSeparator), strings.Split(folders[j], FolderSeparator)
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return folders, counts, nil
+}
+
+// LocationsInFolder returns the sorted locations of the credentials in
+// `folder`. If `nested` is set, the credentials in the folders nested inside
+// it are included.
+func (v *Vault) LocationsInFolder(folder string, nested bool) ([]string, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	folder = CleanFolder(folder)
+	var locations []string
+	for location, cred := range creds {
+		if cred.Folder == folder || (nested && inFolder(cred.Folder, folder)) {
+			locations = append(locations, location)
+		}
+	}
+	sort.Strings(locations)
+	return locations, nil
+}
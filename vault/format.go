@@ -0,0 +1,202 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/poly1305"
+)
+
+// Vault files written by this version of masterkey start with a fixed header
+// consisting of the 8 magic bytes below followed by a big-endian uint16
+// format version. The remainder of the file is the body, whose encoding is
+// determined by the version.
+const (
+	headerLen = len(magic) + 2
+
+	// formatLegacy is the original format: salt:nonce:secretbox(data), with
+	// a scrypt-derived key and no header.
+	formatLegacy = -1
+	// formatJSON is a canonical-JSON vaultFile with no header.
+	formatJSON = 0
+	// formatV1 is a header followed by a canonical-JSON vaultFile.
+	formatV1 = 1
+	// formatV2 is formatV1 with a vaultData payload, which carries the
+	// vault's settings alongside its credentials.
+	formatV2 = 2
+	// formatV3 is formatV2 with a binary vaultFile in place of JSON, which
+	// stores the encrypted data as-is rather than in base64. See
+	// MarshalBinary.
+	formatV3 = 3
+	// formatV4 is formatV3 with room for the decoy vault's credentials in
+	// the sealed duress passphrase. See duressLen.
+	formatV4 = 4
+
+	currentFormat = formatV4
+)
+
+const magic = "MSTRKEY\x00"
+
+var (
+	// ErrUnknownFormat is returned from Open if the file is not a masterkey
+	// vault in any known format.
+	ErrUnknownFormat = errors.New("file is not a masterkey vault")
+
+	// ErrUnsupportedVersion is returned from Open if the file is a masterkey
+	// vault written using a newer format than this version supports.
+	ErrUnsupportedVersion = errors.New("vault was written by a newer version of masterkey")
+)
+
+// detectFormat inspects the vault file contents in bs and returns the format
+// the file is encoded in. Detection never requires a key derivation.
+func detectFormat(bs []byte) (int, error) {
+	if bytes.HasPrefix(bs, []byte(magic)) {
+		if len(bs) < headerLen {
+			return 0, ErrCorruptVault
+		}
+		version := int(binary.BigEndian.Uint16(bs[len(magic):headerLen]))
+		if version > currentFormat || version < formatV1 {
+			return 0, ErrUnsupportedVersion
+		}
+		return version, nil
+	}
+	// a legacy vault begins with a random salt, so one starting with { is
+	// only taken to be JSON if it is valid JSON
+	trimmed := bytes.TrimLeft(bs, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' && (json.Valid(trimmed) || len(bs) < 48+secretbox.Overhead) {
+		return formatJSON, nil
+	}
+	if len(bs) < 48+secretbox.Overhead {
+		return 0, ErrUnknownFormat
+	}
+	return formatLegacy, nil
+}
+
+// decodeVaultFile decodes the body of a vault file in any format but the
+// legacy one. ErrCorruptVault is returned if the body is not structurally
+// valid.
+func decodeVaultFile(bs []byte, format int) (vaultFile, error) {
+	if format >= formatV1 {
+		bs = bs[headerLen:]
+	}
+	var vf vaultFile
+	var err error
+	if format >= formatV3 {
+		err = vf.UnmarshalBinary(bs)
+	} else {
+		err = json.Unmarshal(bs, &vf)
+	}
+	if err != nil {
+		return vf, ErrCorruptVault
+	}
+	if vf.ArgonTime == 0 || vf.ArgonMemory == 0 || vf.ArgonLanes == 0 || len(vf.Data) < poly1305.TagSize {
+		return vf, ErrCorruptVault
+	}
+	if vf.KeyCheck != nil && len(vf.KeyCheck) != blake2b.Size256 {
+		return vf, ErrCorruptVault
+	}
+	if vf.Duress != nil && len(vf.Duress) != shortDuressLen && (format < formatV4 || len(vf.Duress) != duressLen) {
+		return vf, ErrCorruptVault
+	}
+	return vf, nil
+}
+
+// keyCheck returns the key check value for secret, a keyed BLAKE2b hash of
+// a fixed string.
+func keyCheck(secret [32]byte) []byte {
+	h, err := blake2b.New256(secret[:])
+	if err != nil {
+		panic(err)
+	}
+	h.Write([]byte("masterkey key check"))
+	return h.Sum(nil)
+}
+
+// writeVaultFile writes vf to w, prefixed with the current header.
+func writeVaultFile(w io.Writer, vf vaultFile) error {
+	var header [headerLen]byte
+	copy(header[:], magic)
+	binary.BigEndian.PutUint16(header[len(magic):], currentFormat)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	body, err := vf.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using the encoding of
+// the vault file in formatV3: the argon2 time and memory as big-endian
+// uint32s and the lanes as a byte, then the nonce and salt, then KeyCheck,
+// Duress and Data, each preceded by its length as a big-endian uint32. A nil
+// KeyCheck or Duress is written with a length of zero.
+func (vf vaultFile) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	var n [4]byte
+	writeUint32 := func(x uint32) {
+		binary.BigEndian.PutUint32(n[:], x)
+		buf.Write(n[:])
+	}
+	writeBytes := func(bs []byte) {
+		writeUint32(uint32(len(bs)))
+		buf.Write(bs)
+	}
+
+	writeUint32(vf.ArgonTime)
+	writeUint32(vf.ArgonMemory)
+	buf.WriteByte(vf.ArgonLanes)
+	buf.Write(vf.Nonce[:])
+	buf.Write(vf.Salt[:])
+	writeBytes(vf.KeyCheck)
+	writeBytes(vf.Duress)
+	writeBytes(vf.Data)
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, decoding a vault
+// file encoded by MarshalBinary. ErrCorruptVault is returned if `bs` is
+// truncated or has data after the end of the vault file.
+func (vf *vaultFile) UnmarshalBinary(bs []byte) error {
+	r := bytes.NewReader(bs)
+	readBytes := func() ([]byte, error) {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, ErrCorruptVault
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		if int64(n) > int64(r.Len()) {
+			return nil, ErrCorruptVault
+		}
+		b := make([]byte, n)
+		io.ReadFull(r, b)
+		return b, nil
+	}
+
+	fixed := []interface{}{&vf.ArgonTime, &vf.ArgonMemory, &vf.ArgonLanes, &vf.Nonce, &vf.Salt}
+	for _, field := range fixed {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return ErrCorruptVault
+		}
+	}
+	var err error
+	for _, field := range []*[]byte{&vf.KeyCheck, &vf.Duress, &vf.Data} {
+		if *field, err = readBytes(); err != nil {
+			return err
+		}
+	}
+	if r.Len() != 0 {
+		return ErrCorruptVault
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/avahowell/masterkey/filelock"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestSaveWritesHeader(t *testing.T) {
+	v, err := New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Save("header.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("header.db")
+
+	bs, err := ioutil.ReadFile("header.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(bs, []byte(magic)) {
+		t.Fatal("saved vault did not start with the magic bytes")
+	}
+	format, err := detectFormat(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != currentFormat {
+		t.Fatalf("saved vault had format %v, wanted %v", format, currentFormat)
+	}
+}
+
+func TestOpenHeaderlessJSON(t *testing.T) {
+	v, err := New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("testlocation", Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// headerless vaults store only the credential map
+	creds, err := v.decrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload bytes.Buffer
+	if err = gob.NewEncoder(&payload).Encode(creds); err != nil {
+		t.Fatal(err)
+	}
+	aead, err := chacha20poly1305.NewX(v.secret[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vf := vaultFile{
+		Nonce:       v.nonce,
+		Salt:        v.salt,
+		ArgonTime:   v.argonTime,
+		ArgonMemory: v.argonMemory,
+		ArgonLanes:  v.argonLanes,
+		Data:        aead.Seal(nil, v.nonce[:], payload.Bytes(), nil),
+	}
+	bs, err := json.Marshal(vf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile("headerless.db", bs, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("headerless.db")
+
+	vopen, err := Open("headerless.db", "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vopen.Close()
+	if _, err = vopen.Get("testlocation"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	futureHeader := make([]byte, headerLen)
+	copy(futureHeader, magic)
+	binary.BigEndian.PutUint16(futureHeader[len(magic):], currentFormat+1)
+
+	tests := []struct {
+		contents    []byte
+		format      int
+		expectedErr error
+	}{
+		{[]byte("not a vault"), 0, ErrUnknownFormat},
+		{[]byte(magic), 0, ErrCorruptVault},
+		{futureHeader, 0, ErrUnsupportedVersion},
+		{[]byte(`{"ArgonTime":3}`), formatJSON, nil},
+		{make([]byte, 128), formatLegacy, nil},
+		{append([]byte("{"), make([]byte, 127)...), formatLegacy, nil},
+		{[]byte(`{"ArgonTime":3,`), formatJSON, nil},
+	}
+	for _, test := range tests {
+		format, err := detectFormat(test.contents)
+		if err != test.expectedErr {
+			t.Fatalf("detectFormat(%q): got error %v wanted %v", test.contents, err, test.expectedErr)
+		}
+		if err == nil && format != test.format {
+			t.Fatalf("detectFormat(%q): got format %v wanted %v", test.contents, format, test.format)
+		}
+	}
+}
+
+func TestOpenUnknownFormat(t *testing.T) {
+	if err := ioutil.WriteFile("garbage.db", []byte("hello world"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("garbage.db")
+
+	_, err := Open("garbage.db", "testpass")
+	if err != ErrUnknownFormat {
+		t.Fatal("expected Open on a non-vault file to return ErrUnknownFormat, got", err)
+	}
+	if _, err = os.Stat("garbage.db.lck"); !os.IsNotExist(err) {
+		t.Fatal("failed Open did not release the vault lock")
+	}
+}
+
+func TestOpenWrongPassphraseVsCorrupt(t *testing.T) {
+	v, err := New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("testlocation", Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Save("corrupt.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("corrupt.db")
+
+	if _, err = Open("corrupt.db", "wrongpass"); err != ErrWrongPassphrase {
+		t.Fatal("expected Open with the wrong passphrase to return ErrWrongPassphrase, got", err)
+	}
+
+	bs, err := ioutil.ReadFile("corrupt.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vf, err := decodeVaultFile(bs, currentFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vf.Data[len(vf.Data)/2] ^= 0xff
+	var buf bytes.Buffer
+	if err = writeVaultFile(&buf, vf); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile("corrupt.db", buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open("corrupt.db", "testpass"); err != ErrCorruptVault {
+		t.Fatal("expected Open on tampered data to return ErrCorruptVault, got", err)
+	}
+	if _, err = Open("corrupt.db", "wrongpass"); err != ErrWrongPassphrase {
+		t.Fatal("expected Open on tampered data with the wrong passphrase to return ErrWrongPassphrase, got", err)
+	}
+
+	if err = ioutil.WriteFile("corrupt.db", bs[:len(bs)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open("corrupt.db", "testpass"); err != ErrCorruptVault {
+		t.Fatal("expected Open on a truncated vault to return ErrCorruptVault, got", err)
+	}
+}
+
+func TestFileDecryptRetry(t *testing.T) {
+	v, err := New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Save("retry.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("retry.db")
+
+	f, err := ReadFile("retry.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err = f.Decrypt("wrongpass"); err != ErrWrongPassphrase {
+			t.Fatal("expected ErrWrongPassphrase, got", err)
+		}
+		if _, err = Open("retry.db", "testpass"); err != filelock.ErrLocked {
+			t.Fatal("file lock was released after a failed Decrypt")
+		}
+	}
+
+	vopen, err := f.Decrypt("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open("retry.db", "testpass"); err != filelock.ErrLocked {
+		t.Fatal("closing the file released the lock owned by the decrypted vault")
+	}
+	if err = vopen.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileDecryptContext(t *testing.T) {
+	v, err := New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Save("decryptctx.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("decryptctx.db")
+
+	f, err := ReadFile("decryptctx.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = f.DecryptContext(ctx, "testpass"); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+	if _, err = Open("decryptctx.db", "testpass"); err != filelock.ErrLocked {
+		t.Fatal("file lock was released after a cancelled DecryptContext")
+	}
+
+	vopen, err := f.DecryptContext(context.Background(), "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.DecryptContext(context.Background(), "testpass"); err != errFileClosed {
+		t.Fatal("expected errFileClosed, got", err)
+	}
+	if err = vopen.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecryptAll(t *testing.T) {
+	var reqs []DecryptRequest
+	for i := 0; i < 3; i++ {
+		v, err := New("testpass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = v.Add(fmt.Sprint("location", i), Credential{Password: "testpass"}); err != nil {
+			t.Fatal(err)
+		}
+		filename := fmt.Sprintf("decryptall%v.db", i)
+		if err = v.Save(filename); err != nil {
+			t.Fatal(err)
+		}
+		v.Close()
+		defer os.Remove(filename)
+
+		f, err := ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		reqs = append(reqs, DecryptRequest{File: f, Passphrase: "testpass"})
+	}
+	reqs[1].Passphrase = "wrongpass"
+
+	// a limit smaller than any one key derivation runs them one at a time
+	vaults, errs := DecryptAll(reqs, 1)
+	for i := range reqs {
+		if i == 1 {
+			if errs[i] != ErrWrongPassphrase || vaults[i] != nil {
+				t.Fatal("expected ErrWrongPassphrase, got", errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		defer vaults[i].Close()
+		if _, err := vaults[i].Get(fmt.Sprint("location", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	l := newMemoryLimiter(10)
+	l.acquire(6)
+	acquired := make(chan struct{})
+	go func() {
+		l.acquire(6)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more memory than the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.release(6)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("memory was not acquired after it was released")
+	}
+	l.release(6)
+
+	// a request larger than the limit takes all of it
+	l.acquire(100)
+	if l.available != 0 {
+		t.Fatal("expected an oversized request to take the whole limit, left", l.available)
+	}
+	l.release(100)
+	if l.available != 10 {
+		t.Fatal("expected the whole limit to be released, got", l.available)
+	}
+}
+
+func TestFileOutdated(t *testing.T) {
+	f, err := ReadFile("testdata/oldvault.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Outdated() || !f.Legacy() {
+		t.Fatal("expected the legacy vault to be outdated")
+	}
+	v, err := f.Decrypt("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("outdated.db")
+	err = v.Save("outdated.db")
+	v.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = ReadFile("outdated.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Outdated() || f.Legacy() {
+		t.Fatal("expected a saved vault to be in the current format")
+	}
+}
+
+func TestVaultFileBinaryEncoding(t *testing.T) {
+	vf := vaultFile{
+		ArgonTime:   3,
+		ArgonMemory: 10000,
+		ArgonLanes:  4,
+		Data:        bytes.Repeat([]byte{0xfb}, 40),
+		KeyCheck:    bytes.Repeat([]byte{0x01}, 32),
+	}
+	for i := range vf.Nonce {
+		vf.Nonce[i] = byte(i)
+		vf.Salt[i] = byte(255 - i)
+	}
+
+	encoded, err := vf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 9 bytes of KDF parameters, the nonce and salt, and three lengths
+	if want := 9 + 24 + 24 + 3*4 + len(vf.KeyCheck) + len(vf.Data); len(encoded) != want {
+		t.Fatalf("binary encoding was %v bytes, wanted %v", len(encoded), want)
+	}
+	var decoded vaultFile
+	if err = decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, vf) {
+		t.Fatalf("binary encoding did not round trip: got %v wanted %v", decoded, vf)
+	}
+
+	if err = decoded.UnmarshalBinary(encoded[:len(encoded)-1]); err != ErrCorruptVault {
+		t.Fatal("expected a truncated vault file to be corrupt, got", err)
+	}
+	if err = decoded.UnmarshalBinary(append(encoded, 0)); err != ErrCorruptVault {
+		t.Fatal("expected a vault file with trailing data to be corrupt, got", err)
+	}
+}
+
+func TestOpenV2JSON(t *testing.T) {
+	v, err := New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if err = v.Add("testlocation", Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+	vf := vaultFile{
+		Nonce:       v.nonce,
+		Salt:        v.salt,
+		ArgonTime:   v.argonTime,
+		ArgonMemory: v.argonMemory,
+		ArgonLanes:  v.argonLanes,
+		Data:        v.data,
+		KeyCheck:    keyCheck(v.secret),
+	}
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.BigEndian, uint16(formatV2))
+	if err = json.NewEncoder(&buf).Encode(&vf); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile("v2.db", buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("v2.db")
+
+	f, err := ReadFile("v2.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Outdated() || f.Legacy() {
+		t.Fatal("expected a JSON vault file to be outdated")
+	}
+	vopen, err := f.Decrypt("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = vopen.Get("testlocation"); err != nil {
+		t.Fatal(err)
+	}
+	err = vopen.Save("v2.db")
+	vopen.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile("v2.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format, _ := detectFormat(bs); format < formatV3 {
+		t.Fatal("expected the vault to be saved in the binary format, got format", format)
+	}
+	// the JSON file has no duress placeholder
+	if len(bs)-duressLen >= buf.Len() {
+		t.Fatalf("binary vault file was %v bytes, no smaller than the %v byte JSON one", len(bs), buf.Len())
+	}
+}
@@ -0,0 +1,124 @@
+package vault
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/avahowell/masterkey/pwgen"
+)
+
+// WeakPasswordBits is the estimated strength, in bits, below which a password
+// is reported as weak by PasswordIssues.
+const WeakPasswordBits = 60
+
+// rotationPendingMeta is the reserved meta tag set on credentials whose
+// password was replaced by PasswordIssues' fix workflow, but not yet changed
+// on the site.
+const rotationPendingMeta = ReservedMetaPrefix + "rotation-pending"
+
+// PasswordIssue describes what is wrong with a credential's password.
+type PasswordIssue struct {
+	Location string
+	// Strength is the estimated strength of the password, in bits. The
+	// password is weak if it is below WeakPasswordBits.
+	Strength float64
+	// ReusedAt holds the other locations using the same password.
+	ReusedAt []string
+	// RotationPending is true if the password was replaced, but the change
+	// has not yet been confirmed on the site.
+	RotationPending bool
+}
+
+// Weak returns true if the password's estimated strength is below
+// WeakPasswordBits.
+func (issue PasswordIssue) Weak() bool {
+	return issue.Strength < WeakPasswordBits
+}
+
+// RotationPending returns true if the credential's password was replaced but
+// the change has not yet been confirmed on the site.
+func (c Credential) RotationPending() bool {
+	return c.Meta[rotationPendingMeta] == "true"
+}
+
+// SetRotationPending records whether the password of the credential at
+// `location` has been replaced but not yet changed on the site.
+func (v *Vault) SetRotationPending(location string, pending bool) error {
+	value := ""
+	if pending {
+		value = "true"
+	}
+	return v.setReservedMeta(location, rotationPendingMeta, value)
+}
+
+// PasswordIssues returns the credentials whose passwords are weak, reused at
+// another location, or awaiting a change on the site, sorted by location.
+// Credentials without a password are skipped.
+func (v *Vault) PasswordIssues() ([]PasswordIssue, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	byPassword := make(map[string][]string)
+	for location, cred := range creds {
+		if cred.Password != "" {
+			byPassword[cred.Password] = append(byPassword[cred.Password], location)
+		}
+	}
+
+	var issues []PasswordIssue
+	for location, cred := range creds {
+		if cred.Password == "" {
+			continue
+		}
+		issue := PasswordIssue{
+			Location:        location,
+			Strength:        pwgen.Analyze(cred.Password).Strength(),
+			RotationPending: cred.RotationPending(),
+		}
+		for _, other := range byPassword[cred.Password] {
+			if other != location {
+				issue.ReusedAt = append(issue.ReusedAt, other)
+			}
+		}
+		sort.Strings(issue.ReusedAt)
+		if issue.Weak() || len(issue.ReusedAt) > 0 || issue.RotationPending {
+			issues = append(issues, issue)
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].Location < issues[j].Location
+	})
+	return issues, nil
+}
+
+// ChangePasswordURL returns the well-known URL for changing the password of
+// `cred`, at the site of its SiteURL or, failing that, the site `location`
+// refers to. It is "" if neither is a hostname or URL. `cred` may be nil.
+func ChangePasswordURL(location string, cred *Credential) string {
+	if cred != nil {
+		if u := changePasswordURL(cred.SiteURL()); u != "" {
+			return u
+		}
+	}
+	return changePasswordURL(location)
+}
+
+// changePasswordURL returns the well-known URL for changing the password at
+// `site`, or "" if it is not a hostname or URL.
+func changePasswordURL(site string) string {
+	host := site
+	if i := strings.Index(site, "://"); i > 0 {
+		host = site[i+3:]
+		if end := strings.IndexAny(host, "/?#"); end >= 0 {
+			host = host[:end]
+		}
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	}
+	if !HostnameRegexp.MatchString(host) {
+		return ""
+	}
+	return "https://" + strings.ToLower(host) + "/.well-known/change-password"
+}
@@ -0,0 +1,32 @@
+package vault
+
+import "time"
+
+// PasswordChange is a password a credential used to have, and when it was
+// replaced.
+type PasswordChange struct {
+	Password string
+	Replaced time.Time
+}
+
+// setPassword replaces the credential's password with `password`, keeping
+// the old password in its History.
+func (c *Credential) setPassword(password string) {
+	if password == c.Password {
+		return
+	}
+	if c.Password != "" {
+		c.History = append(c.History, PasswordChange{Password: c.Password, Replaced: time.Now().UTC()})
+	}
+	c.Password = password
+}
+
+// History returns the passwords the credential at `location` had before its
+// current one, oldest first, each with when it was replaced.
+func (v *Vault) History(location string) ([]PasswordChange, error) {
+	cred, err := v.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	return append([]PasswordChange(nil), cred.History...), nil
+}
@@ -0,0 +1,49 @@
+package vault
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// MaxIconSize is the largest icon, in bytes, that can be stored with a
+// credential.
+const MaxIconSize = 64 << 10
+
+var (
+	// ErrIconTooLarge is returned from SetIcon if the icon is larger than
+	// MaxIconSize.
+	ErrIconTooLarge = errors.New("icon is too large")
+
+	// ErrNotAnImage is returned from SetIcon if the icon is not an image.
+	ErrNotAnImage = errors.New("icon is not an image")
+)
+
+// SetIcon replaces the icon of the credential at `location` with `icon`. An
+// empty icon removes it.
+func (v *Vault) SetIcon(location string, icon []byte) error {
+	if len(icon) > MaxIconSize {
+		return ErrIconTooLarge
+	}
+	if len(icon) > 0 && !strings.HasPrefix(http.DetectContentType(icon), "image/") {
+		return ErrNotAnImage
+	}
+
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	location = v.resolveLocation(creds, location)
+
+	cred, exists := creds[location]
+	if !exists {
+		return ErrNoSuchCredential
+	}
+
+	if len(icon) == 0 {
+		icon = nil
+	}
+	cred.Icon = icon
+
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
+}
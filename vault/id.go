@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// idRegexp matches the IDs credentials can have: lowercase hex digits in
+// dash separated groups, as newID makes them. Since IDs name the files of a
+// split vault, anything else, such as an ID merged from a tampered vault,
+// is replaced by assignIDs.
+var idRegexp = regexp.MustCompile(`^[0-9a-f]+(-[0-9a-f]+)*$`)
+
+// validID returns true if `id` is a well-formed credential ID.
+func validID(id string) bool {
+	return len(id) <= 64 && idRegexp.MatchString(id)
+}
+
+// newID returns a random (version 4) UUID.
+func newID() string {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// assignIDs gives each credential in `creds` that has no valid ID, or whose
+// ID is shared with another credential, a new one. Credentials are normally
+// given an ID by Add; this covers those added by versions of masterkey that
+// did not assign them, and those merged from other vaults.
+func assignIDs(creds map[string]*Credential) {
+	seen := make(map[string]bool)
+	for _, cred := range creds {
+		if validID(cred.ID) && !seen[cred.ID] {
+			seen[cred.ID] = true
+			continue
+		}
+		for !validID(cred.ID) || seen[cred.ID] {
+			cred.ID = newID()
+		}
+		seen[cred.ID] = true
+	}
+}
+
+// GetByID returns the location of the credential with the ID `id`, and the
+// credential.
+func (v *Vault) GetByID(id string) (string, *Credential, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return "", nil, err
+	}
+	for location, cred := range creds {
+		if cred.ID == id {
+			return location, cred, nil
+		}
+	}
+	return "", nil, ErrNoSuchCredential
+}
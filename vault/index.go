@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+type (
+	// locationIndex maps each location in the vault to what Locations and
+	// Find need to know about its credential. It is kept encrypted apart
+	// from the vault's data, so that listing and searching locations does
+	// not decrypt and decode every password, note and icon in the vault.
+	locationIndex map[string]indexEntry
+
+	// indexEntry is the part of a credential recorded in the index.
+	indexEntry struct {
+		Tags    []string
+		Aliases []string
+	}
+)
+
+// newLocationIndex returns the index of `creds`.
+func newLocationIndex(creds map[string]*Credential) locationIndex {
+	index := make(locationIndex, len(creds))
+	for location, cred := range creds {
+		index[location] = indexEntry{Tags: cred.Tags, Aliases: cred.Aliases()}
+	}
+	return index
+}
+
+// locations returns the indexed locations tagged with every one of `tags`,
+// sorted.
+func (index locationIndex) locations(tags []string) []string {
+	var locations []string
+	for location, entry := range index {
+		if (Credential{Tags: entry.Tags}).hasTags(tags) {
+			locations = append(locations, location)
+		}
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+// find returns the location Find matches `searchtext` to: the location
+// itself, then the credential it is an alias of, then the first location
+// containing it.
+func (index locationIndex) find(searchtext string) (string, bool) {
+	if _, exists := index[searchtext]; exists {
+		return searchtext, true
+	}
+	for location, entry := range index {
+		for _, alias := range entry.Aliases {
+			if alias == searchtext {
+				return location, true
+			}
+		}
+	}
+	for _, location := range index.locations(nil) {
+		if strings.Contains(location, searchtext) {
+			return location, true
+		}
+	}
+	return "", false
+}
+
+// sealIndexLocked encrypts the index of `creds` under the vault's key,
+// replacing the previous one. v.mu must be held.
+func (v *Vault) sealIndexLocked(creds map[string]*Credential) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(newLocationIndex(creds)); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rand.Reader, v.indexNonce[:]); err != nil {
+		panic(err)
+	}
+	aead, err := chacha20poly1305.NewX(v.secret[:])
+	if err != nil {
+		return err
+	}
+	v.index = aead.Seal(nil, v.indexNonce[:], buf.Bytes(), nil)
+	return nil
+}
+
+// decryptIndex decrypts the vault's index.
+func (v *Vault) decryptIndex() (locationIndex, error) {
+	defer v.time(TimeIndex, time.Now())
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.locked {
+		return nil, ErrVaultLocked
+	}
+
+	aead, err := chacha20poly1305.NewX(v.secret[:])
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := aead.Open(nil, v.indexNonce[:], v.index, nil)
+	if err != nil {
+		return nil, ErrCouldNotDecrypt
+	}
+	index := make(locationIndex)
+	if err = gob.NewDecoder(bytes.NewReader(decrypted)).Decode(&index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
@@ -0,0 +1,229 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// journalMagic begins every journal file.
+const journalMagic = "MSTRKEYJ"
+
+// journalSuffix is appended to a vault's filename to name its journal.
+const journalSuffix = ".journal"
+
+// maxJournalRecord bounds the size of a single journal record, so that a
+// corrupt length can not cause a huge allocation.
+const maxJournalRecord = 64 << 20
+
+type (
+	// journal is a write-ahead log of the changes made to a vault since it
+	// was last saved. Each change is encrypted and synced to disk as it is
+	// made, so that changes are not lost if masterkey exits without saving.
+	//
+	// The journal begins with journalMagic and the SHA-256 hash of the vault
+	// file it applies to, so that a journal left behind by an older version
+	// of the vault file is never replayed onto a newer one. Each record is
+	// a big-endian uint32 length, a 24 byte nonce, and a gob-encoded
+	// journalEntry sealed with xchacha20poly1305, using the file hash as
+	// additional data. If the vault has the PadData setting, the encoded
+	// entry is padded with zeros before it is sealed.
+	journal struct {
+		mu        sync.Mutex
+		f         *os.File
+		vaultPath string
+		key       [32]byte
+		base      [sha256.Size]byte
+		records   int
+	}
+
+	// journalEntry records the state of a single location after a change.
+	journalEntry struct {
+		Location string
+		// Credential is nil if the credential at Location was deleted.
+		Credential *Credential
+		// Settings is non-nil if the entry records a change to the vault's
+		// settings rather than a credential.
+		Settings *Settings
+		// Modified is when the change was made.
+		Modified time.Time
+
+		// keepModified is set if the change only updates bookkeeping, such
+		// as usage statistics, and so leaves the credential's ModifiedAt
+		// alone.
+		keepModified bool
+	}
+)
+
+// journalKey derives the key used to encrypt journal records from the key
+// protecting the vault file.
+func journalKey(secret [32]byte) [32]byte {
+	h, err := blake2b.New256(secret[:])
+	if err != nil {
+		panic(err)
+	}
+	h.Write([]byte("masterkey journal"))
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// openJournal opens the journal for the vault at `vaultPath`, whose file
+// contents hash to `base`, and returns the entries it holds. `key` is the
+// journalKey of the secret the vault file was encrypted with. A journal for a
+// different version of the vault file, or one that can not be decrypted, is
+// discarded. Records cut short by a crash end the replay.
+func openJournal(vaultPath string, key [32]byte, base [sha256.Size]byte) (*journal, []journalEntry, error) {
+	j := &journal{
+		vaultPath: vaultPath,
+		key:       key,
+		base:      base,
+	}
+
+	var entries []journalEntry
+	bs, err := ioutil.ReadFile(vaultPath + journalSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	header := append([]byte(journalMagic), base[:]...)
+	valid := 0
+	if bytes.HasPrefix(bs, header) {
+		valid = len(header)
+		entries, valid = j.readEntries(bs, valid)
+	}
+
+	f, err := os.OpenFile(vaultPath+journalSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	j.f = f
+	if valid == 0 {
+		err = j.resetLocked()
+	} else {
+		// drop anything after the last complete record
+		if err = f.Truncate(int64(valid)); err == nil {
+			_, err = f.Seek(int64(valid), io.SeekStart)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	j.records = len(entries)
+	return j, entries, nil
+}
+
+// readEntries decrypts the records in `bs` starting at `offset`. It returns
+// the entries and the offset of the end of the last complete record.
+func (j *journal) readEntries(bs []byte, offset int) ([]journalEntry, int) {
+	aead, err := chacha20poly1305.NewX(j.key[:])
+	if err != nil {
+		return nil, 0
+	}
+	var entries []journalEntry
+	for len(bs)-offset >= 4+chacha20poly1305.NonceSizeX {
+		n := int(binary.BigEndian.Uint32(bs[offset:]))
+		start := offset + 4 + chacha20poly1305.NonceSizeX
+		if n > maxJournalRecord || len(bs)-start < n {
+			break
+		}
+		nonce := bs[offset+4 : start]
+		plaintext, err := aead.Open(nil, nonce, bs[start:start+n], j.base[:])
+		if err != nil {
+			if offset == len(journalMagic)+sha256.Size {
+				// the journal was written using another key
+				return nil, 0
+			}
+			break
+		}
+		var entry journalEntry
+		if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&entry); err != nil {
+			break
+		}
+		entries = append(entries, entry)
+		offset = start + n
+	}
+	return entries, offset
+}
+
+// append encrypts `entry`, appends it to the journal, and syncs the journal
+// to disk. The entry is padded first if `pad` is set.
+func (j *journal) append(entry journalEntry, pad bool) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return err
+	}
+	plaintext := buf.Bytes()
+	if pad {
+		plaintext = padRecord(plaintext)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	aead, err := chacha20poly1305.NewX(j.key[:])
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 4+chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, record[4:]); err != nil {
+		panic(err)
+	}
+	record = aead.Seal(record, record[4:], plaintext, j.base[:])
+	binary.BigEndian.PutUint32(record, uint32(len(record)-4-chacha20poly1305.NonceSizeX))
+
+	if _, err := j.f.Write(record); err != nil {
+		return err
+	}
+	j.records++
+	return j.f.Sync()
+}
+
+// reset empties the journal after the vault has been saved. New entries are
+// encrypted with `key` and apply to the vault file whose contents hash to
+// `base`.
+func (j *journal) reset(key [32]byte, base [sha256.Size]byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.key = key
+	j.base = base
+	return j.resetLocked()
+}
+
+// resetLocked truncates the journal and writes its header.
+func (j *journal) resetLocked() error {
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := j.f.Write(append([]byte(journalMagic), j.base[:]...)); err != nil {
+		return err
+	}
+	j.records = 0
+	return j.f.Sync()
+}
+
+// close closes the journal, removing it if it holds no unsaved changes.
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.f.Close()
+	if j.records == 0 {
+		if rmErr := os.Remove(j.vaultPath + journalSuffix); err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
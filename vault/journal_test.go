@@ -0,0 +1,271 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// crash simulates masterkey exiting without saving or closing `v`.
+func crash(t *testing.T, v *Vault) {
+	if err := v.journal.f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newJournaledVault(t *testing.T) (string, *Vault) {
+	dir, err := ioutil.TempDir("", "masterkey-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultPath := filepath.Join(dir, "vault.db")
+	v, err := New("testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Add("testlocation", Credential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+
+	v, err = Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vaultPath, v
+}
+
+func TestJournalRecovery(t *testing.T) {
+	vaultPath, v := newJournaledVault(t)
+	defer os.RemoveAll(filepath.Dir(vaultPath))
+
+	if err := v.Add("newlocation", Credential{Username: "newuser", Password: "newpass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Edit("testlocation", Credential{Username: "testuser", Password: "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetNotes("testlocation", "some notes"); err != nil {
+		t.Fatal(err)
+	}
+	settings := v.Settings()
+	settings.ConfirmDestructive = true
+	if err := v.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, v)
+
+	v, err := Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Recovered() != 4 {
+		t.Fatal("expected 4 recovered changes, got", v.Recovered())
+	}
+	cred, err := v.Get("testlocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Password != "changed" || cred.Notes != "some notes" {
+		t.Fatal("edit was not recovered:", cred)
+	}
+	if _, err = v.Get("newlocation"); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Settings().ConfirmDestructive {
+		t.Fatal("settings change was not recovered")
+	}
+
+	// recovered changes are kept in the journal until they are saved.
+	if err = v.Delete("newlocation"); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, v)
+	v, err = Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Recovered() != 5 {
+		t.Fatal("expected 5 recovered changes, got", v.Recovered())
+	}
+	if _, err = v.Get("newlocation"); err != ErrNoSuchCredential {
+		t.Fatal("delete was not recovered")
+	}
+
+	if err = v.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(vaultPath + journalSuffix); !os.IsNotExist(err) {
+		t.Fatal("journal was not removed after save and close")
+	}
+	v, err = Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if v.Recovered() != 0 {
+		t.Fatal("saved changes were replayed")
+	}
+	cred, err = v.Get("testlocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Password != "changed" {
+		t.Fatal("recovered change was not saved")
+	}
+}
+
+func TestJournalStale(t *testing.T) {
+	vaultPath, v := newJournaledVault(t)
+	defer os.RemoveAll(filepath.Dir(vaultPath))
+
+	if err := v.Add("newlocation", Credential{Username: "newuser", Password: "newpass"}); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, v)
+
+	// a journal for an older version of the vault file is not replayed.
+	journal, err := ioutil.ReadFile(vaultPath + journalSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(vaultPath+journalSuffix, journal, 0600); err != nil {
+		t.Fatal(err)
+	}
+	v, err = Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Recovered() != 0 {
+		t.Fatal("stale journal was replayed")
+	}
+	v.Close()
+
+	// neither is a journal written with another passphrase.
+	other, err := New("otherpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	bs, err := ioutil.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, _, err := openJournal(vaultPath, journalKey(other.secret), sha256.Sum256(bs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = j.append(journalEntry{Location: "testlocation"}, false); err != nil {
+		t.Fatal(err)
+	}
+	j.f.Close()
+	v, err = Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if v.Recovered() != 0 {
+		t.Fatal("journal written with another key was replayed")
+	}
+	if _, err = v.Get("testlocation"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalTruncated(t *testing.T) {
+	vaultPath, v := newJournaledVault(t)
+	defer os.RemoveAll(filepath.Dir(vaultPath))
+
+	for _, loc := range []string{"a", "b"} {
+		if err := v.Add(loc, Credential{Username: "user", Password: "pass"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	crash(t, v)
+
+	// cut the last record short, as if masterkey crashed while writing it.
+	fi, err := os.Stat(vaultPath + journalSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(vaultPath+journalSuffix, fi.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err = Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if v.Recovered() != 1 {
+		t.Fatal("expected 1 recovered change, got", v.Recovered())
+	}
+	if _, err = v.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Get("b"); err != ErrNoSuchCredential {
+		t.Fatal("partial record was replayed")
+	}
+}
+
+func TestJournalPadded(t *testing.T) {
+	vaultPath, v := newJournaledVault(t)
+	defer os.RemoveAll(filepath.Dir(vaultPath))
+
+	settings := v.Settings()
+	settings.PadData = true
+	if err := v.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int64
+	for _, notes := range []string{"", strings.Repeat("n", 1000)} {
+		before, err := os.Stat(vaultPath + journalSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = v.Add("padded"+strconv.Itoa(len(notes)), Credential{Username: "user", Notes: notes}); err != nil {
+			t.Fatal(err)
+		}
+		after, err := os.Stat(vaultPath + journalSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, after.Size()-before.Size())
+	}
+	if sizes[0] != sizes[1] || sizes[0] < minPaddedRecord {
+		t.Fatal("padded journal records revealed the sizes of their credentials:", sizes)
+	}
+	crash(t, v)
+
+	v, err := Open(vaultPath, "testpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if cred, err := v.Get("padded1000"); err != nil || len(cred.Notes) != 1000 {
+		t.Fatal("could not replay a padded journal record:", err)
+	}
+}
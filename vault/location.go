@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxLocationLength is the longest location, in characters, that can
+// be added to a vault whose settings do not specify a maximum.
+const DefaultMaxLocationLength = 256
+
+var (
+	// ErrEmptyLocation is returned from Add if the location is empty.
+	ErrEmptyLocation = errors.New("location must not be empty")
+
+	// ErrLocationWhitespace is returned from Add if the location begins or
+	// ends with whitespace.
+	ErrLocationWhitespace = errors.New("location must not begin or end with whitespace")
+
+	// ErrLocationControlChars is returned from Add if the location contains
+	// control characters, or is not valid UTF-8.
+	ErrLocationControlChars = errors.New("location must not contain control characters")
+
+	// ErrLocationTooLong is returned from Add if the location is longer than
+	// the vault's maximum location length.
+	ErrLocationTooLong = errors.New("location is too long")
+
+	// HostnameRegexp matches bare hostnames, optionally with a port, which
+	// are treated as site locations.
+	HostnameRegexp = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+(:[0-9]+)?$`)
+)
+
+// validateLocation returns an error if `location` could not be referenced
+// from the shell or is longer than `maxLength` characters. If `maxLength` is
+// zero, DefaultMaxLocationLength is used.
+func validateLocation(location string, maxLength int) error {
+	if location == "" {
+		return ErrEmptyLocation
+	}
+	if !utf8.ValidString(location) {
+		return ErrLocationControlChars
+	}
+	if strings.TrimSpace(location) != location {
+		return ErrLocationWhitespace
+	}
+	for _, r := range location {
+		if unicode.IsControl(r) {
+			return ErrLocationControlChars
+		}
+	}
+	if maxLength == 0 {
+		maxLength = DefaultMaxLocationLength
+	}
+	if utf8.RuneCountInString(location) > maxLength {
+		return ErrLocationTooLong
+	}
+	return nil
+}
+
+// normalizeHostname lowercases `location` if it is a hostname, or lowercases
+// the scheme and host if it is a URL. Other locations are returned unchanged.
+func normalizeHostname(location string) string {
+	if HostnameRegexp.MatchString(location) {
+		return strings.ToLower(location)
+	}
+
+	schemeEnd := strings.Index(location, "://")
+	if schemeEnd <= 0 || strings.ContainsAny(location[:schemeEnd], " /") {
+		return location
+	}
+	hostEnd := len(location)
+	if i := strings.IndexAny(location[schemeEnd+3:], "/?#"); i >= 0 {
+		hostEnd = schemeEnd + 3 + i
+	}
+	return strings.ToLower(location[:hostEnd]) + location[hostEnd:]
+}
+
+// normalizeLocation applies the vault's normalization settings to
+// `location`.
+func (v *Vault) normalizeLocation(location string) string {
+	if v.Settings().NormalizeHostnames {
+		return normalizeHostname(location)
+	}
+	return location
+}
+
+// resolveLocation returns the location in `creds` that `location` refers to.
+// An exact match is preferred, so that credentials added before
+// normalization was enabled can still be referenced as they were added.
+// Otherwise the normalized location is used, or the credential it is an
+// alias of.
+func (v *Vault) resolveLocation(creds map[string]*Credential, location string) string {
+	if _, exists := creds[location]; exists {
+		return location
+	}
+	normalized := v.normalizeLocation(location)
+	if _, exists := creds[normalized]; exists {
+		return normalized
+	}
+	if target, ok := aliasTarget(creds, location); ok {
+		return target
+	}
+	if target, ok := aliasTarget(creds, normalized); ok {
+		return target
+	}
+	return normalized
+}
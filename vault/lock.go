@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrVaultLocked is returned when the contents of a locked vault are read or
+// changed.
+var ErrVaultLocked = errors.New("vault is locked")
+
+// Lock wipes the vault's key from memory. Until Unlock is called with the
+// master passphrase, the vault's credentials can not be read or changed, but
+// it can still be saved. A salt rotation pending under RotateOnSave is
+// dropped. The keys of the vault's journal, which can only decrypt unsaved
+// changes, are kept so that the journal can still be written by Save.
+// Changes can no longer be undone, and snapshots are dropped, along with the
+// keys they are encrypted under.
+func (v *Vault) Lock() {
+	v.mu.Lock()
+	if v.locked {
+		v.mu.Unlock()
+		return
+	}
+	v.lockCheck = keyCheck(v.secret)
+	v.lockJournalKey = journalKey(v.secret)
+	for i := range v.secret {
+		v.secret[i] = 0x00
+	}
+	for i := range v.pendingSecret {
+		v.pendingSecret[i] = 0x00
+	}
+	v.rotatePending = false
+	v.locked = true
+	v.mu.Unlock()
+	v.clearUndo()
+	v.clearSnapshots()
+	v.publish(Event{Type: EventLock})
+}
+
+// Unlock restores the key of a locked vault by deriving it from
+// `passphrase`. ErrWrongPassphrase is returned if `passphrase` is not the
+// vault's master passphrase. Unlock derives a key, so it is as slow as
+// opening the vault.
+func (v *Vault) Unlock(passphrase string) error {
+	v.mu.RLock()
+	salt, params := v.salt, KDFParams{Time: v.argonTime, Memory: v.argonMemory, Lanes: v.argonLanes}
+	v.mu.RUnlock()
+
+	var secret [32]byte
+	start := time.Now()
+	skb := argon2.IDKey([]byte(passphrase), salt[:], params.Time, params.Memory, params.Lanes, keyLen)
+	v.time(TimeKDF, start)
+	subtle.ConstantTimeCopy(1, secret[:], skb)
+
+	v.mu.Lock()
+	if !v.locked {
+		v.mu.Unlock()
+		return nil
+	}
+	if subtle.ConstantTimeCompare(keyCheck(secret), v.lockCheck) != 1 {
+		v.mu.Unlock()
+		return ErrWrongPassphrase
+	}
+	v.secret = secret
+	v.locked = false
+	for i := range v.lockJournalKey {
+		v.lockJournalKey[i] = 0x00
+	}
+	v.mu.Unlock()
+	v.publish(Event{Type: EventUnlock})
+	return nil
+}
+
+// Locked returns true if the vault has been locked by Lock.
+func (v *Vault) Locked() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.locked
+}
+
+// currentKeyCheck returns the key check of the vault's key, even while the
+// vault is locked. v.mu must be held.
+func (v *Vault) currentKeyCheck() []byte {
+	if v.locked {
+		return v.lockCheck
+	}
+	return keyCheck(v.secret)
+}
+
+// currentJournalKey returns the journal key for the vault's key, even while
+// the vault is locked. v.mu must be held.
+func (v *Vault) currentJournalKey() [32]byte {
+	if v.locked {
+		return v.lockJournalKey
+	}
+	return journalKey(v.secret)
+}
@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+)
+
+// ReservedMetaPrefix begins the names of meta tags that masterkey uses to
+// store its own per-credential state. Meta tags in this namespace can not be
+// added, edited, or deleted using the meta methods, and are dropped from
+// credentials passed to Add, so user data and importers can never collide
+// with internal state.
+const ReservedMetaPrefix = "_mk/"
+
+// ErrReservedMeta is returned from the meta methods if the meta name is in
+// the reserved namespace.
+var ErrReservedMeta = errors.New("meta names beginning with " + ReservedMetaPrefix + " are reserved for masterkey")
+
+// IsReservedMeta returns true if `name` is in the reserved meta namespace.
+func IsReservedMeta(name string) bool {
+	return strings.HasPrefix(name, ReservedMetaPrefix)
+}
+
+// UserMeta returns the credential's meta tags, excluding those in the
+// reserved namespace.
+func (c Credential) UserMeta() map[string]string {
+	return stripReservedMeta(c.Meta)
+}
+
+// stripReservedMeta returns a copy of `meta` without any reserved meta tags.
+func stripReservedMeta(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	stripped := make(map[string]string, len(meta))
+	for name, value := range meta {
+		if !IsReservedMeta(name) {
+			stripped[name] = value
+		}
+	}
+	return stripped
+}
+
+// setReservedMeta sets the reserved meta tag `name` of the credential at
+// `location` to `value`, or removes it if `value` is empty.
+func (v *Vault) setReservedMeta(location string, name string, value string) error {
+	return v.setReservedMetas(location, map[string]string{name: value})
+}
+
+// setReservedMetas sets several reserved meta tags of the credential at
+// `location` at once, removing those whose value is empty.
+func (v *Vault) setReservedMetas(location string, values map[string]string) error {
+	return v.updateReservedMetas(location, values, false)
+}
+
+// updateReservedMetas is setReservedMetas, leaving the credential's
+// ModifiedAt alone if `keepModified` is set.
+func (v *Vault) updateReservedMetas(location string, values map[string]string, keepModified bool) error {
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	location = v.resolveLocation(creds, location)
+
+	cred, exists := creds[location]
+	if !exists {
+		return ErrNoSuchCredential
+	}
+	for name, value := range values {
+		if value == "" {
+			delete(cred.Meta, name)
+			continue
+		}
+		if cred.Meta == nil {
+			cred.Meta = make(map[string]string)
+		}
+		cred.Meta[name] = value
+	}
+
+	return v.commit(creds, journalEntry{Location: location, Credential: cred, keepModified: keepModified})
+}
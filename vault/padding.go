@@ -0,0 +1,33 @@
+package vault
+
+// minPaddedSize is the smallest size, in bytes, the payload of a vault with
+// the PadData setting is padded to.
+const minPaddedSize = 16 << 10
+
+// minPaddedRecord is the smallest size, in bytes, the journal records of a
+// vault with the PadData setting are padded to.
+const minPaddedRecord = 4 << 10
+
+// padPayload pads `payload` with zeros to the next power of two no smaller
+// than minPaddedSize, so that the size of the encrypted vault only changes
+// when its contents double in size. Decoding ignores the padding, which
+// follows the encoded vaultData.
+func padPayload(payload []byte) []byte {
+	return padTo(payload, minPaddedSize)
+}
+
+// padRecord pads the encoded journalEntry `record` in the same way, to the
+// next power of two no smaller than minPaddedRecord, so that the journal
+// does not reveal the size of each changed credential.
+func padRecord(record []byte) []byte {
+	return padTo(record, minPaddedRecord)
+}
+
+// padTo pads `bs` with zeros to the next power of two no smaller than `min`.
+func padTo(bs []byte, min int) []byte {
+	size := min
+	for size < len(bs) {
+		size *= 2
+	}
+	return append(bs, make([]byte, size-len(bs))...)
+}
@@ -0,0 +1,103 @@
+package vault
+
+import "sync"
+
+// DefaultParallelMemory is the memory, in KiB, that DecryptAll uses for key
+// derivation at once if no limit is given.
+const DefaultParallelMemory = 4 << 20
+
+// DecryptRequest is a file to be decrypted by DecryptAll.
+type DecryptRequest struct {
+	File       *File
+	Passphrase string
+	Options    []OpenOption
+}
+
+// DecryptAll decrypts the files in `reqs` concurrently, like calling Decrypt
+// on each, and returns the vaults and errors in the same order. Key
+// derivation is memory-hard, so files are only decrypted at the same time
+// while the memory their keys need fits in `memoryLimit` KiB, or
+// DefaultParallelMemory if it is zero. A file that needs more than the limit
+// is decrypted on its own.
+func DecryptAll(reqs []DecryptRequest, memoryLimit uint64) ([]*Vault, []error) {
+	if memoryLimit == 0 {
+		memoryLimit = DefaultParallelMemory
+	}
+	limiter := newMemoryLimiter(memoryLimit)
+	vaults := make([]*Vault, len(reqs))
+	errs := make([]error, len(reqs))
+
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req DecryptRequest) {
+			defer wg.Done()
+			memory := req.File.kdfMemory()
+			limiter.acquire(memory)
+			defer limiter.release(memory)
+			vaults[i], errs[i] = req.File.Decrypt(req.Passphrase, req.Options...)
+		}(i, req)
+	}
+	wg.Wait()
+	return vaults, errs
+}
+
+// kdfMemory returns the memory, in KiB, used to derive the file's keys. Only
+// one key is derived at a time when a vault is opened: legacy vaults derive
+// the argon2 key they are upgraded to once their scrypt key has opened them.
+func (f *File) kdfMemory() uint64 {
+	if f.format == formatLegacy {
+		if scryptMemory := uint64(128 * scryptN * scryptR / 1024); scryptMemory > uint64(defaultArgonMemory()) {
+			return scryptMemory
+		}
+		return uint64(defaultArgonMemory())
+	}
+	vf, err := decodeVaultFile(f.bs, f.format)
+	if err != nil {
+		return 0
+	}
+	return uint64(vf.ArgonMemory)
+}
+
+// memoryLimiter bounds the total memory used by concurrent key derivations.
+type memoryLimiter struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	limit     uint64
+	available uint64
+}
+
+func newMemoryLimiter(limit uint64) *memoryLimiter {
+	l := &memoryLimiter{limit: limit, available: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// clamp returns the amount acquired for a request of `n` KiB: requests larger
+// than the limit take all of it.
+func (l *memoryLimiter) clamp(n uint64) uint64 {
+	if n > l.limit {
+		return l.limit
+	}
+	return n
+}
+
+// acquire blocks until `n` KiB are available and takes them.
+func (l *memoryLimiter) acquire(n uint64) {
+	n = l.clamp(n)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.available < n {
+		l.cond.Wait()
+	}
+	l.available -= n
+}
+
+// release returns `n` KiB taken by acquire.
+func (l *memoryLimiter) release(n uint64) {
+	n = l.clamp(n)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.available += n
+	l.cond.Broadcast()
+}
@@ -0,0 +1,82 @@
+package vault
+
+import (
+	"errors"
+	"time"
+)
+
+// UntilAllowed can be passed to WithWriteProtection to keep a vault
+// read-only until AllowWrites is called.
+const UntilAllowed time.Duration = -1
+
+// ErrWriteProtected is returned when a write-protected vault is changed.
+var ErrWriteProtected = errors.New("vault is write-protected")
+
+// WithWriteProtection opens the vault read-only for `d`, or until
+// AllowWrites is called if `d` is UntilAllowed. This guards against
+// commands run by habit or by a script changing a vault that was only
+// opened to look something up.
+func WithWriteProtection(d time.Duration) OpenOption {
+	return func(c *openConfig) {
+		c.writeProtection = d
+	}
+}
+
+// ProtectWrites makes the vault read-only until `until`, or until
+// AllowWrites is called if `until` is zero. The vault can still be saved,
+// locked and unlocked while it is write-protected.
+func (v *Vault) ProtectWrites(until time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeProtected = true
+	v.writesAllowedAt = until
+}
+
+// AllowWrites lifts the vault's write protection.
+func (v *Vault) AllowWrites() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeProtected = false
+	v.writesAllowedAt = time.Time{}
+}
+
+// WriteProtected returns true if the vault is write-protected, and the time
+// the protection ends, which is zero if it lasts until AllowWrites.
+func (v *Vault) WriteProtected() (bool, time.Time) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.writableLocked() {
+		return true, v.writesAllowedAt
+	}
+	return false, time.Time{}
+}
+
+// checkWritable returns ErrWriteProtected if the vault is write-protected.
+func (v *Vault) checkWritable() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.writableLocked() {
+		return ErrWriteProtected
+	}
+	return nil
+}
+
+// writableLocked returns false while the vault is write-protected. v.mu
+// must be held.
+func (v *Vault) writableLocked() bool {
+	if !v.writeProtected {
+		return true
+	}
+	return !v.writesAllowedAt.IsZero() && !time.Now().Before(v.writesAllowedAt)
+}
+
+// applyWriteProtection protects the newly opened vault as configured by
+// WithWriteProtection.
+func (v *Vault) applyWriteProtection(cfg openConfig) {
+	switch {
+	case cfg.writeProtection == UntilAllowed:
+		v.ProtectWrites(time.Time{})
+	case cfg.writeProtection > 0:
+		v.ProtectWrites(time.Now().Add(cfg.writeProtection))
+	}
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/avahowell/masterkey/pwgen"
+)
+
+// questionMetaPrefix begins the reserved meta tags that store a credential's
+// security questions. The rest of the tag is the question, and its value is
+// the answer.
+const questionMetaPrefix = ReservedMetaPrefix + "question:"
+
+// answerLen is the length of generated security question answers. Answers
+// are lowercase letters only, so they can be read out over the phone.
+const answerLen = 16
+
+var (
+	// ErrQuestionExists is returned from AddQuestion if the credential
+	// already has an answer for the question.
+	ErrQuestionExists = errors.New("credential already has an answer for that question")
+
+	// ErrNoSuchQuestion is returned if no security question matches.
+	ErrNoSuchQuestion = errors.New("credential has no matching security question")
+
+	// ErrEmptyQuestion is returned from AddQuestion if the question is
+	// empty.
+	ErrEmptyQuestion = errors.New("security question can not be empty")
+)
+
+// Questions returns the credential's security questions, sorted.
+func (c Credential) Questions() []string {
+	var questions []string
+	for name := range c.Meta {
+		if strings.HasPrefix(name, questionMetaPrefix) {
+			questions = append(questions, strings.TrimPrefix(name, questionMetaPrefix))
+		}
+	}
+	sort.Strings(questions)
+	return questions
+}
+
+// AddQuestion generates a random answer to the security question `question`
+// and stores it with the credential at `location`. Random answers can't be
+// guessed or researched the way real ones can.
+func (v *Vault) AddQuestion(location string, question string) error {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return ErrEmptyQuestion
+	}
+	cred, err := v.Get(location)
+	if err != nil {
+		return err
+	}
+	if _, exists := cred.Meta[questionMetaPrefix+question]; exists {
+		return ErrQuestionExists
+	}
+	answer, err := pwgen.GeneratePassphrase(pwgen.CharsetAlpha, answerLen)
+	if err != nil {
+		return err
+	}
+	return v.setReservedMeta(location, questionMetaPrefix+question, answer)
+}
+
+// FindQuestion searches the security questions of the credential at
+// `location` for `searchtext`, like FindMeta, ignoring case. The question and
+// its answer are returned.
+func (v *Vault) FindQuestion(location string, searchtext string) (string, string, error) {
+	cred, err := v.Get(location)
+	if err != nil {
+		return "", "", err
+	}
+	questions := cred.Questions()
+	for _, question := range questions {
+		if strings.EqualFold(question, searchtext) {
+			return question, cred.Meta[questionMetaPrefix+question], nil
+		}
+	}
+	for _, question := range questions {
+		if strings.Contains(strings.ToLower(question), strings.ToLower(searchtext)) {
+			return question, cred.Meta[questionMetaPrefix+question], nil
+		}
+	}
+	return "", "", ErrNoSuchQuestion
+}
+
+// DeleteQuestion removes the security question matching `searchtext`, as
+// found by FindQuestion, from the credential at `location`.
+func (v *Vault) DeleteQuestion(location string, searchtext string) (string, error) {
+	question, _, err := v.FindQuestion(location, searchtext)
+	if err != nil {
+		return "", err
+	}
+	return question, v.setReservedMeta(location, questionMetaPrefix+question, "")
+}
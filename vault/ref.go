@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RefPrefix begins references to a field of a credential, such as
+// masterkey://example.com/password, which can be put in config files in
+// place of secrets and expanded with ExpandRefs.
+const RefPrefix = "masterkey://"
+
+// ErrBadRef is returned when a reference is not of the form
+// masterkey://location/field.
+var ErrBadRef = errors.New("references must be of the form masterkey://location/field")
+
+// refRegexp matches references in text. A reference ends at whitespace or
+// a quote.
+var refRegexp = regexp.MustCompile(regexp.QuoteMeta(RefPrefix) + "[^\\s\"'`<>]+")
+
+// ParseRef returns the location and field a reference refers to. The field
+// follows the last slash, so locations may contain slashes, and both may be
+// percent-encoded, to include spaces or quotes.
+func ParseRef(ref string) (string, string, error) {
+	if !strings.HasPrefix(ref, RefPrefix) {
+		return "", "", ErrBadRef
+	}
+	rest := strings.TrimPrefix(ref, RefPrefix)
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", ErrBadRef
+	}
+	location, err := url.PathUnescape(rest[:i])
+	if err != nil {
+		return "", "", ErrBadRef
+	}
+	field, err := url.PathUnescape(rest[i+1:])
+	if err != nil {
+		return "", "", ErrBadRef
+	}
+	return location, field, nil
+}
+
+// Resolve returns the value of the field a reference refers to: username,
+// password, notes, or the name of a meta tag. Unlike Find, the location must
+// match exactly, or be an alias.
+func (v *Vault) Resolve(ref string) (string, error) {
+	location, field, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+	creds, err := v.decrypt()
+	if err != nil {
+		return "", err
+	}
+	cred, exists := creds[v.resolveLocation(creds, location)]
+	if !exists {
+		return "", ErrNoSuchCredential
+	}
+	switch field {
+	case "username":
+		return cred.Username, nil
+	case "password":
+		return cred.Password, nil
+	case "notes":
+		return cred.Notes, nil
+	}
+	value, exists := cred.UserMeta()[field]
+	if !exists {
+		return "", ErrMetaDoesNotExist
+	}
+	return value, nil
+}
+
+// ExpandRefs copies `r` to `w`, replacing each reference with its value as
+// returned by `resolve`. It stops at the first reference that can not be
+// resolved, returning the error.
+func ExpandRefs(r io.Reader, w io.Writer, resolve func(ref string) (string, error)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, readErr := br.ReadString('\n')
+		var err error
+		line = refRegexp.ReplaceAllStringFunc(line, func(ref string) string {
+			if err != nil {
+				return ref
+			}
+			var value string
+			if value, err = resolve(ref); err != nil {
+				err = errors.New(ref + ": " + err.Error())
+			}
+			return value
+		})
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, line); err != nil {
+			return err
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
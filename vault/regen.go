@@ -0,0 +1,45 @@
+package vault
+
+import "github.com/avahowell/masterkey/pwgen"
+
+// previousPasswordMeta is the reserved meta tag in which vaults written
+// before History was added kept the password a credential had before it was
+// regenerated.
+const previousPasswordMeta = ReservedMetaPrefix + "previous-password"
+
+// PreviousPassword returns the password the credential had before its
+// current one, which sites usually ask for when changing it, or "" if it has
+// not been changed.
+func (c Credential) PreviousPassword() string {
+	if len(c.History) > 0 {
+		return c.History[len(c.History)-1].Password
+	}
+	return c.Meta[previousPasswordMeta]
+}
+
+// Regenerate replaces the password of the credential at `location` with a new
+// random password of the same shape: the same length, using the same classes
+// of characters and only the symbols the old password used. The password is
+// lengthened if needed so that its estimated strength is at least `minBits`.
+// The old password is kept in the credential's History. The shape of
+// the new password is returned.
+func (v *Vault) Regenerate(location string, minBits float64) (pwgen.Shape, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return pwgen.Shape{}, err
+	}
+	location = v.resolveLocation(creds, location)
+
+	cred, exists := creds[location]
+	if !exists {
+		return pwgen.Shape{}, ErrNoSuchCredential
+	}
+	shape := pwgen.Analyze(cred.Password).AtLeast(minBits)
+	password, err := pwgen.GenerateShaped(shape)
+	if err != nil {
+		return pwgen.Shape{}, err
+	}
+	cred.setPassword(password)
+
+	return shape, v.commit(creds, journalEntry{Location: location, Credential: cred})
+}
@@ -0,0 +1,62 @@
+package vault
+
+import "time"
+
+// RotationPolicy controls when a vault opened from a file is re-encrypted
+// under a fresh salt.
+type RotationPolicy int
+
+const (
+	// RotateOnOpen rotates the salt as soon as the vault is opened, so the
+	// file changes on every save. This is the default.
+	RotateOnOpen RotationPolicy = iota
+
+	// RotateOnSave rotates the salt along with the first change made to the
+	// vault, so that it is written by the next save. Saving a vault that has
+	// not been changed leaves the file as it was.
+	RotateOnSave
+
+	// RotateManually never rotates the salt on its own. It is only rotated
+	// by ChangePassphrase and Rekey.
+	RotateManually
+)
+
+type (
+	// OpenOption configures how a vault file is opened.
+	OpenOption func(*openConfig)
+
+	openConfig struct {
+		rotation        RotationPolicy
+		writeProtection time.Duration
+		timer           Timer
+	}
+)
+
+// WithRotation sets the RotationPolicy of the opened vault.
+func WithRotation(policy RotationPolicy) OpenOption {
+	return func(c *openConfig) {
+		c.rotation = policy
+	}
+}
+
+func newOpenConfig(opts []OpenOption) openConfig {
+	var c openConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// rotatePendingLocked switches the vault to the salt and secret derived for
+// a RotateOnSave rotation, if one is pending. v.mu must be held.
+func (v *Vault) rotatePendingLocked() {
+	if !v.rotatePending {
+		return
+	}
+	v.salt = v.pendingSalt
+	v.secret = v.pendingSecret
+	for i := range v.pendingSecret {
+		v.pendingSecret[i] = 0x00
+	}
+	v.rotatePending = false
+}
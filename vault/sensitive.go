@@ -0,0 +1,28 @@
+package vault
+
+// sensitiveUsernameMeta is the reserved meta tag set on credentials whose
+// username has been marked sensitive.
+const sensitiveUsernameMeta = ReservedMetaPrefix + "sensitive-username"
+
+// UsernameSensitive returns true if the credential's username has been
+// marked sensitive using SetUsernameSensitive.
+func (c Credential) UsernameSensitive() bool {
+	return c.Meta[sensitiveUsernameMeta] == "true"
+}
+
+// SetUsernameSensitive marks the username of the credential at `location` as
+// sensitive, or not.
+func (v *Vault) SetUsernameSensitive(location string, sensitive bool) error {
+	value := ""
+	if sensitive {
+		value = "true"
+	}
+	return v.setReservedMeta(location, sensitiveUsernameMeta, value)
+}
+
+// MasksUsername returns true if the username of `cred` should be masked when
+// displayed and left out of plaintext exports, either because the vault's
+// SensitiveUsernames setting is on or because it was marked sensitive.
+func (v *Vault) MasksUsername(cred *Credential) bool {
+	return v.Settings().SensitiveUsernames || cred.UsernameSensitive()
+}
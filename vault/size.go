@@ -0,0 +1,69 @@
+package vault
+
+import "sort"
+
+// DefaultSizeWarning is the encrypted size, in bytes, above which a vault
+// whose settings do not specify a threshold is considered too large. The
+// whole vault is decrypted into memory on every access, so large vaults are
+// slow to use.
+const DefaultSizeWarning = 16 << 20
+
+// EntrySize is the size of a credential, returned by LargestEntries.
+type EntrySize struct {
+	Location string
+	Bytes    int
+}
+
+// size returns the approximate number of bytes the credential at `location`
+// takes up in the vault.
+func (c Credential) size(location string) int {
+	n := len(location) + len(c.Username) + len(c.Password) + len(c.Notes) + len(c.Icon)
+	for name, value := range c.Meta {
+		n += len(name) + len(value)
+	}
+	return n
+}
+
+// Size returns the size of the vault's encrypted data, in bytes.
+func (v *Vault) Size() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.data)
+}
+
+// SizeWarning returns the size above which the vault is too large: its
+// SizeWarning setting, or DefaultSizeWarning if that is zero.
+func (v *Vault) SizeWarning() int {
+	if warning := v.Settings().SizeWarning; warning > 0 {
+		return warning
+	}
+	return DefaultSizeWarning
+}
+
+// TooLarge returns true if the vault is larger than its SizeWarning.
+func (v *Vault) TooLarge() bool {
+	return v.Size() > v.SizeWarning()
+}
+
+// LargestEntries returns the `n` largest credentials in the vault, largest
+// first.
+func (v *Vault) LargestEntries(n int) ([]EntrySize, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	var sizes []EntrySize
+	for location, cred := range creds {
+		sizes = append(sizes, EntrySize{Location: location, Bytes: cred.size(location)})
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes != sizes[j].Bytes {
+			return sizes[i].Bytes > sizes[j].Bytes
+		}
+		return sizes[i].Location < sizes[j].Location
+	})
+	if len(sizes) > n {
+		sizes = sizes[:n]
+	}
+	return sizes, nil
+}
@@ -0,0 +1,157 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ErrNoSuchSnapshot is returned from Rollback and DeleteSnapshot if there is
+// no snapshot with the given name.
+var ErrNoSuchSnapshot = errors.New("no snapshot with that name")
+
+type (
+	// Snapshot describes a restore point created by CreateSnapshot.
+	Snapshot struct {
+		Name    string
+		Created time.Time
+	}
+
+	// snapshot is a Snapshot and the vault's credentials when it was
+	// created, encrypted under the vault's snapshotKey.
+	snapshot struct {
+		Snapshot
+		nonce [24]byte
+		data  []byte
+	}
+)
+
+// CreateSnapshot records the vault's credentials as they are now, under
+// `name`, so that Rollback can restore them. A snapshot with the same name is
+// replaced. Snapshots are kept encrypted in memory until the vault is locked
+// or closed, and are never saved.
+func (v *Vault) CreateSnapshot(name string) error {
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(creds); err != nil {
+		return err
+	}
+
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	if v.snapshots == nil {
+		if _, err := io.ReadFull(rand.Reader, v.snapshotKey[:]); err != nil {
+			panic(err)
+		}
+		v.snapshots = make(map[string]snapshot)
+	}
+	s := snapshot{Snapshot: Snapshot{Name: name, Created: time.Now()}}
+	if _, err := io.ReadFull(rand.Reader, s.nonce[:]); err != nil {
+		panic(err)
+	}
+	aead, err := chacha20poly1305.NewX(v.snapshotKey[:])
+	if err != nil {
+		return err
+	}
+	s.data = aead.Seal(nil, s.nonce[:], buf.Bytes(), nil)
+	v.snapshots[name] = s
+	return nil
+}
+
+// Snapshots returns the vault's snapshots, oldest first.
+func (v *Vault) Snapshots() []Snapshot {
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	var snapshots []Snapshot
+	for _, s := range v.snapshots {
+		snapshots = append(snapshots, s.Snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots
+}
+
+// DeleteSnapshot forgets the snapshot called `name`.
+func (v *Vault) DeleteSnapshot(name string) error {
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	if _, ok := v.snapshots[name]; !ok {
+		return ErrNoSuchSnapshot
+	}
+	delete(v.snapshots, name)
+	return nil
+}
+
+// clearSnapshots forgets every snapshot and wipes the key they were
+// encrypted under.
+func (v *Vault) clearSnapshots() {
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	v.snapshots = nil
+	for i := range v.snapshotKey {
+		v.snapshotKey[i] = 0x00
+	}
+}
+
+// Rollback restores the vault's credentials to the snapshot called `name`,
+// as a single change that Undo can revert, and returns the locations it
+// changed. The vault's settings are left as they are.
+func (v *Vault) Rollback(name string) ([]string, error) {
+	v.undoMu.Lock()
+	s, ok := v.snapshots[name]
+	key := v.snapshotKey
+	v.undoMu.Unlock()
+	if !ok {
+		return nil, ErrNoSuchSnapshot
+	}
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, s.nonce[:], s.data, nil)
+	if err != nil {
+		return nil, ErrCouldNotDecrypt
+	}
+	var snapshotCreds map[string]*Credential
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&snapshotCreds); err != nil {
+		return nil, err
+	}
+
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	var step undoStep
+	for location, cred := range snapshotCreds {
+		if !reflect.DeepEqual(creds[location], cred) {
+			step.before = append(step.before, journalEntry{Location: location, Credential: creds[location]})
+			step.after = append(step.after, journalEntry{Location: location, Credential: cred})
+		}
+	}
+	for location, cred := range creds {
+		if _, ok := snapshotCreds[location]; !ok {
+			step.before = append(step.before, journalEntry{Location: location, Credential: cred})
+			step.after = append(step.after, journalEntry{Location: location})
+		}
+	}
+	if len(step.after) == 0 {
+		return nil, nil
+	}
+	locations, err := v.restore(step.after)
+	if err != nil {
+		return nil, err
+	}
+	v.pushUndo(step)
+	return locations, nil
+}
@@ -0,0 +1,405 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Layout is how a vault is laid out when it is saved.
+type Layout int
+
+const (
+	// LayoutFile saves the vault as a single encrypted file. It reveals
+	// nothing about the credentials inside, but the whole file changes on
+	// every save. This is the default.
+	LayoutFile Layout = iota
+
+	// LayoutSplit saves the vault as a directory holding a header, which
+	// carries the key derivation parameters and the vault's settings, and
+	// one encrypted file per credential, named by its ID. Only the files of
+	// changed credentials are rewritten, so file sync tools transfer less
+	// and conflicts are confined to single credentials. The number of
+	// credentials, and which of them changed, can be seen without the
+	// passphrase. The salt of a split vault is only rotated by
+	// ChangePassphrase and Rekey.
+	LayoutSplit
+)
+
+const (
+	// splitHeader is the name of the header of a split vault.
+	splitHeader = "header"
+	// splitEntries is the directory holding a split vault's credentials.
+	splitEntries = "entries"
+)
+
+var (
+	// ErrSplitLocked is returned from Save if a split vault is saved while
+	// it is locked, since its credentials can not be encrypted separately.
+	ErrSplitLocked = errors.New("a vault split into one file per credential can not be saved while locked")
+
+	// ErrSplitMismatch is returned from Open if the credential files of a
+	// split vault are not the ones its header lists: one was removed, or
+	// replaced by an older version of itself.
+	ErrSplitMismatch = errors.New("the credential files of the split vault do not match its header. One may have been removed or replaced by an older version")
+)
+
+type (
+	// Storage holds the files a vault is saved as. Names are slash
+	// separated paths relative to the root of the storage.
+	Storage interface {
+		// ReadFile returns the contents of the file called `name`.
+		ReadFile(name string) ([]byte, error)
+		// WriteFile replaces the contents of the file called `name` with
+		// `data`, atomically.
+		WriteFile(name string, data []byte) error
+		// Remove deletes the file called `name`.
+		Remove(name string) error
+		// List returns the names of the files in the directory `dir`. It
+		// returns no names if the directory does not exist.
+		List(dir string) ([]string, error)
+	}
+
+	// DirStorage is a Storage that keeps files in a directory on the local
+	// filesystem.
+	DirStorage string
+
+	// splitEntry is the plaintext of a credential's file in a split vault.
+	splitEntry struct {
+		Location   string
+		Credential *Credential
+	}
+)
+
+// ReadFile implements Storage.
+func (d DirStorage) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(d.path(name))
+}
+
+// WriteFile implements Storage, by writing to a temporary file and renaming
+// it over `name`.
+func (d DirStorage) WriteFile(name string, data []byte) error {
+	filename := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	tempfile, err := ioutil.TempFile(filepath.Dir(filename), "masterkey-temp")
+	if err != nil {
+		return err
+	}
+	defer tempfile.Close()
+	if _, err = tempfile.Write(data); err != nil {
+		os.Remove(tempfile.Name())
+		return err
+	}
+	if err = tempfile.Sync(); err != nil {
+		os.Remove(tempfile.Name())
+		return err
+	}
+	if err = tempfile.Close(); err != nil {
+		os.Remove(tempfile.Name())
+		return err
+	}
+	return os.Rename(tempfile.Name(), filename)
+}
+
+// Remove implements Storage.
+func (d DirStorage) Remove(name string) error {
+	return os.Remove(d.path(name))
+}
+
+// List implements Storage.
+func (d DirStorage) List(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(d.path(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d DirStorage) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// IsSplit returns true if `path` is a directory holding a split vault.
+func IsSplit(path string) bool {
+	info, err := os.Stat(filepath.Join(path, splitHeader))
+	return err == nil && !info.IsDir()
+}
+
+// Layout returns the layout the vault is saved in.
+func (v *Vault) Layout() Layout {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.layout
+}
+
+// SetLayout sets the layout the vault is saved in by the next Save. A vault
+// saved with a new layout should be saved to a new path.
+func (v *Vault) SetLayout(layout Layout) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.layout = layout
+}
+
+// isEntryName returns true if `name` could be the name of a credential's file
+// in a split vault. Temporary files, and the conflicted copies some file
+// sync tools leave behind, are not.
+func isEntryName(name string) bool {
+	return validID(name)
+}
+
+// isIgnoredName returns true if `name`, in the entries directory of a split
+// vault, is neither a credential's file nor something to report: a file
+// left by an interrupted save, or a hidden file such as .DS_Store.
+func isIgnoredName(name string) bool {
+	return strings.HasPrefix(name, "masterkey-temp") || strings.HasPrefix(name, ".")
+}
+
+// ConflictCopies returns the names of the files in a split vault's entries
+// directory that are not credentials, such as the conflicted copies file
+// sync tools leave behind when a credential changes on two devices at once.
+// They are not read, so a change they hold is not in the vault. It is nil
+// for a vault in the file layout.
+func (v *Vault) ConflictCopies() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return append([]string(nil), v.conflictCopies...)
+}
+
+// sealEntry encrypts `entry` using `secret`, binding it to the file `name`.
+func sealEntry(secret [32]byte, name string, entry splitEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(secret[:])
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, sealed); err != nil {
+		panic(err)
+	}
+	return aead.Seal(sealed, sealed, buf.Bytes(), []byte(name)), nil
+}
+
+// openEntry decrypts a credential's file `name`, sealed by sealEntry.
+func openEntry(secret [32]byte, name string, sealed []byte) (*splitEntry, error) {
+	if len(sealed) < chacha20poly1305.NonceSizeX {
+		return nil, ErrCorruptVault
+	}
+	aead, err := chacha20poly1305.NewX(secret[:])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, sealed[:chacha20poly1305.NonceSizeX], sealed[chacha20poly1305.NonceSizeX:], []byte(name))
+	if err != nil {
+		return nil, ErrCorruptVault
+	}
+	var entry splitEntry
+	if err = gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&entry); err != nil || entry.Credential == nil || name != splitEntries+"/"+entry.Credential.ID {
+		return nil, ErrCorruptVault
+	}
+	return &entry, nil
+}
+
+// saveSplit writes the vault to `s` in the split layout and returns the
+// contents of the header it wrote, and its journal key. Credential files are
+// only rewritten if the credential changed, and the files of deleted
+// credentials are removed.
+func (v *Vault) saveSplit(s Storage) ([]byte, [32]byte, error) {
+	data, err := v.decryptData()
+	if err == ErrVaultLocked {
+		return nil, [32]byte{}, ErrSplitLocked
+	}
+	if err != nil {
+		return nil, [32]byte{}, err
+	}
+
+	duress := v.duressBlob()
+	v.mu.RLock()
+	secret := v.secret
+	vf := vaultFile{
+		Salt:        v.salt,
+		ArgonTime:   v.argonTime,
+		ArgonMemory: v.argonMemory,
+		ArgonLanes:  v.argonLanes,
+		KeyCheck:    v.currentKeyCheck(),
+		Duress:      duress,
+	}
+	v.mu.RUnlock()
+
+	// the header lists the hash of every credential's file
+	entries := make(map[string][sha256.Size]byte, len(data.Credentials))
+	for location, cred := range data.Credentials {
+		if !validID(cred.ID) {
+			return nil, [32]byte{}, ErrCorruptVault
+		}
+		entry := splitEntry{Location: location, Credential: cred}
+		name := splitEntries + "/" + cred.ID
+		if old, err := s.ReadFile(name); err == nil {
+			if oldEntry, err := openEntry(secret, name, old); err == nil && oldEntry.Location == location && bytes.Equal(credentialHash(oldEntry.Credential), credentialHash(cred)) {
+				entries[cred.ID] = sha256.Sum256(old)
+				continue
+			}
+		}
+		sealed, err := sealEntry(secret, name, entry)
+		if err != nil {
+			return nil, [32]byte{}, err
+		}
+		if err = s.WriteFile(name, sealed); err != nil {
+			return nil, [32]byte{}, err
+		}
+		entries[cred.ID] = sha256.Sum256(sealed)
+	}
+
+	// the header holds everything but the credentials
+	header, err := s.ReadFile(splitHeader)
+	if err != nil || !headerCurrent(header, vf, secret, data, entries) {
+		var buf bytes.Buffer
+		if err = gob.NewEncoder(&buf).Encode(&vaultData{Settings: data.Settings, Sync: data.Sync, Entries: entries}); err != nil {
+			return nil, [32]byte{}, err
+		}
+		if _, err = io.ReadFull(rand.Reader, vf.Nonce[:]); err != nil {
+			panic(err)
+		}
+		aead, err := chacha20poly1305.NewX(secret[:])
+		if err != nil {
+			return nil, [32]byte{}, err
+		}
+		vf.Data = aead.Seal(nil, vf.Nonce[:], buf.Bytes(), nil)
+		buf.Reset()
+		if err = writeVaultFile(&buf, vf); err != nil {
+			return nil, [32]byte{}, err
+		}
+		header = buf.Bytes()
+		if err = s.WriteFile(splitHeader, header); err != nil {
+			return nil, [32]byte{}, err
+		}
+	}
+
+	names, err := s.List(splitEntries)
+	if err != nil {
+		return nil, [32]byte{}, err
+	}
+	for _, name := range names {
+		if _, live := entries[name]; isEntryName(name) && !live {
+			if err = s.Remove(splitEntries + "/" + name); err != nil {
+				return nil, [32]byte{}, err
+			}
+		}
+	}
+	return header, journalKey(secret), nil
+}
+
+// headerCurrent returns true if `header`, the header of a split vault, has
+// the key derivation parameters and duress passphrase in `vf` and holds the
+// settings and sync state in `data`, and the hashes of the credentials'
+// files in `entries`.
+func headerCurrent(header []byte, vf vaultFile, secret [32]byte, data *vaultData, entries map[string][sha256.Size]byte) bool {
+	format, err := detectFormat(header)
+	if err != nil || format != currentFormat {
+		return false
+	}
+	old, oldData, err := openHeader(header, format, secret)
+	if err != nil || old.Salt != vf.Salt || old.ArgonTime != vf.ArgonTime || old.ArgonMemory != vf.ArgonMemory || old.ArgonLanes != vf.ArgonLanes || !bytes.Equal(old.Duress, vf.Duress) {
+		return false
+	}
+	return reflect.DeepEqual(oldData.Settings, data.Settings) && reflect.DeepEqual(oldData.Sync, data.Sync) && reflect.DeepEqual(oldData.Entries, entries)
+}
+
+// openHeader decodes `header`, the header of a split vault encoded using
+// `format`, and decrypts its data using `secret`.
+func openHeader(header []byte, format int, secret [32]byte) (vaultFile, *vaultData, error) {
+	vf, err := decodeVaultFile(header, format)
+	if err != nil {
+		return vaultFile{}, nil, err
+	}
+	aead, err := chacha20poly1305.NewX(secret[:])
+	if err != nil {
+		return vaultFile{}, nil, err
+	}
+	plaintext, err := aead.Open(nil, vf.Nonce[:], vf.Data, nil)
+	if err != nil {
+		return vaultFile{}, nil, ErrCorruptVault
+	}
+	var data vaultData
+	if err = gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&data); err != nil {
+		return vaultFile{}, nil, ErrCorruptVault
+	}
+	return vf, &data, nil
+}
+
+// openSplit opens a split vault whose header, `header`, is encoded using
+// `format`, reading its credentials from `s`. The salt is never rotated on
+// open, so that saving the vault only rewrites changed credentials.
+// ErrSplitMismatch is returned if the credentials' files are not the ones
+// listed in the header.
+func openSplit(header []byte, format int, s Storage, passphrase string, cfg openConfig) (*Vault, error) {
+	cfg.rotation = RotateManually
+	vault, err := openVault(header, format, passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+	_, data, err := openHeader(header, format, vault.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.List(splitEntries)
+	if err != nil {
+		return nil, err
+	}
+	creds := make(map[string]*Credential, len(names))
+	for _, name := range names {
+		if !isEntryName(name) {
+			if !isIgnoredName(name) {
+				vault.conflictCopies = append(vault.conflictCopies, name)
+			}
+			continue
+		}
+		sealed, err := s.ReadFile(splitEntries + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if data.Entries != nil {
+			if hash, listed := data.Entries[name]; !listed || hash != sha256.Sum256(sealed) {
+				return nil, ErrSplitMismatch
+			}
+		}
+		entry, err := openEntry(vault.secret, splitEntries+"/"+name, sealed)
+		if err != nil {
+			return nil, err
+		}
+		creds[entry.Location] = entry.Credential
+	}
+	if data.Entries != nil && len(creds) != len(data.Entries) {
+		return nil, ErrSplitMismatch
+	}
+
+	vault.layout = LayoutSplit
+	if err = vault.encrypt(creds); err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
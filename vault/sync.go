@@ -0,0 +1,313 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type (
+	// syncState records when each credential was last changed, and when
+	// credentials were deleted, keyed by credential ID. It is stored
+	// encrypted alongside the vault's credentials, and lets Sync merge two
+	// copies of a vault that were changed independently.
+	syncState struct {
+		// Modified holds the time each credential in the vault was last
+		// changed. It is zero for credentials that have not changed since
+		// the vault was written by a version of masterkey that did not
+		// record it.
+		Modified map[string]time.Time
+		// Deleted holds the time each deleted credential was deleted.
+		Deleted map[string]time.Time
+	}
+
+	// SyncResult describes the changes Sync made to a vault.
+	SyncResult struct {
+		Added   []string
+		Updated []string
+		Deleted []string
+		// Conflicts are the locations credentials were added at because
+		// their own location was taken by a different credential.
+		Conflicts []string
+	}
+)
+
+// clone returns a deep copy of s.
+func (s syncState) clone() syncState {
+	c := syncState{
+		Modified: make(map[string]time.Time, len(s.Modified)),
+		Deleted:  make(map[string]time.Time, len(s.Deleted)),
+	}
+	for id, t := range s.Modified {
+		c.Modified[id] = t
+	}
+	for id, t := range s.Deleted {
+		c.Deleted[id] = t
+	}
+	return c
+}
+
+// update records the changes described by `entries`, whose Modified times
+// must be set, given `creds` after the changes were made. Credentials that
+// are no longer in `creds` are recorded as deleted.
+func (s *syncState) update(creds map[string]*Credential, entries []journalEntry) {
+	if s.Modified == nil {
+		s.Modified = make(map[string]time.Time)
+	}
+	if s.Deleted == nil {
+		s.Deleted = make(map[string]time.Time)
+	}
+	var deletedAt time.Time
+	for _, entry := range entries {
+		switch {
+		case entry.Settings != nil:
+		case entry.Credential == nil:
+			if entry.Modified.After(deletedAt) {
+				deletedAt = entry.Modified
+			}
+		default:
+			s.Modified[entry.Credential.ID] = entry.Modified
+			delete(s.Deleted, entry.Credential.ID)
+		}
+	}
+	if deletedAt.IsZero() {
+		deletedAt = time.Now()
+	}
+
+	live := make(map[string]bool, len(creds))
+	for _, cred := range creds {
+		live[cred.ID] = true
+		if _, ok := s.Modified[cred.ID]; !ok {
+			s.Modified[cred.ID] = time.Time{}
+		}
+	}
+	for id := range s.Modified {
+		if !live[id] {
+			delete(s.Modified, id)
+			s.Deleted[id] = deletedAt
+		}
+	}
+}
+
+// known returns true if the credential with the ID `id` is, or was, in the
+// vault s belongs to.
+func (s syncState) known(id string) bool {
+	_, modified := s.Modified[id]
+	_, deleted := s.Deleted[id]
+	return modified || deleted
+}
+
+// newer returns true if credential `a`, last changed at `at`, should replace
+// credential `b`, last changed at `bt`. The most recent change wins. Ties are
+// broken by comparing the credentials' contents, so that both copies of a
+// vault pick the same credential.
+func newer(a *Credential, at time.Time, b *Credential, bt time.Time) bool {
+	if !at.Equal(bt) {
+		return at.After(bt)
+	}
+	return bytes.Compare(credentialHash(a), credentialHash(b)) > 0
+}
+
+// credentialHash returns a SHA-256 hash of the contents of `cred`. Equal
+// credentials always have the same hash.
+func credentialHash(cred *Credential) []byte {
+	h := sha256.New()
+	write := func(field []byte) {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(field)))
+		h.Write(n[:])
+		h.Write(field)
+	}
+	write([]byte(cred.ID))
+	write([]byte(cred.Username))
+	write([]byte(cred.Password))
+	write([]byte(cred.Notes))
+	write(cred.Icon)
+	names := make([]string, 0, len(cred.Meta))
+	for name := range cred.Meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write([]byte(name))
+		write([]byte(cred.Meta[name]))
+	}
+	// fields added since the hash was introduced are only written when
+	// set, so that the hashes of credentials that do not use them are
+	// unchanged
+	for _, field := range []struct{ name, value string }{{"url", cred.URL}, {"email", cred.Email}, {"folder", cred.Folder}} {
+		if field.value != "" {
+			write([]byte(field.name))
+			write([]byte(field.value))
+		}
+	}
+	for _, tag := range cred.Tags {
+		write([]byte("tag"))
+		write([]byte(tag))
+	}
+	for _, change := range cred.History {
+		write([]byte(change.Password))
+		write([]byte(change.Replaced.UTC().Format(time.RFC3339Nano)))
+	}
+	return h.Sum(nil)
+}
+
+// sameContents returns true if `a` and `b` are the same apart from their IDs.
+func sameContents(a, b *Credential) bool {
+	ac, bc := *a, *b
+	ac.ID, bc.ID = "", ""
+	return bytes.Equal(credentialHash(&ac), credentialHash(&bc))
+}
+
+// conflictLocation returns a location near `location` that is not used in
+// `creds`.
+func conflictLocation(creds map[string]*Credential, location string) string {
+	conflict := location + " (conflict)"
+	for n := 2; ; n++ {
+		if _, exists := creds[conflict]; !exists {
+			return conflict
+		}
+		conflict = fmt.Sprintf("%v (conflict %v)", location, n)
+	}
+}
+
+// Sync merges the changes made to `other`, another copy of the vault, into
+// the vault. Unlike Merge, it never fails on a conflict: credentials are
+// matched by ID, and when both copies changed the same credential the most
+// recent change wins. Credentials deleted in one copy are deleted in the
+// other, unless they were changed after the deletion. Different credentials
+// added to both copies at the same location are both kept, one of them under
+// a new location.
+//
+// Changes are ordered using the clock of the machine they were made on, so
+// a copy whose clock is far off can win conflicts it should lose. Syncing
+// both copies with each other leaves them with the same credentials.
+func (v *Vault) Sync(other *Vault) (SyncResult, error) {
+	var res SyncResult
+	if err := v.checkWritable(); err != nil {
+		return res, err
+	}
+	otherCreds, err := other.decrypt()
+	if err != nil {
+		return res, err
+	}
+	assignIDs(otherCreds)
+	other.mu.RLock()
+	otherState := other.versions.clone()
+	other.mu.RUnlock()
+
+	creds, err := v.decrypt()
+	if err != nil {
+		return res, err
+	}
+	assignIDs(creds)
+	v.mu.RLock()
+	state := v.versions.clone()
+	v.mu.RUnlock()
+
+	byID := make(map[string]string, len(creds))
+	for location, cred := range creds {
+		byID[cred.ID] = location
+	}
+	var entries []journalEntry
+	set := func(location string, cred *Credential, modified time.Time) {
+		creds[location] = cred
+		byID[cred.ID] = location
+		state.Modified[cred.ID] = modified
+		delete(state.Deleted, cred.ID)
+		entries = append(entries, journalEntry{Location: location, Credential: cred, Modified: modified})
+	}
+	remove := func(location string, deleted time.Time) {
+		delete(byID, creds[location].ID)
+		delete(creds, location)
+		entries = append(entries, journalEntry{Location: location, Modified: deleted})
+	}
+
+	otherLocations := make([]string, 0, len(otherCreds))
+	for location := range otherCreds {
+		otherLocations = append(otherLocations, location)
+	}
+	sort.Strings(otherLocations)
+	for _, otherLocation := range otherLocations {
+		otherCred := otherCreds[otherLocation]
+		otherModified := otherState.Modified[otherCred.ID]
+		if deleted, ok := state.Deleted[otherCred.ID]; ok && !otherModified.After(deleted) {
+			continue
+		}
+
+		location, exists := byID[otherCred.ID]
+		if !exists {
+			cred, taken := creds[otherLocation]
+			switch {
+			case !taken:
+				set(otherLocation, otherCred, otherModified)
+				res.Added = append(res.Added, otherLocation)
+			case !otherState.known(cred.ID) && sameContents(cred, otherCred):
+				// the credential was added to both copies, or both
+				// copies were given IDs independently: keep it under
+				// the lower of the two IDs, so that both copies agree
+				// on it.
+				if otherCred.ID < cred.ID {
+					replacement := *cred
+					replacement.ID = otherCred.ID
+					delete(byID, cred.ID)
+					set(otherLocation, &replacement, state.Modified[cred.ID])
+					res.Updated = append(res.Updated, otherLocation)
+				}
+			case otherCred.ID < cred.ID:
+				// the credential with the higher ID moves, so that
+				// both copies agree on where each ends up
+				conflict := conflictLocation(creds, otherLocation)
+				remove(otherLocation, state.Modified[cred.ID])
+				set(conflict, cred, state.Modified[cred.ID])
+				set(otherLocation, otherCred, otherModified)
+				res.Added = append(res.Added, otherLocation)
+				res.Conflicts = append(res.Conflicts, conflict)
+			default:
+				conflict := conflictLocation(creds, otherLocation)
+				set(conflict, otherCred, otherModified)
+				res.Conflicts = append(res.Conflicts, conflict)
+			}
+			continue
+		}
+
+		cred := creds[location]
+		if !newer(otherCred, otherModified, cred, state.Modified[cred.ID]) {
+			continue
+		}
+		if location != otherLocation {
+			// the credential was moved in the other copy
+			remove(location, otherModified)
+			location = otherLocation
+			if _, taken := creds[location]; taken {
+				location = conflictLocation(creds, otherLocation)
+				res.Conflicts = append(res.Conflicts, location)
+			}
+		}
+		set(location, otherCred, otherModified)
+		res.Updated = append(res.Updated, location)
+	}
+
+	for id, deleted := range otherState.Deleted {
+		if location, ok := byID[id]; ok && deleted.After(state.Modified[id]) {
+			remove(location, deleted)
+			res.Deleted = append(res.Deleted, location)
+		}
+		if deleted.After(state.Deleted[id]) && byID[id] == "" {
+			delete(state.Modified, id)
+			state.Deleted[id] = deleted
+		}
+	}
+	sort.Strings(res.Deleted)
+
+	v.mu.Lock()
+	v.versions = state
+	v.mu.Unlock()
+	if len(entries) == 0 {
+		return res, v.encrypt(creds)
+	}
+	return res, v.commit(creds, entries...)
+}
@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidTag is returned if a tag is empty or contains whitespace.
+var ErrInvalidTag = errors.New("tags must not be empty or contain whitespace")
+
+// checkTags returns ErrInvalidTag if any of `tags` is not a valid tag.
+func checkTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" || strings.IndexFunc(tag, unicode.IsSpace) >= 0 {
+			return ErrInvalidTag
+		}
+	}
+	return nil
+}
+
+// normalizeTags returns `tags` sorted, without duplicates, or nil if there
+// are none.
+func normalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// HasTag returns true if the credential is tagged with `tag`.
+func (c Credential) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTags returns true if the credential is tagged with every one of `tags`.
+func (c Credential) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !c.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tag adds `tags` to the credential at `location`. Tags it already has are
+// left as they are.
+func (v *Vault) Tag(location string, tags ...string) error {
+	if err := checkTags(tags); err != nil {
+		return err
+	}
+	return v.setField(location, func(cred *Credential) {
+		cred.Tags = normalizeTags(append(append([]string(nil), cred.Tags...), tags...))
+	})
+}
+
+// Untag removes `tags` from the credential at `location`. Tags it does not
+// have are ignored.
+func (v *Vault) Untag(location string, tags ...string) error {
+	return v.setField(location, func(cred *Credential) {
+		var kept []string
+		for _, tag := range cred.Tags {
+			remove := false
+			for _, t := range tags {
+				remove = remove || t == tag
+			}
+			if !remove {
+				kept = append(kept, tag)
+			}
+		}
+		cred.Tags = kept
+	})
+}
+
+// Tags returns every tag used in the vault, sorted, and the number of
+// credentials tagged with each.
+func (v *Vault) Tags() ([]string, map[string]int, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, nil, err
+	}
+	counts := make(map[string]int)
+	for _, cred := range creds {
+		for _, tag := range cred.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, counts, nil
+}
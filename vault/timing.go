@@ -0,0 +1,55 @@
+package vault
+
+import "time"
+
+// The operations reported to a Timer.
+const (
+	// TimeKDF is deriving a key from a passphrase.
+	TimeKDF = "kdf"
+	// TimeDecrypt is decrypting and decoding the vault's data.
+	TimeDecrypt = "decrypt"
+	// TimeIndex is decrypting and decoding the index of the vault's
+	// locations, used by Locations and Find.
+	TimeIndex = "index"
+	// TimeEncode is encoding and encrypting the vault's data after a change.
+	TimeEncode = "encode"
+	// TimeSave is writing the vault to disk.
+	TimeSave = "save"
+)
+
+// Timer is called with the name of each operation the vault performs, such
+// as TimeKDF, and how long it took, to help diagnose a slow vault.
+type Timer func(op string, d time.Duration)
+
+// since reports the time taken by `op` since `start`. It does nothing if the
+// Timer is nil.
+func (t Timer) since(op string, start time.Time) {
+	if t != nil {
+		t(op, time.Since(start))
+	}
+}
+
+// WithTimer sets the Timer of the opened vault. The time taken to derive its
+// key while opening it is reported too.
+func WithTimer(t Timer) OpenOption {
+	return func(c *openConfig) {
+		c.timer = t
+	}
+}
+
+// SetTimer sets the Timer that the vault reports the time taken by each
+// operation to, or stops reporting them if `t` is nil.
+func (v *Vault) SetTimer(t Timer) {
+	v.timerMu.Lock()
+	defer v.timerMu.Unlock()
+	v.timer = t
+}
+
+// time reports the time taken by `op` since `start` to the vault's Timer, if
+// it has one. It is deferred as v.time(op, time.Now()).
+func (v *Vault) time(op string, start time.Time) {
+	v.timerMu.Lock()
+	t := v.timer
+	v.timerMu.Unlock()
+	t.since(op, start)
+}
@@ -0,0 +1,167 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Meta tags holding a credential's TOTP secret, as a base32 secret or an
+// otpauth://totp/ URI. TOTPMeta is the one to set by hand; OTPAuthMeta is
+// written by some importers.
+const (
+	TOTPMeta    = "totp"
+	OTPAuthMeta = "otpauth"
+)
+
+// maxTOTPPeriod is the longest period, in seconds, accepted from an
+// otpauth://totp/ URI.
+const maxTOTPPeriod = 3600
+
+var (
+	// ErrNoTOTP is returned from GenerateTOTP if the credential has no TOTP
+	// secret.
+	ErrNoTOTP = errors.New("credential has no TOTP secret. Add one with `addmeta location " + TOTPMeta + " secret`")
+
+	// ErrInvalidTOTP is returned from GenerateTOTP if the credential's TOTP
+	// secret can not be decoded.
+	ErrInvalidTOTP = errors.New("TOTP secret is not a base32 secret or otpauth://totp/ URI")
+)
+
+// totpKey holds the parameters of a TOTP generator, as described by RFC
+// 6238.
+type totpKey struct {
+	secret []byte
+	hash   func() hash.Hash
+	digits int
+	period time.Duration
+}
+
+// parseTOTP parses `value`, a base32 secret or an otpauth://totp/ URI, as
+// used by most authenticator apps. Secrets default to SHA-1, 6 digits and a
+// 30 second period.
+func parseTOTP(value string) (totpKey, error) {
+	key := totpKey{hash: sha1.New, digits: 6, period: 30 * time.Second}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(strings.ToLower(value), "otpauth:") {
+		u, err := url.Parse(value)
+		if err != nil || !strings.EqualFold(u.Host, "totp") {
+			return totpKey{}, ErrInvalidTOTP
+		}
+		query := u.Query()
+		value = query.Get("secret")
+		switch strings.ToUpper(query.Get("algorithm")) {
+		case "", "SHA1":
+		case "SHA256":
+			key.hash = sha256.New
+		case "SHA512":
+			key.hash = sha512.New
+		default:
+			return totpKey{}, ErrInvalidTOTP
+		}
+		if digits := query.Get("digits"); digits != "" {
+			n, err := strconv.Atoi(digits)
+			if err != nil || n < 6 || n > 10 {
+				return totpKey{}, ErrInvalidTOTP
+			}
+			key.digits = n
+		}
+		if period := query.Get("period"); period != "" {
+			n, err := strconv.Atoi(period)
+			if err != nil || n <= 0 || n > maxTOTPPeriod {
+				return totpKey{}, ErrInvalidTOTP
+			}
+			key.period = time.Duration(n) * time.Second
+		}
+	}
+	value = strings.ToUpper(strings.TrimRight(strings.Replace(value, " ", "", -1), "="))
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(value)
+	if err != nil || len(secret) == 0 {
+		return totpKey{}, ErrInvalidTOTP
+	}
+	key.secret = secret
+	return key, nil
+}
+
+// ParseOTPAuth returns the issuer and account named by `uri`, an
+// otpauth://totp/ URI, such as otpauth://totp/Example:alice?secret=...
+// ErrInvalidTOTP is returned if it is not one, or its secret is invalid.
+func ParseOTPAuth(uri string) (issuer, account string, err error) {
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(uri)), "otpauth:") {
+		return "", "", ErrInvalidTOTP
+	}
+	if _, err := parseTOTP(uri); err != nil {
+		return "", "", err
+	}
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return "", "", ErrInvalidTOTP
+	}
+	// the label is the account, optionally prefixed by the issuer and a
+	// colon; the issuer parameter takes precedence over the prefix
+	account = strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(account, ":"); i >= 0 {
+		issuer, account = account[:i], account[i+1:]
+	}
+	if param := u.Query().Get("issuer"); param != "" {
+		issuer = param
+	}
+	return strings.TrimSpace(issuer), strings.TrimSpace(account), nil
+}
+
+// code returns the code valid at `t`, and how long it remains valid.
+func (key totpKey) code(t time.Time) (string, time.Duration) {
+	period := int64(key.period / time.Second)
+	counter := t.Unix() / period
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(key.hash, key.secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+	mod := uint64(1)
+	for i := 0; i < key.digits; i++ {
+		mod *= 10
+	}
+	remaining := time.Duration((counter+1)*period-t.Unix()) * time.Second
+	return fmt.Sprintf("%0*d", key.digits, value%mod), remaining
+}
+
+// TOTPSecret returns the credential's TOTP secret, or "" if it has none.
+func (c Credential) TOTPSecret() string {
+	if secret := c.Meta[TOTPMeta]; secret != "" {
+		return secret
+	}
+	return c.Meta[OTPAuthMeta]
+}
+
+// GenerateTOTP returns the current RFC 6238 code for the credential at
+// `location`, and how long it remains valid.
+func (v *Vault) GenerateTOTP(location string) (string, time.Duration, error) {
+	cred, err := v.Get(location)
+	if err != nil {
+		return "", 0, err
+	}
+	secret := cred.TOTPSecret()
+	if secret == "" {
+		return "", 0, ErrNoTOTP
+	}
+	key, err := parseTOTP(secret)
+	if err != nil {
+		return "", 0, err
+	}
+	code, remaining := key.code(time.Now())
+	return code, remaining, nil
+}
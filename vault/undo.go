@@ -0,0 +1,213 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sort"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	// ErrNothingToUndo is returned from Undo if no change has been made
+	// since the vault was opened or last saved.
+	ErrNothingToUndo = errors.New("nothing to undo")
+
+	// ErrNothingToRedo is returned from Redo if no change has been undone
+	// since the last change was made.
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+type (
+	// undoStep is a change to the vault's credentials, as the states of
+	// the credentials it touched before and after it.
+	undoStep struct {
+		before []journalEntry
+		after  []journalEntry
+	}
+
+	// sealedStep is an undoStep encrypted under the vault's undoKey, as it
+	// is kept until it is undone or redone.
+	sealedStep struct {
+		nonce [24]byte
+		data  []byte
+	}
+)
+
+// sealUndo encrypts `step` under the vault's undoKey. v.undoMu must be held.
+func (v *Vault) sealUndo(step undoStep) (sealedStep, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode([2][]journalEntry{step.before, step.after}); err != nil {
+		return sealedStep{}, err
+	}
+	var sealed sealedStep
+	if _, err := io.ReadFull(rand.Reader, sealed.nonce[:]); err != nil {
+		panic(err)
+	}
+	aead, err := chacha20poly1305.NewX(v.undoKey[:])
+	if err != nil {
+		return sealedStep{}, err
+	}
+	sealed.data = aead.Seal(nil, sealed.nonce[:], buf.Bytes(), nil)
+	return sealed, nil
+}
+
+// openUndo decrypts `sealed` using the vault's undoKey. v.undoMu must be
+// held.
+func (v *Vault) openUndo(sealed sealedStep) (undoStep, error) {
+	aead, err := chacha20poly1305.NewX(v.undoKey[:])
+	if err != nil {
+		return undoStep{}, err
+	}
+	plaintext, err := aead.Open(nil, sealed.nonce[:], sealed.data, nil)
+	if err != nil {
+		return undoStep{}, ErrCouldNotDecrypt
+	}
+	var states [2][]journalEntry
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&states); err != nil {
+		return undoStep{}, err
+	}
+	return undoStep{before: states[0], after: states[1]}, nil
+}
+
+// newUndoStep returns the undoStep for `entries`, which are about to be
+// recorded, given `old`, the credentials before they were made. It is empty
+// if `entries` only change the vault's settings or bookkeeping such as usage
+// statistics, so that Undo skips over them.
+func newUndoStep(old map[string]*Credential, entries []journalEntry) undoStep {
+	var step undoStep
+	for _, entry := range entries {
+		if entry.Settings != nil || entry.keepModified {
+			continue
+		}
+		step.before = append(step.before, journalEntry{Location: entry.Location, Credential: old[entry.Location]})
+		step.after = append(step.after, journalEntry{Location: entry.Location, Credential: entry.Credential})
+	}
+	return step
+}
+
+// pushUndo records `step`, a change that was just made, so that Undo can
+// revert it. Changes undone before it can no longer be redone. The step is
+// kept encrypted under a random key, generated afresh once no steps are
+// left, so that the credentials it holds are not left in memory unencrypted.
+func (v *Vault) pushUndo(step undoStep) {
+	if len(step.after) == 0 {
+		return
+	}
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	if len(v.undo) == 0 && len(v.redo) == 0 {
+		if _, err := io.ReadFull(rand.Reader, v.undoKey[:]); err != nil {
+			panic(err)
+		}
+	}
+	sealed, err := v.sealUndo(step)
+	if err != nil {
+		// the change was made; it just can not be undone
+		return
+	}
+	v.undo = append(v.undo, sealed)
+	v.redo = nil
+}
+
+// clearUndo forgets every change Undo and Redo could revert or make again,
+// and wipes the key they were encrypted under.
+func (v *Vault) clearUndo() {
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	v.undo, v.redo = nil, nil
+	for i := range v.undoKey {
+		v.undoKey[i] = 0x00
+	}
+}
+
+// Undo reverts the last change made to the vault's credentials since it was
+// opened or last saved, and returns the locations it changed. Changes to the
+// vault's settings are not undone.
+func (v *Vault) Undo() ([]string, error) {
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	if len(v.undo) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	sealed := v.undo[len(v.undo)-1]
+	step, err := v.openUndo(sealed)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := v.restore(step.before)
+	if err != nil {
+		return nil, err
+	}
+	v.undo = v.undo[:len(v.undo)-1]
+	v.redo = append(v.redo, sealed)
+	return locations, nil
+}
+
+// Redo makes the last change reverted by Undo again, and returns the
+// locations it changed.
+func (v *Vault) Redo() ([]string, error) {
+	v.undoMu.Lock()
+	defer v.undoMu.Unlock()
+	if len(v.redo) == 0 {
+		return nil, ErrNothingToRedo
+	}
+	sealed := v.redo[len(v.redo)-1]
+	step, err := v.openUndo(sealed)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := v.restore(step.after)
+	if err != nil {
+		return nil, err
+	}
+	v.redo = v.redo[:len(v.redo)-1]
+	v.undo = append(v.undo, sealed)
+	return locations, nil
+}
+
+// restore puts the credentials described by `states` back in the vault, as
+// a new change, and returns their locations. Their CreatedAt and ModifiedAt
+// are restored along with them.
+func (v *Vault) restore(states []journalEntry) ([]string, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var locations []string
+	var entries []journalEntry
+	var events []Event
+	for _, state := range states {
+		entry := journalEntry{Location: state.Location, keepModified: true}
+		_, existed := creds[state.Location]
+		if state.Credential == nil {
+			delete(creds, state.Location)
+		} else {
+			cred := *state.Credential
+			entry.Credential = &cred
+			creds[state.Location] = &cred
+		}
+		entries = append(entries, entry)
+		if existed || entry.Credential == nil {
+			events = append(events, entry.event())
+		} else {
+			events = append(events, Event{Type: EventAdd, Location: entry.Location})
+		}
+		if !seen[state.Location] {
+			seen[state.Location] = true
+			locations = append(locations, state.Location)
+		}
+	}
+	if err := v.write(creds, entries...); err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		v.publish(event)
+	}
+	sort.Strings(locations)
+	return locations, nil
+}
@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Reserved meta tags that store how a credential has been used, if the vault
+// tracks usage.
+const (
+	usesMeta     = ReservedMetaPrefix + "uses"
+	lastUsedMeta = ReservedMetaPrefix + "last-used"
+)
+
+// Usage returns the number of times the credential has been used and when it
+// was last used. Both are zero if it has never been used or the vault does
+// not track usage.
+func (c Credential) Usage() (int, time.Time) {
+	uses, _ := strconv.Atoi(c.Meta[usesMeta])
+	lastUsed, _ := time.Parse(time.RFC3339, c.Meta[lastUsedMeta])
+	return uses, lastUsed
+}
+
+// RecordUse counts a use of the credential at `location`, such as its
+// password being copied, if the vault's settings enable TrackUsage. Uses are
+// not recorded while the vault is write-protected.
+func (v *Vault) RecordUse(location string) error {
+	if !v.Settings().TrackUsage {
+		return nil
+	}
+	if err := v.checkWritable(); err != nil {
+		return nil
+	}
+	cred, err := v.Get(location)
+	if err != nil {
+		return err
+	}
+	uses, _ := cred.Usage()
+	return v.updateReservedMetas(location, map[string]string{
+		usesMeta:     strconv.Itoa(uses + 1),
+		lastUsedMeta: time.Now().UTC().Format(time.RFC3339),
+	}, true)
+}
+
+// SetTrackUsage turns usage tracking on or off. Turning it off deletes the
+// usage recorded for every credential.
+func (v *Vault) SetTrackUsage(on bool) error {
+	if err := v.checkWritable(); err != nil {
+		return err
+	}
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	settings := v.Settings()
+	if on && !settings.TrackUsage {
+		settings.TrackUsageSince = time.Now().UTC()
+	}
+	if !on {
+		settings.TrackUsageSince = time.Time{}
+	}
+	settings.TrackUsage = on
+	entries := []journalEntry{{Settings: &settings}}
+	if !on {
+		for location, cred := range creds {
+			if _, ok := cred.Meta[usesMeta]; !ok {
+				if _, ok = cred.Meta[lastUsedMeta]; !ok {
+					continue
+				}
+			}
+			delete(cred.Meta, usesMeta)
+			delete(cred.Meta, lastUsedMeta)
+			entries = append(entries, journalEntry{Location: location, Credential: cred, keepModified: true})
+		}
+	}
+	v.mu.Lock()
+	v.settings = settings
+	v.mu.Unlock()
+	return v.commit(creds, entries...)
+}
+
+// LocationsByLastUsed returns the locations in the vault, most recently used
+// first. Locations that have never been used follow in alphabetical order.
+func (v *Vault) LocationsByLastUsed() ([]string, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	var locations []string
+	lastUsed := make(map[string]time.Time)
+	for location, cred := range creds {
+		locations = append(locations, location)
+		_, lastUsed[location] = cred.Usage()
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		ti, tj := lastUsed[locations[i]], lastUsed[locations[j]]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return locations[i] < locations[j]
+	})
+	return locations, nil
+}
+
+// LocationsByModified returns the locations in the vault, most recently
+// changed first. Locations whose ModifiedAt is not known follow in
+// alphabetical order.
+func (v *Vault) LocationsByModified() ([]string, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	var locations []string
+	for location := range creds {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		ti, tj := creds[locations[i]].ModifiedAt, creds[locations[j]].ModifiedAt
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return locations[i] < locations[j]
+	})
+	return locations, nil
+}
+
+// StaleCredential is a credential returned by StaleCredentials.
+type StaleCredential struct {
+	Location string
+	// LastUsed is zero if the credential has not been used since usage
+	// tracking was turned on.
+	LastUsed time.Time
+}
+
+// StaleCredentials returns the credentials that have not been used since
+// `cutoff`, least recently used first, including archived ones. Credentials
+// that have never been used are only stale if usage has been tracked since
+// before `cutoff`. Nothing is stale if the vault does not track usage.
+func (v *Vault) StaleCredentials(cutoff time.Time) ([]StaleCredential, error) {
+	creds, err := v.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	settings := v.Settings()
+	if !settings.TrackUsage {
+		return nil, nil
+	}
+	var stale []StaleCredential
+	for location, cred := range creds {
+		_, lastUsed := cred.Usage()
+		if lastUsed.IsZero() && settings.TrackUsageSince.After(cutoff) {
+			continue
+		}
+		if lastUsed.Before(cutoff) {
+			stale = append(stale, StaleCredential{Location: location, LastUsed: lastUsed})
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		if !stale[i].LastUsed.Equal(stale[j].LastUsed) {
+			return stale[i].LastUsed.Before(stale[j].LastUsed)
+		}
+		return stale[i].Location < stale[j].Location
+	})
+	return stale, nil
+}
@@ -2,11 +2,13 @@ package vault
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/base64"
 	"encoding/csv"
 	"encoding/gob"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -17,7 +19,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/avahowell/masterkey/filelock"
 	"github.com/avahowell/masterkey/pwgen"
@@ -38,23 +43,40 @@ const (
 	genPasswordLen   = 32
 )
 
-var (
-	defaultArgonMemory = func() uint32 {
-		if flag.Lookup("test.v") != nil { // testing
-			return 1e4
-		}
-		return 2e6
-	}()
-)
+// defaultArgonMemory returns the argon2 memory, in KiB, that new vaults
+// derive their key with. It is checked when a vault is created rather than
+// when the package is initialized, since the testing flags are only
+// registered after that.
+func defaultArgonMemory() uint32 {
+	if flag.Lookup("test.v") != nil { // testing
+		return 1e4
+	}
+	return 2e6
+}
 
 var (
 	// ErrNoSuchCredential is returned from a Get call if the requested
 	// credential does not exist
 	ErrNoSuchCredential = errors.New("credential at specified location does not exist in vault")
 
+	errFileClosed = errors.New("vault file has already been decrypted or closed")
+
+	// ErrInvalidKDFParams is returned from Rekey if the requested key
+	// derivation parameters can not be used.
+	ErrInvalidKDFParams = errors.New("argon2 memory must be at least 8 KiB per lane")
+
 	// ErrCouldNotDecrypt is returned if decryption fails.
 	ErrCouldNotDecrypt = errors.New("provided decryption key is incorrect or the provided vault is corrupt")
 
+	// ErrWrongPassphrase is returned from Open if the passphrase does not
+	// match the one the vault was encrypted with.
+	ErrWrongPassphrase = errors.New("incorrect passphrase")
+
+	// ErrCorruptVault is returned from Open if the vault file is damaged or
+	// has been modified, and so can not be decrypted even with the correct
+	// passphrase.
+	ErrCorruptVault = errors.New("vault file is corrupt or has been modified")
+
 	// ErrCredentialExists is returned from Add if a credential already exists
 	// at the provided location.
 	ErrCredentialExists = errors.New("credential at specified location already exists")
@@ -80,10 +102,172 @@ type (
 		argonMemory uint32
 		argonLanes  uint8
 		lock        *filelock.FileLock
-	}
 
-	// vaultFile defines the file format of the vault stored on disk, encoded using
-	// json.
+		// mu guards the encrypted state of the vault, so that it can be
+		// saved from another goroutine while it is being modified.
+		mu sync.RWMutex
+
+		// onChange is called after each change to the vault's data.
+		onChange func()
+		// onSave is called with the filename after each save.
+		onSave func(string)
+		// subs are sent events by publish.
+		subs subscribers
+
+		// journal records changes made since the vault was last saved, if
+		// the vault was opened from a file. recovered is the number of
+		// changes replayed from the journal when the vault was opened.
+		journal   *journal
+		recovered int
+		// fileKey is the journal key for the vault file the vault was
+		// opened from, which was encrypted before the salt was rotated.
+		fileKey [32]byte
+
+		// pendingSalt and pendingSecret replace salt and secret when the
+		// vault is first changed, if rotatePending is set by RotateOnSave.
+		pendingSalt   [24]byte
+		pendingSecret [32]byte
+		rotatePending bool
+
+		// locked is set by Lock, which wipes secret. lockCheck is the
+		// keyCheck of the wiped secret, used to verify Unlock, and
+		// lockJournalKey its journalKey, used by Save while locked.
+		locked         bool
+		lockCheck      []byte
+		lockJournalKey [32]byte
+
+		// writeProtected is set by ProtectWrites. Changes are refused
+		// until writesAllowedAt, or until AllowWrites if it is zero.
+		writeProtected  bool
+		writesAllowedAt time.Time
+
+		// dataFormat is the file format version that `data` is encoded in.
+		dataFormat int
+
+		// index is the locationIndex of the credentials in `data`,
+		// encrypted under secret using indexNonce. It is rebuilt whenever
+		// `data` is encrypted, and is not written to the vault's file.
+		index      []byte
+		indexNonce [24]byte
+
+		// settings is the plaintext copy of the settings stored in `data`.
+		settings Settings
+		// versions is the plaintext copy of the sync state stored in
+		// `data`.
+		versions syncState
+
+		// layout is the layout Save writes the vault in. conflictCopies
+		// are the files ignored when a split vault was opened.
+		layout         Layout
+		conflictCopies []string
+
+		// duress is the sealed duress passphrase written to the vault's
+		// file, or a placeholder if none is set. decoy is set on the
+		// vault opened by a DuressDecoy passphrase, and decoyFile on
+		// those whose credentials can be saved.
+		duress    []byte
+		decoy     bool
+		decoyFile *decoyFile
+
+		// undo and redo hold the changes Undo and Redo revert and make
+		// again, most recent last, encrypted under undoKey. Both are
+		// cleared when the vault is saved. snapshots are the restore
+		// points created by CreateSnapshot, encrypted under snapshotKey.
+		// undoMu guards them all.
+		undoMu      sync.Mutex
+		undo        []sealedStep
+		redo        []sealedStep
+		undoKey     [32]byte
+		snapshots   map[string]snapshot
+		snapshotKey [32]byte
+
+		// timer is reported the time taken by each operation, if set.
+		// timerMu guards it, apart from mu, which is held while timing.
+		timerMu sync.Mutex
+		timer   Timer
+	}
+
+	// vaultData is the plaintext payload of a vault, encoded using gob
+	// before being encrypted. Vaults written before formatV2 store only
+	// the credential map.
+	vaultData struct {
+		Credentials map[string]*Credential
+		Settings    Settings
+		Sync        syncState
+
+		// Entries is set in the header of a split vault to the hash of
+		// each credential's file, by name, so that a file that is
+		// removed or replaced by an older version is noticed. Headers
+		// written before it was added leave it nil.
+		Entries map[string][sha256.Size]byte
+	}
+
+	// Settings are per-vault options. They are stored encrypted alongside
+	// the vault's credentials.
+	Settings struct {
+		// ConfirmDestructive requires the master passphrase to be entered
+		// again before destructive bulk operations are carried out.
+		ConfirmDestructive bool
+
+		// MaxLocationLength is the longest location, in characters, that
+		// can be added to the vault. Zero means DefaultMaxLocationLength.
+		MaxLocationLength int
+
+		// NormalizeHostnames lowercases locations that are hostnames or
+		// URLs when they are added or looked up.
+		NormalizeHostnames bool
+
+		// SensitiveUsernames masks every username when it is displayed and
+		// leaves it out of plaintext exports.
+		SensitiveUsernames bool
+
+		// TrackUsage records how many times each credential is used, and
+		// when it was last used, in its reserved meta. TrackUsageSince is
+		// when it was turned on.
+		TrackUsage      bool
+		TrackUsageSince time.Time
+
+		// SizeWarning is the encrypted size, in bytes, above which the
+		// vault is too large. Zero means DefaultSizeWarning.
+		SizeWarning int
+
+		// PadData pads the vault's data, and each record of its journal,
+		// before they are encrypted, so that their sizes only reveal
+		// roughly how much they hold, and do not change as single
+		// credentials are added. Split vaults are not
+		// padded, as their number of files shows how many credentials
+		// they hold.
+		PadData bool
+
+		// RemoteURL is the URL of the vault on a sync server.
+		RemoteURL string
+
+		// DuressAction is the action of the vault's duress passphrase, or
+		// DuressNone if it has none.
+		DuressAction DuressAction
+
+		// Timeout is how long to wait with no activity before exiting, and
+		// ClipboardTimeout how long copied secrets stay on the clipboard,
+		// when the vault is open. Zero leaves them to the defaults.
+		Timeout          time.Duration
+		ClipboardTimeout time.Duration
+		// EnforceTimeouts makes Timeout and ClipboardTimeout the longest
+		// allowed: options given on the command line or to a single
+		// command can shorten them, but not lengthen them.
+		EnforceTimeouts bool
+	}
+
+	// KDFParams are the argon2id parameters used to derive a vault's key
+	// from its passphrase. Memory is in KiB.
+	KDFParams struct {
+		Time   uint32
+		Memory uint32
+		Lanes  uint8
+	}
+
+	// vaultFile defines the file format of the vault stored on disk. It is
+	// encoded in binary, see MarshalBinary, or in vaults written before
+	// formatV3, using json. Both encodings are canonical.
 	vaultFile struct {
 		ArgonTime   uint32
 		ArgonMemory uint32
@@ -91,18 +275,113 @@ type (
 		Nonce       [24]byte
 		Salt        [24]byte
 		Data        []byte
+
+		// KeyCheck is a MAC of a fixed string under the derived key. It
+		// lets Open tell a wrong passphrase from corrupt data without
+		// revealing anything about the key.
+		KeyCheck []byte
+
+		// Duress is the sealed duress passphrase, or random data of the
+		// same length if none is set.
+		Duress []byte
 	}
 
-	// Credential defines a Username and Password, and a map of Metadata to store
-	// inside the vault.
+	// Credential defines a Username and Password, free-form multi-line
+	// Notes, the URL of the site and the Email address of the account, an
+	// optional Icon, and a map of Metadata to store inside the vault.
 	Credential struct {
 		Username string
 		Password string
+		Notes    string
+		URL      string
+		Email    string
+
+		// Icon is a small image, such as the site's favicon, in PNG, ICO,
+		// or another format recognized by http.DetectContentType.
+		Icon []byte
 
 		Meta map[string]string
+
+		// Folder is the folder the credential is filed in, such as
+		// work/aws/prod, or "" for the top level. See CleanFolder.
+		Folder string
+
+		// Tags group credentials beyond their locations, such as work or
+		// finance. They are sorted, without duplicates.
+		Tags []string
+
+		// ID is a random UUID assigned when the credential is added to
+		// the vault. Unlike its location, it never changes, so it can be
+		// used to refer to the credential across renames and between
+		// copies of the vault.
+		ID string
+
+		// History holds the passwords the credential had before its
+		// current one, oldest first. Edit and Regenerate add to it.
+		History []PasswordChange
+
+		// CreatedAt is when the credential was added to the vault, and
+		// ModifiedAt when it was last changed. Recording a use of the
+		// credential does not change it. Both are zero for credentials
+		// not changed since the vault was written by a version of
+		// masterkey that did not record them.
+		CreatedAt  time.Time
+		ModifiedAt time.Time
 	}
 )
 
+// MarshalJSON implements json.Marshaler using a canonical encoding of the
+// vault file: fields are always written in declaration order with no
+// whitespace, Nonce and Salt are written as arrays of byte values, and Data is
+// written using padded standard base64, as are KeyCheck and Duress. Duress is
+// left out if it is nil. Two equal vaultFiles always encode to the same
+// bytes, regardless of the version of Go used to write them. The encoding is
+// decodable by encoding/json.
+func (vf vaultFile) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	writeBytes := func(bs []byte) {
+		buf.WriteByte('[')
+		for i, b := range bs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.Itoa(int(b)))
+		}
+		buf.WriteByte(']')
+	}
+	writeBase64 := func(bs []byte) {
+		if bs == nil {
+			buf.WriteString("null")
+			return
+		}
+		buf.WriteByte('"')
+		buf.WriteString(base64.StdEncoding.EncodeToString(bs))
+		buf.WriteByte('"')
+	}
+
+	buf.WriteString(`{"ArgonTime":`)
+	buf.WriteString(strconv.FormatUint(uint64(vf.ArgonTime), 10))
+	buf.WriteString(`,"ArgonMemory":`)
+	buf.WriteString(strconv.FormatUint(uint64(vf.ArgonMemory), 10))
+	buf.WriteString(`,"ArgonLanes":`)
+	buf.WriteString(strconv.FormatUint(uint64(vf.ArgonLanes), 10))
+	buf.WriteString(`,"Nonce":`)
+	writeBytes(vf.Nonce[:])
+	buf.WriteString(`,"Salt":`)
+	writeBytes(vf.Salt[:])
+	buf.WriteString(`,"Data":`)
+	writeBase64(vf.Data)
+	buf.WriteString(`,"KeyCheck":`)
+	writeBase64(vf.KeyCheck)
+	if vf.Duress != nil {
+		buf.WriteString(`,"Duress":`)
+		writeBase64(vf.Duress)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
 // New creates a new, empty, vault using the passphrase provided to
 // `passphrase`.
 func New(passphrase string) (*Vault, error) {
@@ -115,7 +394,7 @@ func New(passphrase string) (*Vault, error) {
 	}
 
 	var secret [32]byte
-	skb := argon2.IDKey([]byte(passphrase), salt[:], defaultArgonTime, defaultArgonMemory, uint8(runtime.NumCPU()), keyLen)
+	skb := argon2.IDKey([]byte(passphrase), salt[:], defaultArgonTime, defaultArgonMemory(), uint8(runtime.NumCPU()), keyLen)
 	subtle.ConstantTimeCopy(1, secret[:], skb)
 
 	v := &Vault{
@@ -123,7 +402,7 @@ func New(passphrase string) (*Vault, error) {
 		salt:        salt,
 		secret:      secret,
 		argonTime:   defaultArgonTime,
-		argonMemory: defaultArgonMemory,
+		argonMemory: defaultArgonMemory(),
 		argonLanes:  uint8(runtime.NumCPU()),
 	}
 
@@ -135,14 +414,9 @@ func New(passphrase string) (*Vault, error) {
 	return v, nil
 }
 
-// openVaultCompat opens an on-disk vault, using the legacy format
-// (NACL/Secretbox, scrypt).
-func openVaultCompat(filename, passphrase string) (*Vault, error) {
-	bs, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-
+// openVaultCompat opens the contents of a vault file, bs, using the legacy
+// format (NACL/Secretbox, scrypt).
+func openVaultCompat(bs []byte, passphrase string) (*Vault, error) {
 	var salt, nonce [24]byte
 	subtle.ConstantTimeCopy(1, salt[:], bs[:24])
 	subtle.ConstantTimeCopy(1, nonce[:], bs[24:48])
@@ -157,24 +431,35 @@ func openVaultCompat(filename, passphrase string) (*Vault, error) {
 
 	decryptedBytes, success := secretbox.Open(nil, bs[48:], &nonce, &secret)
 	if !success {
-		return nil, ErrCouldNotDecrypt
+		return nil, ErrWrongPassphrase
 	}
 
+	// The vault is upgraded to an argon2 key derived from the same salt.
+	// It is only derived once the passphrase is known to be right, while
+	// the credentials are decoded.
+	argonLanes := uint8(runtime.NumCPU())
+	argonKey := make(chan []byte, 1)
+	go func() {
+		argonKey <- argon2.IDKey([]byte(passphrase), salt[:], defaultArgonTime, defaultArgonMemory(), argonLanes, keyLen)
+	}()
+
 	credentials := make(map[string]*Credential)
 	err = gob.NewDecoder(bytes.NewBuffer(decryptedBytes)).Decode(&credentials)
 	if err != nil {
-		return nil, err
+		<-argonKey
+		return nil, ErrCorruptVault
 	}
 
 	v := &Vault{
 		salt:        salt,
 		secret:      secret,
-		argonLanes:  uint8(runtime.NumCPU()),
+		fileKey:     journalKey(secret),
+		argonLanes:  argonLanes,
 		argonTime:   defaultArgonTime,
-		argonMemory: defaultArgonMemory,
+		argonMemory: defaultArgonMemory(),
 	}
 
-	skb := argon2.IDKey([]byte(passphrase), salt[:], v.argonTime, v.argonMemory, v.argonLanes, keyLen)
+	skb := <-argonKey
 	subtle.ConstantTimeCopy(1, v.secret[:], skb)
 
 	err = v.encrypt(credentials)
@@ -185,45 +470,83 @@ func openVaultCompat(filename, passphrase string) (*Vault, error) {
 	return v, nil
 }
 
-// openVault opens an on-disk vault using the current format (salt:nonce:data).
-func openVault(filename, passphrase string) (*Vault, error) {
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	vf := vaultFile{}
-	err = json.NewDecoder(f).Decode(&vf)
+// openVault opens the contents of a vault file, bs, encoded using the
+// provided JSON-based `format`. The salt is rotated according to the
+// RotationPolicy in `cfg`.
+func openVault(bs []byte, format int, passphrase string, cfg openConfig) (*Vault, error) {
+	vf, err := decodeVaultFile(bs, format)
 	if err != nil {
 		return nil, err
 	}
 
+	start := time.Now()
 	skb := argon2.IDKey([]byte(passphrase), vf.Salt[:], vf.ArgonTime, vf.ArgonMemory, vf.ArgonLanes, keyLen)
+	cfg.timer.since(TimeKDF, start)
 	var secret [32]byte
 	subtle.ConstantTimeCopy(1, secret[:], skb)
 
+	// Vaults without a key check can't tell a wrong passphrase from damaged
+	// data, so an authentication failure is assumed to be a typo.
+	keyOK := vf.KeyCheck == nil || subtle.ConstantTimeCompare(vf.KeyCheck, keyCheck(secret)) == 1
+	if !keyOK {
+		if action, decoy, key := unsealDuress(vf.Duress, passphrase); action != DuressNone {
+			return nil, duressError{action: action, decoy: decoy, key: key, file: vf}
+		}
+		return nil, ErrWrongPassphrase
+	}
+
 	vault := &Vault{
 		data:        vf.Data,
 		nonce:       vf.Nonce,
 		secret:      secret,
+		fileKey:     journalKey(secret),
 		salt:        vf.Salt,
 		argonTime:   vf.ArgonTime,
 		argonMemory: vf.ArgonMemory,
 		argonLanes:  vf.ArgonLanes,
+		dataFormat:  format,
+		duress:      vf.Duress,
+		timer:       cfg.timer,
 	}
 
-	// rotate the salt on open
-	creds, err := vault.decrypt()
-	if err != nil {
-		return nil, err
+	data, err := vault.decryptData()
+	if err == ErrCouldNotDecrypt && vf.KeyCheck == nil {
+		return nil, ErrWrongPassphrase
 	}
-	_, err = io.ReadFull(rand.Reader, vault.salt[:])
 	if err != nil {
-		panic(err)
+		return nil, ErrCorruptVault
+	}
+	creds := data.Credentials
+	vault.settings = data.Settings
+	vault.versions = data.Sync
+
+	if cfg.rotation != RotateManually {
+		var salt [24]byte
+		if _, err = io.ReadFull(rand.Reader, salt[:]); err != nil {
+			panic(err)
+		}
+		start = time.Now()
+		skb = argon2.IDKey([]byte(passphrase), salt[:], vault.argonTime, vault.argonMemory, vault.argonLanes, keyLen)
+		cfg.timer.since(TimeKDF, start)
+		if cfg.rotation == RotateOnOpen {
+			vault.salt = salt
+			subtle.ConstantTimeCopy(1, vault.secret[:], skb)
+		} else {
+			vault.pendingSalt = salt
+			subtle.ConstantTimeCopy(1, vault.pendingSecret[:], skb)
+			vault.rotatePending = true
+		}
 	}
-	skb = argon2.IDKey([]byte(passphrase), vault.salt[:], vault.argonTime, vault.argonMemory, vault.argonLanes, keyLen)
-	subtle.ConstantTimeCopy(1, vault.secret[:], skb)
 
-	err = vault.encrypt(creds)
+	// Data in an older format is re-encrypted even if the salt is not being
+	// rotated yet, so that it can be written in the current format.
+	if cfg.rotation == RotateOnOpen || vault.dataFormat < currentFormat {
+		err = vault.encrypt(creds)
+	} else {
+		vault.mu.Lock()
+		err = vault.sealIndexLocked(creds)
+		vault.mu.Unlock()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -231,11 +554,26 @@ func openVault(filename, passphrase string) (*Vault, error) {
 	return vault, nil
 }
 
-// Open reads a vault from the location provided to `filename` and decrypts
-// it using `passphrase`. If decryption succeeds, new nonce is chosen and the
-// vault is re-encrypted, ensuring nonces are unique and not reused across
-// sessions.
-func Open(filename string, passphrase string) (*Vault, error) {
+// File is a vault file that has been locked and read from disk, but not yet
+// decrypted. It allows a caller to retry decryption with several passphrases
+// without releasing the lock or re-reading the file between attempts.
+type File struct {
+	bs     []byte
+	format int
+	path   string
+	// split is set if the file is the header of a split vault, whose
+	// credentials are read from split.
+	split Storage
+
+	mu   sync.Mutex
+	lock *filelock.FileLock
+}
+
+// ReadFile locks the vault at `filename`, reads it, and detects its format.
+// If `filename` is a directory holding a split vault, its header is read.
+// The lock is held until Close is called or until Decrypt succeeds, at which
+// point it is transferred to the returned Vault.
+func ReadFile(filename string) (*File, error) {
 	vaultPath, err := filepath.Abs(filename)
 	if err != nil {
 		return nil, err
@@ -244,24 +582,208 @@ func Open(filename string, passphrase string) (*Vault, error) {
 	if err != nil {
 		return nil, err
 	}
-	vault, err := openVault(vaultPath, passphrase)
+	var split Storage
+	if IsSplit(vaultPath) {
+		split = DirStorage(vaultPath)
+	}
+	var bs []byte
+	if split != nil {
+		bs, err = split.ReadFile(splitHeader)
+	} else {
+		bs, err = ioutil.ReadFile(vaultPath)
+	}
 	if err != nil {
-		vault, err = openVaultCompat(vaultPath, passphrase)
-		if err != nil {
-			lock.Unlock()
-			return nil, err
+		lock.Unlock()
+		return nil, err
+	}
+	format, err := detectFormat(bs)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return &File{
+		bs:     bs,
+		format: format,
+		path:   vaultPath,
+		split:  split,
+		lock:   lock,
+	}, nil
+}
+
+// Outdated returns true if the file is in an older format than the one
+// vaults are saved in. Vaults opened from an outdated file are upgraded in
+// memory, and are written in the current format the next time they are
+// saved.
+func (f *File) Outdated() bool {
+	return f.format < currentFormat
+}
+
+// Legacy returns true if the file is in the original format, whose key is
+// derived using scrypt rather than argon2.
+func (f *File) Legacy() bool {
+	return f.format == formatLegacy
+}
+
+// Decrypt decrypts the file using `passphrase`. If decryption succeeds, the
+// salt is rotated according to the RotationPolicy set in `opts`, RotateOnOpen
+// by default, and any changes left in the vault's journal by a session that
+// did not save are replayed. If decryption fails, the file remains locked and
+// Decrypt may be called again.
+func (f *File) Decrypt(passphrase string, opts ...OpenOption) (*Vault, error) {
+	if f.closed() {
+		return nil, errFileClosed
+	}
+	cfg := newOpenConfig(opts)
+	vault, err := f.open(passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return f.claim(vault, cfg)
+}
+
+// DecryptContext is like Decrypt, but returns ctx.Err() as soon as `ctx` is
+// done. Key derivation can not be interrupted, so it carries on in the
+// background and its result is discarded, leaving the file locked so that
+// decryption may be tried again. DecryptContext may be called concurrently.
+func (f *File) DecryptContext(ctx context.Context, passphrase string, opts ...OpenOption) (*Vault, error) {
+	if f.closed() {
+		return nil, errFileClosed
+	}
+	type result struct {
+		vault *Vault
+		err   error
+	}
+	cfg := newOpenConfig(opts)
+	done := make(chan result, 1)
+	go func() {
+		vault, err := f.open(passphrase, cfg)
+		done <- result{vault, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		if ctx.Err() != nil {
+			r.vault.Close()
+			return nil, ctx.Err()
 		}
+		return f.claim(r.vault, cfg)
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.vault != nil {
+				r.vault.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// open decrypts the file contents into a Vault that does not yet hold the
+// file's lock.
+func (f *File) open(passphrase string, cfg openConfig) (*Vault, error) {
+	if f.format == formatLegacy {
+		return openVaultCompat(f.bs, passphrase)
+	}
+	var vault *Vault
+	var err error
+	if f.split != nil {
+		vault, err = openSplit(f.bs, f.format, f.split, passphrase, cfg)
+	} else {
+		vault, err = openVault(f.bs, f.format, passphrase, cfg)
 	}
+	if d, ok := err.(duressError); ok {
+		return f.openDuress(d, passphrase)
+	}
+	return vault, err
+}
+
+// claim transfers the file's lock to `vault`, replays the file's journal and
+// then applies the write protection set in `cfg`.
+func (f *File) claim(vault *Vault, cfg openConfig) (*Vault, error) {
+	f.mu.Lock()
+	lock := f.lock
+	f.lock = nil
+	f.mu.Unlock()
+	if lock == nil {
+		vault.Close()
+		return nil, errFileClosed
+	}
+
 	vault.lock = lock
+	// a decoy must leave the real vault's journal alone
+	if vault.decoy {
+		return vault, nil
+	}
+	if err := vault.startJournal(f.path, sha256.Sum256(f.bs)); err != nil {
+		vault.Close()
+		return nil, err
+	}
+	vault.applyWriteProtection(cfg)
+	return vault, nil
+}
+
+// closed returns true if the file has been decrypted or closed.
+func (f *File) closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lock == nil
+}
+
+// Close releases the lock held by the file, unless it has been transferred
+// to a Vault by Decrypt.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lock == nil {
+		return nil
+	}
+	err := f.lock.Unlock()
+	f.lock = nil
+	return err
+}
 
+// Open reads a vault from the location provided to `filename` and decrypts
+// it using `passphrase`. The format of the file is detected from its header
+// before any key is derived. The salt is rotated according to the
+// RotationPolicy set in `opts`, RotateOnOpen by default.
+func Open(filename string, passphrase string, opts ...OpenOption) (*Vault, error) {
+	f, err := ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := f.Decrypt(passphrase, opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
 	return vault, nil
 }
 
 // Close releases the lock acquired by calling Open() on a vault.
 func (v *Vault) Close() error {
+	v.mu.Lock()
 	for i := range v.secret {
 		v.secret[i] = 0x00
 	}
+	for i := range v.fileKey {
+		v.fileKey[i] = 0x00
+	}
+	for i := range v.pendingSecret {
+		v.pendingSecret[i] = 0x00
+	}
+	for i := range v.lockJournalKey {
+		v.lockJournalKey[i] = 0x00
+	}
+	v.rotatePending = false
+	v.mu.Unlock()
+	v.clearUndo()
+	v.clearSnapshots()
+	if v.journal != nil {
+		v.journal.close()
+		v.journal = nil
+	}
 	if v.lock != nil {
 		return v.lock.Unlock()
 	}
@@ -271,7 +793,13 @@ func (v *Vault) Close() error {
 // Generate generates a new strong mnemonic passphrase and Add()s it to the
 // vault.
 func (v *Vault) Generate(location string, username string) error {
-	phrase, err := pwgen.GeneratePassphrase(pwgen.CharsetAlphaNum, genPasswordLen)
+	return v.GenerateFrom(location, username, pwgen.CharsetAlphaNum)
+}
+
+// GenerateFrom is like Generate, but generates the password from the
+// characters in `charset`.
+func (v *Vault) GenerateFrom(location string, username string, charset []byte) error {
+	phrase, err := pwgen.GeneratePassphrase(charset, genPasswordLen)
 	if err != nil {
 		return err
 	}
@@ -285,6 +813,22 @@ func (v *Vault) Generate(location string, username string) error {
 // decrypt decrypts the vault and returns the credential data as a map of
 // strings (locations) to Credentials.
 func (v *Vault) decrypt() (map[string]*Credential, error) {
+	data, err := v.decryptData()
+	if err != nil {
+		return nil, err
+	}
+	return data.Credentials, nil
+}
+
+// decryptData decrypts the vault and returns its entire payload.
+func (v *Vault) decryptData() (*vaultData, error) {
+	defer v.time(TimeDecrypt, time.Now())
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.locked {
+		return nil, ErrVaultLocked
+	}
+
 	aead, err := chacha20poly1305.NewX(v.secret[:])
 	if err != nil {
 		return nil, err
@@ -294,50 +838,97 @@ func (v *Vault) decrypt() (map[string]*Credential, error) {
 		return nil, ErrCouldNotDecrypt
 	}
 
-	credentials := make(map[string]*Credential)
-	err = gob.NewDecoder(bytes.NewBuffer(decryptedData)).Decode(&credentials)
+	data := &vaultData{
+		Credentials: make(map[string]*Credential),
+	}
+	if v.dataFormat < formatV2 {
+		err = gob.NewDecoder(bytes.NewBuffer(decryptedData)).Decode(&data.Credentials)
+	} else {
+		err = gob.NewDecoder(bytes.NewBuffer(decryptedData)).Decode(data)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if data.Credentials == nil {
+		data.Credentials = make(map[string]*Credential)
+	}
 
-	return credentials, nil
+	return data, nil
 }
 
-// encrypt encrypts the supplied credential map and updates the vault's
-// encrypted data.
-func (v *Vault) encrypt(creds map[string]*Credential) error {
+// encrypt encrypts the supplied credential map, along with the vault's
+// settings, and updates the vault's encrypted data. `entries` describe the
+// changes made to the credentials, and are recorded in the vault's sync
+// state. The OnChange func is called once the data has been updated.
+func (v *Vault) encrypt(creds map[string]*Credential, entries ...journalEntry) error {
+	if err := v.encryptLocked(creds, entries...); err != nil {
+		return err
+	}
+	v.mu.RLock()
+	onChange := v.onChange
+	v.mu.RUnlock()
+	if onChange != nil {
+		onChange()
+	}
+	return nil
+}
+
+// encryptLocked does the work of encrypt while holding the vault's lock.
+func (v *Vault) encryptLocked(creds map[string]*Credential, entries ...journalEntry) error {
+	defer v.time(TimeEncode, time.Now())
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return ErrVaultLocked
+	}
+	if !v.writableLocked() {
+		return ErrWriteProtected
+	}
+	v.rotatePendingLocked()
+	assignIDs(creds)
+	v.versions.update(creds, entries)
+
 	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(creds)
+	err := gob.NewEncoder(&buf).Encode(&vaultData{
+		Credentials: creds,
+		Settings:    v.settings,
+		Sync:        v.versions,
+	})
 	if err != nil {
 		return err
 	}
 	if _, err = io.ReadFull(rand.Reader, v.nonce[:]); err != nil {
 		panic(err)
 	}
+	payload := buf.Bytes()
+	if v.settings.PadData {
+		payload = padPayload(payload)
+	}
 	aead, err := chacha20poly1305.NewX(v.secret[:])
 	if err != nil {
 		return err
 	}
-	v.data = aead.Seal(nil, v.nonce[:], buf.Bytes(), nil)
+	v.data = aead.Seal(nil, v.nonce[:], payload, nil)
+	v.dataFormat = currentFormat
 
-	return nil
+	return v.sealIndexLocked(creds)
 }
 
 // Add adds the credential provided to `credential` at the location provided
-// by `location` to the vault.
+// by `location` to the vault. The location must be valid according to the
+// rules described by the vault's Settings, and is normalized before use. Meta
+// tags in the reserved namespace are dropped from the credential.
 func (v *Vault) Add(location string, credential Credential) error {
-	creds, err := v.decrypt()
-	if err != nil {
-		return err
-	}
-
-	if _, exists := creds[location]; exists {
-		return ErrCredentialExists
-	}
-
-	creds[location] = &credential
+	return v.Batch(func(tx *Tx) error {
+		return tx.Add(location, credential)
+	})
+}
 
-	return v.encrypt(creds)
+// add adds `credential` to the vault at `location` as-is.
+func (v *Vault) add(location string, credential Credential) error {
+	return v.Batch(func(tx *Tx) error {
+		return tx.add(location, credential)
+	})
 }
 
 // Get retrieves a Credential at the provided `location`.
@@ -346,6 +937,7 @@ func (v *Vault) Get(location string) (*Credential, error) {
 	if err != nil {
 		return nil, err
 	}
+	location = v.resolveLocation(creds, location)
 
 	cred, ok := creds[location]
 	if !ok {
@@ -355,23 +947,38 @@ func (v *Vault) Get(location string) (*Credential, error) {
 }
 
 // Save safely (atomically) persists the vault to disk at the filename
-// provided to `filename`.
+// provided to `filename`. A vault in the split layout is saved to the
+// directory `filename`. Saving a decoy vault only saves its credentials; see
+// Decoy.
 func (v *Vault) Save(filename string) error {
+	defer v.time(TimeSave, time.Now())
+	if v.decoyFile != nil {
+		return v.saveDecoy(filename)
+	}
+	if v.decoy {
+		v.clearUndo()
+		v.notifySaved(filename)
+		return nil
+	}
+	if v.Layout() == LayoutSplit {
+		header, key, err := v.saveSplit(DirStorage(filename))
+		if err != nil {
+			return err
+		}
+		return v.saved(filename, header, key)
+	}
+
 	tempfile, err := ioutil.TempFile(path.Dir(filename), "masterkey-temp")
 	if err != nil {
 		return err
 	}
 	defer tempfile.Close()
 
-	vf := vaultFile{
-		Nonce:       v.nonce,
-		Salt:        v.salt,
-		ArgonTime:   v.argonTime,
-		ArgonMemory: v.argonMemory,
-		ArgonLanes:  v.argonLanes,
-		Data:        v.data,
+	bs, key, err := v.encodeFile()
+	if err != nil {
+		return err
 	}
-	err = json.NewEncoder(tempfile).Encode(&vf)
+	_, err = tempfile.Write(bs)
 	if err != nil {
 		return err
 	}
@@ -389,52 +996,218 @@ func (v *Vault) Save(filename string) error {
 	if err != nil {
 		return err
 	}
+	return v.saved(filename, bs, key)
+}
 
+// encodeFile returns the contents of the vault's file in the file layout,
+// and its journal key.
+func (v *Vault) encodeFile() ([]byte, [32]byte, error) {
+	duress := v.duressBlob()
+	v.mu.RLock()
+	vf := vaultFile{
+		Nonce:       v.nonce,
+		Salt:        v.salt,
+		ArgonTime:   v.argonTime,
+		ArgonMemory: v.argonMemory,
+		ArgonLanes:  v.argonLanes,
+		Data:        v.data,
+		KeyCheck:    v.currentKeyCheck(),
+		Duress:      duress,
+	}
+	key := v.currentJournalKey()
+	v.mu.RUnlock()
+	var buf bytes.Buffer
+	if err := writeVaultFile(&buf, vf); err != nil {
+		return nil, key, err
+	}
+	return buf.Bytes(), key, nil
+}
+
+// Encode returns the vault as the contents of a vault file, as Save would
+// write it in the file layout, for storing somewhere other than the local
+// filesystem.
+func (v *Vault) Encode() ([]byte, error) {
+	bs, _, err := v.encodeFile()
+	return bs, err
+}
+
+// Decode decrypts the contents of a vault file `bs`, such as one returned by
+// Encode, using `passphrase`. The vault is not rotated, locked or journaled.
+func Decode(bs []byte, passphrase string) (*Vault, error) {
+	format, err := detectFormat(bs)
+	if err != nil {
+		return nil, err
+	}
+	if format == formatLegacy {
+		return openVaultCompat(bs, passphrase)
+	}
+	v, err := openVault(bs, format, passphrase, openConfig{rotation: RotateManually})
+	if _, ok := err.(duressError); ok {
+		return nil, ErrWrongPassphrase
+	}
+	return v, err
+}
+
+// saved resets the vault's journal, using `key`, if it was saved to the file
+// it was opened from, whose contents are now `bs`, and publishes an
+// EventSave.
+func (v *Vault) saved(filename string, bs []byte, key [32]byte) error {
+	if v.journal != nil {
+		if abs, err := filepath.Abs(filename); err == nil && abs == v.journal.vaultPath {
+			if err = v.journal.reset(key, sha256.Sum256(bs)); err != nil {
+				return err
+			}
+		}
+	}
+	v.clearUndo()
+	v.notifySaved(filename)
 	return nil
 }
 
+// notifySaved calls the OnSave func, then publishes an EventSave, for a save
+// to `filename`.
+func (v *Vault) notifySaved(filename string) {
+	v.mu.RLock()
+	onSave := v.onSave
+	v.mu.RUnlock()
+	if onSave != nil {
+		onSave(filename)
+	}
+	v.publish(Event{Type: EventSave, Path: filename})
+}
+
 // Edit replaces the credential at location with the provided `credential`. The
-// metadata from the old credential is preserved.
+// notes, URL, email, icon, metadata, folder, and tags from the old credential
+// are preserved.
 func (v *Vault) Edit(location string, credential Credential) error {
+	return v.Batch(func(tx *Tx) error {
+		return tx.Edit(location, credential)
+	})
+}
+
+// SetNotes replaces the notes of the credential at `location` with `notes`.
+func (v *Vault) SetNotes(location string, notes string) error {
 	creds, err := v.decrypt()
 	if err != nil {
 		return err
 	}
+	location = v.resolveLocation(creds, location)
 
-	oldcred, ok := creds[location]
-	if !ok {
+	cred, exists := creds[location]
+	if !exists {
 		return ErrNoSuchCredential
 	}
 
-	credential.Meta = oldcred.Meta
-	creds[location] = &credential
+	cred.Notes = notes
 
-	return v.encrypt(creds)
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
 }
 
-// Delete removes the credential at `location`.
+// Delete removes the credential at `location`, along with its aliases.
+// ErrIsAlias is returned if `location` is an alias.
 func (v *Vault) Delete(location string) error {
+	return v.Batch(func(tx *Tx) error {
+		return tx.Delete(location)
+	})
+}
+
+// Rename moves the credential at `oldLocation` to `newLocation` in a single
+// change, keeping its ID, meta tags, aliases and history. Like locations
+// given to Add, `newLocation` must be valid according to the vault's
+// Settings, and is normalized before use. If `newLocation` is an alias of
+// the credential, the alias is removed.
+func (v *Vault) Rename(oldLocation string, newLocation string) error {
+	if err := validateLocation(newLocation, v.Settings().MaxLocationLength); err != nil {
+		return err
+	}
 	creds, err := v.decrypt()
 	if err != nil {
 		return err
 	}
+	oldLocation = v.resolveLocation(creds, oldLocation)
+	newLocation = v.normalizeLocation(newLocation)
 
-	if _, exists := creds[location]; !exists {
+	cred, exists := creds[oldLocation]
+	if !exists {
 		return ErrNoSuchCredential
 	}
+	if newLocation == oldLocation {
+		return nil
+	}
+	if _, exists = creds[newLocation]; exists {
+		return ErrCredentialExists
+	}
+	if target, exists := aliasTarget(creds, newLocation); exists && target != oldLocation {
+		return ErrAliasExists
+	}
 
-	delete(creds, location)
+	var aliases []string
+	for _, alias := range cred.Aliases() {
+		if alias != newLocation {
+			aliases = append(aliases, alias)
+		}
+	}
+	cred.setAliases(aliases)
+	delete(creds, oldLocation)
+	creds[newLocation] = cred
 
-	return v.encrypt(creds)
+	err = v.record(creds, journalEntry{Location: oldLocation}, journalEntry{Location: newLocation, Credential: cred})
+	if err != nil {
+		return err
+	}
+	v.publish(Event{Type: EventDelete, Location: oldLocation})
+	v.publish(Event{Type: EventAdd, Location: newLocation})
+	return nil
+}
+
+// Copy adds a copy of the credential at `src` at `dst`, with its password,
+// notes, meta tags, folder and tags, for credentials that differ in little
+// but their location, such as staging and production accounts. The copy gets
+// a new ID, and does not share the aliases, usage or password history of the
+// original. `dst` must be valid according to the vault's Settings, and is
+// normalized before use.
+func (v *Vault) Copy(src string, dst string) error {
+	if err := validateLocation(dst, v.Settings().MaxLocationLength); err != nil {
+		return err
+	}
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	cred, exists := creds[v.resolveLocation(creds, src)]
+	if !exists {
+		return ErrNoSuchCredential
+	}
+
+	dup := *cred
+	dup.Meta = nil
+	for name, value := range cred.Meta {
+		if name == aliasesMeta || name == usesMeta || name == lastUsedMeta {
+			continue
+		}
+		if dup.Meta == nil {
+			dup.Meta = make(map[string]string)
+		}
+		dup.Meta[name] = value
+	}
+	dup.ID = ""
+	dup.History = nil
+	dup.CreatedAt, dup.ModifiedAt = time.Time{}, time.Time{}
+	return v.add(v.normalizeLocation(dst), dup)
 }
 
 // AddMeta adds a meta tag to the credential in the vault at `location`. `name`
 // is used for the name of the meta tag and `value` is used as its value.
 func (v *Vault) AddMeta(location string, name string, value string) error {
+	if IsReservedMeta(name) {
+		return ErrReservedMeta
+	}
+
 	creds, err := v.decrypt()
 	if err != nil {
 		return err
 	}
+	location = v.resolveLocation(creds, location)
 
 	cred, exists := creds[location]
 	if !exists {
@@ -451,16 +1224,21 @@ func (v *Vault) AddMeta(location string, name string, value string) error {
 	cred.Meta[name] = value
 	creds[location] = cred
 
-	return v.encrypt(creds)
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
 }
 
 // EditMeta changes a meta tag at a given location and meta tag name to
 // `newvalue`.
 func (v *Vault) EditMeta(location string, name string, newvalue string) error {
+	if IsReservedMeta(name) {
+		return ErrReservedMeta
+	}
+
 	creds, err := v.decrypt()
 	if err != nil {
 		return err
 	}
+	location = v.resolveLocation(creds, location)
 
 	cred, exists := creds[location]
 	if !exists {
@@ -474,15 +1252,20 @@ func (v *Vault) EditMeta(location string, name string, newvalue string) error {
 	cred.Meta[name] = newvalue
 	creds[location] = cred
 
-	return v.encrypt(creds)
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
 }
 
 // DeleteMeta removes a meta tag from the credential at `location`.
 func (v *Vault) DeleteMeta(location string, metaname string) error {
+	if IsReservedMeta(metaname) {
+		return ErrReservedMeta
+	}
+
 	creds, err := v.decrypt()
 	if err != nil {
 		return err
 	}
+	location = v.resolveLocation(creds, location)
 
 	cred, exists := creds[location]
 	if !exists {
@@ -496,52 +1279,67 @@ func (v *Vault) DeleteMeta(location string, metaname string) error {
 	delete(cred.Meta, metaname)
 	creds[location] = cred
 
-	return v.encrypt(creds)
+	return v.commit(creds, journalEntry{Location: location, Credential: cred})
 }
 
 // Locations retrieves the locations in the vault and returns them as a
-// slice of strings.
-func (v *Vault) Locations() ([]string, error) {
-	var locations []string
-	creds, err := v.decrypt()
+// slice of strings. If `tags` are given, only the locations of credentials
+// tagged with every one of them are returned.
+func (v *Vault) Locations(tags ...string) ([]string, error) {
+	index, err := v.decryptIndex()
 	if err != nil {
-		return locations, err
+		return nil, err
 	}
+	return index.locations(tags), nil
+}
 
+// Each calls `fn` with each credential in the vault, in order of location,
+// decrypting the vault only once. Changes `fn` makes to a credential are not
+// stored in the vault. Each stops at the first error `fn` returns, and
+// returns it.
+func (v *Vault) Each(fn func(location string, cred *Credential) error) error {
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	locations := make([]string, 0, len(creds))
 	for location := range creds {
 		locations = append(locations, location)
 	}
-
 	sort.Strings(locations)
-
-	return locations, nil
+	for _, location := range locations {
+		if err = fn(location, creds[location]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Find searches the vault for locations containing the `searchtext` and
 // returns the matching credential name and credential if it is found.
-// Otherwise, an error `ErrNoSuchCredential` will be returned.
+// Otherwise, an error `ErrNoSuchCredential` will be returned. An exact match
+// is preferred, then an alias, then the first location containing
+// `searchtext`. Locations are matched using the vault's index, so the vault
+// is only decrypted once a match is found.
 func (v *Vault) Find(searchtext string) (string, *Credential, error) {
-	creds, err := v.decrypt()
+	index, err := v.decryptIndex()
 	if err != nil {
 		return "", nil, err
 	}
-
-	// first try direct string comparison, we want the most exact match if
-	// possible
-	for location, cred := range creds {
-		if location == searchtext {
-			return location, cred, nil
-		}
+	location, ok := index.find(searchtext)
+	if !ok {
+		return "", nil, ErrNoSuchCredential
 	}
 
-	// that failed, so let's match using strings.Contains
-	for location, cred := range creds {
-		if strings.Contains(location, searchtext) {
-			return location, cred, nil
-		}
+	creds, err := v.decrypt()
+	if err != nil {
+		return "", nil, err
 	}
-
-	return "", nil, ErrNoSuchCredential
+	cred, exists := creds[location]
+	if !exists {
+		return "", nil, ErrNoSuchCredential
+	}
+	return location, cred, nil
 }
 
 // FindMeta search the credential at location `location` for a meta value
@@ -552,19 +1350,21 @@ func (v *Vault) FindMeta(location string, searchtext string) (string, string, er
 	if err != nil {
 		return "", "", err
 	}
+	location = v.resolveLocation(creds, location)
 
 	cred, exists := creds[location]
 	if !exists {
 		return "", "", ErrNoSuchCredential
 	}
 
-	for metaname, metaval := range cred.Meta {
+	meta := cred.UserMeta()
+	for metaname, metaval := range meta {
 		if metaname == searchtext {
 			return metaname, metaval, nil
 		}
 	}
 
-	for metaname, metaval := range cred.Meta {
+	for metaname, metaval := range meta {
 		if strings.Contains(metaname, searchtext) {
 			return metaname, metaval, nil
 		}
@@ -576,7 +1376,33 @@ func (v *Vault) FindMeta(location string, searchtext string) (string, string, er
 // LoadCSV loads password data from a CSV file. The text provided by
 // locationField is used as the key for Location data, usernameField and
 // passwordField are used as the key for the Username and Password data.
+// Columns named url, email and notes, in any case, fill the credential's URL,
+// Email and Notes, and a column named group, as exported by KeePass, fills
+// its Folder. Other columns are added as meta tags.
 func (v *Vault) LoadCSV(c io.Reader, locationField, usernameField, passwordField string) (int, error) {
+	return v.LoadCSVContext(context.Background(), c, locationField, usernameField, passwordField)
+}
+
+// LoadCSVContext is like LoadCSV, but stops before the next row once `ctx`
+// is done, returning the number of credentials imported so far and
+// ctx.Err().
+func (v *Vault) LoadCSVContext(ctx context.Context, c io.Reader, locationField, usernameField, passwordField string) (int, error) {
+	nimported := 0
+	var loadErr error
+	err := v.Batch(func(tx *Tx) error {
+		nimported, loadErr = loadCSV(ctx, tx, c, locationField, usernameField, passwordField)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return nimported, loadErr
+}
+
+// loadCSV does the work of LoadCSVContext, adding the credentials using `tx`
+// so that they are committed together. Those added before an error are
+// kept.
+func loadCSV(ctx context.Context, tx *Tx, c io.Reader, locationField, usernameField, passwordField string) (int, error) {
 	r := csv.NewReader(c)
 
 	var header []string
@@ -587,6 +1413,9 @@ func (v *Vault) LoadCSV(c io.Reader, locationField, usernameField, passwordField
 	nimported := 0
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return nimported, err
+		}
 		record, err := r.Read()
 		if err == io.EOF {
 			break
@@ -612,25 +1441,49 @@ func (v *Vault) LoadCSV(c io.Reader, locationField, usernameField, passwordField
 
 		location := record[locationFieldIndex]
 		cred := Credential{Username: record[usernameFieldIndex], Password: record[passwordFieldIndex]}
-
-		err = v.Add(location, cred)
-		if err != nil {
-			fmt.Printf("error importing %v: %v. skipping.\n", location, err)
-			continue
+		fieldIndexes := make(map[int]bool)
+		for idx, field := range record {
+			if idx == locationFieldIndex || idx == usernameFieldIndex || idx == passwordFieldIndex {
+				continue
+			}
+			switch strings.ToLower(header[idx]) {
+			case "url":
+				cred.URL = field
+			case "email":
+				cred.Email = field
+			case "notes":
+				cred.Notes = field
+			case "group":
+				cred.Folder = CleanFolder(field)
+			default:
+				continue
+			}
+			fieldIndexes[idx] = true
 		}
 
 		for idx, field := range record {
-			if idx == locationFieldIndex || idx == usernameFieldIndex || idx == passwordFieldIndex {
+			if idx == locationFieldIndex || idx == usernameFieldIndex || idx == passwordFieldIndex || fieldIndexes[idx] {
 				continue
 			}
 
 			metaname := header[idx]
 			metaval := field
-
-			err = v.AddMeta(location, metaname, metaval)
-			if err != nil {
-				return nimported, err
+			if IsReservedMeta(metaname) {
+				continue
 			}
+			if _, exists := cred.Meta[metaname]; exists {
+				return nimported, ErrMetaExists
+			}
+			if cred.Meta == nil {
+				cred.Meta = make(map[string]string)
+			}
+			cred.Meta[metaname] = metaval
+		}
+
+		err = tx.Add(location, cred)
+		if err != nil {
+			fmt.Printf("error importing %v: %v. skipping.\n", location, err)
+			continue
 		}
 
 		nimported++
@@ -641,7 +1494,61 @@ func (v *Vault) LoadCSV(c io.Reader, locationField, usernameField, passwordField
 
 // ChangePassphrase re-encrypts the entire vault with a new master key derived
 // from the provided `newpassphrase`.
+// The change is not journaled: until the vault is saved, its journal remains
+// protected by the old passphrase. ErrDuressIsPassphrase is returned if
+// `newpassphrase` is the vault's duress passphrase.
 func (v *Vault) ChangePassphrase(newpassphrase string) error {
+	v.mu.RLock()
+	duress := v.duress
+	v.mu.RUnlock()
+	if openDuress(duress, newpassphrase) != DuressNone {
+		return ErrDuressIsPassphrase
+	}
+	return v.rekey(newpassphrase, v.KDFParams())
+}
+
+// KDFParams returns the argon2id parameters the vault's key is derived with.
+func (v *Vault) KDFParams() KDFParams {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return KDFParams{
+		Time:   v.argonTime,
+		Memory: v.argonMemory,
+		Lanes:  v.argonLanes,
+	}
+}
+
+// Rekey re-encrypts the entire vault with a fresh salt and nonce, and a new
+// master key derived from the vault's existing `passphrase` using `params`.
+// Zero fields of `params` keep their current value. ErrWrongPassphrase is
+// returned if `passphrase` is not the vault's master passphrase. Like
+// ChangePassphrase, the change is not journaled.
+func (v *Vault) Rekey(passphrase string, params KDFParams) error {
+	current := v.KDFParams()
+	if params.Time == 0 {
+		params.Time = current.Time
+	}
+	if params.Memory == 0 {
+		params.Memory = current.Memory
+	}
+	if params.Lanes == 0 {
+		params.Lanes = current.Lanes
+	}
+	if params.Memory < 8*uint32(params.Lanes) {
+		return ErrInvalidKDFParams
+	}
+	if !v.VerifyPassphrase(passphrase) {
+		return ErrWrongPassphrase
+	}
+	return v.rekey(passphrase, params)
+}
+
+// rekey re-encrypts the vault with a fresh salt and nonce, using a key
+// derived from `passphrase` using `params`.
+func (v *Vault) rekey(passphrase string, params KDFParams) error {
+	if err := v.checkWritable(); err != nil {
+		return err
+	}
 	creds, err := v.decrypt()
 	if err != nil {
 		return err
@@ -656,12 +1563,23 @@ func (v *Vault) ChangePassphrase(newpassphrase string) error {
 	}
 
 	var secret [32]byte
-	skb := argon2.IDKey([]byte(newpassphrase), salt[:], v.argonTime, v.argonMemory, v.argonLanes, keyLen)
+	start := time.Now()
+	skb := argon2.IDKey([]byte(passphrase), salt[:], params.Time, params.Memory, params.Lanes, keyLen)
+	v.time(TimeKDF, start)
 	subtle.ConstantTimeCopy(1, secret[:], skb)
 
+	v.mu.Lock()
 	v.nonce = nonce
 	v.secret = secret
 	v.salt = salt
+	v.argonTime = params.Time
+	v.argonMemory = params.Memory
+	v.argonLanes = params.Lanes
+	for i := range v.pendingSecret {
+		v.pendingSecret[i] = 0x00
+	}
+	v.rotatePending = false
+	v.mu.Unlock()
 
 	err = v.encrypt(creds)
 	if err != nil {
@@ -671,9 +1589,9 @@ func (v *Vault) ChangePassphrase(newpassphrase string) error {
 	return nil
 }
 
-// Merge adds every credential in otherVault to the vault. If a credential
-// already exists with the same location in the vault, an error will be
-// returned.
+// Merge adds every credential in otherVault to the vault, including any
+// reserved meta tags. If a credential already exists with the same location
+// in the vault, an error will be returned.
 func (v *Vault) Merge(otherVault *Vault) error {
 	otherLocations, err := otherVault.Locations()
 	if err != nil {
@@ -688,10 +1606,169 @@ func (v *Vault) Merge(otherVault *Vault) error {
 		if err != nil {
 			return err
 		}
-		err = v.Add(loc, *otherCred)
+		err = v.add(loc, *otherCred)
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// Settings returns the vault's settings.
+func (v *Vault) Settings() Settings {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.settings
+}
+
+// SetSettings replaces the vault's settings with `settings`.
+func (v *Vault) SetSettings(settings Settings) error {
+	if err := v.checkWritable(); err != nil {
+		return err
+	}
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.settings = settings
+	v.mu.Unlock()
+	return v.commit(creds, journalEntry{Settings: &settings})
+}
+
+// VerifyPassphrase returns true if `passphrase` is the vault's master
+// passphrase. It derives a key, so it is as slow as opening the vault.
+func (v *Vault) VerifyPassphrase(passphrase string) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	defer v.time(TimeKDF, time.Now())
+	skb := argon2.IDKey([]byte(passphrase), v.salt[:], v.argonTime, v.argonMemory, v.argonLanes, keyLen)
+	var secret [32]byte
+	subtle.ConstantTimeCopy(1, secret[:], skb)
+	return subtle.ConstantTimeCompare(keyCheck(secret), v.currentKeyCheck()) == 1
+}
+
+// OnChange registers a function to be called after each change to the
+// vault's data, such as an Add, Edit, or Delete. It can be used to save the
+// vault automatically.
+func (v *Vault) OnChange(f func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.onChange = f
+}
+
+// OnSave registers a function to be called with the filename after each
+// save of the vault. Unlike an EventSave, which is dropped if the subscriber
+// is not ready for it, the function is called for every save, before Save
+// returns, so it should not block for long.
+func (v *Vault) OnSave(f func(filename string)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.onSave = f
+}
+
+// commit encrypts `creds`, like encrypt, records `entries` in the vault's
+// journal, if it has one, and publishes an event for each of them. Entries
+// must describe edits, deletions or settings changes; add publishes its own
+// event.
+func (v *Vault) commit(creds map[string]*Credential, entries ...journalEntry) error {
+	if err := v.record(creds, entries...); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		v.publish(entry.event())
+	}
+	return nil
+}
+
+// record writes `creds` and `entries` as write does, and remembers the
+// change so that Undo can revert it.
+func (v *Vault) record(creds map[string]*Credential, entries ...journalEntry) error {
+	old, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	step := newUndoStep(old, entries)
+	if err := v.write(creds, entries...); err != nil {
+		return err
+	}
+	v.pushUndo(step)
+	return nil
+}
+
+// write encrypts `creds` and records `entries` in the vault's journal.
+// Entries are stamped with the current time unless their Modified time is
+// already set, and so are the CreatedAt and ModifiedAt of their credentials.
+func (v *Vault) write(creds map[string]*Credential, entries ...journalEntry) error {
+	now := time.Now()
+	for i := range entries {
+		if entries[i].Modified.IsZero() {
+			entries[i].Modified = now
+		}
+		if cred := entries[i].Credential; cred != nil {
+			if cred.CreatedAt.IsZero() {
+				cred.CreatedAt = entries[i].Modified.UTC()
+			}
+			if !entries[i].keepModified || cred.ModifiedAt.IsZero() {
+				cred.ModifiedAt = entries[i].Modified.UTC()
+			}
+		}
+	}
+	if err := v.encrypt(creds, entries...); err != nil {
+		return err
+	}
+	if v.journal == nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if err := v.journal.append(entry, v.settings.PadData); err != nil {
+			return fmt.Errorf("change was made but could not be journaled: %v", err)
+		}
+	}
+	return nil
+}
+
+// startJournal opens the journal for the vault file at `vaultPath`, whose
+// contents hash to `base`, and replays any changes it holds. Journaling is
+// best effort: if the journal can not be opened, for example because the
+// vault's directory is read-only, the vault is used without one.
+func (v *Vault) startJournal(vaultPath string, base [sha256.Size]byte) error {
+	j, entries, err := openJournal(vaultPath, v.fileKey, base)
+	if err != nil {
+		return nil
+	}
+	v.journal = j
+	if len(entries) == 0 {
+		return nil
+	}
+
+	creds, err := v.decrypt()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Settings != nil:
+			v.mu.Lock()
+			v.settings = *entry.Settings
+			v.mu.Unlock()
+		case entry.Credential == nil:
+			delete(creds, entry.Location)
+		default:
+			creds[entry.Location] = entry.Credential
+		}
+		v.mu.Lock()
+		v.versions.update(creds, []journalEntry{entry})
+		v.mu.Unlock()
+	}
+	v.recovered = len(entries)
+	return v.encrypt(creds)
+}
+
+// Recovered returns the number of unsaved changes that were replayed from
+// the vault's journal when it was opened. They are written to the vault file
+// by the next Save.
+func (v *Vault) Recovered() int {
+	return v.recovered
+}
@@ -0,0 +1,448 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// plainScalar matches the strings MarshalEntriesYAML writes without quotes:
+// those that YAML can not mistake for a number, boolean, null or any of its
+// syntax.
+var plainScalar = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./@+-]*( [A-Za-z0-9_./@+-]+)*$`)
+
+// yamlKeywords are plain scalars YAML reads as something other than a
+// string.
+var yamlKeywords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"null": true, "y": true, "n": true,
+}
+
+// MarshalEntriesYAML returns `entries` as a YAML document for editing by
+// hand, a list with one item per entry, such as:
+//
+//	---
+//	- location: example.com
+//	  id: 0d9c5d8e-...
+//	  username: alice
+//	  url: "https://example.com/login"
+//	  email: ""
+//	  folder: work/aws
+//	  tags: [work]
+//	  meta:
+//	    pin: "1234"
+//	  notes: |-
+//	    recovery codes:
+//	    ...
+//
+// Every field but the icon is written, even if empty, so that it can be
+// filled in. The password is only written if it is set.
+func MarshalEntriesYAML(entries []Entry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	if len(entries) == 0 {
+		buf.WriteString("[]\n")
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "- location: %v\n", yamlScalar(entry.Location))
+		fmt.Fprintf(&buf, "  id: %v\n", yamlScalar(entry.ID))
+		fmt.Fprintf(&buf, "  username: %v\n", yamlScalar(entry.Username))
+		if entry.Password != "" {
+			fmt.Fprintf(&buf, "  password: %v\n", yamlScalar(entry.Password))
+		}
+		fmt.Fprintf(&buf, "  url: %v\n", yamlScalar(entry.URL))
+		fmt.Fprintf(&buf, "  email: %v\n", yamlScalar(entry.Email))
+		fmt.Fprintf(&buf, "  folder: %v\n", yamlScalar(entry.Folder))
+		tags := make([]string, len(entry.Tags))
+		for i, tag := range entry.Tags {
+			tags[i] = yamlScalar(tag)
+		}
+		fmt.Fprintf(&buf, "  tags: [%v]\n", strings.Join(tags, ", "))
+		if len(entry.Meta) == 0 {
+			buf.WriteString("  meta: {}\n")
+		} else {
+			buf.WriteString("  meta:\n")
+			var names []string
+			for name := range entry.Meta {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(&buf, "    %v: %v\n", yamlScalar(name), yamlScalar(entry.Meta[name]))
+			}
+		}
+		if yamlBlock(entry.Notes) {
+			buf.WriteString("  notes: |-\n")
+			for _, line := range strings.Split(entry.Notes, "\n") {
+				if line == "" {
+					buf.WriteString("\n")
+				} else {
+					fmt.Fprintf(&buf, "    %v\n", line)
+				}
+			}
+		} else {
+			fmt.Fprintf(&buf, "  notes: %v\n", yamlScalar(entry.Notes))
+		}
+	}
+	return buf.Bytes()
+}
+
+// yamlScalar returns `s` as a plain scalar if YAML reads it back unchanged,
+// and as a double-quoted scalar otherwise.
+func yamlScalar(s string) string {
+	if plainScalar.MatchString(s) && !yamlKeywords[strings.ToLower(s)] {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// yamlBlock returns true if `s` is written as a literal block: if it has
+// more than one line, and none of the characters or whitespace a literal
+// block can not hold as-is.
+func yamlBlock(s string) bool {
+	if !strings.Contains(s, "\n") || strings.HasSuffix(s, "\n") || strings.HasPrefix(s, " ") {
+		return false
+	}
+	for _, r := range s {
+		if r != '\n' && !strconv.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalEntriesYAML parses a YAML document written by MarshalEntriesYAML,
+// and edited by hand, into its entries. Only the subset of YAML that
+// MarshalEntriesYAML writes is understood, along with single-quoted
+// scalars, comments and block lists of tags. As with UnmarshalEntry, unknown
+// fields are rejected, and every entry must have a location.
+func UnmarshalEntriesYAML(bs []byte) ([]Entry, error) {
+	p := &yamlParser{}
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	scanner.Buffer(nil, len(bs)+1)
+	for scanner.Scan() {
+		p.lines = append(p.lines, strings.TrimRight(scanner.Text(), " \t\r"))
+	}
+	entries, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("line %v: %v", p.n, err)
+	}
+	return entries, nil
+}
+
+// yamlParser parses the lines of a YAML document of entries. n is the
+// number of the line being parsed, counting from 1.
+type yamlParser struct {
+	lines []string
+	n     int
+}
+
+// next returns the next line that is not blank or a comment, and its
+// indentation, or false at the end of the document.
+func (p *yamlParser) next() (string, int, bool) {
+	for p.n < len(p.lines) {
+		line := p.lines[p.n]
+		p.n++
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || (p.n == 1 && trimmed == "---") {
+			continue
+		}
+		return trimmed, len(line) - len(trimmed), true
+	}
+	return "", 0, false
+}
+
+// peekIndent returns the indentation of the next line that is not blank or
+// a comment, or -1 at the end of the document.
+func (p *yamlParser) peekIndent() int {
+	n := p.n
+	_, indent, ok := p.next()
+	p.n = n
+	if !ok {
+		return -1
+	}
+	return indent
+}
+
+func (p *yamlParser) parse() ([]Entry, error) {
+	var entries []Entry
+	line, indent, ok := p.next()
+	if ok && indent == 0 && line == "[]" {
+		if _, _, ok = p.next(); ok {
+			return nil, fmt.Errorf("unexpected content after []")
+		}
+		return nil, nil
+	}
+	for ok {
+		if indent != 0 || !strings.HasPrefix(line, "- ") {
+			return nil, fmt.Errorf("expected an entry starting with -")
+		}
+		entry, err := p.parseEntry(line[2:], 2)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Location == "" {
+			return nil, ErrEntryLocation
+		}
+		entries = append(entries, entry)
+		line, indent, ok = p.next()
+	}
+	return entries, nil
+}
+
+// parseEntry parses the fields of an entry, the first of which is `line`.
+// The fields are indented by `indent`.
+func (p *yamlParser) parseEntry(line string, indent int) (Entry, error) {
+	var entry Entry
+	seen := make(map[string]bool)
+	for {
+		key, value, err := splitYAMLKey(line)
+		if err != nil {
+			return entry, err
+		}
+		if seen[key] {
+			return entry, fmt.Errorf("%v is given twice", key)
+		}
+		seen[key] = true
+
+		var s string
+		switch key {
+		case "tags":
+			entry.Tags, err = p.parseList(value, indent)
+		case "meta":
+			entry.Meta, err = p.parseMap(value, indent)
+		case "notes":
+			if value == "|" || value == "|-" {
+				entry.Notes = p.parseBlock(indent, value == "|")
+				break
+			}
+			s, err = parseYAMLScalar(value)
+			entry.Notes = s
+		default:
+			s, err = parseYAMLScalar(value)
+			switch key {
+			case "location":
+				entry.Location = s
+			case "id":
+				entry.ID = s
+			case "username":
+				entry.Username = s
+			case "password":
+				entry.Password = s
+			case "url":
+				entry.URL = s
+			case "email":
+				entry.Email = s
+			case "folder":
+				entry.Folder = s
+			default:
+				return entry, fmt.Errorf("unknown field %v", key)
+			}
+		}
+		if err != nil {
+			return entry, err
+		}
+
+		if p.peekIndent() != indent {
+			return entry, nil
+		}
+		line, _, _ = p.next()
+	}
+}
+
+// parseList parses a list of strings, given as a flow list in `value`, or
+// as a block list on the lines following, indented further than `indent`.
+func (p *yamlParser) parseList(value string, indent int) ([]string, error) {
+	if value != "" {
+		if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("expected a list such as [a, b]")
+		}
+		var list []string
+		for _, item := range splitYAMLFlow(value[1 : len(value)-1]) {
+			s, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	var list []string
+	for p.peekIndent() > indent {
+		line, _, _ := p.next()
+		if !strings.HasPrefix(line, "- ") && line != "-" {
+			return nil, fmt.Errorf("expected a list item starting with -")
+		}
+		s, err := parseYAMLScalar(strings.TrimPrefix(strings.TrimPrefix(line, "-"), " "))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// parseMap parses a map of strings, given as {} in `value`, or on the lines
+// following, indented further than `indent`.
+func (p *yamlParser) parseMap(value string, indent int) (map[string]string, error) {
+	if value == "{}" {
+		return nil, nil
+	}
+	if value != "" {
+		return nil, fmt.Errorf("expected {} or names and values on the following lines")
+	}
+	m := make(map[string]string)
+	for p.peekIndent() > indent {
+		line, _, _ := p.next()
+		key, value, err := splitYAMLKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := m[key]; exists {
+			return nil, fmt.Errorf("%v is given twice", key)
+		}
+		if m[key], err = parseYAMLScalar(value); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// parseBlock parses a literal block made of the lines following, indented
+// further than `indent`, and of blank lines. The final line break is kept
+// if `keep` is set.
+func (p *yamlParser) parseBlock(indent int, keep bool) string {
+	var lines []string
+	blockIndent := -1
+	for p.n < len(p.lines) {
+		line := p.lines[p.n]
+		trimmed := strings.TrimLeft(line, " ")
+		lineIndent := len(line) - len(trimmed)
+		if trimmed != "" {
+			if lineIndent <= indent || (blockIndent >= 0 && lineIndent < blockIndent) {
+				break
+			}
+			if blockIndent < 0 {
+				blockIndent = lineIndent
+			}
+			line = line[blockIndent:]
+		} else {
+			line = ""
+		}
+		lines = append(lines, line)
+		p.n++
+	}
+	// trailing blank lines are not part of the block
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	text := strings.Join(lines, "\n")
+	if keep && text != "" {
+		text += "\n"
+	}
+	return text
+}
+
+// splitYAMLKey splits `line` into a key and its value.
+func splitYAMLKey(line string) (string, string, error) {
+	var key string
+	rest := line
+	if strings.HasPrefix(line, `"`) || strings.HasPrefix(line, "'") {
+		end := quotedEnd(line)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted name")
+		}
+		var err error
+		if key, err = parseYAMLScalar(line[:end]); err != nil {
+			return "", "", err
+		}
+		rest = line[end:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("expected a : after %v", line[:end])
+		}
+		rest = rest[1:]
+	} else {
+		i := strings.Index(line, ":")
+		if i <= 0 || (i+1 < len(line) && line[i+1] != ' ') {
+			return "", "", fmt.Errorf("expected name: value")
+		}
+		key, rest = line[:i], line[i+1:]
+	}
+	return key, strings.TrimSpace(rest), nil
+}
+
+// quotedEnd returns the index just past the quoted scalar at the start of
+// `s`, or -1 if it is not terminated.
+func quotedEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// splitYAMLFlow splits the items of a flow list, `s`, at the commas outside
+// quotes.
+func splitYAMLFlow(s string) []string {
+	var items []string
+	for s = strings.TrimSpace(s); s != ""; {
+		end := strings.Index(s, ",")
+		if s[0] == '"' || s[0] == '\'' {
+			if q := quotedEnd(s); q >= 0 {
+				end = strings.Index(s[q:], ",")
+				if end >= 0 {
+					end += q
+				}
+			}
+		}
+		if end < 0 {
+			items = append(items, s)
+			break
+		}
+		items = append(items, strings.TrimSpace(s[:end]))
+		s = strings.TrimSpace(s[end+1:])
+	}
+	return items
+}
+
+// parseYAMLScalar parses a plain, single-quoted or double-quoted scalar. A
+// plain ~ or null is read as an empty string.
+func parseYAMLScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		if quotedEnd(s) != len(s) {
+			return "", fmt.Errorf("unexpected content after %v", s)
+		}
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %v", s)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(s, "'"):
+		if quotedEnd(s) != len(s) {
+			return "", fmt.Errorf("unexpected content after %v", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "~" || s == "null" {
+		return "", nil
+	}
+	if s != "" && strings.ContainsAny(s[:1], "[]{}&*!|>%@`") {
+		return "", fmt.Errorf("%v must be quoted", s)
+	}
+	return s, nil
+}